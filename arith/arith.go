@@ -0,0 +1,180 @@
+// Package arith evaluates bash arithmetic expressions, as used by the '$(( ))'
+// expansion and the '(( ))' command, with the same 64-bit integer semantics and
+// errors as bash.
+package arith
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Variables provides access to the variables referenced by an expression.
+//
+// The name of an array element includes its subscript, such as 'a[1]' or
+// 'm[key]'; the subscript of an Indexed array is evaluated before Get or Set is
+// called, and so is always an integer, which may be negative.
+type Variables interface {
+	Get(name string) (string, bool)
+	Set(name, value string) error
+}
+
+// Associative is an optional interface for Variables that determines whether
+// a variable is an Associative array, whose subscripts are used as keys instead
+// of being evaluated as expressions.
+type Associative interface {
+	IsAssociative(name string) bool
+}
+
+// Map is a simple Variables implementation that stores values in a map.
+type Map map[string]string
+
+// Get implements the Variables interface.
+func (m Map) Get(name string) (string, bool) {
+	v, ok := m[name]
+
+	return v, ok
+}
+
+// Set implements the Variables interface.
+func (m Map) Set(name, value string) error {
+	m[name] = value
+
+	return nil
+}
+
+// Evaluator evaluates arithmetic expressions using the given Variables.
+//
+// The value of each variable referenced by an expression is itself evaluated
+// as an expression, with unset and empty variables having the value zero,
+// unless NoUnset is set, in which case referencing an unset variable is an
+// error, as with 'set -u'. When Vars is nil, all variables are unset and
+// assignments are discarded.
+//
+// Expand is used to expand the words of an ArithmeticExpansion before they are
+// evaluated. When it is nil, only literal words and simple parameters, such as
+// '$name', can be expanded.
+type Evaluator struct {
+	Vars    Variables
+	NoUnset bool
+	Expand  func(*bash.Word) (string, error)
+}
+
+// Eval evaluates an arithmetic expression, returning its value.
+func (e *Evaluator) Eval(expr string) (int64, error) {
+	ev := evaluator{Evaluator: e, vars: e.Vars}
+
+	if ev.vars == nil {
+		ev.vars = Map{}
+	}
+
+	return ev.subexpr(nil, expr)
+}
+
+// Expansion expands and evaluates an ArithmeticExpansion, returning its value
+// and the exit status that the '(( ))' command would have; zero when the
+// value is non-zero, and one otherwise, including when an error occurs.
+func (e *Evaluator) Expansion(a *bash.ArithmeticExpansion) (int64, int, error) {
+	expr, err := astutil.ArithmeticText(a, e.word)
+	if err != nil {
+		return 0, 1, err
+	}
+
+	v, err := e.Eval(expr)
+	if err != nil {
+		return 0, 1, err
+	}
+
+	return v, Status(v), nil
+}
+
+// Status returns the exit status of a '(( ))' command that evaluated to the
+// given value.
+func Status(v int64) int {
+	if v == 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func (e *Evaluator) word(w *bash.Word) (string, error) {
+	if e.Expand != nil {
+		return e.Expand(w)
+	}
+
+	if s, ok := astutil.Literal(w); ok {
+		return s, nil
+	}
+
+	var sb strings.Builder
+
+	for _, p := range w.Parts {
+		switch {
+		case p.Part == nil:
+			return "", fmt.Errorf("%s: %w", w, ErrUnexpanded)
+		case p.Part.Type == bash.TokenIdentifier:
+			name, rest := astutil.SplitParameter(p.Part.Data)
+
+			if e.Vars != nil {
+				v, _ := e.Vars.Get(name)
+				sb.WriteString(v)
+			}
+
+			sb.WriteString(rest)
+		default:
+			sb.WriteString(astutil.Unquote(p.Part.Data, p.Part.Type))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// Error is an error in the evaluation of an expression, in the form reported
+// by bash, where Token is the remainder of the expression from the point at
+// which the error occurred.
+type Error struct {
+	Err   error
+	Expr  string
+	Token string
+}
+
+// Error implements the error interface.
+func (e Error) Error() string {
+	return e.Expr + ": " + e.Err.Error() + " (error token is \"" + e.Token + "\")"
+}
+
+// Unwrap returns the underlying error.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors.
+var (
+	ErrDivisionByZero     = errors.New("division by 0")
+	ErrExponentNegative   = errors.New("exponent less than 0")
+	ErrInvalidBase        = errors.New("invalid arithmetic base")
+	ErrInvalidNumber      = errors.New("invalid number")
+	ErrInvalidConstant    = errors.New("invalid integer constant")
+	ErrValueTooGreat      = errors.New("value too great for base")
+	ErrOperandExpected    = errors.New("syntax error: operand expected")
+	ErrInvalidOperator    = errors.New("syntax error: invalid arithmetic operator")
+	ErrSyntax             = errors.New("syntax error in expression")
+	ErrMissingParen       = errors.New("missing `)'")
+	ErrColonExpected      = errors.New("`:' expected for conditional expression")
+	ErrExpressionExpected = errors.New("expression expected")
+	ErrNonVariable        = errors.New("attempted assignment to non-variable")
+	ErrIdentifierExpected = errors.New("identifier expected after pre-increment or pre-decrement")
+	ErrLvalue             = errors.New("assignment requires lvalue")
+	ErrBadSubscript       = errors.New("bad array subscript")
+	ErrRecursion          = errors.New("expression recursion level exceeded")
+	ErrUnexpanded         = errors.New("word cannot be expanded")
+)
+
+func itoa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
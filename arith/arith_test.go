@@ -0,0 +1,677 @@
+package arith
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+func testVars() Map {
+	return Map{
+		"x":    "5",
+		"y":    "3",
+		"s":    "x+y",
+		"r":    "s",
+		"z":    "",
+		"e":    "1+",
+		"w":    " 7 ",
+		"big":  "9223372036854775807",
+		"neg":  "-1",
+		"loop": "loop",
+		"a":    "1",
+		"a[0]": "1",
+		"a[1]": "2",
+		"a[2]": "3",
+	}
+}
+
+func TestEval(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Output int64
+	}{
+		{ // 1
+			Input:  "1 + 2 * 3",
+			Output: 7,
+		},
+		{ // 2
+			Input:  "(1 + 2) * 3",
+			Output: 9,
+		},
+		{ // 3
+			Input:  "7 / 2",
+			Output: 3,
+		},
+		{ // 4
+			Input:  "-7 / 2",
+			Output: -3,
+		},
+		{ // 5
+			Input:  "-7 % 3",
+			Output: -1,
+		},
+		{ // 6
+			Input:  "2 ** 10",
+			Output: 1024,
+		},
+		{ // 7
+			Input:  "2 ** 63",
+			Output: -9223372036854775808,
+		},
+		{ // 8
+			Input:  "2 ** 64",
+			Output: 0,
+		},
+		{ // 9
+			Input:  "3 ** 40",
+			Output: -6289078614652622815,
+		},
+		{ // 10
+			Input:  "-2 ** 2",
+			Output: 4,
+		},
+		{ // 11
+			Input:  "2 ** 0",
+			Output: 1,
+		},
+		{ // 12
+			Input:  "~-1",
+			Output: 0,
+		},
+		{ // 13
+			Input:  "!0",
+			Output: 1,
+		},
+		{ // 14
+			Input:  "!5",
+			Output: 0,
+		},
+		{ // 15
+			Input:  "- -1",
+			Output: 1,
+		},
+		{ // 16
+			Input:  "1 << 3",
+			Output: 8,
+		},
+		{ // 17
+			Input:  "1 << 64",
+			Output: 1,
+		},
+		{ // 18
+			Input:  "-16 >> 2",
+			Output: -4,
+		},
+		{ // 19
+			Input:  "6 & 3",
+			Output: 2,
+		},
+		{ // 20
+			Input:  "6 | 3",
+			Output: 7,
+		},
+		{ // 21
+			Input:  "6 ^ 3",
+			Output: 5,
+		},
+		{ // 22
+			Input:  "1 < 2",
+			Output: 1,
+		},
+		{ // 23
+			Input:  "2 <= 1",
+			Output: 0,
+		},
+		{ // 24
+			Input:  "3 >= 3",
+			Output: 1,
+		},
+		{ // 25
+			Input:  "4 > 5",
+			Output: 0,
+		},
+		{ // 26
+			Input:  "1 == 1",
+			Output: 1,
+		},
+		{ // 27
+			Input:  "1 != 1",
+			Output: 0,
+		},
+		{ // 28
+			Input:  "1 && 0",
+			Output: 0,
+		},
+		{ // 29
+			Input:  "0 || 2",
+			Output: 1,
+		},
+		{ // 30
+			Input:  "1 ? 2 : 3",
+			Output: 2,
+		},
+		{ // 31
+			Input:  "0 ? 2 : 1 ? 4 : 5",
+			Output: 4,
+		},
+		{ // 32
+			Input:  "1, 2, 3",
+			Output: 3,
+		},
+		{ // 33
+			Input:  "010",
+			Output: 8,
+		},
+		{ // 34
+			Input:  "0x1F",
+			Output: 31,
+		},
+		{ // 35
+			Input:  "0XfF",
+			Output: 255,
+		},
+		{ // 36
+			Input:  "2#1010",
+			Output: 10,
+		},
+		{ // 37
+			Input:  "16#ff",
+			Output: 255,
+		},
+		{ // 38
+			Input:  "36#Zz",
+			Output: 1295,
+		},
+		{ // 39
+			Input:  "64#@_",
+			Output: 4031,
+		},
+		{ // 40
+			Input:  "64#a",
+			Output: 10,
+		},
+		{ // 41
+			Input:  "64#A",
+			Output: 36,
+		},
+		{ // 42
+			Input:  "9223372036854775807 + 1",
+			Output: -9223372036854775808,
+		},
+		{ // 43
+			Input:  "-9223372036854775808 / -1",
+			Output: -9223372036854775808,
+		},
+		{ // 44
+			Input:  "-9223372036854775808 % -1",
+			Output: 0,
+		},
+		{ // 45
+			Input:  "x + y",
+			Output: 8,
+		},
+		{ // 46
+			Input:  "s",
+			Output: 8,
+		},
+		{ // 47
+			Input:  "r * 2",
+			Output: 16,
+		},
+		{ // 48
+			Input:  "z + 1",
+			Output: 1,
+		},
+		{ // 49
+			Input:  "w * 2",
+			Output: 14,
+		},
+		{ // 50
+			Input:  "big + 1",
+			Output: -9223372036854775808,
+		},
+		{ // 51
+			Input:  "neg << 63",
+			Output: -9223372036854775808,
+		},
+		{ // 52
+			Input:  "a[1] + a[2]",
+			Output: 5,
+		},
+		{ // 53
+			Input:  "0 && 1 / 0",
+			Output: 0,
+		},
+		{ // 54
+			Input:  "1 || 1 / 0",
+			Output: 1,
+		},
+		{ // 55
+			Input:  "0 ? 1 / 0 : 2",
+			Output: 2,
+		},
+		{ // 56
+			Input:  "u + 1",
+			Output: 1,
+		},
+	} {
+		e := Evaluator{Vars: testVars()}
+
+		if output, err := e.Eval(test.Input); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting output %d, got %d", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Err     error
+		Message string
+	}{
+		{ // 1
+			Input:   "1 / 0",
+			Err:     ErrDivisionByZero,
+			Message: "1 / 0: division by 0 (error token is \"0\")",
+		},
+		{ // 2
+			Input:   " 1 % 0 ",
+			Err:     ErrDivisionByZero,
+			Message: "1 % 0 : division by 0 (error token is \"0 \")",
+		},
+		{ // 3
+			Input:   "2 ** -1",
+			Err:     ErrExponentNegative,
+			Message: "2 ** -1: exponent less than 0 (error token is \"1\")",
+		},
+		{ // 4
+			Input:   "08",
+			Err:     ErrValueTooGreat,
+			Message: "08: value too great for base (error token is \"08\")",
+		},
+		{ // 5
+			Input:   "1a",
+			Err:     ErrValueTooGreat,
+			Message: "1a: value too great for base (error token is \"1a\")",
+		},
+		{ // 6
+			Input:   "65#1",
+			Err:     ErrInvalidBase,
+			Message: "65#1: invalid arithmetic base (error token is \"65#1\")",
+		},
+		{ // 7
+			Input:   "1#1",
+			Err:     ErrInvalidBase,
+			Message: "1#1: invalid arithmetic base (error token is \"1#1\")",
+		},
+		{ // 8
+			Input:   "2#2",
+			Err:     ErrValueTooGreat,
+			Message: "2#2: value too great for base (error token is \"2#2\")",
+		},
+		{ // 9
+			Input:   "1 +",
+			Err:     ErrOperandExpected,
+			Message: "1 +: syntax error: operand expected (error token is \"+\")",
+		},
+		{ // 10
+			Input:   "1 + * 2",
+			Err:     ErrOperandExpected,
+			Message: "1 + * 2: syntax error: operand expected (error token is \"* 2\")",
+		},
+		{ // 11
+			Input:   "1 2",
+			Err:     ErrSyntax,
+			Message: "1 2: syntax error in expression (error token is \"2\")",
+		},
+		{ // 12
+			Input:   "x y",
+			Err:     ErrSyntax,
+			Message: "x y: syntax error in expression (error token is \"y\")",
+		},
+		{ // 13
+			Input:   "$",
+			Err:     ErrOperandExpected,
+			Message: "$: syntax error: operand expected (error token is \"$\")",
+		},
+		{ // 14
+			Input:   "1, 2,",
+			Err:     ErrOperandExpected,
+			Message: "1, 2,: syntax error: operand expected (error token is \",\")",
+		},
+		{ // 15
+			Input: "(1 + 2",
+			Err:   ErrMissingParen,
+		},
+		{ // 16
+			Input: ")",
+			Err:   ErrOperandExpected,
+		},
+		{ // 17
+			Input:   "1 ? 2",
+			Err:     ErrColonExpected,
+			Message: "1 ? 2: `:' expected for conditional expression (error token is \"2\")",
+		},
+		{ // 18
+			Input:   "1 ? : 2",
+			Err:     ErrExpressionExpected,
+			Message: "1 ? : 2: expression expected (error token is \": 2\")",
+		},
+		{ // 19
+			Input:   "5 = 3",
+			Err:     ErrNonVariable,
+			Message: "5 = 3: attempted assignment to non-variable (error token is \"= 3\")",
+		},
+		{ // 20
+			Input:   "x++++",
+			Err:     ErrOperandExpected,
+			Message: "x++++: syntax error: operand expected (error token is \"+\")",
+		},
+		{ // 21
+			Input:   "1 + x = 3",
+			Err:     ErrNonVariable,
+			Message: "1 + x = 3: attempted assignment to non-variable (error token is \"= 3\")",
+		},
+		{ // 22
+			Input:   "0 ? 1 : x = 6",
+			Err:     ErrNonVariable,
+			Message: "0 ? 1 : x = 6: attempted assignment to non-variable (error token is \"= 6\")",
+		},
+		{ // 23
+			Input:   "a[1",
+			Err:     ErrBadSubscript,
+			Message: "a[1: bad array subscript (error token is \"a[1\")",
+		},
+		{ // 24
+			Input:   "a[]",
+			Err:     ErrBadSubscript,
+			Message: "a[]: bad array subscript",
+		},
+		{ // 25
+			Input:   "e * 3",
+			Err:     ErrOperandExpected,
+			Message: "1+: syntax error: operand expected (error token is \"+\")",
+		},
+		{ // 26
+			Input: "loop",
+			Err:   ErrRecursion,
+		},
+	} {
+		e := Evaluator{Vars: testVars()}
+
+		_, err := e.Eval(test.Input)
+		if err == nil {
+			t.Errorf("test %d: expecting error, got none", n+1)
+		} else if !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if test.Message != "" && err.Error() != test.Message {
+			t.Errorf("test %d: expecting message %q, got %q", n+1, test.Message, err.Error())
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Output int64
+		Vars   Map
+	}{
+		{ // 1
+			Input:  "x += 1, x",
+			Output: 6,
+			Vars:   Map{"x": "6"},
+		},
+		{ // 2
+			Input:  "q = 4, y = q ** 2, y",
+			Output: 16,
+			Vars:   Map{"q": "4", "y": "16"},
+		},
+		{ // 3
+			Input:  "x++ + ++x",
+			Output: 12,
+			Vars:   Map{"x": "7"},
+		},
+		{ // 4
+			Input:  "--x",
+			Output: 4,
+			Vars:   Map{"x": "4"},
+		},
+		{ // 5
+			Input:  "x--",
+			Output: 5,
+			Vars:   Map{"x": "4"},
+		},
+		{ // 6
+			Input:  "x <<= 2",
+			Output: 20,
+			Vars:   Map{"x": "20"},
+		},
+		{ // 7
+			Input:  "y |= 4",
+			Output: 7,
+			Vars:   Map{"y": "7"},
+		},
+		{ // 8
+			Input:  "a[i++] += 10",
+			Output: 11,
+			Vars:   Map{"a[0]": "11", "i": "1"},
+		},
+		{ // 9
+			Input:  "a[5] = 7",
+			Output: 7,
+			Vars:   Map{"a[5]": "7"},
+		},
+		{ // 10
+			Input:  "1 ? x = 7 : 6",
+			Output: 7,
+			Vars:   Map{"x": "7"},
+		},
+		{ // 11
+			Input:  "x = 0 ? 2 : 3",
+			Output: 3,
+			Vars:   Map{"x": "3"},
+		},
+		{ // 12
+			Input:  "0 && (x = 9)",
+			Output: 0,
+			Vars:   Map{},
+		},
+		{ // 13
+			Input:  "x = y = 2",
+			Output: 2,
+			Vars:   Map{"x": "2", "y": "2"},
+		},
+	} {
+		vars := Map{"x": "5", "y": "3", "i": "0", "a[0]": "1", "a[1]": "2", "a[2]": "3"}
+		want := maps.Clone(vars)
+
+		maps.Copy(want, test.Vars)
+
+		e := Evaluator{Vars: vars}
+
+		if output, err := e.Eval(test.Input); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting output %d, got %d", n+1, test.Output, output)
+		} else if !maps.Equal(vars, want) {
+			t.Errorf("test %d: expecting vars %v, got %v", n+1, want, vars)
+		}
+	}
+}
+
+func TestNoUnset(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Output  int64
+		Message string
+	}{
+		{ // 1
+			Input:   "u + 1",
+			Message: "u: unbound variable",
+		},
+		{ // 2
+			Input:  "a[3]",
+			Output: 0,
+		},
+		{ // 3
+			Input:  "0 && u",
+			Output: 0,
+		},
+		{ // 4
+			Input:  "1 ? 2 : u",
+			Output: 2,
+		},
+		{ // 5
+			Input:  "u = 3",
+			Output: 3,
+		},
+	} {
+		e := Evaluator{Vars: testVars(), NoUnset: true}
+
+		output, err := e.Eval(test.Input)
+		if test.Message != "" {
+			if !errors.Is(err, expand.ErrUnbound) {
+				t.Errorf("test %d: expecting unbound error, got %v", n+1, err)
+			} else if err.Error() != test.Message {
+				t.Errorf("test %d: expecting message %q, got %q", n+1, test.Message, err.Error())
+			}
+		} else if err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting output %d, got %d", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    string
+		Output   int64
+		Name     string
+		Variable expand.Variable
+	}{
+		{ // 1
+			Input:    "a[-1] *= 2",
+			Output:   6,
+			Name:     "a",
+			Variable: expand.Indexed("1", "2", "6"),
+		},
+		{ // 2
+			Input:    "a = 9",
+			Output:   9,
+			Name:     "a",
+			Variable: expand.Indexed("9", "2", "3"),
+		},
+		{ // 3
+			Input:    "m[k] * m[j]",
+			Output:   40,
+			Name:     "m",
+			Variable: expand.Associative(map[string]string{"k": "4", "j": "x*2"}),
+		},
+		{ // 4
+			Input:    "m[x+1] = 3",
+			Output:   3,
+			Name:     "m",
+			Variable: expand.Associative(map[string]string{"k": "4", "j": "x*2", "x+1": "3"}),
+		},
+		{ // 5
+			Input:    "s[2] = 1",
+			Output:   1,
+			Name:     "s",
+			Variable: expand.Variable{Attributes: attributes.Indexed, Array: map[int]string{0: "7", 2: "1"}},
+		},
+		{ // 6
+			Input:    "n[1]++",
+			Output:   0,
+			Name:     "n",
+			Variable: expand.Variable{Attributes: attributes.Indexed, Array: map[int]string{1: "1"}},
+		},
+	} {
+		env := expand.Map{
+			"x": expand.Scalar("5"),
+			"s": expand.Scalar("7"),
+			"a": expand.Indexed("1", "2", "3"),
+			"m": expand.Associative(map[string]string{"k": "4", "j": "x*2"}),
+		}
+		e := Evaluator{Vars: Env(env)}
+
+		if output, err := e.Eval(test.Input); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting output %d, got %d", n+1, test.Output, output)
+		} else if v, _ := env.Get(test.Name); !reflect.DeepEqual(v, test.Variable) {
+			t.Errorf("test %d: expecting variable %v, got %v", n+1, test.Variable, v)
+		}
+	}
+}
+
+func TestExpansion(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Output  int64
+		Status  int
+		Message string
+	}{
+		{ // 1
+			Input:  "(( x * $y ))",
+			Output: 15,
+			Status: 0,
+		},
+		{ // 2
+			Input:  "(( x - 5 ))",
+			Output: 0,
+			Status: 1,
+		},
+		{ // 3
+			Input:  "(( x <<= 1 ))",
+			Output: 10,
+			Status: 0,
+		},
+		{ // 4
+			Input:  `(( "x" + 1 ))`,
+			Output: 6,
+			Status: 0,
+		},
+		{ // 5
+			Input:   "(( y = 1/0 ))",
+			Status:  1,
+			Message: "y = 1/0 : division by 0 (error token is \"0 \")",
+		},
+		{ // 6
+			Input:   "((  $y /\t0  ))",
+			Status:  1,
+			Message: "3 /\t0  : division by 0 (error token is \"0  \")",
+		},
+	} {
+		tk := parser.NewStringTokeniser(test.Input)
+
+		f, err := bash.Parse(&tk)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error parsing script: %s", n+1, err)
+		}
+
+		e := Evaluator{Vars: testVars()}
+
+		if output, status, err := e.Expansion(f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Compound.ArithmeticCompound); test.Message != "" {
+			if err == nil || err.Error() != test.Message {
+				t.Errorf("test %d: expecting error %q, got %v", n+1, test.Message, err)
+			} else if status != test.Status {
+				t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+			}
+		} else if err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting output %d, got %d", n+1, test.Output, output)
+		} else if status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		}
+	}
+}
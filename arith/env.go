@@ -0,0 +1,69 @@
+package arith
+
+import (
+	"fmt"
+	"strings"
+
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+)
+
+// Env returns Variables that read and assign the variables of an
+// expand.Environment, allowing an Evaluator to be used as the Arithmetic
+// function of an expand.Expander.
+//
+// Assigning to an element of a scalar converts it into an Indexed array, and
+// assigning to a variable that is an array sets its first element, as in bash.
+func Env(env expand.Environment) Variables {
+	return environment{env}
+}
+
+type environment struct {
+	env expand.Environment
+}
+
+// Get implements the Variables interface.
+func (e environment) Get(name string) (string, bool) {
+	base, key, keyed := splitName(name)
+
+	v, ok := e.env.Get(base)
+	if !ok {
+		return "", false
+	} else if !keyed {
+		return v.String(), true
+	}
+
+	return v.Index(key)
+}
+
+// Set implements the Variables interface.
+func (e environment) Set(name, value string) error {
+	base, key, keyed := splitName(name)
+
+	v, ok := e.env.Get(base)
+	if !keyed {
+		return e.env.Set(base, v.Assign(value))
+	} else if !ok {
+		v = expand.Indexed()
+	}
+
+	v, err := v.AssignIndex(key, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return e.env.Set(base, v)
+}
+
+// IsAssociative implements the Associative interface.
+func (e environment) IsAssociative(name string) bool {
+	v, ok := e.env.Get(name)
+
+	return ok && v.Attributes.Has(attributes.Associative)
+}
+
+func splitName(name string) (string, string, bool) {
+	base, key, keyed := strings.Cut(name, "[")
+
+	return base, strings.TrimSuffix(key, "]"), keyed
+}
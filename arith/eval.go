@@ -0,0 +1,947 @@
+package arith
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash/expand"
+)
+
+// maxDepth is the maximum nesting of expressions, including those evaluated
+// from the values of variables, before evaluation fails.
+const maxDepth = 1024
+
+type token int
+
+// Single character operators are represented by the character itself.
+const (
+	tokEOF token = 0
+)
+
+const (
+	tokEqual token = 256 + iota
+	tokNotEqual
+	tokLessEqual
+	tokGreaterEqual
+	tokShiftLeft
+	tokShiftRight
+	tokLogicalAnd
+	tokLogicalOr
+	tokPower
+	tokPreIncrement
+	tokPreDecrement
+	tokPostIncrement
+	tokPostDecrement
+	tokAssignOp
+	tokConditional
+	tokNumber
+	tokVariable
+)
+
+// isOperator reports whether a token is a single character operator.
+func isOperator(t token) bool {
+	return t < 256 && t != tokEOF && strings.IndexByte("=><+-*/%!()&|^~?:,", byte(t)) >= 0
+}
+
+// isMultiOperator reports whether a token is an operator composed of multiple
+// characters.
+func isMultiOperator(t token) bool {
+	return t >= tokEqual && t <= tokConditional
+}
+
+// evaluator holds the state shared by an expression and the expressions
+// evaluated from its variables.
+type evaluator struct {
+	*Evaluator
+	vars  Variables
+	depth int
+}
+
+// lvalue is a variable that may be assigned to.
+//
+// The subscript of an array element is only evaluated once, either when the
+// value of the element is read, or when it is assigned.
+type lvalue struct {
+	name     string
+	key      string
+	resolved bool
+}
+
+// expression is the parsing state of a single expression, following the
+// structure of the bash evaluator; the current token is read ahead of the
+// operator that consumes it, and the previous token determines whether an
+// assignment is valid.
+type expression struct {
+	ev        *evaluator
+	expr      string
+	tp        int
+	lasttp    int
+	curtok    token
+	lasttok   token
+	assignTok token
+	tokstr    string
+	tokval    int64
+	lval      lvalue
+	noeval    int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isVarStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isVarChar(c byte) bool {
+	return isVarStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNumberChar(c byte) bool {
+	return isVarChar(c) || c == '@'
+}
+
+// subexpr evaluates an expression, which is either the top-level expression,
+// or the value of a variable or subscript referenced by the outer expression.
+func (ev *evaluator) subexpr(outer *expression, expr string) (int64, error) {
+	if strings.TrimLeft(expr, " \t\n") == "" {
+		return 0, nil
+	}
+
+	if ev.depth >= maxDepth {
+		return 0, outer.error(ErrRecursion)
+	}
+
+	ev.depth++
+	defer func() { ev.depth-- }()
+
+	x := expression{ev: ev, expr: expr, lasttp: -1}
+
+	if err := x.readtok(); err != nil {
+		return 0, err
+	}
+
+	v, err := x.comma()
+	if err != nil {
+		return 0, err
+	}
+
+	if x.curtok != tokEOF {
+		return 0, x.error(ErrSyntax)
+	}
+
+	return v, nil
+}
+
+// error returns an Error for the expression, with the error token being the
+// remainder of the expression from the start of the last token read.
+func (x *expression) error(err error) error {
+	e := Error{Err: err, Expr: strings.TrimLeft(x.expr, " \t")}
+
+	if x.lasttp >= 0 {
+		e.Token = x.expr[x.lasttp:]
+	}
+
+	return e
+}
+
+func (x *expression) comma() (int64, error) {
+	v, err := x.assign()
+
+	for err == nil && x.curtok == ',' {
+		if err = x.readtok(); err == nil {
+			v, err = x.assign()
+		}
+	}
+
+	return v, err
+}
+
+func (x *expression) assign() (int64, error) {
+	v, err := x.cond()
+	if err != nil || x.curtok != '=' && x.curtok != tokAssignOp {
+		return v, err
+	}
+
+	special := x.curtok == tokAssignOp
+	op, lhs := x.assignTok, v
+
+	if x.lasttok != tokVariable {
+		return 0, x.error(ErrNonVariable)
+	}
+
+	lv := x.lval
+
+	if err := x.readtok(); err != nil {
+		return 0, err
+	}
+
+	if v, err = x.assign(); err != nil {
+		return 0, err
+	}
+
+	if special {
+		if (op == '/' || op == '%') && v == 0 {
+			if x.noeval == 0 {
+				return 0, x.error(ErrDivisionByZero)
+			}
+
+			v = 1
+		}
+
+		v = binary(op, lhs, v)
+	}
+
+	if x.noeval == 0 {
+		if err := x.bind(lv, v); err != nil {
+			return 0, err
+		}
+	}
+
+	return v, nil
+}
+
+// binary applies an arithmetic or bitwise operator, with the wrapping
+// behaviour of bash.
+func binary(op token, a, b int64) int64 {
+	switch op {
+	case '*':
+		return a * b
+	case '/':
+		if a == math.MinInt64 && b == -1 {
+			return a
+		}
+
+		return a / b
+	case '%':
+		if a == math.MinInt64 && b == -1 {
+			return 0
+		}
+
+		return a % b
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case tokShiftLeft:
+		return a << (uint64(b) & 63)
+	case tokShiftRight:
+		return a >> (uint64(b) & 63)
+	case '&':
+		return a & b
+	case '|':
+		return a | b
+	case '^':
+		return a ^ b
+	}
+
+	return 0
+}
+
+func boolean(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (x *expression) cond() (int64, error) {
+	cval, err := x.logicalOr()
+	if err != nil || x.curtok != '?' {
+		return cval, err
+	}
+
+	val1, err := x.skipIf(cval == 0, func() (int64, error) {
+		if err := x.readtok(); err != nil {
+			return 0, err
+		}
+
+		if x.curtok == tokEOF || x.curtok == ':' {
+			return 0, x.error(ErrExpressionExpected)
+		}
+
+		return x.comma()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if x.curtok != ':' {
+		return 0, x.error(ErrColonExpected)
+	}
+
+	val2, err := x.skipIf(cval != 0, func() (int64, error) {
+		if err := x.readtok(); err != nil {
+			return 0, err
+		}
+
+		if x.curtok == tokEOF {
+			return 0, x.error(ErrExpressionExpected)
+		}
+
+		return x.cond()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	x.lasttok = tokConditional
+
+	if cval != 0 {
+		return val1, nil
+	}
+
+	return val2, nil
+}
+
+// skipIf calls the given function, without evaluating variables, performing
+// assignments, or reporting division errors when skip is true.
+func (x *expression) skipIf(skip bool, fn func() (int64, error)) (int64, error) {
+	if skip {
+		x.noeval++
+		defer func() { x.noeval-- }()
+	}
+
+	return fn()
+}
+
+func (x *expression) logicalOr() (int64, error) {
+	v, err := x.logicalAnd()
+
+	for err == nil && x.curtok == tokLogicalOr {
+		var v2 int64
+
+		v2, err = x.skipIf(v != 0, func() (int64, error) {
+			if err := x.readtok(); err != nil {
+				return 0, err
+			}
+
+			return x.logicalAnd()
+		})
+		v = boolean(v != 0 || v2 != 0)
+		x.lasttok = tokLogicalOr
+	}
+
+	return v, err
+}
+
+func (x *expression) logicalAnd() (int64, error) {
+	v, err := x.bitwiseOr()
+
+	for err == nil && x.curtok == tokLogicalAnd {
+		var v2 int64
+
+		v2, err = x.skipIf(v == 0, func() (int64, error) {
+			if err := x.readtok(); err != nil {
+				return 0, err
+			}
+
+			return x.bitwiseOr()
+		})
+		v = boolean(v != 0 && v2 != 0)
+		x.lasttok = tokLogicalAnd
+	}
+
+	return v, err
+}
+
+// binaryLevel parses a left-associative sequence of operands, separated by
+// any of the given operators.
+func (x *expression) binaryLevel(next func() (int64, error), apply func(op token, a, b int64) int64, ops ...token) (int64, error) {
+	v, err := next()
+
+	for err == nil && x.curtok != tokEOF && slices.Contains(ops, x.curtok) {
+		op := x.curtok
+
+		if err = x.readtok(); err != nil {
+			break
+		}
+
+		var v2 int64
+
+		if v2, err = next(); err == nil {
+			v = apply(op, v, v2)
+			x.lasttok = tokNumber
+		}
+	}
+
+	return v, err
+}
+
+func (x *expression) bitwiseOr() (int64, error) {
+	return x.binaryLevel(x.bitwiseXor, binary, '|')
+}
+
+func (x *expression) bitwiseXor() (int64, error) {
+	return x.binaryLevel(x.bitwiseAnd, binary, '^')
+}
+
+func (x *expression) bitwiseAnd() (int64, error) {
+	return x.binaryLevel(x.equality, binary, '&')
+}
+
+func (x *expression) equality() (int64, error) {
+	return x.binaryLevel(x.relational, compare, tokEqual, tokNotEqual)
+}
+
+func (x *expression) relational() (int64, error) {
+	return x.binaryLevel(x.shift, compare, '<', '>', tokLessEqual, tokGreaterEqual)
+}
+
+func compare(op token, a, b int64) int64 {
+	switch op {
+	case tokEqual:
+		return boolean(a == b)
+	case tokNotEqual:
+		return boolean(a != b)
+	case '<':
+		return boolean(a < b)
+	case '>':
+		return boolean(a > b)
+	case tokLessEqual:
+		return boolean(a <= b)
+	case tokGreaterEqual:
+		return boolean(a >= b)
+	}
+
+	return 0
+}
+
+func (x *expression) shift() (int64, error) {
+	return x.binaryLevel(x.additive, binary, tokShiftLeft, tokShiftRight)
+}
+
+func (x *expression) additive() (int64, error) {
+	return x.binaryLevel(x.multiplicative, binary, '+', '-')
+}
+
+func (x *expression) multiplicative() (int64, error) {
+	v, err := x.power()
+
+	for err == nil && (x.curtok == '*' || x.curtok == '/' || x.curtok == '%') {
+		op, stp := x.curtok, x.tp
+
+		if err = x.readtok(); err != nil {
+			break
+		}
+
+		var v2 int64
+
+		if v2, err = x.power(); err != nil {
+			break
+		}
+
+		if op != '*' && v2 == 0 {
+			if x.noeval == 0 {
+				for stp < len(x.expr) && (x.expr[stp] == ' ' || x.expr[stp] == '\t') {
+					stp++
+				}
+
+				x.lasttp = stp
+
+				return 0, x.error(ErrDivisionByZero)
+			}
+
+			v2 = 1
+		}
+
+		v = binary(op, v, v2)
+		x.lasttok = tokNumber
+	}
+
+	return v, err
+}
+
+func (x *expression) power() (int64, error) {
+	v, err := x.unary()
+
+	for err == nil && x.curtok == tokPower {
+		if err = x.readtok(); err != nil {
+			break
+		}
+
+		var v2 int64
+
+		if v2, err = x.power(); err != nil {
+			break
+		}
+
+		x.lasttok = tokNumber
+
+		if v2 == 0 {
+			return 1, nil
+		} else if v2 < 0 {
+			return 0, x.error(ErrExponentNegative)
+		}
+
+		v = ipow(v, v2)
+	}
+
+	return v, err
+}
+
+func ipow(base, exp int64) int64 {
+	result := int64(1)
+
+	for exp != 0 {
+		if exp&1 != 0 {
+			result *= base
+		}
+
+		exp >>= 1
+		base *= base
+	}
+
+	return result
+}
+
+func (x *expression) unary() (int64, error) {
+	switch op := x.curtok; op {
+	case '!', '~', '-', '+':
+		if err := x.readtok(); err != nil {
+			return 0, err
+		}
+
+		v, err := x.unary()
+		if err != nil {
+			return 0, err
+		}
+
+		x.lasttok = tokNumber
+
+		switch op {
+		case '!':
+			return boolean(v == 0), nil
+		case '~':
+			return ^v, nil
+		case '-':
+			return -v, nil
+		}
+
+		return v, nil
+	}
+
+	return x.primary()
+}
+
+func (x *expression) primary() (int64, error) {
+	switch x.curtok {
+	case tokPreIncrement, tokPreDecrement:
+		op := x.curtok
+		x.lasttok = op
+
+		if err := x.readtok(); err != nil {
+			return 0, err
+		}
+
+		if x.curtok != tokVariable {
+			return 0, x.error(ErrIdentifierExpected)
+		}
+
+		v := x.tokval + increment(op == tokPreIncrement)
+
+		if x.noeval == 0 {
+			if err := x.bind(x.lval, v); err != nil {
+				return 0, err
+			}
+		}
+
+		x.curtok = tokNumber
+
+		return v, x.readtok()
+	case '(':
+		if err := x.readtok(); err != nil {
+			return 0, err
+		}
+
+		v, err := x.comma()
+		if err != nil {
+			return 0, err
+		}
+
+		if x.curtok != ')' {
+			return 0, x.error(ErrMissingParen)
+		}
+
+		return v, x.readtok()
+	case tokNumber, tokVariable:
+		v := x.tokval
+
+		if x.curtok == tokVariable {
+			saved := *x
+			x.noeval = 1
+
+			if err := x.readtok(); err != nil {
+				return 0, err
+			}
+
+			if op := x.curtok; op == tokPostIncrement || op == tokPostDecrement {
+				x.tokstr, x.noeval, x.lval, x.lasttok = saved.tokstr, saved.noeval, saved.lval, tokVariable
+
+				if x.noeval == 0 {
+					if err := x.bind(x.lval, v+increment(op == tokPostIncrement)); err != nil {
+						return 0, err
+					}
+				}
+
+				x.curtok = tokNumber
+			} else {
+				*x = saved
+			}
+		}
+
+		return v, x.readtok()
+	}
+
+	return 0, x.error(ErrOperandExpected)
+}
+
+func increment(inc bool) int64 {
+	if inc {
+		return 1
+	}
+
+	return -1
+}
+
+// readtok reads the next token of the expression, evaluating the value of any
+// number or variable.
+func (x *expression) readtok() error {
+	cp := x.tp
+
+	for cp < len(x.expr) && isSpace(x.expr[cp]) {
+		cp++
+	}
+
+	if cp == len(x.expr) {
+		x.lasttok, x.curtok = x.curtok, tokEOF
+		x.tp = cp
+
+		return nil
+	}
+
+	x.tp, x.lasttp = cp, cp
+	c := x.expr[cp]
+	cp++
+
+	switch {
+	case isVarStart(c):
+		return x.variableToken(cp)
+	case isDigit(c):
+		for cp < len(x.expr) && (isNumberChar(x.expr[cp]) || x.expr[cp] == '#') {
+			cp++
+		}
+
+		v, err := x.number(x.tp, cp)
+		if err != nil {
+			return err
+		}
+
+		x.tokval = v
+		x.lasttok, x.curtok = x.curtok, tokNumber
+		x.tp = cp
+
+		return nil
+	}
+
+	var c1 byte
+
+	if cp < len(x.expr) {
+		c1 = x.expr[cp]
+	}
+
+	cp++
+
+	tok := token(c)
+
+	switch {
+	case c == '=' && c1 == '=':
+		tok = tokEqual
+	case c == '!' && c1 == '=':
+		tok = tokNotEqual
+	case c == '>' && c1 == '=':
+		tok = tokGreaterEqual
+	case c == '<' && c1 == '=':
+		tok = tokLessEqual
+	case c == '<' && c1 == '<', c == '>' && c1 == '>':
+		tok = tokShiftLeft
+
+		if c == '>' {
+			tok = tokShiftRight
+		}
+
+		if cp < len(x.expr) && x.expr[cp] == '=' {
+			x.assignTok, tok = tok, tokAssignOp
+			cp++
+		}
+	case c == '&' && c1 == '&':
+		tok = tokLogicalAnd
+	case c == '|' && c1 == '|':
+		tok = tokLogicalOr
+	case c == '*' && c1 == '*':
+		tok = tokPower
+	case (c == '-' || c == '+') && c1 == c && x.curtok == tokVariable:
+		tok = tokPostDecrement
+
+		if c == '+' {
+			tok = tokPostIncrement
+		}
+	case (c == '-' || c == '+') && c1 == c && x.curtok == tokNumber && (x.lasttok == tokPreIncrement || x.lasttok == tokPreDecrement):
+		return x.error(fmt.Errorf("%c%c: %w", c, c, ErrLvalue))
+	case (c == '-' || c == '+') && c1 == c:
+		xp := cp
+
+		for xp < len(x.expr) && isSpace(x.expr[xp]) {
+			xp++
+		}
+
+		if xp < len(x.expr) && isVarStart(x.expr[xp]) {
+			tok = tokPreDecrement
+
+			if c == '+' {
+				tok = tokPreIncrement
+			}
+		} else {
+			cp--
+		}
+	case c1 == '=' && strings.IndexByte("*/%+-&^|", c) >= 0:
+		x.assignTok, tok = token(c), tokAssignOp
+	case !isOperator(tok):
+		if x.curtok == tokEOF || isOperator(x.curtok) || isMultiOperator(x.curtok) {
+			return x.error(ErrOperandExpected)
+		}
+
+		return x.error(ErrInvalidOperator)
+	default:
+		cp--
+	}
+
+	x.lasttok, x.curtok = x.curtok, tok
+	x.tp = cp
+
+	return nil
+}
+
+// variableToken reads a variable name, along with any subscript, and
+// evaluates its value, unless it is about to be assigned.
+func (x *expression) variableToken(cp int) error {
+	for cp < len(x.expr) && isVarChar(x.expr[cp]) {
+		cp++
+	}
+
+	if cp < len(x.expr) && x.expr[cp] == '[' {
+		end := skipSubscript(x.expr, cp)
+		if end < 0 {
+			return x.error(ErrBadSubscript)
+		}
+
+		cp = end + 1
+	}
+
+	x.tokstr = x.expr[x.tp:cp]
+
+	saved := *x
+	x.tp, x.noeval, x.curtok = cp, 1, tokVariable
+	err := x.readtok()
+	peek := x.curtok
+	*x = saved
+
+	if err != nil {
+		return err
+	}
+
+	if x.lasttok == tokPreIncrement || x.lasttok == tokPreDecrement || peek != '=' {
+		if x.lval, x.tokval, err = x.variable(x.tokstr); err != nil {
+			return err
+		}
+	} else {
+		x.lval, x.tokval = lvalue{name: x.tokstr}, 0
+	}
+
+	x.lasttok, x.curtok = x.curtok, tokVariable
+	x.tp = cp
+
+	return nil
+}
+
+// skipSubscript returns the position of the bracket that closes the subscript
+// starting at the given position, or -1 if there is none.
+func skipSubscript(s string, pos int) int {
+	depth := 0
+
+	for n := pos; n < len(s); n++ {
+		switch s[n] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return n
+			}
+		}
+	}
+
+	return -1
+}
+
+// number parses an integer constant, which may be in octal, hexadecimal, or
+// in an explicit base from 2 to 64.
+//
+// Errors in a constant are reported with the expression truncated at the end
+// of the constant.
+func (x *expression) number(start, end int) (int64, error) {
+	s := x.expr[start:end]
+	fail := func(err error) (int64, error) {
+		return 0, Error{Err: err, Expr: strings.TrimLeft(x.expr[:end], " \t"), Token: s}
+	}
+
+	base := int64(10)
+	foundBase := false
+	n := 0
+
+	if s[0] == '0' {
+		if len(s) == 1 {
+			return 0, nil
+		}
+
+		n++
+		base = 8
+
+		if s[1] == 'x' || s[1] == 'X' {
+			base = 16
+			n++
+		}
+
+		foundBase = true
+	}
+
+	var val int64
+
+	for ; n < len(s); n++ {
+		c := s[n]
+
+		if c == '#' {
+			if foundBase {
+				return fail(ErrInvalidNumber)
+			} else if val < 2 || val > 64 {
+				return fail(ErrInvalidBase)
+			}
+
+			base, val, foundBase = val, 0, true
+
+			if n+1 == len(s) || !isNumberChar(s[n+1]) {
+				return fail(ErrInvalidConstant)
+			}
+
+			continue
+		}
+
+		d := digit(c, base)
+		if d >= base {
+			return fail(ErrValueTooGreat)
+		}
+
+		val = val*base + d
+	}
+
+	return val, nil
+}
+
+func digit(c byte, base int64) int64 {
+	switch {
+	case isDigit(c):
+		return int64(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int64(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		if base <= 36 {
+			return int64(c-'A') + 10
+		}
+
+		return int64(c-'A') + 36
+	case c == '@':
+		return 62
+	}
+
+	return 63
+}
+
+// variable returns the value of a variable, which is evaluated as an
+// expression.
+func (x *expression) variable(name string) (lvalue, int64, error) {
+	lv := lvalue{name: name}
+
+	if x.noeval > 0 {
+		return lv, 0, nil
+	}
+
+	base, sub, keyed := strings.Cut(name, "[")
+	full := base
+
+	if keyed {
+		key, err := x.key(base, sub[:len(sub)-1])
+		if err != nil {
+			return lv, 0, err
+		}
+
+		lv.key, lv.resolved = key, true
+		full = base + "[" + key + "]"
+	}
+
+	value, ok := x.ev.vars.Get(full)
+	if !ok && x.ev.NoUnset {
+		if _, exists := x.ev.vars.Get(base); !keyed || !exists {
+			return lv, 0, fmt.Errorf("%s: %w", base, expand.ErrUnbound)
+		}
+	}
+
+	v, err := x.ev.subexpr(x, value)
+
+	return lv, v, err
+}
+
+// key determines the key of an array element; the subscript of an Indexed
+// array is evaluated as an expression.
+func (x *expression) key(name, sub string) (string, error) {
+	if sub == "" {
+		return "", fmt.Errorf("%s[]: %w", name, ErrBadSubscript)
+	}
+
+	if a, ok := x.ev.vars.(Associative); ok && a.IsAssociative(name) {
+		return sub, nil
+	}
+
+	v, err := x.ev.subexpr(x, sub)
+	if err != nil {
+		return "", err
+	}
+
+	return itoa(v), nil
+}
+
+// bind assigns a value to a variable.
+func (x *expression) bind(lv lvalue, v int64) error {
+	name := lv.name
+
+	if base, sub, keyed := strings.Cut(name, "["); keyed {
+		key := lv.key
+
+		if !lv.resolved {
+			var err error
+
+			if key, err = x.key(base, sub[:len(sub)-1]); err != nil {
+				return err
+			}
+		}
+
+		name = base + "[" + key + "]"
+	}
+
+	return x.ev.vars.Set(name, itoa(v))
+}
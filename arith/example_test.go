@@ -0,0 +1,49 @@
+package arith_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/arith"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	env := expand.Map{
+		"count": expand.Scalar("3"),
+		"sizes": expand.Indexed("10", "20", "30"),
+	}
+
+	ev := arith.Evaluator{Vars: arith.Env(env)}
+
+	fmt.Println(ev.Eval("sizes[count - 1] * 2, ++count"))
+	fmt.Println(ev.Eval("16#ff + 2#101"))
+	fmt.Println(ev.Eval("count / 0"))
+
+	tk := parser.NewStringTokeniser(`echo "total: $(( sizes[0] + sizes[1] + sizes[2] ))"`)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	e := expand.Expander{Env: env, Arithmetic: ev.Eval}
+
+	fields, err := e.Fields(b.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command.AssignmentsOrWords[1].Word)
+
+	fmt.Println(fields, err)
+
+	v, _ := env.Get("count")
+
+	fmt.Println(v)
+
+	// Output:
+	// 4 <nil>
+	// 260 <nil>
+	// 0 count / 0: division by 0 (error token is "0")
+	// [total: 60] <nil>
+	// 4
+}
@@ -8193,6 +8193,73 @@ func TestArithmeticExpansion(t *testing.T) {
 				Token:   tk[1],
 			}
 		}},
+		{"$((a==b>=c|=d))", func(t *test, tk Tokens) { // 7
+			t.Output = ArithmeticExpansion{
+				WordsAndOperators: []WordOrOperator{
+					{
+						Word: &Word{
+							Parts: []WordPart{
+								{
+									Part:   &tk[1],
+									Tokens: tk[1:2],
+								},
+							},
+							Tokens: tk[1:2],
+						},
+						Tokens: tk[1:2],
+					},
+					{
+						Operator: &tk[2],
+						Tokens:   tk[2:3],
+					},
+					{
+						Word: &Word{
+							Parts: []WordPart{
+								{
+									Part:   &tk[3],
+									Tokens: tk[3:4],
+								},
+							},
+							Tokens: tk[3:4],
+						},
+						Tokens: tk[3:4],
+					},
+					{
+						Operator: &tk[4],
+						Tokens:   tk[4:5],
+					},
+					{
+						Word: &Word{
+							Parts: []WordPart{
+								{
+									Part:   &tk[5],
+									Tokens: tk[5:6],
+								},
+							},
+							Tokens: tk[5:6],
+						},
+						Tokens: tk[5:6],
+					},
+					{
+						Operator: &tk[6],
+						Tokens:   tk[6:7],
+					},
+					{
+						Word: &Word{
+							Parts: []WordPart{
+								{
+									Part:   &tk[7],
+									Tokens: tk[7:8],
+								},
+							},
+							Tokens: tk[7:8],
+						},
+						Tokens: tk[7:8],
+					},
+				},
+				Tokens: tk[:9],
+			}
+		}},
 	}, func(t *test) (Type, error) {
 		var ae ArithmeticExpansion
 
@@ -317,7 +317,7 @@ func (be *BraceExpansion) parse(b *bashParser) error {
 		be.BraceExpansionType = BraceExpansionSequence
 	}
 
-	for !b.AcceptToken(parser.Token{Type: TokenBraceExpansion, Data: "}"}) {
+	for {
 		c := b.NewGoal()
 
 		var w Word
@@ -329,9 +329,14 @@ func (be *BraceExpansion) parse(b *bashParser) error {
 		be.Words = append(be.Words, w)
 
 		b.Score(c)
-		b.Accept(TokenPunctuator)
+
+		if !b.Accept(TokenPunctuator) {
+			break
+		}
 	}
 
+	b.AcceptToken(parser.Token{Type: TokenBraceExpansion, Data: "}"})
+
 	be.Tokens = b.ToTokens()
 
 	return nil
@@ -769,7 +774,7 @@ func (w *WordOrOperator) parse(b *bashParser) error {
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "<<"}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: ">>"}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "<="}) ||
-		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "=>"}) ||
+		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: ">="}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "<"}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: ">"}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "?"}) ||
@@ -790,6 +795,8 @@ func (w *WordOrOperator) parse(b *bashParser) error {
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: ">>="}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "&="}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "^="}) ||
+		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "|="}) ||
+		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "=="}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "!="}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: "("}) ||
 		b.AcceptToken(parser.Token{Type: TokenPunctuator, Data: ")"}) ||
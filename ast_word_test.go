@@ -1142,6 +1142,75 @@ func TestBraceExpansion(t *testing.T) {
 				Token:   tk[1],
 			}
 		}},
+		{"{a,}", func(t *test, tk Tokens) { // 6
+			t.Output = BraceExpansion{
+				BraceExpansionType: BraceExpansionWords,
+				Words: []Word{
+					{
+						Parts: []WordPart{
+							{
+								Part:   &tk[1],
+								Tokens: tk[1:2],
+							},
+						},
+						Tokens: tk[1:2],
+					},
+					{
+						Tokens: tk[3:3],
+					},
+				},
+				Tokens: tk[:4],
+			}
+		}},
+		{"{a,{b,c}}", func(t *test, tk Tokens) { // 7
+			t.Output = BraceExpansion{
+				BraceExpansionType: BraceExpansionWords,
+				Words: []Word{
+					{
+						Parts: []WordPart{
+							{
+								Part:   &tk[1],
+								Tokens: tk[1:2],
+							},
+						},
+						Tokens: tk[1:2],
+					},
+					{
+						Parts: []WordPart{
+							{
+								BraceExpansion: &BraceExpansion{
+									BraceExpansionType: BraceExpansionWords,
+									Words: []Word{
+										{
+											Parts: []WordPart{
+												{
+													Part:   &tk[4],
+													Tokens: tk[4:5],
+												},
+											},
+											Tokens: tk[4:5],
+										},
+										{
+											Parts: []WordPart{
+												{
+													Part:   &tk[6],
+													Tokens: tk[6:7],
+												},
+											},
+											Tokens: tk[6:7],
+										},
+									},
+									Tokens: tk[3:8],
+								},
+								Tokens: tk[3:8],
+							},
+						},
+						Tokens: tk[3:8],
+					},
+				},
+				Tokens: tk[:9],
+			}
+		}},
 	}, func(t *test) (Type, error) {
 		var b BraceExpansion
 
@@ -0,0 +1,240 @@
+// Package attributes infers the attributes, such as being an array or an
+// integer, of the variables of a parsed bash file.
+package attributes
+
+import (
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/bash/scope"
+)
+
+// Attribute is a set of variable attributes, as set by the options of the
+// 'declare' builtin.
+type Attribute uint8
+
+// Attributes.
+const (
+	Indexed     Attribute = 1 << iota // -a
+	Associative                       // -A
+	Integer                           // -i
+	Nameref                           // -n
+	Readonly                          // -r
+	Exported                          // -x
+	Lowercase                         // -l
+	Uppercase                         // -u
+)
+
+const letters = "aAinrxlu"
+
+// Has returns true if all of the given Attributes are set.
+func (a Attribute) Has(b Attribute) bool {
+	return a&b == b
+}
+
+// IsArray returns true if either the Indexed or Associative Attribute is set.
+func (a Attribute) IsArray() bool {
+	return a&(Indexed|Associative) != 0
+}
+
+// String implements the fmt.Stringer interface, returning the options that
+// would be given to 'declare' to set the Attributes, or "--" if none are set.
+func (a Attribute) String() string {
+	if a == 0 {
+		return "--"
+	}
+
+	var sb strings.Builder
+
+	sb.WriteByte('-')
+
+	for n := range len(letters) {
+		if a&(1<<n) != 0 {
+			sb.WriteByte(letters[n])
+		}
+	}
+
+	return sb.String()
+}
+
+// Parse returns the Attributes set by the given 'declare' option letters.
+//
+// Unknown letters are ignored and, as in bash, the last of 'l' and 'u' takes
+// precedence.
+func Parse(flags string) Attribute {
+	var a Attribute
+
+	for _, c := range flags {
+		if n := strings.IndexRune(letters, c); n >= 0 {
+			switch c {
+			case 'l':
+				a &^= Uppercase
+			case 'u':
+				a &^= Lowercase
+			}
+
+			a |= 1 << n
+		}
+	}
+
+	return a
+}
+
+// Table is a scope.Table with the inferred Attributes of each variable Symbol
+// and Reference.
+type Table struct {
+	*scope.Table
+	symbols    map[*scope.Symbol]Attribute
+	references map[*scope.Reference]Attribute
+}
+
+// attribution is a point at which Attributes are given to a variable.
+type attribution struct {
+	attributes Attribute
+	scope      *scope.Scope
+	pos        uint64
+}
+
+// Infer resolves the variables of a parsed file and determines the Attributes
+// they have at each Symbol and Reference.
+//
+// Attributes are set by the declaration builtins, including 'export' and
+// 'readonly' when given only the name of an existing variable. Variables are
+// also considered to be Indexed arrays when assigned an array value, assigned
+// to a subscript, or read into with 'read -a', 'mapfile', or 'readarray', and
+// to be Exported when assigned as part of a command.
+//
+// Attributes persist across the definitions of a variable, and within a single
+// function, or the top-level code, only those given at or before a position
+// are included. As the order in which functions are called is not known, all
+// of the Attributes given within other functions are included.
+func Infer(f *bash.File) *Table {
+	t := &Table{
+		Table:      scope.Resolve(f),
+		symbols:    make(map[*scope.Symbol]Attribute),
+		references: make(map[*scope.Reference]Attribute),
+	}
+
+	own := make(map[*bash.Token]Attribute)
+	refs := make(map[*bash.Token]*scope.Reference)
+
+	for _, ref := range t.References {
+		if ref.Kind == scope.Variable {
+			refs[ref.Token] = ref
+		}
+	}
+
+	attributions := make(map[*scope.Symbol][]attribution)
+
+	astutil.Inspect(f, func(n bash.Type, _ []bash.Type) bool {
+		switch n := n.(type) {
+		case *bash.Assignment:
+			if n.Identifier.Identifier != nil && (n.Identifier.Subscript != nil || n.Value != nil && n.Value.Array != nil) {
+				own[n.Identifier.Identifier] |= Indexed
+			}
+		case *bash.Command:
+			if name := astutil.CommandName(n); astutil.IsDeclaration(name) {
+				for _, d := range astutil.Declarations(n) {
+					if d.Assignment == nil && (name == "export" || name == "readonly") {
+						if ref := refs[d.Token]; ref != nil {
+							for _, def := range ref.Definitions {
+								attributions[def] = append(attributions[def], attribution{Parse(d.Flags), ref.Scope, ref.Token.Pos})
+							}
+						}
+					} else {
+						own[d.Token] |= Parse(d.Flags)
+					}
+				}
+			} else if names, isArray := astutil.AssignedNames(n); isArray {
+				for _, name := range names {
+					if name.Word != nil {
+						own[name.Word.Parts[0].Part] |= Indexed
+					} else {
+						own[n.AssignmentsOrWords[0].Word.Parts[0].Part] |= Indexed
+					}
+				}
+			}
+		}
+
+		return true
+	})
+
+	for _, sym := range t.Symbols {
+		if sym.Kind != scope.Variable {
+			continue
+		}
+
+		a := own[sym.Token]
+
+		switch sym.Binding {
+		case scope.BindEnvironment:
+			a |= Exported
+		case scope.BindRead, scope.BindArithmetic:
+			if strings.Contains(sym.Token.Data, "[") {
+				a |= Indexed
+			}
+		}
+
+		attributions[sym] = append(attributions[sym], attribution{a, sym.Scope, sym.Token.Pos})
+	}
+
+	for _, sym := range t.Symbols {
+		if sym.Kind == scope.Variable {
+			t.symbols[sym] = combine(attributions, t.Variable(sym), sym.Scope, sym.Token.Pos)
+		}
+	}
+
+	for _, ref := range t.References {
+		if ref.Kind == scope.Variable {
+			t.references[ref] = combine(attributions, ref.Definitions, ref.Scope, ref.Token.Pos)
+		}
+	}
+
+	return t
+}
+
+// combine merges the Attributes given to the definitions of a variable that
+// apply at the given position.
+func combine(attributions map[*scope.Symbol][]attribution, defs []*scope.Symbol, s *scope.Scope, pos uint64) Attribute {
+	var a Attribute
+
+	for _, def := range defs {
+		for _, at := range attributions[def] {
+			if at.scope != s || at.pos <= pos {
+				a |= at.attributes
+			}
+		}
+	}
+
+	if a.Has(Associative) {
+		a &^= Indexed
+	}
+
+	return a
+}
+
+// Symbol returns the Attributes of the variable assigned by the given Symbol,
+// after its assignment.
+func (t *Table) Symbol(sym *scope.Symbol) Attribute {
+	return t.symbols[sym]
+}
+
+// Reference returns the Attributes of the variable at the given Reference.
+func (t *Table) Reference(ref *scope.Reference) Attribute {
+	return t.references[ref]
+}
+
+// At returns the Attributes of the variable Symbol or Reference whose name
+// token contains the given position.
+func (t *Table) At(pos uint64) Attribute {
+	sym, ref := t.Lookup(pos)
+
+	if sym != nil {
+		return t.Symbol(sym)
+	} else if ref != nil {
+		return t.Reference(ref)
+	}
+
+	return 0
+}
@@ -0,0 +1,134 @@
+package attributes
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+	"vimagination.zapto.org/bash/scope"
+)
+
+func TestParse(t *testing.T) {
+	for n, test := range [...]struct {
+		Flags  string
+		Output string
+	}{
+		{ // 1
+			"",
+			"--",
+		},
+		{ // 2
+			"ai",
+			"-ai",
+		},
+		{ // 3
+			"xrAgn",
+			"-Anrx",
+		},
+		{ // 4
+			"lu",
+			"-u",
+		},
+		{ // 5
+			"ul",
+			"-l",
+		},
+	} {
+		if out := Parse(test.Flags).String(); out != test.Output {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Output, out)
+		}
+	}
+}
+
+func TestInfer(t *testing.T) {
+	for n, test := range [...]struct {
+		Input      string
+		Attributes []string
+	}{
+		{ // 1
+			"a=1\necho $a",
+			[]string{"a@1:1 --", "a@2:6 --"},
+		},
+		{ // 2
+			"declare -i a=1\na+=2\necho $a",
+			[]string{"a@1:12 -i", "a@2:1 -i", "a@3:6 -i"},
+		},
+		{ // 3
+			"a=(1 2)\nb[1]=x\necho ${a[0]} ${b[1]}",
+			[]string{"a@1:1 -a", "b@2:1 -a", "a@3:8 -a", "b@3:16 -a"},
+		},
+		{ // 4
+			"declare -A m\nm[k]=v\necho ${m[k]}",
+			[]string{"m@1:12 -A", "m@2:1 -A", "m@3:8 -A"},
+		},
+		{ // 5
+			"a=1\necho $a\nreadonly a\necho $a",
+			[]string{"a@1:1 --", "a@2:6 --", "a@3:10 -r", "a@4:6 -r"},
+		},
+		{ // 6
+			"A=1 cmd\nexport B=2\ndeclare -x C\necho $A $B $C",
+			[]string{"A@1:1 -x", "B@2:8 -x", "C@3:12 -x", "A@4:6 -x", "B@4:9 -x", "C@4:12 -x"},
+		},
+		{ // 7
+			"read -ra parts\nmapfile\necho ${parts[0]} ${MAPFILE[0]}",
+			[]string{"parts@1:10 -a", "MAPFILE@2:1 -a", "parts@3:8 -a", "MAPFILE@3:20 -a"},
+		},
+		{ // 8
+			"declare -l lower\ndeclare -u upper\ndeclare -n ref=lower\necho $lower $upper $ref",
+			[]string{"lower@1:12 -l", "upper@2:12 -u", "ref@3:12 -n", "lower@3:16 -l", "lower@4:6 -l", "upper@4:13 -u", "ref@4:20 -n"},
+		},
+		{ // 9
+			"f() {\n\tlocal -i a\n\ta=1\n}\na=x\nf\necho $a",
+			[]string{"a@2:11 -i", "a@3:2 -i", "a@5:1 --", "a@7:6 --"},
+		},
+		{ // 10
+			"f() {\n\ta=1\n}\ng() {\n\tlocal -a a\n\tf\n}\ng",
+			[]string{"a@2:2 -a", "a@5:11 -a"},
+		},
+		{ // 11
+			"echo $a\ndeclare -i a",
+			[]string{"a@2:12 -i", "a@1:6 --"},
+		},
+		{ // 12
+			"(( x[1] = 2 ))\ny=x\n(( y++ ))",
+			[]string{"x@1:4 -a", "y@2:1 --", "y@3:4 --", "y@3:4 --"},
+		},
+	} {
+		table := Infer(testutil.Parse(t, test.Input))
+
+		var attributes []string
+
+		for _, sym := range table.Symbols {
+			if sym.Kind != scope.Variable {
+				continue
+			}
+
+			attributes = append(attributes, fmt.Sprintf("%s@%d:%d %s", sym.Name, sym.Token.Line+1, sym.Token.LinePos+1, table.Symbol(sym)))
+		}
+
+		for _, ref := range table.References {
+			if ref.Kind != scope.Variable {
+				continue
+			}
+
+			attributes = append(attributes, fmt.Sprintf("%s@%d:%d %s", ref.Name, ref.Token.Line+1, ref.Token.LinePos+1, table.Reference(ref)))
+		}
+
+		if !reflect.DeepEqual(attributes, test.Attributes) {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Attributes, attributes)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	table := Infer(testutil.Parse(t, "declare -ai a\necho $a"))
+
+	if a := table.At(12); a != Indexed|Integer {
+		t.Errorf("test 1: expecting -ai, got %s", a)
+	} else if a = table.At(20); a != Indexed|Integer {
+		t.Errorf("test 2: expecting -ai, got %s", a)
+	} else if a = table.At(14); a != 0 {
+		t.Errorf("test 3: expecting --, got %s", a)
+	}
+}
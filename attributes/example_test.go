@@ -0,0 +1,37 @@
+package attributes_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/scope"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "#!/bin/bash\n\ndeclare -i count=0\ndeclare -A seen\nfiles=()\n\nfor f in *; do\n\tfiles+=(\"$f\")\n\tseen[$f]=1\n\tcount+=1\ndone\n\nreadonly count\necho \"$count ${#files[@]}\"\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	table := attributes.Infer(b)
+
+	for _, ref := range table.References {
+		if ref.Kind == scope.Variable {
+			fmt.Printf("%d:%d %s %s\n", ref.Token.Line+1, ref.Token.LinePos+1, ref.Name, table.Reference(ref))
+		}
+	}
+
+	// Output:
+	// 8:11 f --
+	// 9:7 f --
+	// 13:10 count -ir
+	// 14:7 count -ir
+	// 14:17 files -a
+}
@@ -0,0 +1,516 @@
+// Package bashtest provides a harness for testing bash scripts from Go tests,
+// with their external commands replaced by stubs.
+package bashtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/bash/interp"
+	"vimagination.zapto.org/parser"
+)
+
+// Script is a parsed script, along with the environment it is run in.
+//
+// Env contains the environment of the script, in the form 'name=value', and
+// Stdin its standard input. Dir is the working directory, and FS, when set,
+// the filesystem used for pathname expansion, file tests, and the files read
+// by redirections, as with interp.Runner.
+//
+// External commands are run by the stubs given to Stub; any other external
+// command is not found.
+type Script struct {
+	Env   []string
+	Stdin string
+	Dir   string
+	FS    fs.FS
+
+	tb    testing.TB
+	file  *bash.File
+	stubs map[string]interp.ExecHandler
+	setup bool
+	args  []string
+}
+
+// Load parses the script in the named file, failing the test if it cannot be
+// read or parsed.
+func Load(tb testing.TB, name string) *Script {
+	tb.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		tb.Fatalf("bashtest: %s", err)
+	}
+
+	return parse(tb, name, string(data))
+}
+
+// Parse parses a script, failing the test if it cannot be parsed.
+func Parse(tb testing.TB, src string) *Script {
+	tb.Helper()
+
+	return parse(tb, "script", src)
+}
+
+func parse(tb testing.TB, name, src string) *Script {
+	tb.Helper()
+
+	tk := parser.NewStringTokeniser(src)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		tb.Fatalf("bashtest: %s: %s", name, err)
+	}
+
+	return &Script{tb: tb, file: f, stubs: make(map[string]interp.ExecHandler)}
+}
+
+// Stub sets the handler that is run in place of the named external command.
+//
+// The Output and Status functions create handlers that give canned results,
+// while an interp.ExecFunc allows the command to be implemented in Go.
+func (s *Script) Stub(name string, h interp.ExecHandler) *Script {
+	s.stubs[name] = h
+
+	return s
+}
+
+// Output returns a stub that writes the given output to stdout, and exits
+// with the given status.
+func Output(stdout string, status int) interp.ExecFunc {
+	return func(_ context.Context, cmd *interp.Command) (int, error) {
+		if cmd.Stdout != nil {
+			if _, err := io.WriteString(cmd.Stdout, stdout); err != nil {
+				return 0, err
+			}
+		}
+
+		return status, nil
+	}
+}
+
+// Status returns a stub that writes nothing, and exits with the given status.
+func Status(status int) interp.ExecFunc {
+	return Output("", status)
+}
+
+// Run runs the whole script, with the given positional parameters.
+func (s *Script) Run(args ...string) *Result {
+	s.tb.Helper()
+
+	res, r := s.runner(args)
+
+	res.status, res.err = r.Run(context.Background(), s.file)
+
+	return res.finish(r)
+}
+
+// Setup sets Call to run the top-level code of the script before calling the
+// function, with the given positional parameters, so that the globals, shell
+// options, traps, and sourced files that the function relies on are set up as
+// they would be when the script calls it.
+//
+// The entry point of the script is not run; that is the last top-level
+// statement to call one of the functions of the script, other than from a
+// command substitution, such as a trailing 'main "$@"'.
+func (s *Script) Setup(args ...string) *Script {
+	s.setup = true
+	s.args = args
+
+	return s
+}
+
+// callMarker is the name of the command run between the setup code and the
+// call of a function, which marks the start of the call.
+const callMarker = "bashtest: call"
+
+// Call runs the named function, with the given arguments.
+//
+// Only the functions defined by the top-level statements of the script are
+// defined before the call, unless Setup has been called, in which case the rest
+// of the top-level code is run as well, in the same run as the call, so that
+// an EXIT trap it sets is run once the call has finished. What the setup code
+// writes is not included in the Result, but the external commands it runs are.
+//
+// The test fails if the script does not define the function, or if the setup
+// code exits before the function can be called.
+func (s *Script) Call(name string, args ...string) *Result {
+	s.tb.Helper()
+
+	defs, ok := topLevel(s.file, name, s.setup)
+	if !ok {
+		s.tb.Fatalf("bashtest: function %q not defined", name)
+	}
+
+	call := make([]string, len(args)+1)
+	call[0] = name
+
+	for n, arg := range args {
+		call[n+1] = expand.Quote(arg)
+	}
+
+	tk := parser.NewStringTokeniser(expand.Quote(callMarker) + "\n" + strings.Join(call, " "))
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		s.tb.Fatalf("bashtest: %s", err)
+	}
+
+	defs.Lines = append(defs.Lines, f.Lines...)
+
+	res, r := s.runner(s.args)
+
+	res.recorder.call = func() {
+		res.called = true
+
+		res.stdout.Reset()
+		res.stderr.Reset()
+	}
+
+	res.status, res.err = r.Run(context.Background(), defs)
+
+	if res.err == nil && !res.called {
+		s.tb.Fatalf("bashtest: setup exited with status %d before calling %s: %q", res.status, name, res.stderr.String())
+	}
+
+	return res.finish(r)
+}
+
+// topLevel returns a file containing the function definitions of the
+// top-level statements of the given file, reporting whether the named function
+// is among them.
+//
+// When all is true, the other top-level statements are included as well,
+// except for the entry point of the script.
+func topLevel(f *bash.File, name string, all bool) (*bash.File, bool) {
+	var (
+		defs  bash.File
+		fns   = make(map[string]bool)
+		found bool
+		entry *bash.Statement
+	)
+
+	for _, line := range f.Lines {
+		for _, st := range line.Statements {
+			if fc := definition(&st); fc != nil {
+				fns[fc.Identifier.Data] = true
+			}
+		}
+	}
+
+	for l := range f.Lines {
+		for n := range f.Lines[l].Statements {
+			if st := &f.Lines[l].Statements[n]; definition(st) == nil && calls(st, fns) {
+				entry = st
+			}
+		}
+	}
+
+	for l, line := range f.Lines {
+		var statements []bash.Statement
+
+		for n, st := range line.Statements {
+			if fc := definition(&st); fc != nil {
+				found = found || fc.Identifier.Data == name
+			} else if !all || &f.Lines[l].Statements[n] == entry {
+				continue
+			}
+
+			statements = append(statements, st)
+		}
+
+		if len(statements) > 0 {
+			defs.Lines = append(defs.Lines, bash.Line{Statements: statements, Tokens: line.Tokens})
+		}
+	}
+
+	return &defs, found
+}
+
+// definition returns the function defined by the statement, if it is a
+// function definition.
+func definition(st *bash.Statement) *bash.FunctionCompound {
+	if st.Statement != nil || st.Pipeline.Pipeline != nil || st.Pipeline.CommandOrCompound.Compound == nil {
+		return nil
+	}
+
+	fc := st.Pipeline.CommandOrCompound.Compound.FunctionCompound
+	if fc == nil || fc.Identifier == nil {
+		return nil
+	}
+
+	return fc
+}
+
+// calls determines whether the statement calls any of the given functions,
+// other than from a command substitution.
+func calls(st *bash.Statement, fns map[string]bool) bool {
+	var found bool
+
+	astutil.Inspect(st, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.FunctionCompound, *bash.CommandSubstitution:
+			return false
+		case *bash.Command:
+			found = found || fns[astutil.CommandName(t)]
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+// runner creates a Runner for a single run of the script, along with the
+// Result it records to.
+func (s *Script) runner(args []string) (*Result, *interp.Runner) {
+	res := &Result{tb: s.tb, recorder: &recorder{stubs: s.stubs}}
+
+	return res, &interp.Runner{
+		Args:   args,
+		Env:    s.Env,
+		Dir:    s.Dir,
+		Stdin:  strings.NewReader(s.Stdin),
+		Stdout: &res.stdout,
+		Stderr: &res.stderr,
+		FS:     s.FS,
+		Exec:   res.recorder,
+	}
+}
+
+// Call is an external command run by a script.
+type Call struct {
+	Args []string
+	Env  []string
+	Dir  string
+}
+
+// Getenv returns the value of the named variable from the environment of the
+// command.
+func (c Call) Getenv(name string) string {
+	return (&interp.Command{Env: c.Env}).Getenv(name)
+}
+
+// String returns the arguments of the call, separated by spaces, with each
+// quoted when it is empty, or contains characters special to the shell.
+func (c Call) String() string {
+	args := make([]string, len(c.Args))
+
+	for n, arg := range c.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]{}~#!") {
+			arg = expand.Quote(arg)
+		}
+
+		args[n] = arg
+	}
+
+	return strings.Join(args, " ")
+}
+
+// Result is the result of running a script, or one of its functions.
+//
+// The Expect methods check the result, marking the test as having failed if
+// they do not match, and return the Result so that they can be chained.
+type Result struct {
+	tb       testing.TB
+	runner   *interp.Runner
+	recorder *recorder
+	err      error
+	called   bool
+
+	stdout, stderr strings.Builder
+	status         int
+}
+
+// recorder is the interp.ExecHandler of a run, which records each call, and
+// runs the stub for the command.
+//
+// The call function, when set, is run in place of the command that marks the
+// start of the call of a function.
+type recorder struct {
+	stubs map[string]interp.ExecHandler
+	call  func()
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Exec implements the interp.ExecHandler interface.
+func (r *recorder) Exec(ctx context.Context, cmd *interp.Command) (int, error) {
+	if r.call != nil && cmd.Args[0] == callMarker {
+		r.call()
+
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, Call{Args: slices.Clone(cmd.Args), Env: slices.Clone(cmd.Env), Dir: cmd.Dir})
+	r.mu.Unlock()
+
+	stub, ok := r.stubs[cmd.Args[0]]
+	if !ok {
+		return 0, interp.ErrNotFound
+	}
+
+	return stub.Exec(ctx, cmd)
+}
+
+// LookPath implements the interp.PathHandler interface, finding stubbed
+// commands at a path that is the same as their name.
+func (r *recorder) LookPath(_ context.Context, cmd *interp.Command) (string, error) {
+	if _, ok := r.stubs[cmd.Args[0]]; ok {
+		return cmd.Args[0], nil
+	}
+
+	return "", interp.ErrNotFound
+}
+
+func (r *Result) finish(runner *interp.Runner) *Result {
+	r.tb.Helper()
+
+	if r.err != nil {
+		r.tb.Fatalf("bashtest: %s", r.err)
+	}
+
+	r.runner = runner
+
+	return r
+}
+
+// Stdout returns what was written to stdout.
+func (r *Result) Stdout() string {
+	return r.stdout.String()
+}
+
+// Stderr returns what was written to stderr.
+func (r *Result) Stderr() string {
+	return r.stderr.String()
+}
+
+// Status returns the exit status.
+func (r *Result) Status() int {
+	return r.status
+}
+
+// Var returns the value of the named variable once the run has finished, and
+// whether it is set.
+func (r *Result) Var(name string) (string, bool) {
+	v, ok := r.runner.Get(name)
+	if !ok {
+		return "", false
+	}
+
+	return v.String(), true
+}
+
+// Calls returns the external commands run, in the order that they were
+// started.
+func (r *Result) Calls() []Call {
+	r.recorder.mu.Lock()
+	defer r.recorder.mu.Unlock()
+
+	return slices.Clone(r.recorder.calls)
+}
+
+// ExpectStdout checks what was written to stdout.
+func (r *Result) ExpectStdout(stdout string) *Result {
+	r.tb.Helper()
+
+	if got := r.Stdout(); got != stdout {
+		r.tb.Errorf("expecting stdout %q, got %q", stdout, got)
+	}
+
+	return r
+}
+
+// ExpectStderr checks what was written to stderr.
+func (r *Result) ExpectStderr(stderr string) *Result {
+	r.tb.Helper()
+
+	if got := r.Stderr(); got != stderr {
+		r.tb.Errorf("expecting stderr %q, got %q", stderr, got)
+	}
+
+	return r
+}
+
+// ExpectStatus checks the exit status.
+func (r *Result) ExpectStatus(status int) *Result {
+	r.tb.Helper()
+
+	if r.status != status {
+		r.tb.Errorf("expecting status %d, got %d", status, r.status)
+	}
+
+	return r
+}
+
+// ExpectVar checks that the named variable is set to the given value.
+func (r *Result) ExpectVar(name, value string) *Result {
+	r.tb.Helper()
+
+	if got, ok := r.Var(name); !ok {
+		r.tb.Errorf("expecting variable %s to be set to %q, but it is unset", name, value)
+	} else if got != value {
+		r.tb.Errorf("expecting variable %s to be set to %q, got %q", name, value, got)
+	}
+
+	return r
+}
+
+// ExpectUnset checks that the named variable is not set.
+func (r *Result) ExpectUnset(name string) *Result {
+	r.tb.Helper()
+
+	if got, ok := r.Var(name); ok {
+		r.tb.Errorf("expecting variable %s to be unset, got %q", name, got)
+	}
+
+	return r
+}
+
+// ExpectCalls checks the external commands that were run, each given as a
+// single string of its arguments, quoted as by 'set -x' where needed.
+func (r *Result) ExpectCalls(calls ...string) *Result {
+	r.tb.Helper()
+
+	var got []string
+
+	for _, c := range r.Calls() {
+		got = append(got, c.String())
+	}
+
+	if !slices.Equal(got, calls) {
+		r.tb.Errorf("expecting calls:\n%s\ngot:\n%s", formatCalls(calls), formatCalls(got))
+	}
+
+	return r
+}
+
+func formatCalls(calls []string) string {
+	if len(calls) == 0 {
+		return "\t(none)"
+	}
+
+	var sb strings.Builder
+
+	for n, c := range calls {
+		if n > 0 {
+			sb.WriteByte('\n')
+		}
+
+		fmt.Fprintf(&sb, "\t%s", c)
+	}
+
+	return sb.String()
+}
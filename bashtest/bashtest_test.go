@@ -0,0 +1,310 @@
+package bashtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/bash/interp"
+)
+
+type recordTB struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recordTB) Helper() {}
+
+func (r *recordTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordTB) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+
+	r.fatal = true
+
+	runtime.Goexit()
+}
+
+// run runs fn as a test with a recordTB, as Fatalf stops the goroutine it is
+// called from.
+func run(tb testing.TB, fn func(tb testing.TB)) *recordTB {
+	r := &recordTB{TB: tb}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		fn(r)
+	}()
+
+	<-done
+
+	return r
+}
+
+const script = `#!/bin/bash
+greet() {
+	local name="${1:-$DEFAULT}"
+	GREETED="$name"
+	echo "Hello, $name"
+}
+
+deploy() {
+	local rev
+	rev="$(git rev-parse HEAD)" || return 1
+	kubectl apply -f - <<< "image: app:$rev"
+	echo "deployed $rev" >&2
+}
+
+check() {
+	command -v jq > /dev/null || { echo "missing jq" >&2; return 2; }
+	read -r input
+	jq -r .name <<< "$input"
+}
+
+echo "top-level $LINENO"
+greet "$@"
+`
+
+func TestRun(t *testing.T) {
+	s := Parse(t, script)
+	s.Env = []string{"DEFAULT=world"}
+
+	s.Run("Alice").
+		ExpectStdout("top-level 21\nHello, Alice\n").
+		ExpectStderr("").
+		ExpectStatus(0).
+		ExpectVar("GREETED", "Alice").
+		ExpectCalls()
+}
+
+func TestCall(t *testing.T) {
+	s := Parse(t, script)
+	s.Env = []string{"DEFAULT=world"}
+
+	s.Call("greet").
+		ExpectStdout("Hello, world\n").
+		ExpectVar("GREETED", "world").
+		ExpectUnset("name")
+
+	var applied string
+
+	s.Stub("git", Output("abc123\n", 0)).
+		Stub("kubectl", interp.ExecFunc(func(_ context.Context, cmd *interp.Command) (int, error) {
+			data, _ := io.ReadAll(cmd.Stdin)
+			applied = string(data)
+
+			return 0, nil
+		}))
+
+	s.Call("deploy").
+		ExpectStdout("").
+		ExpectStderr("deployed abc123\n").
+		ExpectStatus(0).
+		ExpectCalls("git rev-parse HEAD", "kubectl apply -f -")
+
+	if applied != "image: app:abc123\n" {
+		t.Errorf("expecting kubectl to be given %q, got %q", "image: app:abc123\n", applied)
+	}
+
+	s.Stub("git", Status(128))
+
+	s.Call("deploy").
+		ExpectStatus(1).
+		ExpectCalls("git rev-parse HEAD")
+}
+
+func TestCallSetup(t *testing.T) {
+	s := Parse(t, `set -u
+PREFIX="${1:-app}"
+NAME="$PREFIX-$(whoami)"
+
+name() {
+	echo "$NAME"
+}
+
+unset_var() {
+	echo "$UNSET"
+}
+
+main() {
+	echo main
+}
+
+if [ -n "$PREFIX" ]; then
+	main "$@"
+fi
+`)
+
+	s.Stub("whoami", Output("user\n", 0))
+
+	s.Call("name").
+		ExpectStdout("\n").
+		ExpectCalls()
+
+	s.Setup("svc")
+
+	s.Call("name").
+		ExpectStdout("svc-user\n").
+		ExpectVar("PREFIX", "svc").
+		ExpectCalls("whoami")
+
+	s.Call("unset_var").
+		ExpectStderr("bash: line 10: UNSET: unbound variable\n").
+		ExpectStatus(1)
+
+	s.Setup().
+		Call("name").
+		ExpectStdout("app-user\n")
+}
+
+func TestCallSetupEntry(t *testing.T) {
+	s := Parse(t, `get_version() {
+	echo 1.2
+}
+
+VERSION="$(get_version)"
+trap 'echo cleanup' EXIT
+echo setup
+
+show() {
+	echo "$VERSION"
+}
+
+main() {
+	show
+	exit 1
+}
+
+main "$@"
+`).Setup()
+
+	s.Call("show").
+		ExpectStdout("1.2\ncleanup\n").
+		ExpectStatus(0)
+
+	s.Call("main").
+		ExpectStdout("1.2\ncleanup\n").
+		ExpectStatus(1)
+}
+
+func TestCallInput(t *testing.T) {
+	s := Parse(t, script)
+
+	s.Call("check").
+		ExpectStderr("missing jq\n").
+		ExpectStatus(2)
+
+	s.Stdin = "{\"name\": \"x\"}\n"
+
+	res := s.Stub("jq", Output("x\n", 0)).Call("check").ExpectStdout("x\n")
+
+	if calls := res.Calls(); len(calls) != 1 || calls[0].String() != "jq -r .name" {
+		t.Errorf("expecting one call to jq, got %v", calls)
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, io.ErrShortWrite
+}
+
+func TestOutput(t *testing.T) {
+	if status, err := Output("a", 2)(context.Background(), &interp.Command{Stdout: errWriter{}}); err != io.ErrShortWrite {
+		t.Errorf("expecting error %v, got %v", io.ErrShortWrite, err)
+	} else if status != 0 {
+		t.Errorf("expecting status 0, got %d", status)
+	}
+
+	var sb strings.Builder
+
+	if status, err := Output("a", 2)(context.Background(), &interp.Command{Stdout: &sb}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if status != 2 {
+		t.Errorf("expecting status 2, got %d", status)
+	} else if sb.String() != "a" {
+		t.Errorf("expecting output %q, got %q", "a", sb.String())
+	}
+}
+
+func TestUnstubbed(t *testing.T) {
+	Parse(t, "missing 'a b' ''; echo $?").
+		Run().
+		ExpectStdout("127\n").
+		ExpectStderr("bash: line 1: missing: command not found\n").
+		ExpectCalls("missing 'a b' ''")
+}
+
+func TestExpectFailures(t *testing.T) {
+	tb := run(t, func(tb testing.TB) {
+		Parse(tb, "x=1; echo out; echo err >&2; cmd a; exit 3").
+			Stub("cmd", Status(0)).
+			Run().
+			ExpectStdout("other\n").
+			ExpectStderr("").
+			ExpectStatus(0).
+			ExpectVar("x", "2").
+			ExpectVar("y", "").
+			ExpectUnset("x").
+			ExpectCalls("cmd b")
+	})
+
+	expected := []string{
+		"expecting stdout \"other\\n\", got \"out\\n\"",
+		"expecting stderr \"\", got \"err\\n\"",
+		"expecting status 0, got 3",
+		"expecting variable x to be set to \"2\", got \"1\"",
+		"expecting variable y to be set to \"\", but it is unset",
+		"expecting variable x to be unset, got \"1\"",
+		"expecting calls:\n\tcmd b\ngot:\n\tcmd a",
+	}
+
+	if strings.Join(tb.errors, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expecting errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(tb.errors, "\n"))
+	}
+}
+
+func TestFatal(t *testing.T) {
+	for n, test := range [...]struct {
+		Fn    func(tb testing.TB)
+		Error string
+	}{
+		{ // 1
+			Fn: func(tb testing.TB) {
+				Parse(tb, "if")
+			},
+			Error: "bashtest: script: ",
+		},
+		{ // 2
+			Fn: func(tb testing.TB) {
+				Parse(tb, "f() { :; }").Call("g")
+			},
+			Error: "bashtest: function \"g\" not defined",
+		},
+		{ // 3
+			Fn: func(tb testing.TB) {
+				Load(tb, "nonexistent.sh")
+			},
+			Error: "bashtest: open nonexistent.sh: ",
+		},
+		{ // 4
+			Fn: func(tb testing.TB) {
+				Parse(tb, "echo failed >&2; exit 3\nf() { :; }").Setup().Call("f")
+			},
+			Error: "bashtest: setup exited with status 3 before calling f: \"failed\\n\"",
+		},
+	} {
+		if tb := run(t, test.Fn); !tb.fatal {
+			t.Errorf("test %d: expecting fatal error", n+1)
+		} else if len(tb.errors) != 1 || !strings.HasPrefix(tb.errors[0], test.Error) {
+			t.Errorf("test %d: expecting error starting %q, got %q", n+1, test.Error, tb.errors)
+		}
+	}
+}
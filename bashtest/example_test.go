@@ -0,0 +1,45 @@
+package bashtest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"vimagination.zapto.org/bash/bashtest"
+)
+
+func Example() {
+	t := new(testing.T) // provided by the test function.
+
+	s := bashtest.Parse(t, `
+release() {
+	local version
+	version="$(git describe --tags)" || return 1
+	VERSION="$version"
+	echo "releasing $version"
+	gh release create "$version" --notes "$1"
+}
+
+release "$@"
+`)
+
+	s.Stub("git", bashtest.Output("v1.2.3\n", 0)).
+		Stub("gh", bashtest.Status(0))
+
+	s.Call("release", "bug fixes").
+		ExpectStdout("releasing v1.2.3\n").
+		ExpectStatus(0).
+		ExpectVar("VERSION", "v1.2.3").
+		ExpectCalls("git describe --tags", "gh release create v1.2.3 --notes 'bug fixes'")
+
+	fmt.Println(t.Failed())
+
+	s.Stub("git", bashtest.Status(128))
+
+	res := s.Call("release")
+
+	fmt.Println(res.Status(), res.Calls())
+
+	// Output:
+	// false
+	// 1 [git describe --tags]
+}
@@ -0,0 +1,315 @@
+// Package callgraph builds the graph of calls between the functions of a
+// parsed bash file, along with an inventory of the external commands it runs.
+package callgraph
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Kind represents what a Call invokes.
+type Kind uint8
+
+// Kinds.
+const (
+	CallFunction Kind = iota
+	CallBuiltin
+	CallExternal
+	CallDynamic
+)
+
+// String implements the fmt.Stringer interface.
+func (k Kind) String() string {
+	switch k {
+	case CallFunction:
+		return "function"
+	case CallBuiltin:
+		return "builtin"
+	case CallExternal:
+		return "external"
+	case CallDynamic:
+		return "dynamic"
+	}
+
+	return "unknown"
+}
+
+// Call represents a single invocation of a command.
+//
+// Caller is the function containing the Call, or nil for top-level code. Via
+// lists the wrapper commands, such as 'sudo' or 'xargs', through which the
+// command is run; each wrapper is also recorded as its own Call.
+//
+// For a CallDynamic, whose name cannot be determined, Name is empty.
+type Call struct {
+	Kind    Kind
+	Name    string
+	Caller  *Function
+	Via     []string
+	Token   *bash.Token
+	Command *bash.Command
+}
+
+// Function represents a single definition of a function, along with the calls
+// made from within it, and the calls made to it.
+type Function struct {
+	Name       string
+	Definition *bash.FunctionCompound
+	Calls      []*Call
+	Callers    []*Call
+}
+
+// Graph contains all of the Functions of a file, in definition order, and all
+// of the Calls, in source order.
+type Graph struct {
+	Functions []*Function
+	Calls     []*Call
+}
+
+// Builtins contains the names of the bash builtins and keywords that can be
+// run as commands.
+var Builtins = map[string]bool{
+	":": true, ".": true, "[": true, "alias": true, "bg": true, "bind": true, "break": true,
+	"builtin": true, "caller": true, "cd": true, "command": true, "compgen": true, "complete": true,
+	"compopt": true, "continue": true, "declare": true, "dirs": true, "disown": true, "echo": true,
+	"enable": true, "eval": true, "exec": true, "exit": true, "export": true, "false": true,
+	"fc": true, "fg": true, "getopts": true, "hash": true, "help": true, "history": true,
+	"jobs": true, "kill": true, "let": true, "local": true, "logout": true, "mapfile": true,
+	"popd": true, "printf": true, "pushd": true, "pwd": true, "read": true, "readarray": true,
+	"readonly": true, "return": true, "set": true, "shift": true, "shopt": true, "source": true,
+	"suspend": true, "test": true, "time": true, "times": true, "trap": true, "true": true,
+	"type": true, "typeset": true, "ulimit": true, "umask": true, "unalias": true, "unset": true,
+	"wait": true,
+}
+
+// Build creates the call Graph of a parsed file.
+//
+// As in bash, a command run through the 'command' builtin is never resolved to
+// a function.
+func Build(f *bash.File) *Graph {
+	g := new(Graph)
+	defs := make(map[*bash.FunctionCompound]*Function)
+	names := make(map[string]bool)
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if fc, ok := t.(*bash.FunctionCompound); ok && fc.Identifier != nil {
+			fn := &Function{Name: fc.Identifier.Data, Definition: fc}
+			defs[fc] = fn
+			names[fn.Name] = true
+			g.Functions = append(g.Functions, fn)
+		}
+
+		return true
+	})
+
+	astutil.Inspect(f, func(t bash.Type, parents []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			g.command(cmd, callerOf(defs, parents), names)
+		}
+
+		return true
+	})
+
+	slices.SortStableFunc(g.Calls, func(a, b *Call) int {
+		return cmp.Compare(a.Token.Pos, b.Token.Pos)
+	})
+
+	for _, c := range g.Calls {
+		if c.Kind == CallFunction {
+			for _, fn := range g.Functions {
+				if fn.Name == c.Name {
+					fn.Callers = append(fn.Callers, c)
+				}
+			}
+		}
+	}
+
+	return g
+}
+
+func callerOf(defs map[*bash.FunctionCompound]*Function, parents []bash.Type) *Function {
+	for n := len(parents) - 1; n >= 0; n-- {
+		if fc, ok := parents[n].(*bash.FunctionCompound); ok {
+			return defs[fc]
+		}
+	}
+
+	return nil
+}
+
+func (g *Graph) command(cmd *bash.Command, caller *Function, functions map[string]bool) {
+	words := astutil.Words(cmd)
+	if len(words) == 0 {
+		return
+	}
+
+	name, cmdWords, wrapped := astutil.Unwrap(words)
+	next := words
+
+	for n, w := range wrapped {
+		for len(next) > 0 {
+			word := next[0]
+			next = next[1:]
+
+			if lit, _ := astutil.Literal(word); lit == w {
+				g.add(cmd, caller, functions, w, wrapped[:n], word)
+
+				break
+			}
+		}
+	}
+
+	g.add(cmd, caller, functions, name, wrapped, cmdWords[0])
+
+	if name == "trap" && len(cmdWords) > 2 {
+		if handler, ok := astutil.Literal(cmdWords[1]); ok {
+			if fields := strings.Fields(handler); len(fields) > 0 && functions[fields[0]] {
+				g.add(cmd, caller, functions, fields[0], nil, cmdWords[1])
+			}
+		}
+	}
+}
+
+func (g *Graph) add(cmd *bash.Command, caller *Function, functions map[string]bool, name string, via []string, word *bash.Word) {
+	c := &Call{Name: name, Caller: caller, Via: slices.Clone(via), Command: cmd}
+
+	if c.Token = word.Parts[0].Part; c.Token == nil {
+		c.Token = &word.Parts[0].Tokens[0]
+	}
+
+	switch {
+	case name == "":
+		c.Kind = CallDynamic
+	case functions[name] && !slices.Contains(via, "command"):
+		c.Kind = CallFunction
+	case Builtins[name]:
+		c.Kind = CallBuiltin
+	default:
+		c.Kind = CallExternal
+	}
+
+	g.Calls = append(g.Calls, c)
+
+	if caller != nil {
+		caller.Calls = append(caller.Calls, c)
+	}
+}
+
+// Lookup returns the definitions of the named function.
+func (g *Graph) Lookup(name string) []*Function {
+	var fns []*Function
+
+	for _, fn := range g.Functions {
+		if fn.Name == name {
+			fns = append(fns, fn)
+		}
+	}
+
+	return fns
+}
+
+// External returns all Calls to external commands.
+func (g *Graph) External() []*Call {
+	var calls []*Call
+
+	for _, c := range g.Calls {
+		if c.Kind == CallExternal {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// Commands returns the sorted, unique names of all external commands called.
+func (g *Graph) Commands() []string {
+	var cmds []string
+
+	for _, c := range g.External() {
+		if !slices.Contains(cmds, c.Name) {
+			cmds = append(cmds, c.Name)
+		}
+	}
+
+	slices.Sort(cmds)
+
+	return cmds
+}
+
+// Reachable returns all of the functions that may be called, directly or
+// indirectly, by the top-level code of the file, in definition order.
+func (g *Graph) Reachable() []*Function {
+	var (
+		reached []*Function
+		queue   []*Call
+	)
+
+	for _, c := range g.Calls {
+		if c.Caller == nil {
+			queue = append(queue, c)
+		}
+	}
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		if c.Kind != CallFunction {
+			continue
+		}
+
+		for _, fn := range g.Lookup(c.Name) {
+			if !slices.Contains(reached, fn) {
+				reached = append(reached, fn)
+				queue = append(queue, fn.Calls...)
+			}
+		}
+	}
+
+	slices.SortFunc(reached, func(a, b *Function) int {
+		return slices.Index(g.Functions, a) - slices.Index(g.Functions, b)
+	})
+
+	return reached
+}
+
+// CommandsFrom returns the sorted, unique names of the external commands that
+// may be run, directly or through other functions, when the named function is
+// called.
+func (g *Graph) CommandsFrom(name string) []string {
+	var (
+		cmds    []string
+		visited []*Function
+		queue   = g.Lookup(name)
+	)
+
+	for len(queue) > 0 {
+		fn := queue[0]
+		queue = queue[1:]
+
+		if slices.Contains(visited, fn) {
+			continue
+		}
+
+		visited = append(visited, fn)
+
+		for _, c := range fn.Calls {
+			switch c.Kind {
+			case CallExternal:
+				if !slices.Contains(cmds, c.Name) {
+					cmds = append(cmds, c.Name)
+				}
+			case CallFunction:
+				queue = append(queue, g.Lookup(c.Name)...)
+			}
+		}
+	}
+
+	slices.Sort(cmds)
+
+	return cmds
+}
@@ -0,0 +1,159 @@
+package callgraph
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func TestBuild(t *testing.T) {
+	for n, test := range [...]struct {
+		Input string
+		Calls []string
+	}{
+		{ // 1
+			"ls -l",
+			[]string{"external ls@1:1"},
+		},
+		{ // 2
+			"echo a; cd b; [ -f c ]",
+			[]string{"builtin echo@1:1", "builtin cd@1:9", "builtin [@1:15"},
+		},
+		{ // 3
+			"f() {\n\tgit status\n}\nf",
+			[]string{"f: external git@2:2", "function f@4:1"},
+		},
+		{ // 4
+			"sudo -u root apt-get install -y curl",
+			[]string{"external sudo@1:1", "external apt-get@1:14 via sudo"},
+		},
+		{ // 5
+			"find . | xargs -0 rm",
+			[]string{"external find@1:1", "external xargs@1:10", "external rm@1:19 via xargs"},
+		},
+		{ // 6
+			"env A=1 B=2 time nice -n 5 make",
+			[]string{"external env@1:1", "builtin time@1:13 via env", "external nice@1:18 via env,time", "external make@1:28 via env,time,nice"},
+		},
+		{ // 7
+			"exec python3 app.py",
+			[]string{"builtin exec@1:1", "external python3@1:6 via exec"},
+		},
+		{ // 8
+			"command grep a b",
+			[]string{"builtin command@1:1", "external grep@1:9 via command"},
+		},
+		{ // 9
+			"$cmd a; \"$b\"",
+			[]string{"dynamic @1:1", "dynamic @1:9"},
+		},
+		{ // 10
+			"cleanup() {\n\trm -f \"$tmp\"\n}\ntrap cleanup EXIT",
+			[]string{"cleanup: external rm@2:2", "builtin trap@4:1", "function cleanup@4:6"},
+		},
+		{ // 11
+			"f() {\n\tg() {\n\t\tcurl x\n\t}\n\tg\n}",
+			[]string{"g: external curl@3:3", "f: function g@5:2"},
+		},
+		{ // 12
+			"a=$(date +%s) ls",
+			[]string{"external date@1:5", "external ls@1:15"},
+		},
+		{ // 13
+			"f() {\n\t:\n}\ncommand f",
+			[]string{"f: builtin :@2:2", "builtin command@4:1", "external f@4:9 via command"},
+		},
+		{ // 14
+			"cd() {\n\tbuiltin cd \"$@\"\n}\ncd /",
+			[]string{"cd: builtin builtin@2:2", "function cd@4:1"},
+		},
+	} {
+		var calls []string
+
+		for _, c := range Build(testutil.Parse(t, test.Input)).Calls {
+			var call strings.Builder
+
+			if c.Caller != nil {
+				call.WriteString(c.Caller.Name + ": ")
+			}
+
+			fmt.Fprintf(&call, "%s %s@%d:%d", c.Kind, c.Name, c.Token.Line+1, c.Token.LinePos+1)
+
+			if len(c.Via) > 0 {
+				call.WriteString(" via " + strings.Join(c.Via, ","))
+			}
+
+			calls = append(calls, call.String())
+		}
+
+		if !reflect.DeepEqual(calls, test.Calls) {
+			t.Errorf("test %d: expecting calls %q, got %q", n+1, test.Calls, calls)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	g := Build(testutil.Parse(t, "a() {\n\tb\n\tcurl x\n}\nb() {\n\tsudo jq .\n\ta\n}\nc() {\n\twget y\n}\nb\ncurl z | tar x"))
+
+	for n, test := range [...]struct {
+		Got, Expected []string
+	}{
+		{ // 1
+			g.Commands(),
+			[]string{"curl", "jq", "sudo", "tar", "wget"},
+		},
+		{ // 2
+			g.CommandsFrom("a"),
+			[]string{"curl", "jq", "sudo"},
+		},
+		{ // 3
+			g.CommandsFrom("c"),
+			[]string{"wget"},
+		},
+		{ // 4
+			names(g.Reachable()),
+			[]string{"a", "b"},
+		},
+		{ // 5
+			callers(g.Lookup("a")[0]),
+			[]string{"b@7:2"},
+		},
+		{ // 6
+			callers(g.Lookup("b")[0]),
+			[]string{"a@2:2", "@12:1"},
+		},
+	} {
+		if !reflect.DeepEqual(test.Got, test.Expected) {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Expected, test.Got)
+		}
+	}
+}
+
+func names(fns []*Function) []string {
+	var n []string
+
+	for _, fn := range fns {
+		n = append(n, fn.Name)
+	}
+
+	return n
+}
+
+func callers(fn *Function) []string {
+	var c []string
+
+	for _, call := range fn.Callers {
+		var name string
+
+		if call.Caller != nil {
+			name = call.Caller.Name
+		}
+
+		c = append(c, fmt.Sprintf("%s@%d:%d", name, call.Token.Line+1, call.Token.LinePos+1))
+	}
+
+	return c
+}
@@ -0,0 +1,46 @@
+package callgraph_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/callgraph"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "fetch() {\n\tcurl -fsSL \"$1\" | tar -xz\n}\n\ninstall() {\n\tfetch \"$url\"\n\tsudo make install\n}\n\ninstall\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	g := callgraph.Build(b)
+
+	for _, c := range g.Calls {
+		if c.Kind != callgraph.CallFunction {
+			continue
+		}
+
+		caller := "main"
+
+		if c.Caller != nil {
+			caller = c.Caller.Name
+		}
+
+		fmt.Printf("%s calls %s\n", caller, c.Name)
+	}
+
+	fmt.Println(g.Commands())
+	fmt.Println(g.CommandsFrom("fetch"))
+
+	// Output:
+	// install calls fetch
+	// main calls install
+	// [curl make sudo tar]
+	// [curl tar]
+}
@@ -0,0 +1,762 @@
+// Package cfg builds control-flow graphs of parsed bash files.
+package cfg
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// EdgeKind represents the reason control passes from one Block to another.
+type EdgeKind uint8
+
+// Edge Kinds.
+const (
+	EdgeNext EdgeKind = iota
+	EdgeTrue
+	EdgeFalse
+	EdgeMatch
+	EdgeNoMatch
+	EdgeFallthrough
+	EdgeLoop
+	EdgeBreak
+	EdgeContinue
+	EdgeReturn
+	EdgeExit
+)
+
+var edgeNames = [...]string{
+	EdgeNext:        "next",
+	EdgeTrue:        "true",
+	EdgeFalse:       "false",
+	EdgeMatch:       "match",
+	EdgeNoMatch:     "nomatch",
+	EdgeFallthrough: "fallthrough",
+	EdgeLoop:        "loop",
+	EdgeBreak:       "break",
+	EdgeContinue:    "continue",
+	EdgeReturn:      "return",
+	EdgeExit:        "exit",
+}
+
+// String implements the fmt.Stringer interface.
+func (e EdgeKind) String() string {
+	if int(e) < len(edgeNames) {
+		return edgeNames[e]
+	}
+
+	return "unknown"
+}
+
+// Edge is a directed connection to a Block.
+type Edge struct {
+	Kind EdgeKind
+	To   *Block
+}
+
+// Block is a basic block; a sequence of nodes that are always run in order.
+//
+// Each node is one of the following:
+//
+//	*bash.Pipeline       A pipeline that is run as a single unit.
+//	*bash.Statement      A statement run in the background.
+//	*bash.ForCompound    The header of a for loop, which either selects the next value or leaves the loop.
+//	*bash.SelectCompound The header of a select loop.
+//	*bash.CaseCompound   The expansion of the word to be matched by a case statement.
+//	*bash.PatternLines   The patterns of a case arm, tested against the case word.
+type Block struct {
+	ID    int
+	Nodes []bash.Type
+	Succs []Edge
+	Preds []*Block
+}
+
+// Kind represents what code a Graph represents.
+type Kind uint8
+
+// Graph Kinds.
+const (
+	KindFile Kind = iota
+	KindFunction
+	KindSubshell
+	KindSubstitution
+)
+
+// String implements the fmt.Stringer interface.
+func (k Kind) String() string {
+	switch k {
+	case KindFile:
+		return "file"
+	case KindFunction:
+		return "function"
+	case KindSubshell:
+		return "subshell"
+	case KindSubstitution:
+		return "substitution"
+	}
+
+	return "unknown"
+}
+
+// Graph is the control-flow graph of a single unit of code.
+//
+// The Node of the Graph is the AST node from which it was built, which will be
+// one of the following:
+//
+//	*bash.File                For KindFile.
+//	*bash.FunctionCompound    For KindFunction.
+//	*bash.GroupingCompound    For a KindSubshell created with parentheses.
+//	*bash.Statement           For a KindSubshell created by running a statement in the background.
+//	*bash.Pipeline            For a KindSubshell created for a compound element of a multi-command pipeline.
+//	*bash.CommandSubstitution For KindSubstitution.
+//
+// Every Graph starts at the Entry Block and finishes at the Exit Block, which
+// contains no nodes.
+type Graph struct {
+	Kind   Kind
+	Node   bash.Type
+	Entry  *Block
+	Exit   *Block
+	Blocks []*Block
+}
+
+// Program contains the Graphs of a file; Main is the Graph of the top-level
+// code, and Graphs contains every Graph, including Main, in the order they
+// were found.
+type Program struct {
+	Main   *Graph
+	Graphs []*Graph
+	graphs map[bash.Type]*Graph
+}
+
+// Build creates the control-flow Graphs for a parsed file, with separate
+// Graphs for each function, subshell, and command substitution.
+func Build(f *bash.File) *Program {
+	p := &Program{graphs: make(map[bash.Type]*Graph)}
+	p.Main = p.build(KindFile, f, func(b *builder) { b.file(f) })
+
+	return p
+}
+
+// Graph returns the Graph built for the given AST node, or nil if no Graph
+// was built for it.
+func (p *Program) Graph(node bash.Type) *Graph {
+	return p.graphs[node]
+}
+
+func (p *Program) build(kind Kind, node bash.Type, fn func(*builder)) *Graph {
+	g := &Graph{Kind: kind, Node: node}
+	p.graphs[node] = g
+	p.Graphs = append(p.Graphs, g)
+	b := &builder{program: p, graph: g}
+	g.Entry = b.newBlock()
+	b.current = g.Entry
+	g.Exit = new(Block)
+
+	fn(b)
+	b.edge(b.current, g.Exit, EdgeNext)
+
+	g.Blocks = append(g.Blocks, g.Exit)
+
+	g.simplify()
+
+	return g
+}
+
+type loop struct {
+	continueTo, breakTo *Block
+}
+
+type builder struct {
+	program *Program
+	graph   *Graph
+	current *Block
+	loops   []loop
+}
+
+func (b *builder) newBlock() *Block {
+	bl := new(Block)
+	b.graph.Blocks = append(b.graph.Blocks, bl)
+
+	return bl
+}
+
+func (b *builder) edge(from, to *Block, kind EdgeKind) {
+	from.Succs = append(from.Succs, Edge{Kind: kind, To: to})
+	to.Preds = append(to.Preds, from)
+}
+
+func (b *builder) branch(t, f *Block) {
+	if t == f {
+		b.edge(b.current, t, EdgeNext)
+	} else {
+		b.edge(b.current, t, EdgeTrue)
+		b.edge(b.current, f, EdgeFalse)
+	}
+}
+
+func (b *builder) add(node bash.Type) {
+	b.current.Nodes = append(b.current.Nodes, node)
+}
+
+// jump ends the current block with an edge to the given block, leaving the
+// following code in a new, unreachable, block.
+func (b *builder) jump(to *Block, kind EdgeKind) {
+	b.edge(b.current, to, kind)
+
+	b.current = b.newBlock()
+}
+
+func (b *builder) file(f *bash.File) {
+	for n := range f.Lines {
+		for m := range f.Lines[n].Statements {
+			after := b.newBlock()
+
+			b.statement(&f.Lines[n].Statements[m], after, after)
+
+			b.current = after
+		}
+	}
+}
+
+// statement builds the statement chain, ending with a branch to t if it
+// succeeds, or to f if it fails.
+//
+// As with the exit status, the success of a pipeline takes into account any
+// '!' negation.
+func (b *builder) statement(s *bash.Statement, t, f *Block) {
+	if s.JobControl == bash.JobControlBackground {
+		b.add(s)
+		b.program.build(KindSubshell, s, func(sb *builder) {
+			fg := *s
+			fg.JobControl = bash.JobControlForeground
+
+			sb.statement(&fg, sb.graph.Exit, sb.graph.Exit)
+
+			sb.current = sb.newBlock()
+		})
+		b.edge(b.current, t, EdgeNext)
+
+		return
+	}
+
+	var (
+		pipelines []*bash.Pipeline
+		ops       []bash.LogicalOperator
+	)
+
+	for st := s; st != nil; st = st.Statement {
+		pipelines = append(pipelines, &st.Pipeline)
+		ops = append(ops, st.LogicalOperator)
+	}
+
+	starts := make([]*Block, len(pipelines))
+
+	for n := 1; n < len(starts); n++ {
+		starts[n] = b.newBlock()
+	}
+
+	for n, p := range pipelines {
+		if n > 0 {
+			b.current = starts[n]
+		}
+
+		b.pipeline(p)
+
+		if n == len(pipelines)-1 {
+			b.branch(t, f)
+
+			continue
+		}
+
+		next, skip := starts[n+1], t
+
+		if ops[n] == bash.LogicalOperatorAnd {
+			skip = f
+		}
+
+		for m := n + 1; m < len(ops)-1; m++ {
+			if ops[m] != ops[n] {
+				skip = starts[m+1]
+
+				break
+			}
+		}
+
+		if ops[n] == bash.LogicalOperatorAnd {
+			b.branch(next, skip)
+		} else {
+			b.branch(skip, next)
+		}
+	}
+}
+
+func (b *builder) pipeline(p *bash.Pipeline) {
+	if p.Pipeline != nil || p.Coproc {
+		b.add(p)
+
+		for e := p; e != nil; e = e.Pipeline {
+			if e.CommandOrCompound.Compound != nil {
+				b.program.build(KindSubshell, e, func(sb *builder) {
+					sb.compound(e, e.CommandOrCompound.Compound)
+				})
+			} else if e.CommandOrCompound.Command != nil {
+				b.nested(e.CommandOrCompound.Command)
+			}
+		}
+
+		return
+	}
+
+	if c := p.CommandOrCompound.Command; c != nil {
+		b.add(p)
+		b.nested(c)
+		b.command(c)
+	} else if c := p.CommandOrCompound.Compound; c != nil {
+		b.compound(p, c)
+	}
+}
+
+func (b *builder) command(c *bash.Command) {
+	words := astutil.Words(c)
+	if len(words) == 0 {
+		return
+	}
+
+	if _, _, wrapped := astutil.Unwrap(words); len(wrapped) > 0 && wrapped[0] == "exec" {
+		b.jump(b.graph.Exit, EdgeExit)
+
+		return
+	}
+
+	switch name, _ := astutil.Literal(words[0]); name {
+	case "exit":
+		b.jump(b.graph.Exit, EdgeExit)
+	case "return":
+		b.jump(b.graph.Exit, EdgeReturn)
+	case "break", "continue":
+		if len(b.loops) == 0 {
+			return
+		}
+
+		level := 1
+
+		if len(words) > 1 {
+			if arg, ok := astutil.Literal(words[1]); ok {
+				if l, err := strconv.Atoi(arg); err == nil && l > 0 {
+					level = l
+				}
+			}
+		}
+
+		l := b.loops[max(len(b.loops)-level, 0)]
+
+		if name == "break" {
+			b.jump(l.breakTo, EdgeBreak)
+		} else {
+			b.jump(l.continueTo, EdgeContinue)
+		}
+	}
+}
+
+func (b *builder) compound(p *bash.Pipeline, c *bash.Compound) {
+	for n := range c.Redirections {
+		b.nested(&c.Redirections[n])
+	}
+
+	switch {
+	case c.IfCompound != nil:
+		b.ifCompound(c.IfCompound)
+	case c.CaseCompound != nil:
+		b.caseCompound(c.CaseCompound)
+	case c.LoopCompound != nil:
+		b.loopCompound(c.LoopCompound)
+	case c.ForCompound != nil:
+		if c.ForCompound.ArithmeticExpansion != nil {
+			b.nested(c.ForCompound.ArithmeticExpansion)
+		}
+
+		for n := range c.ForCompound.Words {
+			b.nested(&c.ForCompound.Words[n])
+		}
+
+		b.iterate(c.ForCompound, &c.ForCompound.File)
+	case c.SelectCompound != nil:
+		for n := range c.SelectCompound.Words {
+			b.nested(&c.SelectCompound.Words[n])
+		}
+
+		b.iterate(c.SelectCompound, &c.SelectCompound.File)
+	case c.GroupingCompound != nil:
+		if c.GroupingCompound.SubShell {
+			b.add(p)
+			b.program.build(KindSubshell, c.GroupingCompound, func(sb *builder) {
+				sb.file(&c.GroupingCompound.File)
+			})
+		} else {
+			b.file(&c.GroupingCompound.File)
+		}
+	case c.FunctionCompound != nil:
+		b.add(p)
+		b.program.build(KindFunction, c.FunctionCompound, func(sb *builder) {
+			if body := &c.FunctionCompound.Body; body.GroupingCompound != nil {
+				sb.file(&body.GroupingCompound.File)
+			} else {
+				sb.compound(&bash.Pipeline{CommandOrCompound: bash.CommandOrCompound{Compound: body}}, body)
+			}
+		})
+	case c.TestCompound != nil:
+		b.add(p)
+		b.nested(c.TestCompound)
+	case c.ArithmeticCompound != nil:
+		b.add(p)
+		b.nested(c.ArithmeticCompound)
+	}
+}
+
+func (b *builder) ifCompound(i *bash.IfCompound) {
+	after := b.newBlock()
+
+	for _, tc := range append([]*bash.TestConsequence{&i.If}, pointers(i.ElIf)...) {
+		then, next := b.newBlock(), b.newBlock()
+
+		b.statement(&tc.Test, then, next)
+
+		b.current = then
+
+		b.file(&tc.Consequence)
+		b.edge(b.current, after, EdgeNext)
+
+		b.current = next
+	}
+
+	if i.Else != nil {
+		b.file(i.Else)
+	}
+
+	b.edge(b.current, after, EdgeNext)
+
+	b.current = after
+}
+
+func pointers[T any](s []T) []*T {
+	p := make([]*T, len(s))
+
+	for n := range s {
+		p[n] = &s[n]
+	}
+
+	return p
+}
+
+func (b *builder) caseCompound(c *bash.CaseCompound) {
+	b.add(c)
+	b.nested(&c.Word)
+
+	if len(c.Matches) == 0 {
+		return
+	}
+
+	after := b.newBlock()
+	tests := make([]*Block, len(c.Matches)+1)
+	bodies := make([]*Block, len(c.Matches)+1)
+	tests[0] = b.current
+	tests[len(c.Matches)] = after
+	bodies[len(c.Matches)] = after
+
+	for n := range c.Matches {
+		if n > 0 {
+			tests[n] = b.newBlock()
+		}
+
+		bodies[n] = b.newBlock()
+	}
+
+	for n := range c.Matches {
+		pl := &c.Matches[n]
+		b.current = tests[n]
+
+		b.add(pl)
+
+		for m := range pl.Patterns {
+			b.nested(&pl.Patterns[m])
+		}
+
+		b.edge(b.current, bodies[n], EdgeMatch)
+
+		if !matchesAll(pl) {
+			b.edge(b.current, tests[n+1], EdgeNoMatch)
+		}
+
+		b.current = bodies[n]
+
+		b.file(&pl.Lines)
+
+		switch pl.CaseTerminationType {
+		case bash.CaseTerminationContinue: // ;&
+			b.edge(b.current, bodies[n+1], EdgeFallthrough)
+		case bash.CaseTerminationFallthrough: // ;;&
+			b.edge(b.current, tests[n+1], EdgeFallthrough)
+		default:
+			b.edge(b.current, after, EdgeNext)
+		}
+	}
+
+	b.current = after
+}
+
+func matchesAll(pl *bash.PatternLines) bool {
+	for _, p := range pl.Patterns {
+		if len(p.Parts) == 1 && p.Parts[0].Part != nil && p.Parts[0].Part.Data == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *builder) loopCompound(l *bash.LoopCompound) {
+	cond, body, after := b.newBlock(), b.newBlock(), b.newBlock()
+
+	b.edge(b.current, cond, EdgeNext)
+
+	b.current = cond
+
+	if l.Until {
+		b.statement(&l.Statement, after, body)
+	} else {
+		b.statement(&l.Statement, body, after)
+	}
+
+	b.body(&l.File, body, cond, after)
+}
+
+func (b *builder) iterate(header bash.Type, f *bash.File) {
+	head, body, after := b.newBlock(), b.newBlock(), b.newBlock()
+
+	b.edge(b.current, head, EdgeNext)
+
+	b.current = head
+
+	b.add(header)
+	b.edge(head, body, EdgeTrue)
+	b.edge(head, after, EdgeFalse)
+	b.body(f, body, head, after)
+}
+
+func (b *builder) body(f *bash.File, body, cond, after *Block) {
+	b.loops = append(b.loops, loop{continueTo: cond, breakTo: after})
+	b.current = body
+
+	b.file(f)
+	b.edge(b.current, cond, EdgeLoop)
+
+	b.loops = b.loops[:len(b.loops)-1]
+	b.current = after
+}
+
+// nested builds the Graphs of the command substitutions contained within the
+// given node.
+func (b *builder) nested(t bash.Type) {
+	astutil.Inspect(t, func(t bash.Type, _ []bash.Type) bool {
+		if cs, ok := t.(*bash.CommandSubstitution); ok {
+			b.program.build(KindSubstitution, cs, func(sb *builder) {
+				sb.file(&cs.Command)
+			})
+
+			return false
+		}
+
+		return true
+	})
+}
+
+// simplify removes empty blocks that unconditionally continue to another
+// block, merges blocks that always follow one another, and drops empty,
+// unreachable blocks, before renumbering the remaining blocks.
+func (g *Graph) simplify() {
+	for changed := true; changed; {
+		changed = false
+
+		for _, bl := range g.Blocks {
+			if bl == g.Exit || bl.ID < 0 {
+				continue
+			}
+
+			empty := len(bl.Nodes) == 0 && bl != g.Entry
+
+			if empty && len(bl.Succs) == 1 && bl.Succs[0].Kind == EdgeNext && bl.Succs[0].To != bl {
+				g.bypass(bl)
+
+				changed = true
+			} else if empty && len(bl.Preds) == 0 {
+				g.remove(bl)
+
+				changed = true
+			} else if len(bl.Succs) == 1 && bl.Succs[0].Kind == EdgeNext {
+				if next := bl.Succs[0].To; next != g.Exit && next != g.Entry && next != bl && len(next.Preds) == 1 {
+					g.merge(bl, next)
+
+					changed = true
+				}
+			}
+		}
+	}
+
+	g.Blocks = slices.DeleteFunc(g.Blocks, func(bl *Block) bool { return bl.ID < 0 })
+
+	g.order()
+}
+
+// order sorts the blocks into source order, keeping the Entry Block first and
+// the Exit Block last, and numbers them.
+//
+// A block without nodes is placed after the last of its predecessors.
+func (g *Graph) order() {
+	keys := make(map[*Block]int64, len(g.Blocks))
+
+	var key func(*Block) int64
+
+	key = func(bl *Block) int64 {
+		if k, ok := keys[bl]; ok {
+			return k
+		}
+
+		keys[bl] = -1
+
+		var k int64 = -1
+
+		if len(bl.Nodes) > 0 {
+			k = 2 * int64(position(bl.Nodes[0]))
+		} else if bl != g.Entry {
+			for _, p := range bl.Preds {
+				k = max(k, key(p)+1)
+			}
+		}
+
+		keys[bl] = k
+
+		return k
+	}
+
+	keys[g.Exit] = math.MaxInt64
+
+	slices.SortStableFunc(g.Blocks, func(a, b *Block) int {
+		if a == g.Entry {
+			return -1
+		} else if b == g.Entry {
+			return 1
+		}
+
+		return cmp.Compare(key(a), key(b))
+	})
+
+	for n, bl := range g.Blocks {
+		bl.ID = n
+	}
+}
+
+func position(t bash.Type) uint64 {
+	var tks bash.Tokens
+
+	switch t := t.(type) {
+	case *bash.Pipeline:
+		tks = t.Tokens
+	case *bash.Statement:
+		tks = t.Tokens
+	case *bash.ForCompound:
+		tks = t.Tokens
+	case *bash.SelectCompound:
+		tks = t.Tokens
+	case *bash.CaseCompound:
+		tks = t.Tokens
+	case *bash.PatternLines:
+		tks = t.Tokens
+	}
+
+	if len(tks) == 0 {
+		return 0
+	}
+
+	return tks[0].Pos
+}
+
+func (g *Graph) bypass(bl *Block) {
+	to := bl.Succs[0].To
+	to.Preds = slices.DeleteFunc(to.Preds, func(p *Block) bool { return p == bl })
+
+	for _, p := range bl.Preds {
+		for n := range p.Succs {
+			if p.Succs[n].To == bl {
+				p.Succs[n].To = to
+				to.Preds = append(to.Preds, p)
+			}
+		}
+	}
+
+	bl.Preds = nil
+	bl.Succs = nil
+	bl.ID = -1
+}
+
+func (g *Graph) remove(bl *Block) {
+	for _, s := range bl.Succs {
+		s.To.Preds = slices.DeleteFunc(s.To.Preds, func(p *Block) bool { return p == bl })
+	}
+
+	bl.Succs = nil
+	bl.ID = -1
+}
+
+func (g *Graph) merge(bl, next *Block) {
+	bl.Nodes = append(bl.Nodes, next.Nodes...)
+	bl.Succs = next.Succs
+
+	for _, s := range next.Succs {
+		for n, p := range s.To.Preds {
+			if p == next {
+				s.To.Preds[n] = bl
+			}
+		}
+	}
+
+	next.Nodes = nil
+	next.Preds = nil
+	next.Succs = nil
+	next.ID = -1
+}
+
+// Reachable returns the Blocks that can be reached from the Entry Block, in
+// order.
+func (g *Graph) Reachable() []*Block {
+	seen := map[*Block]bool{g.Entry: true}
+	queue := []*Block{g.Entry}
+
+	for len(queue) > 0 {
+		bl := queue[0]
+		queue = queue[1:]
+
+		for _, s := range bl.Succs {
+			if !seen[s.To] {
+				seen[s.To] = true
+				queue = append(queue, s.To)
+			}
+		}
+	}
+
+	return slices.DeleteFunc(slices.Clone(g.Blocks), func(bl *Block) bool { return !seen[bl] })
+}
+
+// Unreachable returns the Blocks containing nodes that can never be run, in
+// order.
+func (g *Graph) Unreachable() []*Block {
+	reachable := g.Reachable()
+
+	return slices.DeleteFunc(slices.Clone(g.Blocks), func(bl *Block) bool {
+		return len(bl.Nodes) == 0 || slices.Contains(reachable, bl)
+	})
+}
@@ -0,0 +1,218 @@
+package cfg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func describe(t bash.Type) string {
+	switch t := t.(type) {
+	case *bash.Pipeline:
+		return fmt.Sprintf("%s", *t)
+	case *bash.Statement:
+		return fmt.Sprintf("%s", *t)
+	case *bash.ForCompound:
+		if t.Identifier != nil {
+			return "for " + t.Identifier.Data
+		}
+
+		return "for (())"
+	case *bash.SelectCompound:
+		return "select " + t.Identifier.Data
+	case *bash.CaseCompound:
+		return fmt.Sprintf("case %s", t.Word)
+	case *bash.PatternLines:
+		var patterns []string
+
+		for _, p := range t.Patterns {
+			patterns = append(patterns, fmt.Sprintf("%s", p))
+		}
+
+		return strings.Join(patterns, "|") + ")"
+	}
+
+	return fmt.Sprintf("%T", t)
+}
+
+func dump(g *Graph) []string {
+	var blocks []string
+
+	for _, bl := range g.Blocks {
+		var (
+			nodes []string
+			succs []string
+		)
+
+		for _, n := range bl.Nodes {
+			nodes = append(nodes, describe(n))
+		}
+
+		for _, s := range bl.Succs {
+			succs = append(succs, fmt.Sprintf("%s:%d", s.Kind, s.To.ID))
+		}
+
+		block := fmt.Sprintf("%d: %s", bl.ID, strings.Join(nodes, "; "))
+
+		if len(succs) > 0 {
+			block += " -> " + strings.Join(succs, " ")
+		}
+
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+func TestBuild(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Blocks []string
+	}{
+		{ // 1
+			"a\nb; c",
+			[]string{"0: a; b; c -> next:1", "1: "},
+		},
+		{ // 2
+			"a && b\nc",
+			[]string{"0: a -> true:1 false:2", "1: b -> next:2", "2: c -> next:3", "3: "},
+		},
+		{ // 3
+			"a || b && c\nd",
+			[]string{"0: a -> true:2 false:1", "1: b -> true:2 false:3", "2: c -> next:3", "3: d -> next:4", "4: "},
+		},
+		{ // 4
+			"a && b || c\nd",
+			[]string{"0: a -> true:1 false:2", "1: b -> true:3 false:2", "2: c -> next:3", "3: d -> next:4", "4: "},
+		},
+		{ // 5
+			"! a && b",
+			[]string{"0: ! a -> true:1 false:2", "1: b -> next:2", "2: "},
+		},
+		{ // 6
+			"if a; then\n\tb\nelif c; then\n\td\nelse\n\te\nfi\nf",
+			[]string{"0: a -> true:1 false:2", "1: b -> next:5", "2: c -> true:3 false:4", "3: d -> next:5", "4: e -> next:5", "5: f -> next:6", "6: "},
+		},
+		{ // 7
+			"if a && b; then\n\tc\nfi",
+			[]string{"0: a -> true:1 false:3", "1: b -> true:2 false:3", "2: c -> next:3", "3: "},
+		},
+		{ // 8
+			"while a; do\n\tb\ndone\nc",
+			[]string{"0:  -> next:1", "1: a -> true:2 false:3", "2: b -> loop:1", "3: c -> next:4", "4: "},
+		},
+		{ // 9
+			"until a; do\n\tb\ndone",
+			[]string{"0:  -> next:1", "1: a -> true:3 false:2", "2: b -> loop:1", "3: "},
+		},
+		{ // 10
+			"for i in a b; do\n\tc\ndone",
+			[]string{"0:  -> next:1", "1: for i -> true:2 false:3", "2: c -> loop:1", "3: "},
+		},
+		{ // 11
+			"for i in a b; do\n\tif c; then\n\t\tbreak\n\tfi\n\tcontinue\n\td\ndone\ne",
+			[]string{"0:  -> next:1", "1: for i -> true:2 false:6", "2: c -> true:3 false:4", "3: break -> break:6", "4: continue -> continue:1", "5: d -> loop:1", "6: e -> next:7", "7: "},
+		},
+		{ // 12
+			"while a; do\n\tfor i in b; do\n\t\tbreak 2\n\t\tcontinue 2\n\tdone\ndone",
+			[]string{"0:  -> next:1", "1: a -> true:2 false:6", "2: for i -> true:4 false:3", "3:  -> loop:1", "4: break 2 -> break:6", "5: continue 2 -> continue:1", "6: "},
+		},
+		{ // 13
+			"case $a in\nx) b;;\ny) c;&\nz) d;;&\n*) e;;\nesac\nf",
+			[]string{"0: case $a; x) -> match:1 nomatch:2", "1: b -> next:8", "2: y) -> match:3 nomatch:4", "3: c -> fallthrough:5", "4: z) -> match:5 nomatch:6", "5: d -> fallthrough:6", "6: *) -> match:7", "7: e -> next:8", "8: f -> next:9", "9: "},
+		},
+		{ // 14
+			"a\nexit 1\nb",
+			[]string{"0: a; exit 1 -> exit:2", "1: b -> next:2", "2: "},
+		},
+		{ // 15
+			"a\nexec b\nc",
+			[]string{"0: a; exec b -> exit:2", "1: c -> next:2", "2: "},
+		},
+		{ // 16
+			"exec >log\na",
+			[]string{"0: exec >log; a -> next:1", "1: "},
+		},
+		{ // 17
+			"{ a; b; }\nc",
+			[]string{"0: a; b; c -> next:1", "1: "},
+		},
+		{ // 18
+			"(exit 1)\na",
+			[]string{"0: ( exit 1; ); a -> next:1", "1: "},
+		},
+		{ // 19
+			"f() {\n\treturn\n}\nf",
+			[]string{"0: f() { return; }; f -> next:1", "1: "},
+		},
+		{ // 20
+			"a | while b; do exit; done\nc",
+			[]string{"0: a | while b; do\n\texit;\ndone; c -> next:1", "1: "},
+		},
+		{ // 21
+			"a && b &\nc",
+			[]string{"0: a && b&; c -> next:1", "1: "},
+		},
+	} {
+		if blocks := dump(Build(testutil.Parse(t, test.Input)).Main); !reflect.DeepEqual(blocks, test.Blocks) {
+			t.Errorf("test %d: expecting blocks %q, got %q", n+1, test.Blocks, blocks)
+		}
+	}
+}
+
+func TestProgram(t *testing.T) {
+	p := Build(testutil.Parse(t, "f() {\n\ta || return\n\tb\n}\n(exit; c)\nx=$(d; exit)\ne | { exit; }\ng && h &"))
+
+	var graphs [][]string
+
+	for _, g := range p.Graphs {
+		graphs = append(graphs, append([]string{g.Kind.String()}, dump(g)...))
+	}
+
+	expected := [][]string{
+		{"file", "0: f() {\n\ta || return;\n\tb;\n}; ( exit; c; ); x=$(d; exit;); e | { exit; }; g && h& -> next:1", "1: "},
+		{"function", "0: a -> true:2 false:1", "1: return -> return:3", "2: b -> next:3", "3: "},
+		{"subshell", "0: exit -> exit:2", "1: c -> next:2", "2: "},
+		{"substitution", "0: d; exit -> exit:1", "1: "},
+		{"subshell", "0: exit -> exit:1", "1: "},
+		{"subshell", "0: g -> true:1 false:2", "1: h -> next:2", "2: "},
+	}
+
+	if !reflect.DeepEqual(graphs, expected) {
+		t.Errorf("expecting graphs %q, got %q", expected, graphs)
+	}
+
+	for n, test := range [...]struct {
+		Node        bash.Type
+		Unreachable []string
+	}{
+		{ // 1
+			p.Main.Node,
+			nil,
+		},
+		{ // 2
+			p.Graphs[1].Node,
+			nil,
+		},
+		{ // 3
+			p.Graphs[2].Node,
+			[]string{"c"},
+		},
+	} {
+		var unreachable []string
+
+		for _, bl := range p.Graph(test.Node).Unreachable() {
+			for _, node := range bl.Nodes {
+				unreachable = append(unreachable, describe(node))
+			}
+		}
+
+		if !reflect.DeepEqual(unreachable, test.Unreachable) {
+			t.Errorf("test %d: expecting unreachable nodes %q, got %q", n+1, test.Unreachable, unreachable)
+		}
+	}
+}
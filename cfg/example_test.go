@@ -0,0 +1,50 @@
+package cfg_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/cfg"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "for f in *.txt; do\n\tif [ -s \"$f\" ]; then\n\t\tcontinue\n\t\techo never\n\tfi\n\n\trm \"$f\"\ndone\n\nexit 0\necho done\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	g := cfg.Build(b).Main
+
+	for _, bl := range g.Blocks {
+		fmt.Printf("block %d:", bl.ID)
+
+		for _, s := range bl.Succs {
+			fmt.Printf(" %s->%d", s.Kind, s.To.ID)
+		}
+
+		fmt.Println()
+	}
+
+	for _, bl := range g.Unreachable() {
+		fmt.Printf("unreachable: block %d (%d nodes)\n", bl.ID, len(bl.Nodes))
+	}
+
+	// Output:
+	// block 0: next->1
+	// block 1: true->2 false->6
+	// block 2: true->3 false->5
+	// block 3: continue->1
+	// block 4: next->5
+	// block 5: loop->1
+	// block 6: exit->8
+	// block 7: next->8
+	// block 8:
+	// unreachable: block 4 (1 nodes)
+	// unreachable: block 7 (1 nodes)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/dryrun"
+	"vimagination.zapto.org/parser"
+)
+
+var (
+	errUnknownFormat = errors.New("unknown format")
+	errNoScript      = errors.New("no script given")
+	errInvalidEnv    = errors.New("invalid environment variable; expecting NAME=VALUE")
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		format  string
+		inherit bool
+		t       dryrun.Tracer
+	)
+
+	flag.StringVar(&format, "f", "text", "output format: text, json")
+	flag.BoolVar(&inherit, "E", false, "pass the environment of this program to the script")
+	flag.Func("e", "set an environment variable for the script, as NAME=VALUE; can be repeated", func(v string) error {
+		if !strings.Contains(v, "=") {
+			return errInvalidEnv
+		}
+
+		t.Env = append(t.Env, v)
+
+		return nil
+	})
+	flag.Func("s", "give the named environment variable an unknown value; can be repeated", func(v string) error {
+		t.Symbolic = append(t.Symbolic, v)
+
+		return nil
+	})
+	flag.Parse()
+
+	if format != "text" && format != "json" {
+		return fmt.Errorf("%w: %s", errUnknownFormat, format)
+	} else if flag.NArg() == 0 {
+		return errNoScript
+	}
+
+	if inherit {
+		t.Env = append(os.Environ(), t.Env...)
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	f, err := parseFile(flag.Arg(0))
+	if err != nil {
+		return fmt.Errorf("%s: %w", flag.Arg(0), err)
+	}
+
+	t.Args = flag.Args()[1:]
+	t.Dir = dir
+	t.Stderr = os.Stderr
+
+	trace, err := t.Run(context.Background(), f)
+	if err != nil {
+		return err
+	}
+
+	return write(os.Stdout, format, trace)
+}
+
+func parseFile(name string) (*bash.File, error) {
+	var r io.Reader = os.Stdin
+
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	tk := parser.NewReaderTokeniser(r)
+
+	return bash.Parse(bash.SetTokeniser(&tk))
+}
+
+func write(w io.Writer, format string, trace *dryrun.Trace) error {
+	if format == "json" {
+		if trace.Commands == nil {
+			trace.Commands = []dryrun.Command{}
+		}
+
+		if trace.Branches == nil {
+			trace.Branches = []dryrun.Branch{}
+		}
+
+		enc := json.NewEncoder(w)
+
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(trace)
+	}
+
+	if _, err := trace.WriteTo(w); err != nil {
+		return err
+	}
+
+	if trace.Status != 0 {
+		_, err := fmt.Fprintf(w, "# exit status %d\n", trace.Status)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/env"
+	"vimagination.zapto.org/parser"
+)
+
+var (
+	errReported      = errors.New("problems reported")
+	errUnknownFormat = errors.New("unknown format")
+)
+
+func main() {
+	if err := run(); err != nil {
+		if err != errReported {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		os.Exit(1)
+	}
+}
+
+type file struct {
+	Path string `json:"file"`
+	*env.Contract
+}
+
+func run() error {
+	var format string
+
+	flag.StringVar(&format, "f", "markdown", "output format: markdown, json")
+	flag.Parse()
+
+	if format != "markdown" && format != "json" {
+		return fmt.Errorf("%w: %s", errUnknownFormat, format)
+	}
+
+	var (
+		results []file
+		failed  bool
+	)
+
+	files := flag.Args()
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	for _, name := range files {
+		c, err := extractFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+
+			failed = true
+
+			continue
+		}
+
+		results = append(results, file{Path: name, Contract: c})
+	}
+
+	if err := write(os.Stdout, format, results); err != nil {
+		return err
+	}
+
+	if failed {
+		return errReported
+	}
+
+	return nil
+}
+
+func extractFile(name string) (*env.Contract, error) {
+	var r io.Reader = os.Stdin
+
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	tk := parser.NewReaderTokeniser(r)
+
+	b, err := bash.Parse(bash.SetTokeniser(&tk))
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Extract(b), nil
+}
+
+func write(w io.Writer, format string, results []file) error {
+	if format == "json" {
+		if results == nil {
+			results = []file{}
+		}
+
+		for n := range results {
+			if results[n].Inputs == nil {
+				results[n].Inputs = []env.Input{}
+			}
+
+			if results[n].Exports == nil {
+				results[n].Exports = []env.Export{}
+			}
+		}
+
+		enc := json.NewEncoder(w)
+
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(results)
+	}
+
+	var sb strings.Builder
+
+	for n, r := range results {
+		if n > 0 {
+			sb.WriteString("\n")
+		}
+
+		writeMarkdown(&sb, r)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+func writeMarkdown(sb *strings.Builder, r file) {
+	fmt.Fprintf(sb, "# %s\n\n## Inputs\n\n", r.Path)
+
+	if len(r.Inputs) == 0 {
+		sb.WriteString("None.\n")
+	} else {
+		sb.WriteString("| Name | Required | Default | Line |\n| --- | --- | --- | --- |\n")
+
+		for _, in := range r.Inputs {
+			required := "no"
+
+			if in.Required {
+				required = "yes"
+
+				if in.Message != "" {
+					required += ": " + escape(in.Message)
+				}
+			}
+
+			defaults := make([]string, len(in.Defaults))
+
+			for n, d := range in.Defaults {
+				defaults[n] = code(d)
+			}
+
+			fmt.Fprintf(sb, "| %s | %s | %s | %d |\n", code(in.Name), required, strings.Join(defaults, ", "), in.Line)
+		}
+	}
+
+	sb.WriteString("\n## Exports\n\n")
+
+	if len(r.Exports) == 0 {
+		sb.WriteString("None.\n")
+	} else {
+		sb.WriteString("| Name | Commands | Line |\n| --- | --- | --- |\n")
+
+		for _, ex := range r.Exports {
+			commands := "all"
+
+			if len(ex.Commands) > 0 {
+				cmds := make([]string, len(ex.Commands))
+
+				for n, c := range ex.Commands {
+					cmds[n] = code(c)
+				}
+
+				commands = strings.Join(cmds, ", ")
+			}
+
+			fmt.Fprintf(sb, "| %s | %s | %d |\n", code(ex.Name), commands, ex.Line)
+		}
+	}
+}
+
+func escape(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+func code(s string) string {
+	s = escape(s)
+
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+
+	return "`" + s + "`"
+}
@@ -1,29 +1,44 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 
 	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/report"
 	"vimagination.zapto.org/parser"
 )
 
+var errReported = errors.New("errors reported")
+
 func main() {
 	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		if err != errReported {
+			fmt.Fprintln(os.Stderr, err)
+		}
 
 		os.Exit(1)
 	}
 }
 
 func run() error {
-	var write, concise bool
+	var (
+		write, concise bool
+		format         string
+	)
 
 	flag.BoolVar(&write, "w", false, "write formatted bash code to source file instead of stdout")
 	flag.BoolVar(&concise, "c", false, "print concise bash")
+	flag.StringVar(&format, "f", "text", "format of parsing errors: "+report.FormatNames())
 	flag.Parse()
 
+	errFormat, err := report.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
 	file := flag.CommandLine.Arg(0)
 
 	r := os.Stdin
@@ -41,7 +56,24 @@ func run() error {
 
 	b, err := bash.Parse(bash.SetTokeniser(&tk))
 	if err != nil {
-		return err
+		if errFormat == report.FormatText {
+			return err
+		}
+
+		name := file
+		if name == "" {
+			name = "stdin"
+		}
+
+		r := report.New("bashfmt")
+
+		r.AddError(name, err)
+
+		if err := r.Write(os.Stdout, errFormat); err != nil {
+			return err
+		}
+
+		return errReported
 	}
 
 	out := os.Stdout
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/lint"
+	"vimagination.zapto.org/bash/report"
+	"vimagination.zapto.org/parser"
+)
+
+var (
+	errReported        = errors.New("problems reported")
+	errUnknownSeverity = errors.New("unknown severity")
+)
+
+func main() {
+	if err := run(); err != nil {
+		if err != errReported {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		format, baseline, severity string
+		update                     bool
+	)
+
+	flag.StringVar(&format, "f", "text", "output format: "+report.FormatNames())
+	flag.StringVar(&baseline, "b", "", "baseline file; only problems not recorded in it are reported")
+	flag.BoolVar(&update, "u", false, "write all problems found to the baseline file instead of reporting them")
+	flag.StringVar(&severity, "s", "style", "minimum severity to report: style, info, warning, error")
+	flag.Parse()
+
+	f, err := report.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	minSeverity, err := parseSeverity(severity)
+	if err != nil {
+		return err
+	}
+
+	base := lint.NewBaseline()
+
+	if baseline != "" && !update {
+		if base, err = readBaseline(baseline); err != nil {
+			return err
+		}
+	}
+
+	rules := slices.Concat(lint.ErrorHandlingRules(), lint.SecurityRules(), lint.PortabilityRules(), lint.ArrayRules())
+	l := lint.New(rules...)
+	r := report.New("bashlint", rules...)
+	files := flag.Args()
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	for _, file := range files {
+		diagnostics, err := lintFile(l, file)
+		if err != nil {
+			r.AddError(file, err)
+
+			continue
+		}
+
+		diagnostics = lint.Filter(diagnostics, minSeverity)
+
+		if update {
+			base.Add(file, diagnostics)
+		} else {
+			r.Add(file, base.Filter(file, diagnostics)...)
+		}
+	}
+
+	if update {
+		return writeBaseline(baseline, base)
+	}
+
+	if err := r.Write(os.Stdout, f); err != nil {
+		return err
+	}
+
+	if len(r.Results) > 0 {
+		return errReported
+	}
+
+	return nil
+}
+
+func parseSeverity(name string) (lint.Severity, error) {
+	for s := lint.SeverityStyle; s <= lint.SeverityError; s++ {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", errUnknownSeverity, name)
+}
+
+func lintFile(l *lint.Linter, file string) ([]lint.Diagnostic, error) {
+	var r io.Reader = os.Stdin
+
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	tk := parser.NewReaderTokeniser(r)
+
+	b, err := bash.Parse(bash.SetTokeniser(&tk))
+	if err != nil {
+		return nil, err
+	}
+
+	return l.Lint(b), nil
+}
+
+func readBaseline(file string) (*lint.Baseline, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return lint.NewBaseline(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return lint.ReadBaseline(f)
+}
+
+func writeBaseline(file string, b *lint.Baseline) error {
+	if file == "" {
+		_, err := b.WriteTo(os.Stdout)
+
+		return err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.WriteTo(f); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/metrics"
+	"vimagination.zapto.org/parser"
+)
+
+var (
+	errReported      = errors.New("problems reported")
+	errUnknownFormat = errors.New("unknown format")
+)
+
+func main() {
+	if err := run(); err != nil {
+		if err != errReported {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		os.Exit(1)
+	}
+}
+
+type file struct {
+	Path string `json:"file"`
+	*metrics.File
+}
+
+func run() error {
+	var (
+		format                  string
+		maxComplexity, maxDepth int
+	)
+
+	flag.StringVar(&format, "f", "text", "output format: text, json")
+	flag.IntVar(&maxComplexity, "c", 0, "report files and functions with a cyclomatic complexity above this value; 0 to disable")
+	flag.IntVar(&maxDepth, "d", 0, "report files and functions with a nesting depth above this value; 0 to disable")
+	flag.Parse()
+
+	if format != "text" && format != "json" {
+		return fmt.Errorf("%w: %s", errUnknownFormat, format)
+	}
+
+	var (
+		results []file
+		failed  bool
+	)
+
+	files := flag.Args()
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	for _, name := range files {
+		m, err := measureFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+
+			failed = true
+
+			continue
+		}
+
+		results = append(results, file{Path: name, File: m})
+	}
+
+	if err := write(os.Stdout, format, results); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		for _, m := range append([]metrics.Metrics{r.Metrics}, r.Functions...) {
+			if exceeds(os.Stderr, r.Path, m, "complexity", m.Complexity, maxComplexity) || exceeds(os.Stderr, r.Path, m, "depth", m.Depth, maxDepth) {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return errReported
+	}
+
+	return nil
+}
+
+func measureFile(name string) (*metrics.File, error) {
+	var r io.Reader = os.Stdin
+
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	tk := parser.NewReaderTokeniser(r)
+
+	b, err := bash.Parse(bash.SetTokeniser(&tk))
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics.Measure(b), nil
+}
+
+func write(w io.Writer, format string, results []file) error {
+	if format == "json" {
+		if results == nil {
+			results = []file{}
+		}
+
+		enc := json.NewEncoder(w)
+
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(results)
+	}
+
+	for _, r := range results {
+		if err := writeMetrics(w, r.Path, "", r.Metrics); err != nil {
+			return err
+		}
+
+		for _, fn := range r.Functions {
+			if err := writeMetrics(w, r.Path, fn.Name, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeMetrics(w io.Writer, file, name string, m metrics.Metrics) error {
+	if name == "" {
+		name = "(file)"
+	}
+
+	_, err := fmt.Fprintf(w, "%s:%d: %s lines=%d complexity=%d depth=%d statements=%d external=%d/%d subshells=%d\n", file, m.Line, name, m.Lines, m.Complexity, m.Depth, m.Statements, len(m.ExternalCommands), m.ExternalCalls, m.Subshells)
+
+	return err
+}
+
+func exceeds(w io.Writer, file string, m metrics.Metrics, metric string, value, limit int) bool {
+	if limit <= 0 || value <= limit {
+		return false
+	}
+
+	name := "file"
+
+	if m.Name != "" {
+		name = "function " + m.Name
+	}
+
+	fmt.Fprintf(w, "%s:%d: %s has a %s of %d, above the limit of %d\n", file, m.Line, name, metric, value, limit)
+
+	return true
+}
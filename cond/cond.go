@@ -0,0 +1,359 @@
+// Package cond evaluates the conditional expressions of the bash '[[' command,
+// and of the 'test' builtin.
+package cond
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/bash/pattern"
+)
+
+// Evaluator evaluates the Tests of a TestCompound.
+//
+// Words are expanded with the Expander, whose Env is also used by the '-v' and
+// '-R' tests, and to set BASH_REMATCH after a '=~' test; its Options determine
+// whether pattern and regular expression matching ignores case, and its
+// Arithmetic function is used to evaluate the operands of numeric
+// comparisons, which must otherwise be integers. When the Expander is nil,
+// only literal words can be expanded.
+//
+// File tests are performed against FS, or, when it is nil, against the FS and
+// Dir of the Expander; file tests are false when neither is set.
+//
+// Option is called to determine whether a shell option is enabled, for the
+// '-o' test, and Terminal is called to determine whether a file descriptor is
+// open on a terminal, for the '-t' test. Both tests are false when the
+// corresponding function is nil.
+//
+// Operand, when not nil, is called with the value of each word that is
+// expanded, and, with file set, with the name of each file that is tested.
+type Evaluator struct {
+	Expander *expand.Expander
+	FS       FS
+	Option   func(name string) bool
+	Terminal func(fd int) bool
+	Operand  func(value string, file bool)
+}
+
+// Compound evaluates the Tests of a TestCompound, returning the exit status
+// of the '[[' command; zero when the tests are true, one when they are false,
+// and two when a regular expression is invalid.
+func (e *Evaluator) Compound(t *bash.TestCompound) (int, error) {
+	ok, err := e.Eval(&t.Tests)
+
+	switch {
+	case errors.Is(err, ErrInvalidRegexp):
+		return 2, err
+	case err != nil, !ok:
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+// Eval evaluates a chain of Tests, in which '&&' binds more tightly than '||',
+// and evaluation stops as soon as the result is known.
+func (e *Evaluator) Eval(t *bash.Tests) (bool, error) {
+	and := true
+
+	for ; t != nil; t = t.Tests {
+		if and {
+			ok, err := e.test(t)
+			if err != nil {
+				return false, err
+			}
+
+			and = ok
+		}
+
+		if t.LogicalOperator != bash.LogicalOperatorAnd {
+			if and {
+				return true, nil
+			}
+
+			and = true
+		}
+	}
+
+	return false, nil
+}
+
+func (e *Evaluator) test(t *bash.Tests) (bool, error) {
+	var (
+		ok  bool
+		err error
+	)
+
+	switch {
+	case t.Parens != nil:
+		ok, err = e.Eval(t.Parens)
+	case t.Word == nil:
+		return false, ErrMissingOperand
+	case t.Pattern != nil:
+		ok, err = e.binary(t)
+	case t.Test == bash.TestOperatorNone:
+		var s string
+
+		s, err = e.word(t.Word)
+		ok = s != ""
+	default:
+		ok, err = e.unary(t)
+	}
+
+	return ok != t.Not, err
+}
+
+func (e *Evaluator) expander() *expand.Expander {
+	if e.Expander == nil {
+		return &expand.Expander{}
+	}
+
+	return e.Expander
+}
+
+func (e *Evaluator) word(w *bash.Word) (string, error) {
+	s, err := e.expander().Word(w)
+	if err == nil {
+		e.operand(s, false)
+	}
+
+	return s, err
+}
+
+func (e *Evaluator) operand(value string, file bool) {
+	if e.Operand != nil {
+		e.Operand(value, file)
+	}
+}
+
+func (e *Evaluator) unary(t *bash.Tests) (bool, error) {
+	operand, err := e.word(t.Word)
+	if err != nil {
+		return false, err
+	}
+
+	return e.unaryOperator(t.Test, operand)
+}
+
+// unaryOperator performs a unary test on an expanded operand.
+func (e *Evaluator) unaryOperator(op bash.TestOperator, operand string) (bool, error) {
+	switch op {
+	case bash.TestOperatorStringIsZero:
+		return operand == "", nil
+	case bash.TestOperatorStringIsNonZero:
+		return operand != "", nil
+	case bash.TestOperatorOptNameIsEnabled:
+		return e.Option != nil && e.Option(operand), nil
+	case bash.TestOperatorVarNameIsSet:
+		return e.isSet(operand)
+	case bash.TestOperatorVarnameIsRef:
+		v, ok := e.ref(operand)
+
+		return ok && v.Attributes.Has(attributes.Nameref), nil
+	case bash.TestOperatorFileIsTerminal:
+		fd, err := strconv.Atoi(strings.TrimSpace(operand))
+
+		return err == nil && e.Terminal != nil && e.Terminal(fd), nil
+	}
+
+	return e.file(op, operand), nil
+}
+
+// ref returns the named variable without following namerefs, when the
+// Environment supports it.
+func (e *Evaluator) ref(name string) (expand.Variable, bool) {
+	if rg, ok := e.expander().Env.(expand.RefGetter); ok {
+		return rg.GetRef(name)
+	}
+
+	return e.variable(name)
+}
+
+func (e *Evaluator) variable(name string) (expand.Variable, bool) {
+	if env := e.expander().Env; env != nil {
+		return env.Get(name)
+	}
+
+	return expand.Variable{}, false
+}
+
+// isSet determines whether a variable, or an element of an array, is set, as
+// with the '-v' test.
+func (e *Evaluator) isSet(name string) (bool, error) {
+	base, key, keyed := strings.Cut(name, "[")
+
+	v, ok := e.variable(base)
+	if !ok {
+		return false, nil
+	} else if !keyed {
+		_, ok = v.Index("0")
+
+		return ok, nil
+	}
+
+	key = strings.TrimSuffix(key, "]")
+
+	if key == "@" || key == "*" {
+		return len(v.Keys()) > 0, nil
+	} else if !v.Attributes.Has(attributes.Associative) {
+		n, err := e.arithmetic(key)
+		if err != nil {
+			return false, err
+		}
+
+		key = strconv.FormatInt(n, 10)
+	}
+
+	_, ok = v.Index(key)
+
+	return ok, nil
+}
+
+func (e *Evaluator) binary(t *bash.Tests) (bool, error) {
+	left, err := e.word(t.Word)
+	if err != nil {
+		return false, err
+	}
+
+	w := &bash.Word{Parts: t.Pattern.Parts, Tokens: t.Pattern.Tokens}
+
+	switch t.Test {
+	case bash.TestOperatorStringsEqual, bash.TestOperatorStringsNotEqual:
+		right, err := e.expander().Pattern(w)
+		if err != nil {
+			return false, err
+		}
+
+		e.operand(right, false)
+
+		opts := pattern.ExtGlob
+
+		if e.expander().Options&expand.NoCaseMatch != 0 {
+			opts |= pattern.NoCaseMatch
+		}
+
+		return pattern.Compile(right, opts).Match(left) == (t.Test == bash.TestOperatorStringsEqual), nil
+	case bash.TestOperatorStringsMatch:
+		right, err := e.expander().Regexp(w)
+		if err != nil {
+			return false, err
+		}
+
+		e.operand(right, false)
+
+		return e.match(left, right)
+	}
+
+	right, err := e.word(w)
+	if err != nil {
+		return false, err
+	}
+
+	switch t.Test {
+	case bash.TestOperatorStringBefore:
+		return left < right, nil
+	case bash.TestOperatorStringAfter:
+		return left > right, nil
+	case bash.TestOperatorFilesAreSameInode, bash.TestOperatorFileIsNewerThan, bash.TestOperatorFileIsOlderThan:
+		return e.compareFiles(t.Test, left, right), nil
+	}
+
+	return e.compare(t.Test, left, right)
+}
+
+// match matches a string against an extended regular expression, setting the
+// BASH_REMATCH array to the match and its subexpressions.
+func (e *Evaluator) match(s, expr string) (bool, error) {
+	flags := syntax.POSIX
+
+	if e.expander().Options&expand.NoCaseMatch != 0 {
+		flags |= syntax.FoldCase
+	}
+
+	parsed, err := syntax.Parse(expr, flags)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", expr, ErrInvalidRegexp)
+	}
+
+	re, err := regexp.Compile(parsed.String())
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", expr, ErrInvalidRegexp)
+	}
+
+	re.Longest()
+
+	matches := re.FindStringSubmatch(s)
+
+	if env := e.expander().Env; env != nil {
+		if err := env.Set("BASH_REMATCH", expand.Indexed(matches...)); err != nil {
+			return false, err
+		}
+	}
+
+	return matches != nil, nil
+}
+
+// compare compares the values of two arithmetic expressions.
+func (e *Evaluator) compare(op bash.TestOperator, left, right string) (bool, error) {
+	l, err := e.arithmetic(left)
+	if err != nil {
+		return false, err
+	}
+
+	r, err := e.arithmetic(right)
+	if err != nil {
+		return false, err
+	}
+
+	return compareIntegers(op, l, r)
+}
+
+func compareIntegers(op bash.TestOperator, l, r int64) (bool, error) {
+	switch op {
+	case bash.TestOperatorEqual:
+		return l == r, nil
+	case bash.TestOperatorNotEqual:
+		return l != r, nil
+	case bash.TestOperatorLessThan:
+		return l < r, nil
+	case bash.TestOperatorLessThanEqual:
+		return l <= r, nil
+	case bash.TestOperatorGreaterThan:
+		return l > r, nil
+	case bash.TestOperatorGreaterThanEqual:
+		return l >= r, nil
+	}
+
+	return false, ErrUnknownOperator
+}
+
+func (e *Evaluator) arithmetic(expr string) (int64, error) {
+	if fn := e.expander().Arithmetic; fn != nil {
+		return fn(expr)
+	}
+
+	expr = strings.TrimSpace(expr)
+
+	if expr == "" {
+		return 0, nil
+	} else if n, err := strconv.ParseInt(expr, 10, 64); err == nil {
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("%s: %w", expr, expand.ErrNoArithmetic)
+}
+
+// Errors.
+var (
+	ErrMissingOperand  = errors.New("missing operand")
+	ErrInvalidRegexp   = errors.New("invalid regular expression")
+	ErrUnknownOperator = errors.New("unknown operator")
+)
@@ -0,0 +1,293 @@
+package cond
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+var (
+	old = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+var testFS = fstest.MapFS{
+	"home/u/file":   {Data: []byte("data"), Mode: 0o755, ModTime: now},
+	"home/u/empty":  {Mode: 0o600, ModTime: old},
+	"home/u/fifo":   {Mode: fs.ModeNamedPipe},
+	"home/u/sticky": {Mode: fs.ModeDir | fs.ModeSticky | 0o777},
+	"home/u/dir/x":  {},
+	"etc/passwd":    {Data: []byte("root"), Mode: fs.ModeSetuid | 0o644, ModTime: old},
+}
+
+func testVars() expand.Map {
+	return expand.Map{
+		"x":   expand.Scalar("abc"),
+		"y":   expand.Scalar(""),
+		"n":   expand.Scalar("5"),
+		"arr": expand.Indexed("1", "2"),
+		"ref": {Attributes: attributes.Nameref, Value: "x"},
+		"m":   expand.Associative(map[string]string{"k": "v"}),
+	}
+}
+
+func compound(t *testing.T, src string) *bash.TestCompound {
+	t.Helper()
+
+	tk := parser.NewStringTokeniser("[[ " + src + " ]]")
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %s", err)
+	}
+
+	return f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Compound.TestCompound
+}
+
+func TestCompound(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Options expand.Options
+		Status  int
+		Rematch []string
+	}{
+		{Input: "$x"},                                                           // 1
+		{Input: "$y", Status: 1},                                                // 2
+		{Input: "-z $y"},                                                        // 3
+		{Input: "! -n $x", Status: 1},                                           // 4
+		{Input: "$x == a*"},                                                     // 5
+		{Input: `$x == "a*"`, Status: 1},                                        // 6
+		{Input: "$x != a?c", Status: 1},                                         // 7
+		{Input: "$x == @(abc|d)"},                                               // 8
+		{Input: "$x == ABC", Status: 1},                                         // 9
+		{Input: "$x == ABC", Options: expand.NoCaseMatch},                       // 10
+		{Input: "$x =~ ^a(b)(c)?$", Rematch: []string{"abc", "b", "c"}},         // 11
+		{Input: `$x =~ "a.c"`, Status: 1, Rematch: []string{}},                  // 12
+		{Input: `$x =~ a\.c`, Status: 1, Rematch: []string{}},                   // 13
+		{Input: "$x =~ a.c", Rematch: []string{"abc"}},                          // 14
+		{Input: "$x =~ B", Options: expand.NoCaseMatch, Rematch: []string{"b"}}, // 15
+		{Input: "$x =~ (", Status: 2},                                           // 16
+		{Input: "$x < abd"},                                                     // 17
+		{Input: "$x > abd", Status: 1},                                          // 18
+		{Input: "$n -eq 5"},                                                     // 19
+		{Input: "$n -gt 5", Status: 1},                                          // 20
+		{Input: "$n -ge 5"},                                                     // 21
+		{Input: "$n -lt 4", Status: 1},                                          // 22
+		{Input: "3 -le 2", Status: 1},                                           // 23
+		{Input: "3 -ne 2"},                                                      // 24
+		{Input: "a -eq 1", Status: 1},                                           // 25
+		{Input: "-v x"},                                                         // 26
+		{Input: "-v nosuch", Status: 1},                                         // 27
+		{Input: "-v arr[1]"},                                                    // 28
+		{Input: "-v arr[5]", Status: 1},                                         // 29
+		{Input: "-v m[k]"},                                                      // 30
+		{Input: "-v m[z]", Status: 1},                                           // 31
+		{Input: "-v arr[@]"},                                                    // 32
+		{Input: "-R ref"},                                                       // 33
+		{Input: "-R x", Status: 1},                                              // 34
+		{Input: "-o noglob"},                                                    // 35
+		{Input: "-o errexit", Status: 1},                                        // 36
+		{Input: "-t 1"},                                                         // 37
+		{Input: "-t 2", Status: 1},                                              // 38
+		{Input: "-n $x && -z $y"},                                               // 39
+		{Input: "-z $x && -z $y", Status: 1},                                    // 40
+		{Input: "-z $x || -n $x"},                                               // 41
+		{Input: "-n $x || $n -eq nosuch"},                                       // 42
+		{Input: "-z $x && $n -eq nosuch", Status: 1},                            // 43
+		{Input: "-z $x || -z $y && -n $x"},                                      // 44
+		{Input: "-n $x || -z $x && -z $x"},                                      // 45
+		{Input: "( -z $x || -n $x ) && -z $y"},                                  // 46
+		{Input: "! ( -z $x )"},                                                  // 47
+		{Input: "-z $x || ( -n $x && $x == *c )"},                               // 48
+	} {
+		env := testVars()
+		e := Evaluator{
+			Expander: &expand.Expander{Env: env, Options: test.Options},
+			Option:   func(name string) bool { return name == "noglob" },
+			Terminal: func(fd int) bool { return fd == 1 },
+		}
+
+		if status, _ := e.Compound(compound(t, test.Input)); status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		} else if rematch, ok := env.Get("BASH_REMATCH"); test.Rematch != nil && (!ok || !slices.Equal(rematch.Values(), test.Rematch)) {
+			t.Errorf("test %d: expecting BASH_REMATCH %q, got %q", n+1, test.Rematch, rematch.Values())
+		}
+	}
+}
+
+type access struct {
+	FS
+}
+
+func (access) Access(name string, perm fs.FileMode) bool {
+	return name == "file" && perm != 2
+}
+
+func (access) Owned(name string, group bool) bool {
+	return name == "file" && !group
+}
+
+func (access) Accessed(name string) (time.Time, error) {
+	return old, nil
+}
+
+func TestFiles(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Access bool
+		Status int
+	}{
+		{Input: "-e file"},                           // 1
+		{Input: "-a nosuch", Status: 1},              // 2
+		{Input: "-f file"},                           // 3
+		{Input: "-f dir", Status: 1},                 // 4
+		{Input: "-d dir"},                            // 5
+		{Input: "-d /etc"},                           // 6
+		{Input: "-f ../../etc/passwd"},               // 7
+		{Input: "-s file"},                           // 8
+		{Input: "-s empty", Status: 1},               // 9
+		{Input: "-p fifo"},                           // 10
+		{Input: "-k sticky"},                         // 11
+		{Input: "-u /etc/passwd"},                    // 12
+		{Input: "-g /etc/passwd", Status: 1},         // 13
+		{Input: "-x file"},                           // 14
+		{Input: "-x empty", Status: 1},               // 15
+		{Input: "-w empty"},                          // 16
+		{Input: "-w file", Access: true, Status: 1},  // 17
+		{Input: "-r file", Access: true},             // 18
+		{Input: "-O file", Status: 1},                // 19
+		{Input: "-O file", Access: true},             // 20
+		{Input: "-G file", Access: true, Status: 1},  // 21
+		{Input: "-N file", Access: true},             // 22
+		{Input: "-N empty", Access: true, Status: 1}, // 23
+		{Input: "-h file", Status: 1},                // 24
+		{Input: "-S file", Status: 1},                // 25
+		{Input: "-b file", Status: 1},                // 26
+		{Input: "-c file", Status: 1},                // 27
+		{Input: "file -nt empty"},                    // 28
+		{Input: "empty -nt file", Status: 1},         // 29
+		{Input: "file -nt nosuch"},                   // 30
+		{Input: "empty -ot file"},                    // 31
+		{Input: "nosuch -ot file"},                   // 32
+		{Input: "file -ot nosuch", Status: 1},        // 33
+		{Input: `-e ""`, Status: 1},                  // 34
+	} {
+		e := Evaluator{FS: FromFS(testFS, "/home/u")}
+
+		if test.Access {
+			e.FS = access{e.FS}
+		}
+
+		if status, err := e.Compound(compound(t, test.Input)); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		}
+	}
+}
+
+func TestOperand(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    string
+		Operands []string
+	}{
+		{"-n $x", []string{"abc"}},                                  // 1
+		{"$x == a*", []string{"abc", "a*"}},                         // 2
+		{"$x =~ ^a", []string{"abc", "^a"}},                         // 3
+		{"-f $x", []string{"abc", "file:abc"}},                      // 4
+		{"file -nt $y", []string{"file", "", "file:file", "file:"}}, // 5
+		{"-z $y || -n $x", []string{""}},                            // 6
+	} {
+		var operands []string
+
+		e := Evaluator{
+			Expander: &expand.Expander{Env: testVars()},
+			Operand: func(value string, file bool) {
+				if file {
+					value = "file:" + value
+				}
+
+				operands = append(operands, value)
+			},
+		}
+
+		if _, err := e.Compound(compound(t, test.Input)); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !slices.Equal(operands, test.Operands) {
+			t.Errorf("test %d: expecting operands %q, got %q", n+1, test.Operands, operands)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		Input string
+		Err   error
+	}{
+		{"$x =~ (", ErrInvalidRegexp},             // 1
+		{"$n -eq nosuch", expand.ErrNoArithmetic}, // 2
+		{"$u", expand.ErrUnbound},                 // 3
+	} {
+		e := Evaluator{Expander: &expand.Expander{Env: testVars(), Options: expand.NoUnset}}
+
+		if _, err := e.Compound(compound(t, test.Input)); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		}
+	}
+}
+
+func TestTest(t *testing.T) {
+	for n, test := range [...]struct {
+		Args []string
+		OK   bool
+		Err  error
+	}{
+		{},                                       // 1
+		{Args: []string{"a"}, OK: true},          // 2
+		{Args: []string{""}},                     // 3
+		{Args: []string{"-z"}, OK: true},         // 4
+		{Args: []string{"!", "-z"}},              // 5
+		{Args: []string{"-n", ""}},               // 6
+		{Args: []string{"-f", "file"}, OK: true}, // 7
+		{Args: []string{"-d", "file"}},           // 8
+		{Args: []string{"-v", "x"}, OK: true},    // 9
+		{Args: []string{"a", "b"}, Err: ErrUnaryOperatorExpected},                  // 10
+		{Args: []string{"a*", "=", "abc"}},                                         // 11
+		{Args: []string{"abc", "==", "abc"}, OK: true},                             // 12
+		{Args: []string{"a", "<", "b"}, OK: true},                                  // 13
+		{Args: []string{" 12 ", "-eq", "12"}, OK: true},                            // 14
+		{Args: []string{"1+1", "-eq", "2"}, Err: ErrIntegerExpected},               // 15
+		{Args: []string{"a", "-a", ""}},                                            // 16
+		{Args: []string{"a", "-o", ""}, OK: true},                                  // 17
+		{Args: []string{"!", "a", "=", "b"}, OK: true},                             // 18
+		{Args: []string{"(", "a", ")"}, OK: true},                                  // 19
+		{Args: []string{"(", "-n", "", ")"}},                                       // 20
+		{Args: []string{"a", "b", "c"}, Err: ErrBinaryOperatorExpected},            // 21
+		{Args: []string{"1", "-lt", "2", "-a", "!", "a", "=", "b"}, OK: true},      // 22
+		{Args: []string{"", "-o", "(", "1", "-gt", "2", "-o", "x", ")"}, OK: true}, // 23
+		{Args: []string{"a", "=", "a", "-a", "b", "=", "c"}},                       // 24
+		{Args: []string{"a", "b", "c", "d", "e"}, Err: ErrTooManyArguments},        // 25
+		{Args: []string{"a", "-a", "b", "-o"}, Err: ErrArgumentExpected},           // 26
+		{Args: []string{"(", "a", "-a", "b", "c"}, Err: ErrMissingParen},           // 27
+		{Args: []string{"file", "-nt", "empty", "-a", "-e", "file"}, OK: true},     // 28
+	} {
+		e := Evaluator{
+			Expander: &expand.Expander{Env: testVars()},
+			FS:       FromFS(testFS, "/home/u"),
+		}
+
+		if ok, err := e.Test(test.Args); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if ok != test.OK {
+			t.Errorf("test %d: expecting %v, got %v", n+1, test.OK, ok)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cond_test
+
+import (
+	"fmt"
+	"testing/fstest"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/arith"
+	"vimagination.zapto.org/bash/cond"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	env := expand.Map{
+		"file":    expand.Scalar("notes.txt"),
+		"version": expand.Scalar("v1.12"),
+	}
+
+	ev := arith.Evaluator{Vars: arith.Env(env)}
+	e := cond.Evaluator{
+		Expander: &expand.Expander{
+			Env:        env,
+			Arithmetic: ev.Eval,
+			FS:         fstest.MapFS{"home/notes.txt": {Data: []byte("hello")}},
+			Dir:        "/home",
+		},
+	}
+
+	for _, src := range []string{
+		`-s $file && $file == *.txt`,
+		`$version =~ ^v([0-9]+)\.([0-9]+)$ && ${BASH_REMATCH[2]} -gt 10`,
+		`-d $file || ! -e /tmp`,
+		`$version =~ (`,
+	} {
+		tk := parser.NewStringTokeniser("[[ " + src + " ]]")
+
+		f, err := bash.Parse(&tk)
+		if err != nil {
+			fmt.Println(err)
+
+			return
+		}
+
+		fmt.Println(e.Compound(f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Compound.TestCompound))
+	}
+
+	// Output:
+	// 0 <nil>
+	// 0 <nil>
+	// 0 <nil>
+	// 2 (: invalid regular expression
+}
@@ -0,0 +1,216 @@
+package cond
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"vimagination.zapto.org/bash"
+)
+
+// FS provides the file information used by file tests.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// Access is an optional interface for an FS that provides the information
+// needed by the '-r', '-w', '-x', '-O', '-G' and '-N' tests that is not
+// available from an fs.FileInfo.
+//
+// Without it, a file is considered readable, writable, or executable when any
+// of the corresponding permission bits are set, is never owned by the current
+// user or group, and is never modified since it was last read.
+type Access interface {
+	// Access determines whether the current user can access the file with
+	// the given permission, which is one of 4 (read), 2 (write) or 1
+	// (execute).
+	Access(name string, perm fs.FileMode) bool
+
+	// Owned determines whether the file is owned by the effective user, or,
+	// when group is set, the effective group.
+	Owned(name string, group bool) bool
+
+	// Accessed returns the time at which the file was last read.
+	Accessed(name string) (time.Time, error)
+}
+
+// FromFS returns an FS that performs file tests against an fs.FS, which
+// represents the root of the filesystem, with dir being the absolute path of
+// the working directory within it.
+//
+// As an fs.FS cannot report on symbolic links, Lstat is the same as Stat.
+func FromFS(fsys fs.FS, dir string) FS {
+	return fsFS{fsys, dir}
+}
+
+type fsFS struct {
+	fsys fs.FS
+	dir  string
+}
+
+func (f fsFS) path(name string) string {
+	if !path.IsAbs(name) {
+		name = path.Join("/", f.dir, name)
+	}
+
+	return path.Clean(name)[1:]
+}
+
+// Stat implements the FS interface.
+func (f fsFS) Stat(name string) (fs.FileInfo, error) {
+	p := f.path(name)
+
+	if p == "" {
+		p = "."
+	}
+
+	return fs.Stat(f.fsys, p)
+}
+
+// Lstat implements the FS interface.
+func (f fsFS) Lstat(name string) (fs.FileInfo, error) {
+	return f.Stat(name)
+}
+
+// OS returns an FS that performs file tests against the filesystem of the
+// operating system, with relative paths being resolved from dir.
+func OS(dir string) FS {
+	return osFS(dir)
+}
+
+type osFS string
+
+func (o osFS) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(string(o), name)
+}
+
+// Stat implements the FS interface.
+func (o osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(o.path(name))
+}
+
+// Lstat implements the FS interface.
+func (o osFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(o.path(name))
+}
+
+func (e *Evaluator) fs() FS {
+	if e.FS != nil {
+		return e.FS
+	} else if ex := e.expander(); ex.FS != nil {
+		return FromFS(ex.FS, ex.Dir)
+	}
+
+	return nil
+}
+
+func (e *Evaluator) stat(name string) (fs.FileInfo, bool) {
+	fsys := e.fs()
+	if fsys == nil || name == "" {
+		return nil, false
+	}
+
+	fi, err := fsys.Stat(name)
+
+	return fi, err == nil
+}
+
+// file performs a unary file test.
+func (e *Evaluator) file(op bash.TestOperator, name string) bool {
+	e.operand(name, true)
+
+	if op == bash.TestOperatorFileIsSymbolic {
+		fsys := e.fs()
+		if fsys == nil || name == "" {
+			return false
+		}
+
+		fi, err := fsys.Lstat(name)
+
+		return err == nil && fi.Mode()&fs.ModeSymlink != 0
+	}
+
+	fi, ok := e.stat(name)
+	if !ok {
+		return false
+	}
+
+	mode := fi.Mode()
+	access, hasAccess := e.fs().(Access)
+
+	switch op {
+	case bash.TestOperatorFileExists:
+		return true
+	case bash.TestOperatorFileIsBlock:
+		return mode&fs.ModeDevice != 0 && mode&fs.ModeCharDevice == 0
+	case bash.TestOperatorFileIsCharacter:
+		return mode&fs.ModeCharDevice != 0
+	case bash.TestOperatorDirectoryExists:
+		return mode.IsDir()
+	case bash.TestOperatorFileIsRegular:
+		return mode.IsRegular()
+	case bash.TestOperatorFileHasSetGroupID:
+		return mode&fs.ModeSetgid != 0
+	case bash.TestOperatorFileHasStickyBit:
+		return mode&fs.ModeSticky != 0
+	case bash.TestOperatorFileIsPipe:
+		return mode&fs.ModeNamedPipe != 0
+	case bash.TestOperatorFileIsNonZero:
+		return fi.Size() > 0
+	case bash.TestOperatorFileHasSetUserID:
+		return mode&fs.ModeSetuid != 0
+	case bash.TestOperatorFileIsSocket:
+		return mode&fs.ModeSocket != 0
+	case bash.TestOperatorFileIsReadable, bash.TestOperatorFileIsWritable, bash.TestOperatorFileIsExecutable:
+		perm := fs.FileMode(4)
+
+		if op == bash.TestOperatorFileIsWritable {
+			perm = 2
+		} else if op == bash.TestOperatorFileIsExecutable {
+			perm = 1
+		}
+
+		if hasAccess {
+			return access.Access(name, perm)
+		}
+
+		return mode.Perm()&(perm|perm<<3|perm<<6) != 0
+	case bash.TestOperatorFileIsOwnedByEffectiveUser, bash.TestOperatorFileIsOwnedByEffectiveGroup:
+		return hasAccess && access.Owned(name, op == bash.TestOperatorFileIsOwnedByEffectiveGroup)
+	case bash.TestOperatorFileWasModifiedSinceLastRead:
+		if !hasAccess {
+			return false
+		}
+
+		accessed, err := access.Accessed(name)
+
+		return err == nil && fi.ModTime().After(accessed)
+	}
+
+	return false
+}
+
+// compareFiles performs the binary file tests.
+func (e *Evaluator) compareFiles(op bash.TestOperator, left, right string) bool {
+	e.operand(left, true)
+	e.operand(right, true)
+
+	l, lok := e.stat(left)
+	r, rok := e.stat(right)
+
+	switch op {
+	case bash.TestOperatorFileIsNewerThan:
+		return lok && (!rok || l.ModTime().After(r.ModTime()))
+	case bash.TestOperatorFileIsOlderThan:
+		return rok && (!lok || l.ModTime().Before(r.ModTime()))
+	}
+
+	return lok && rok && os.SameFile(l, r)
+}
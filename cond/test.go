@@ -0,0 +1,281 @@
+package cond
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+)
+
+var (
+	unaryOperators = map[string]bash.TestOperator{
+		"-a": bash.TestOperatorFileExists,
+		"-e": bash.TestOperatorFileExists,
+		"-b": bash.TestOperatorFileIsBlock,
+		"-c": bash.TestOperatorFileIsCharacter,
+		"-d": bash.TestOperatorDirectoryExists,
+		"-f": bash.TestOperatorFileIsRegular,
+		"-g": bash.TestOperatorFileHasSetGroupID,
+		"-h": bash.TestOperatorFileIsSymbolic,
+		"-L": bash.TestOperatorFileIsSymbolic,
+		"-k": bash.TestOperatorFileHasStickyBit,
+		"-p": bash.TestOperatorFileIsPipe,
+		"-r": bash.TestOperatorFileIsReadable,
+		"-s": bash.TestOperatorFileIsNonZero,
+		"-t": bash.TestOperatorFileIsTerminal,
+		"-u": bash.TestOperatorFileHasSetUserID,
+		"-w": bash.TestOperatorFileIsWritable,
+		"-x": bash.TestOperatorFileIsExecutable,
+		"-G": bash.TestOperatorFileIsOwnedByEffectiveGroup,
+		"-N": bash.TestOperatorFileWasModifiedSinceLastRead,
+		"-O": bash.TestOperatorFileIsOwnedByEffectiveUser,
+		"-S": bash.TestOperatorFileIsSocket,
+		"-o": bash.TestOperatorOptNameIsEnabled,
+		"-v": bash.TestOperatorVarNameIsSet,
+		"-R": bash.TestOperatorVarnameIsRef,
+		"-z": bash.TestOperatorStringIsZero,
+		"-n": bash.TestOperatorStringIsNonZero,
+	}
+	binaryOperators = map[string]bash.TestOperator{
+		"=":   bash.TestOperatorStringsEqual,
+		"==":  bash.TestOperatorStringsEqual,
+		"!=":  bash.TestOperatorStringsNotEqual,
+		"<":   bash.TestOperatorStringBefore,
+		">":   bash.TestOperatorStringAfter,
+		"-eq": bash.TestOperatorEqual,
+		"-ne": bash.TestOperatorNotEqual,
+		"-lt": bash.TestOperatorLessThan,
+		"-le": bash.TestOperatorLessThanEqual,
+		"-gt": bash.TestOperatorGreaterThan,
+		"-ge": bash.TestOperatorGreaterThanEqual,
+		"-ef": bash.TestOperatorFilesAreSameInode,
+		"-nt": bash.TestOperatorFileIsNewerThan,
+		"-ot": bash.TestOperatorFileIsOlderThan,
+	}
+)
+
+// Test evaluates the arguments of the 'test' builtin, or of '[' without its
+// closing ']'.
+//
+// As in bash, expressions of up to four arguments are evaluated according to
+// the POSIX rules for the number of arguments, with longer expressions parsed
+// with '-a' binding more tightly than '-o'. Unlike with '[[', the '=' and '!='
+// operators compare strings rather than matching patterns, and the operands of
+// numeric comparisons must be integers.
+//
+// An error is returned for an invalid expression, for which the exit status of
+// 'test' is two.
+func (e *Evaluator) Test(args []string) (bool, error) {
+	t := tester{Evaluator: e, args: args}
+
+	var (
+		ok  bool
+		err error
+	)
+
+	switch len(args) {
+	case 0:
+	case 1:
+		ok = args[0] != ""
+	case 2:
+		ok, err = t.two()
+	case 3:
+		ok, err = t.three()
+	case 4:
+		if args[0] == "!" {
+			t.pos++
+			ok, err = t.three()
+			ok = !ok
+
+			break
+		} else if args[0] == "(" && args[3] == ")" {
+			t.pos++
+			ok, err = t.two()
+
+			break
+		}
+
+		fallthrough
+	default:
+		if ok, err = t.or(); err == nil && t.pos < len(args) {
+			return false, ErrTooManyArguments
+		}
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// tester holds the state of the evaluation of the arguments of 'test'.
+type tester struct {
+	*Evaluator
+	args []string
+	pos  int
+}
+
+func (t *tester) two() (bool, error) {
+	first, second := t.args[t.pos], t.args[t.pos+1]
+
+	if first == "!" {
+		return second == "", nil
+	}
+
+	op, ok := unaryOperators[first]
+	if !ok {
+		return false, fmt.Errorf("%s: %w", first, ErrUnaryOperatorExpected)
+	}
+
+	return t.unaryOperator(op, second)
+}
+
+func (t *tester) three() (bool, error) {
+	first, second, third := t.args[t.pos], t.args[t.pos+1], t.args[t.pos+2]
+
+	switch {
+	case binaryOperators[second] != bash.TestOperatorNone:
+		return t.binaryOperator(second, first, third)
+	case second == "-a":
+		return first != "" && third != "", nil
+	case second == "-o":
+		return first != "" || third != "", nil
+	case first == "!":
+		t.pos++
+		ok, err := t.two()
+
+		return !ok, err
+	case first == "(" && third == ")":
+		return second != "", nil
+	}
+
+	return false, fmt.Errorf("%s: %w", second, ErrBinaryOperatorExpected)
+}
+
+// or parses and evaluates an expression of the form 'and [-o or]'.
+func (t *tester) or() (bool, error) {
+	ok, err := t.and()
+	if err != nil || t.pos >= len(t.args) || t.args[t.pos] != "-o" {
+		return ok, err
+	}
+
+	t.pos++
+
+	right, err := t.or()
+
+	return ok || right, err
+}
+
+// and parses and evaluates an expression of the form 'term [-a and]'.
+func (t *tester) and() (bool, error) {
+	ok, err := t.term()
+	if err != nil || t.pos >= len(t.args) || t.args[t.pos] != "-a" {
+		return ok, err
+	}
+
+	t.pos++
+
+	right, err := t.and()
+
+	return ok && right, err
+}
+
+// term parses and evaluates a negated term, a parenthesised expression, a
+// binary or unary test, or a single string.
+func (t *tester) term() (bool, error) {
+	if t.pos >= len(t.args) {
+		return false, ErrArgumentExpected
+	}
+
+	switch arg := t.args[t.pos]; {
+	case arg == "!":
+		if t.pos++; t.pos >= len(t.args) {
+			return false, ErrArgumentExpected
+		}
+
+		ok, err := t.term()
+
+		return !ok, err
+	case arg == "(":
+		if t.pos++; t.pos >= len(t.args) {
+			return false, ErrArgumentExpected
+		}
+
+		ok, err := t.or()
+		if err != nil {
+			return false, err
+		} else if t.pos >= len(t.args) {
+			return false, ErrMissingParen
+		} else if t.args[t.pos] != ")" {
+			return false, fmt.Errorf("%w, found %s", ErrMissingParen, t.args[t.pos])
+		}
+
+		t.pos++
+
+		return ok, nil
+	case t.pos+3 <= len(t.args) && binaryOperators[t.args[t.pos+1]] != bash.TestOperatorNone:
+		t.pos += 3
+
+		return t.binaryOperator(t.args[t.pos-2], arg, t.args[t.pos-1])
+	case t.pos+2 <= len(t.args) && unaryOperators[arg] != bash.TestOperatorNone:
+		t.pos += 2
+
+		return t.unaryOperator(unaryOperators[arg], t.args[t.pos-1])
+	}
+
+	t.pos++
+
+	return t.args[t.pos-1] != "", nil
+}
+
+// binaryOperator performs a binary test of the 'test' builtin.
+func (t *tester) binaryOperator(op, left, right string) (bool, error) {
+	switch test := binaryOperators[op]; test {
+	case bash.TestOperatorStringsEqual:
+		return left == right, nil
+	case bash.TestOperatorStringsNotEqual:
+		return left != right, nil
+	case bash.TestOperatorStringBefore:
+		return left < right, nil
+	case bash.TestOperatorStringAfter:
+		return left > right, nil
+	case bash.TestOperatorFilesAreSameInode, bash.TestOperatorFileIsNewerThan, bash.TestOperatorFileIsOlderThan:
+		return t.compareFiles(test, left, right), nil
+	default:
+		l, err := integer(left)
+		if err != nil {
+			return false, err
+		}
+
+		r, err := integer(right)
+		if err != nil {
+			return false, err
+		}
+
+		return compareIntegers(test, l, r)
+	}
+}
+
+// integer parses an operand of a numeric comparison of the 'test' builtin,
+// which may be surrounded by whitespace.
+func integer(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", s, ErrIntegerExpected)
+	}
+
+	return n, nil
+}
+
+// Errors returned by Test.
+var (
+	ErrUnaryOperatorExpected  = errors.New("unary operator expected")
+	ErrBinaryOperatorExpected = errors.New("binary operator expected")
+	ErrIntegerExpected        = errors.New("integer expression expected")
+	ErrArgumentExpected       = errors.New("argument expected")
+	ErrMissingParen           = errors.New("`)' expected")
+	ErrTooManyArguments       = errors.New("too many arguments")
+)
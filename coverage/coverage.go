@@ -0,0 +1,356 @@
+// Package coverage instruments bash scripts to record which of their
+// statements are run, and reports on the coverage recorded.
+package coverage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/walk"
+	"vimagination.zapto.org/parser"
+)
+
+// ProbeFunc is the name of the function, defined by an instrumented script,
+// that each probe calls.
+const ProbeFunc = "__coverage_probe"
+
+// The names of the variables and function used by the probes to restore
+// PIPESTATUS.
+const (
+	probeStatuses = "__coverage_ps"
+	probeForm     = "__coverage_form"
+	probeExit     = "__coverage_exit"
+)
+
+// Kind is the kind of code covered by a Block.
+type Kind uint8
+
+// Block kinds.
+const (
+	Statement Kind = iota // a statement of a list
+	Branch                // a pipeline following '&&' or '||'
+	CaseArm               // a pattern and its commands in a case statement
+)
+
+// String returns the name of the Kind.
+func (k Kind) String() string {
+	switch k {
+	case Statement:
+		return "statement"
+	case Branch:
+		return "branch"
+	case CaseArm:
+		return "case arm"
+	}
+
+	return "unknown"
+}
+
+// Position is a position in the source of a script; the line and column are
+// one-based, with the column counted in bytes.
+type Position struct {
+	Line, Column uint64
+}
+
+// Block is a range of code, with a probe that counts the number of times it
+// is reached. The End position is that of the byte following the block.
+type Block struct {
+	Kind       Kind
+	Start, End Position
+	Count      uint64
+}
+
+// Profile is the coverage of a single script; its Blocks, identified by their
+// index, in the order in which they start.
+type Profile struct {
+	Name   string
+	Source string
+	Blocks []Block
+}
+
+// probe is a Block before it has been given an identifier, along with the
+// positions at which its probe is inserted.
+type probe struct {
+	block      Block
+	start, end uint64
+	at         uint64
+	group      bool
+}
+
+type insertion struct {
+	pos  uint64
+	text string
+}
+
+// Instrument parses a script, returning the source of the script with probes
+// inserted, along with an empty Profile of the blocks they cover.
+//
+// A probe is inserted before each statement, with each pipeline following an
+// '&&' or '||' being grouped along with its own probe, and a probe is also
+// inserted at the start of each arm of a case statement. Each probe calls a
+// function, ProbeFunc, defined before the first statement, which writes the
+// number of its block to the given file descriptor, as a line of text. If the
+// file descriptor is not open, the hits are discarded.
+//
+// The probes preserve '$?', '$_', and PIPESTATUS, so that neither they nor the
+// exit status of the script are changed; when the script contains a pipeline
+// of more than one command, or one negated with '!', PIPESTATUS is restored by
+// running a pipeline of the same length.
+//
+// No lines are added or removed, so that '$LINENO' is unchanged, and nothing
+// is inserted into heredocs, so the commands of substitutions within them are
+// not blocks. The probes are, however, included in the output of 'set -x', and
+// run the DEBUG trap.
+func Instrument(name, src string, fd int) (string, *Profile, error) {
+	tk := parser.NewStringTokeniser(src)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		return "", nil, err
+	}
+
+	i := instrumenter{lines: lineStarts(src), pipelines: make(map[int]bool)}
+
+	i.Handle(f)
+
+	slices.SortStableFunc(i.probes, func(a, b probe) int {
+		return int(a.start) - int(b.start)
+	})
+
+	p := &Profile{Name: name, Source: src, Blocks: make([]Block, len(i.probes))}
+
+	var insertions []insertion
+
+	def, call := i.probeText(fd)
+
+	if len(f.Lines) > 0 && len(f.Lines[0].Statements) > 0 {
+		insertions = append(insertions, insertion{pos: f.Lines[0].Statements[0].Tokens[0].Pos, text: def})
+	}
+
+	for id, pr := range i.probes {
+		p.Blocks[id] = pr.block
+		call := fmt.Sprintf(call, id)
+
+		if pr.group {
+			insertions = append(insertions, insertion{pos: pr.at, text: "{ " + call}, insertion{pos: pr.end, text: "; }"})
+		} else {
+			insertions = append(insertions, insertion{pos: pr.at, text: call})
+		}
+	}
+
+	slices.SortStableFunc(insertions, func(a, b insertion) int {
+		return int(a.pos) - int(b.pos)
+	})
+
+	var (
+		sb   strings.Builder
+		last uint64
+	)
+
+	for _, ins := range insertions {
+		sb.WriteString(src[last:ins.pos])
+		sb.WriteString(ins.text)
+
+		last = ins.pos
+	}
+
+	sb.WriteString(src[last:])
+
+	return sb.String(), p, nil
+}
+
+func lineStarts(src string) []uint64 {
+	starts := []uint64{0}
+
+	for n, c := range []byte(src) {
+		if c == '\n' {
+			starts = append(starts, uint64(n+1))
+		}
+	}
+
+	return starts
+}
+
+// instrumenter finds the blocks of a script, and the lengths of its pipelines.
+type instrumenter struct {
+	lines     []uint64
+	probes    []probe
+	pipelines map[int]bool
+	negated   bool
+}
+
+func (i *instrumenter) Handle(t bash.Type) error {
+	switch t := t.(type) {
+	case *bash.Line:
+		for n := range t.Statements {
+			i.statement(&t.Statements[n])
+		}
+	case *bash.Statement:
+		i.pipeline(&t.Pipeline)
+	case *bash.PatternLines:
+		i.caseArm(t)
+	case *bash.Heredoc:
+		return nil
+	}
+
+	return walk.Walk(t, i)
+}
+
+// pipeline records the length of a pipeline of more than one command, and
+// whether it is negated.
+func (i *instrumenter) pipeline(p *bash.Pipeline) {
+	length := 0
+
+	for q := p; q != nil; q = q.Pipeline {
+		length++
+	}
+
+	if length > 1 {
+		i.pipelines[length] = true
+	}
+
+	i.negated = i.negated || p.Not
+}
+
+// probeText returns the definition of the probe function, and the format of a
+// call to it, taking the number of a block.
+//
+// Without pipelines of more than one command or negated pipelines in the
+// script, PIPESTATUS always holds just the exit status, and so only the exit
+// status needs to be preserved, by returning it, and '$_', by passing it as
+// the last argument.
+//
+// Otherwise, the probe function saves PIPESTATUS, returning true only when it
+// holds just a zero exit status; when it does not, the saved statuses are
+// restored by a pipeline of the same length, each command of which returns
+// one of them, and which is negated when '$?' does not match its status. The
+// pipeline is run on the left of '&&' or '||', or negated, such that it is
+// the last command run, and that its failure neither runs the ERR trap nor
+// exits the shell with 'set -e'.
+func (i *instrumenter) probeText(fd int) (string, string) {
+	if len(i.pipelines) == 0 && !i.negated {
+		return fmt.Sprintf("%s() { printf '%%d\\n' \"$1\" 2>/dev/null >&%d || :; return \"$2\"; }; ", ProbeFunc, fd),
+			ProbeFunc + " %d \"$?\" \"$_\" && : \"$_\"; "
+	}
+
+	def := fmt.Sprintf("%[1]s() { printf '%%d\\n' \"$1\" 2>/dev/null >&%[2]d || :; "+
+		"local s=$2 p=0; %[3]s=(); shift 2; "+
+		"while (( $# > 1 )); do %[3]s+=(\"$1\"); if [[ ! -o pipefail ]] || (( $1 )); then p=$1; fi; shift; done; "+
+		"(( ${#%[3]s[@]} )) || %[3]s=(\"$s\") p=$s; "+
+		"if (( s != p )); then %[4]s=${#%[3]s[@]}!; elif (( s )); then %[4]s=${#%[3]s[@]}n; elif (( ${#%[3]s[@]} > 1 )); then %[4]s=${#%[3]s[@]}z; else return 0; fi; "+
+		"return 1; }; %[5]s() { return \"${%[3]s[$1]}\"; }; ", ProbeFunc, fd, probeStatuses, probeForm, probeExit)
+
+	var call strings.Builder
+
+	fmt.Fprintf(&call, "if %[1]s %%d \"$?\" \"${PIPESTATUS[@]}\" \"$_\"; then : \"$_\"; else case $%[2]s in 1n) %[3]s 0 \"$_\" && :;; 1!) ! %[3]s 0 \"$_\";; ", ProbeFunc, probeForm, probeExit)
+
+	for _, length := range slices.Sorted(maps.Keys(i.pipelines)) {
+		stages := make([]string, length)
+
+		for n := range stages {
+			stages[n] = fmt.Sprintf("%s %d", probeExit, n)
+		}
+
+		pipeline := strings.Join(stages, " | ")
+
+		fmt.Fprintf(&call, "%[1]dz) %[2]s || :;; %[1]dn) %[2]s && :;; %[1]d!) ! %[2]s;; ", length, pipeline)
+	}
+
+	call.WriteString("esac; fi; ")
+
+	return def, call.String()
+}
+
+// statement adds the probe for a statement, and for each of the pipelines that
+// follow an '&&' or '||'.
+func (i *instrumenter) statement(st *bash.Statement) {
+	if len(st.Tokens) == 0 {
+		return
+	}
+
+	last := st
+
+	for ; last.Statement != nil; last = last.Statement {
+		if next := last.Statement; len(next.Pipeline.Tokens) > 0 {
+			start, end := i.span(next.Pipeline.Tokens)
+
+			i.add(probe{block: Block{Kind: Branch}, start: start, end: end, at: start, group: true})
+		}
+	}
+
+	start, _ := i.span(st.Tokens)
+	_, end := i.span(last.Pipeline.Tokens)
+
+	i.add(probe{block: Block{Kind: Statement}, start: start, end: end, at: start})
+}
+
+// caseArm adds the probe for an arm of a case statement, which is inserted
+// after the closing parenthesis of its patterns.
+func (i *instrumenter) caseArm(pl *bash.PatternLines) {
+	if len(pl.Tokens) == 0 || len(pl.Patterns) == 0 {
+		return
+	}
+
+	start, end := i.span(pl.Tokens)
+	_, patterns := i.span(pl.Patterns[len(pl.Patterns)-1].Tokens)
+
+	for _, tk := range pl.Tokens {
+		if tk.Pos >= patterns && tk.Data == ")" {
+			i.add(probe{block: Block{Kind: CaseArm}, start: start, end: end, at: tk.Pos + 1})
+
+			return
+		}
+	}
+}
+
+// span returns the byte offsets of the start and end of a list of tokens.
+func (i *instrumenter) span(tks bash.Tokens) (uint64, uint64) {
+	if len(tks) == 0 {
+		return 0, 0
+	}
+
+	last := tks[len(tks)-1]
+
+	return tks[0].Pos, last.Pos + uint64(len(last.Data))
+}
+
+func (i *instrumenter) add(p probe) {
+	p.block.Start = i.position(p.start)
+	p.block.End = i.position(p.end)
+	i.probes = append(i.probes, p)
+}
+
+// position converts a byte offset to a Position.
+func (i *instrumenter) position(pos uint64) Position {
+	line, _ := slices.BinarySearch(i.lines, pos+1)
+
+	return Position{Line: uint64(line), Column: pos - i.lines[line-1] + 1}
+}
+
+// ErrInvalidHit is returned by ReadHits when a line is not the number of one
+// of the blocks of the Profile.
+var ErrInvalidHit = errors.New("invalid hit")
+
+// ReadHits reads the hits recorded by the probes of an instrumented script,
+// adding them to the counts of the blocks.
+func (p *Profile) ReadHits(r io.Reader) error {
+	s := bufio.NewScanner(r)
+
+	for line := 1; s.Scan(); line++ {
+		id, err := strconv.ParseUint(strings.TrimSpace(s.Text()), 10, 64)
+		if err != nil || id >= uint64(len(p.Blocks)) {
+			return fmt.Errorf("%w: line %d: %q", ErrInvalidHit, line, s.Text())
+		}
+
+		p.Blocks[id].Count++
+	}
+
+	return s.Err()
+}
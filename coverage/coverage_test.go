@@ -0,0 +1,349 @@
+package coverage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"vimagination.zapto.org/bash/interp"
+)
+
+const probeDef = "__coverage_probe() { printf '%d\\n' \"$1\" 2>/dev/null >&9 || :; return \"$2\"; }; "
+
+const pipelineProbeDef = `__coverage_probe() { printf '%d\n' "$1" 2>/dev/null >&9 || :; local s=$2 p=0; __coverage_ps=(); shift 2; ` +
+	`while (( $# > 1 )); do __coverage_ps+=("$1"); if [[ ! -o pipefail ]] || (( $1 )); then p=$1; fi; shift; done; ` +
+	`(( ${#__coverage_ps[@]} )) || __coverage_ps=("$s") p=$s; ` +
+	`if (( s != p )); then __coverage_form=${#__coverage_ps[@]}!; elif (( s )); then __coverage_form=${#__coverage_ps[@]}n; elif (( ${#__coverage_ps[@]} > 1 )); then __coverage_form=${#__coverage_ps[@]}z; else return 0; fi; ` +
+	`return 1; }; __coverage_exit() { return "${__coverage_ps[$1]}"; }; `
+
+type nopCloser struct {
+	io.ReadWriter
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type result struct {
+	Stdout, Stderr, Hits string
+	Status               int
+}
+
+// run sources a script, with fd 9 opened to record the hits of its probes.
+func run(_ *testing.T, src string) (result, error) {
+	var stdout, stderr, hits strings.Builder
+
+	files := fstest.MapFS{"script.sh": {Data: []byte(src)}}
+	r := interp.Runner{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Open: interp.OpenFunc(func(_ context.Context, name string, flag int, _ fs.FileMode) (io.ReadWriteCloser, error) {
+			if name == "/hits" {
+				return nopCloser{struct {
+					io.Reader
+					io.Writer
+				}{strings.NewReader(""), &hits}}, nil
+			} else if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+				return nil, fs.ErrPermission
+			}
+
+			f, err := files.Open(strings.TrimPrefix(name, "/"))
+			if err != nil {
+				return nil, err
+			}
+
+			return nopCloser{struct {
+				io.Reader
+				io.Writer
+			}{f, io.Discard}}, nil
+		}),
+	}
+
+	status, err := r.RunString(context.Background(), "exec 9>/hits; . /script.sh")
+
+	return result{Stdout: stdout.String(), Stderr: stderr.String(), Hits: hits.String(), Status: status}, err
+}
+
+// runBash sources a script with bash, as run does.
+func runBash(t *testing.T, src string) (result, error) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.sh")
+	hitsFile := filepath.Join(dir, "hits")
+
+	if err := os.WriteFile(script, []byte(src), 0o600); err != nil {
+		return result{}, err
+	}
+
+	var stdout, stderr strings.Builder
+
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-c", `exec 9>"$HITS"; . "$SCRIPT"`)
+	cmd.Dir = dir
+	cmd.Env = []string{"HITS=" + hitsFile, "SCRIPT=" + script}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	var (
+		status int
+		exit   *exec.ExitError
+	)
+
+	if err := cmd.Run(); errors.As(err, &exit) {
+		status = exit.ExitCode()
+	} else if err != nil {
+		return result{}, err
+	}
+
+	hits, err := os.ReadFile(hitsFile)
+
+	return result{Stdout: stdout.String(), Stderr: stderr.String(), Hits: string(hits), Status: status}, err
+}
+
+// runners returns the functions with which to run the scripts of a test;
+// bash, when installed, as well as the interpreter.
+func runners() []func(*testing.T, string) (result, error) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		return []func(*testing.T, string) (result, error){run}
+	}
+
+	return []func(*testing.T, string) (result, error){run, runBash}
+}
+
+func TestInstrument(t *testing.T) {
+	runs := runners()
+
+	for n, test := range [...]struct {
+		Script       string
+		Instrumented string
+		Stdout       string
+		Status       int
+		Counts       []uint64
+	}{
+		{ // 1
+			Script:       "echo a\necho b",
+			Instrumented: probeDef + "__coverage_probe 0 \"$?\" \"$_\" && : \"$_\"; echo a\n__coverage_probe 1 \"$?\" \"$_\" && : \"$_\"; echo b",
+			Stdout:       "a\nb\n",
+			Counts:       []uint64{1, 1},
+		},
+		{ // 2
+			Script:       "true && echo a || echo b",
+			Instrumented: probeDef + "__coverage_probe 0 \"$?\" \"$_\" && : \"$_\"; true && { __coverage_probe 1 \"$?\" \"$_\" && : \"$_\"; echo a; } || { __coverage_probe 2 \"$?\" \"$_\" && : \"$_\"; echo b; }",
+			Stdout:       "a\n",
+			Counts:       []uint64{1, 1, 0},
+		},
+		{ // 3
+			Script:       "case $1 in\na) echo a;;\n*) ;;\nesac",
+			Instrumented: probeDef + "__coverage_probe 0 \"$?\" \"$_\" && : \"$_\"; case $1 in\na)__coverage_probe 1 \"$?\" \"$_\" && : \"$_\";  __coverage_probe 2 \"$?\" \"$_\" && : \"$_\"; echo a;;\n*)__coverage_probe 3 \"$?\" \"$_\" && : \"$_\";  ;;\nesac",
+			Counts:       []uint64{1, 0, 0, 1},
+		},
+		{ // 4
+			Script: "false\necho $?\n(exit 3); echo $?",
+			Stdout: "1\n3\n",
+			Counts: []uint64{1, 1, 1, 1, 1},
+		},
+		{ // 5
+			Script: "echo $LINENO\n\necho $LINENO",
+			Stdout: "1\n3\n",
+			Counts: []uint64{1, 1},
+		},
+		{ // 6
+			Script:       "read -r x <<EOF && echo \"$x done\"\n$LINENO\nEOF\necho $LINENO",
+			Instrumented: probeDef + "__coverage_probe 0 \"$?\" \"$_\" && : \"$_\"; read -r x <<EOF && { __coverage_probe 1 \"$?\" \"$_\" && : \"$_\"; echo \"$x done\"; }\n$LINENO\nEOF\n__coverage_probe 2 \"$?\" \"$_\" && : \"$_\"; echo $LINENO",
+			Stdout:       "1 done\n4\n",
+			Counts:       []uint64{1, 1, 1},
+		},
+		{ // 7
+			Script: "set -e\nf() { return 2; }\nf || echo caught\nfalse\necho unreached",
+			Stdout: "caught\n",
+			Status: 1,
+			Counts: []uint64{1, 1, 1, 1, 1, 1, 0},
+		},
+		{ // 8
+			Script: "for i in 1 2 3; do\n\tif [ $i = 2 ]; then\n\t\tcontinue\n\tfi\n\techo $i\ndone",
+			Stdout: "1\n3\n",
+			Counts: []uint64{1, 3, 1, 2},
+		},
+		{ // 9
+			Script: "x=$(echo a; echo b) && echo \"$x\"\nexit 4\necho unreached",
+			Stdout: "a\nb\n",
+			Status: 4,
+			Counts: []uint64{1, 1, 1, 1, 1, 0},
+		},
+		{ // 10
+			Script: "# comment\n",
+		},
+		{ // 11
+			Script: "true | true",
+			Instrumented: pipelineProbeDef + `if __coverage_probe 0 "$?" "${PIPESTATUS[@]}" "$_"; then : "$_"; else case $__coverage_form in ` +
+				`1n) __coverage_exit 0 "$_" && :;; 1!) ! __coverage_exit 0 "$_";; ` +
+				`2z) __coverage_exit 0 | __coverage_exit 1 || :;; 2n) __coverage_exit 0 | __coverage_exit 1 && :;; 2!) ! __coverage_exit 0 | __coverage_exit 1;; ` +
+				`esac; fi; true | true`,
+			Counts: []uint64{1},
+		},
+		{ // 12
+			Script: "false | true\necho \"${PIPESTATUS[@]} $?\"\n! true\necho \"${PIPESTATUS[@]} $?\"\ntrue | false\necho \"${PIPESTATUS[@]} $?\"\nfalse\necho \"${PIPESTATUS[@]} $?\"",
+			Stdout: "1 0 0\n0 1\n0 1 1\n1 1\n",
+			Counts: []uint64{1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		{ // 13
+			Script: "set -o pipefail\nfalse | true || echo \"${PIPESTATUS[@]} $?\"\n! false | true\necho \"${PIPESTATUS[@]} $?\"",
+			Stdout: "1 0 1\n1 0 0\n",
+			Counts: []uint64{1, 1, 1, 1, 1},
+		},
+		{ // 14
+			Script: "echo a b\necho \"$_\"\nx=1\necho \"$_\"\nf() { :; }\nf c d\necho \"$_\"",
+			Stdout: "a b\nb\n\nd\n",
+			Counts: []uint64{1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		{ // 15
+			Script: "echo a b\ntrue | true c\necho \"$_\"\n! true d\necho \"$_\"",
+			Stdout: "a b\nb\nd\n",
+			Counts: []uint64{1, 1, 1, 1, 1},
+		},
+		{ // 16
+			Script: "set -e\ntrap 'echo err' ERR\ntrue | false && :\necho \"${PIPESTATUS[@]} $?\"\nfalse | true\n! true\necho end\nfalse | false\necho unreached",
+			Stdout: "0 1 1\nend\nerr\n",
+			Status: 1,
+			Counts: []uint64{1, 1, 1, 0, 1, 1, 1, 1, 1, 0},
+		},
+		{ // 17
+			Script:       "read -r x <<E\nvalue $(echo inner; echo more)\nE\necho \"$x\"",
+			Instrumented: probeDef + "__coverage_probe 0 \"$?\" \"$_\" && : \"$_\"; read -r x <<E\nvalue $(echo inner; echo more)\nE\n__coverage_probe 1 \"$?\" \"$_\" && : \"$_\"; echo \"$x\"",
+			Stdout:       "value inner\n",
+			Counts:       []uint64{1, 1},
+		},
+	} {
+		instrumented, p, err := Instrument("script.sh", test.Script, 9)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+
+			continue
+		} else if test.Instrumented != "" && instrumented != test.Instrumented {
+			t.Errorf("test %d: expecting instrumented script %q, got %q", n+1, test.Instrumented, instrumented)
+
+			continue
+		}
+
+		for m, runner := range runs {
+			q := Profile{Blocks: slices.Clone(p.Blocks)}
+
+			for l, src := range [...]string{test.Script, instrumented} {
+				res, err := runner(t, src)
+				if err != nil {
+					t.Errorf("test %d.%d.%d: unexpected error: %s", n+1, m+1, l+1, err)
+				} else if res.Stdout != test.Stdout {
+					t.Errorf("test %d.%d.%d: expecting stdout %q, got %q", n+1, m+1, l+1, test.Stdout, res.Stdout)
+				} else if res.Status != test.Status {
+					t.Errorf("test %d.%d.%d: expecting status %d, got %d", n+1, m+1, l+1, test.Status, res.Status)
+				} else if err := q.ReadHits(strings.NewReader(res.Hits)); err != nil {
+					t.Errorf("test %d.%d.%d: unexpected error reading hits: %s", n+1, m+1, l+1, err)
+				}
+			}
+
+			var counts []uint64
+
+			for _, b := range q.Blocks {
+				counts = append(counts, b.Count)
+			}
+
+			if !reflect.DeepEqual(counts, test.Counts) {
+				t.Errorf("test %d.%d: expecting counts %v, got %v", n+1, m+1, test.Counts, counts)
+			}
+		}
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	_, p, err := Instrument("script.sh", "a && b\nc() {\n\td\n}\ncase x in\ny) e;;\nesac", 9)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []Block{
+		{Kind: Statement, Start: Position{1, 1}, End: Position{1, 7}},
+		{Kind: Branch, Start: Position{1, 6}, End: Position{1, 7}},
+		{Kind: Statement, Start: Position{2, 1}, End: Position{4, 2}},
+		{Kind: Statement, Start: Position{3, 2}, End: Position{3, 3}},
+		{Kind: Statement, Start: Position{5, 1}, End: Position{7, 5}},
+		{Kind: CaseArm, Start: Position{6, 1}, End: Position{6, 7}},
+		{Kind: Statement, Start: Position{6, 4}, End: Position{6, 5}},
+	}
+
+	if !reflect.DeepEqual(p.Blocks, expected) {
+		t.Errorf("expecting blocks %v, got %v", expected, p.Blocks)
+	}
+}
+
+func TestReadHits(t *testing.T) {
+	p := Profile{Blocks: make([]Block, 3)}
+
+	if err := p.ReadHits(strings.NewReader("0\n2\n2\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := p.ReadHits(strings.NewReader("1\n3\n")); !errors.Is(err, ErrInvalidHit) {
+		t.Errorf("expecting error %v, got %v", ErrInvalidHit, err)
+	}
+
+	if err := p.ReadHits(strings.NewReader("x\n")); !errors.Is(err, ErrInvalidHit) {
+		t.Errorf("expecting error %v, got %v", ErrInvalidHit, err)
+	}
+
+	for n, count := range [...]uint64{1, 1, 2} {
+		if p.Blocks[n].Count != count {
+			t.Errorf("block %d: expecting count %d, got %d", n, count, p.Blocks[n].Count)
+		}
+	}
+}
+
+func TestInstrumentLimitations(t *testing.T) {
+	runs := runners()
+
+	for n, test := range [...]struct {
+		Script string
+		Stdout string
+		Stderr []string
+	}{
+		{ // 1
+			Script: "set -x\necho a",
+			Stdout: "a\n",
+			Stderr: []string{" __coverage_probe 1 0 -x\n", " : -x\n", " echo a\n"},
+		},
+		{ // 2
+			Script: "trap 'echo debug' DEBUG\necho a",
+			Stdout: "debug\ndebug\ndebug\na\n",
+		},
+	} {
+		instrumented, _, err := Instrument("script.sh", test.Script, 9)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+
+			continue
+		}
+
+		for m, runner := range runs {
+			res, err := runner(t, instrumented)
+			if err != nil {
+				t.Errorf("test %d.%d: unexpected error: %s", n+1, m+1, err)
+
+				continue
+			} else if res.Stdout != test.Stdout {
+				t.Errorf("test %d.%d: expecting stdout %q, got %q", n+1, m+1, test.Stdout, res.Stdout)
+			}
+
+			for _, expected := range test.Stderr {
+				if !strings.Contains(res.Stderr, expected) {
+					t.Errorf("test %d.%d: expecting stderr to contain %q, got %q", n+1, m+1, expected, res.Stderr)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package coverage_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"vimagination.zapto.org/bash/coverage"
+)
+
+func Example() {
+	src := "if [ \"$1\" = \"-v\" ]; then\n\tverbose=1\nfi\n[ -n \"$verbose\" ] && echo starting\necho done\n"
+
+	instrumented, profile, err := coverage.Instrument("script.sh", src, 9)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	fmt.Println(strings.Count(instrumented, "\n") == strings.Count(src, "\n"))
+
+	// The hits written to fd 9 by running the instrumented script, such as
+	// with 'bash instrumented.sh 9>hits'.
+	hits := "0\n2\n4\n"
+
+	if err := profile.ReadHits(strings.NewReader(hits)); err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	profile.WriteText(os.Stdout)
+
+	// Output:
+	// true
+	//      1      1  if [ "$1" = "-v" ]; then
+	//      0      2  	verbose=1
+	//      -      3  fi
+	//      1*     4  [ -n "$verbose" ] && echo starting
+	//      1      5  echo done
+	// script.sh: 60.0% of blocks covered (3/5)
+}
@@ -0,0 +1,186 @@
+package coverage
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// Line is a line of the source of a script, along with the coverage of the
+// blocks that start on it.
+//
+// Count is the count of the first block starting on the line, Blocks the
+// number of blocks starting on it, and Covered the number of those that were
+// reached.
+type Line struct {
+	Number  uint64
+	Text    string
+	Count   uint64
+	Blocks  int
+	Covered int
+}
+
+// Partial returns true when some, but not all, of the blocks starting on the
+// line were reached.
+func (l Line) Partial() bool {
+	return l.Covered > 0 && l.Covered < l.Blocks
+}
+
+// Lines returns the lines of the source of the script, with the coverage of
+// each.
+func (p *Profile) Lines() []Line {
+	texts := strings.Split(strings.TrimSuffix(p.Source, "\n"), "\n")
+	lines := make([]Line, len(texts))
+
+	for n, text := range texts {
+		lines[n] = Line{Number: uint64(n + 1), Text: text}
+	}
+
+	for _, b := range p.Blocks {
+		if b.Start.Line == 0 || b.Start.Line > uint64(len(lines)) {
+			continue
+		}
+
+		l := &lines[b.Start.Line-1]
+
+		if l.Blocks == 0 {
+			l.Count = b.Count
+		}
+
+		l.Blocks++
+
+		if b.Count > 0 {
+			l.Covered++
+		}
+	}
+
+	return lines
+}
+
+// Covered returns the number of blocks that were reached, and the total number
+// of blocks.
+func (p *Profile) Covered() (int, int) {
+	var covered int
+
+	for _, b := range p.Blocks {
+		if b.Count > 0 {
+			covered++
+		}
+	}
+
+	return covered, len(p.Blocks)
+}
+
+// percent returns the percentage of blocks reached.
+func (p *Profile) percent() float64 {
+	covered, total := p.Covered()
+	if total == 0 {
+		return 100
+	}
+
+	return 100 * float64(covered) / float64(total)
+}
+
+// WriteText writes the source of the script, with each line prefixed by its
+// count; a line on which no block starts is prefixed with '-', and one on
+// which only some of the blocks were reached is marked with a '*'. A summary
+// of the coverage is written after the source.
+func (p *Profile) WriteText(w io.Writer) error {
+	for _, l := range p.Lines() {
+		count, mark := "-", " "
+
+		if l.Blocks > 0 {
+			count = fmt.Sprint(l.Count)
+		}
+
+		if l.Partial() {
+			mark = "*"
+		}
+
+		if _, err := fmt.Fprintf(w, "%6s%s %5d  %s\n", count, mark, l.Number, l.Text); err != nil {
+			return err
+		}
+	}
+
+	covered, total := p.Covered()
+
+	_, err := fmt.Fprintf(w, "%s: %.1f%% of blocks covered (%d/%d)\n", p.Name, p.percent(), covered, total)
+
+	return err
+}
+
+const (
+	htmlStart = `<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8">
+		<title>%[1]s</title>
+		<style>
+			pre { counter-reset: line }
+			pre span::before { counter-increment: line; content: counter(line); display: inline-block; width: 4em; padding-right: 1em; text-align: right; color: #888 }
+			.covered { background-color: #cfc }
+			.partial { background-color: #ffc }
+			.uncovered { background-color: #fcc }
+		</style>
+	</head>
+	<body>
+		<h1>%[1]s</h1>
+		<p>%.1[2]f%% of blocks covered (%[3]d/%[4]d)</p>
+		<pre>`
+	htmlEnd = `</pre>
+	</body>
+</html>
+`
+)
+
+// WriteHTML writes the source of the script as an HTML page, with each line
+// on which a block starts coloured by its coverage, and titled with its count.
+func (p *Profile) WriteHTML(w io.Writer) error {
+	covered, total := p.Covered()
+
+	if _, err := fmt.Fprintf(w, htmlStart, html.EscapeString(p.Name), p.percent(), covered, total); err != nil {
+		return err
+	}
+
+	for _, l := range p.Lines() {
+		var err error
+
+		switch text := html.EscapeString(l.Text); {
+		case l.Blocks == 0:
+			_, err = fmt.Fprintf(w, "<span>%s</span>\n", text)
+		case l.Partial():
+			_, err = fmt.Fprintf(w, "<span class=\"partial\" title=\"%d (%d/%d blocks)\">%s</span>\n", l.Count, l.Covered, l.Blocks, text)
+		case l.Covered > 0:
+			_, err = fmt.Fprintf(w, "<span class=\"covered\" title=\"%d\">%s</span>\n", l.Count, text)
+		default:
+			_, err = fmt.Fprintf(w, "<span class=\"uncovered\" title=\"0\">%s</span>\n", text)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, htmlEnd)
+
+	return err
+}
+
+// WriteGoProfile writes the coverage in the format of the profiles written by
+// 'go test -coverprofile', in count mode, allowing them to be read by
+// 'go tool cover' and other tools that accept them. Each block is counted as a
+// single statement.
+func (p *Profile) WriteGoProfile(w io.Writer) error {
+	if _, err := io.WriteString(w, "mode: count\n"); err != nil {
+		return err
+	}
+
+	for _, b := range p.Blocks {
+		if _, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d 1 %d\n", p.Name, b.Start.Line, b.Start.Column, b.End.Line, b.End.Column, b.Count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
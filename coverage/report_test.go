@@ -0,0 +1,77 @@
+package coverage
+
+import (
+	"strings"
+	"testing"
+)
+
+var testProfile = Profile{
+	Name:   "script.sh",
+	Source: "# <test>\nfalse && echo yes\necho a\necho b\n",
+	Blocks: []Block{
+		{Kind: Statement, Start: Position{2, 1}, End: Position{2, 18}, Count: 1},
+		{Kind: Branch, Start: Position{2, 10}, End: Position{2, 18}},
+		{Kind: Statement, Start: Position{3, 1}, End: Position{3, 7}, Count: 2},
+		{Kind: Statement, Start: Position{4, 1}, End: Position{4, 7}},
+	},
+}
+
+func TestWriteText(t *testing.T) {
+	var sb strings.Builder
+
+	if err := testProfile.WriteText(&sb); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const expected = "" +
+		"     -      1  # <test>\n" +
+		"     1*     2  false && echo yes\n" +
+		"     2      3  echo a\n" +
+		"     0      4  echo b\n" +
+		"script.sh: 50.0% of blocks covered (2/4)\n"
+
+	if got := sb.String(); got != expected {
+		t.Errorf("expecting output %q, got %q", expected, got)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var sb strings.Builder
+
+	if err := testProfile.WriteHTML(&sb); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := sb.String()
+
+	for _, expected := range [...]string{
+		"<title>script.sh</title>",
+		"<p>50.0% of blocks covered (2/4)</p>",
+		"<pre><span># &lt;test&gt;</span>\n",
+		"<span class=\"partial\" title=\"1 (1/2 blocks)\">false &amp;&amp; echo yes</span>\n",
+		"<span class=\"covered\" title=\"2\">echo a</span>\n",
+		"<span class=\"uncovered\" title=\"0\">echo b</span>\n</pre>",
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("expecting output to contain %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestWriteGoProfile(t *testing.T) {
+	var sb strings.Builder
+
+	if err := testProfile.WriteGoProfile(&sb); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const expected = "mode: count\n" +
+		"script.sh:2.1,2.18 1 1\n" +
+		"script.sh:2.10,2.18 1 0\n" +
+		"script.sh:3.1,3.7 1 2\n" +
+		"script.sh:4.1,4.7 1 0\n"
+
+	if got := sb.String(); got != expected {
+		t.Errorf("expecting output %q, got %q", expected, got)
+	}
+}
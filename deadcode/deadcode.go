@@ -0,0 +1,409 @@
+// Package deadcode finds, and optionally removes, the unused definitions and
+// unreachable code of a parsed bash file.
+package deadcode
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/callgraph"
+	"vimagination.zapto.org/bash/cfg"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/bash/scope"
+)
+
+// Kind represents the type of dead code found.
+type Kind uint8
+
+// Kinds.
+const (
+	UnusedFunction Kind = iota
+	UnusedVariable
+	UnreachableCode
+	ShadowedCase
+)
+
+// String implements the fmt.Stringer interface.
+func (k Kind) String() string {
+	switch k {
+	case UnusedFunction:
+		return "unused function"
+	case UnusedVariable:
+		return "unused variable"
+	case UnreachableCode:
+		return "unreachable code"
+	case ShadowedCase:
+		return "shadowed case"
+	}
+
+	return "unknown"
+}
+
+// Finding is a single piece of dead code.
+//
+// Name is the name of the unused function or variable, and is empty for the
+// other Kinds. Tokens contains the tokens of the dead code.
+//
+// Node is the *bash.Statement or *bash.PatternLines that will be removed by
+// the Remove function, and is nil if the code cannot be safely removed, such
+// as an unused variable assigned by a command that also does other work.
+type Finding struct {
+	Kind   Kind
+	Name   string
+	Tokens bash.Tokens
+	Node   bash.Type
+}
+
+// Find returns the dead code of a parsed file, in source order.
+//
+// This includes functions that are never called, variables that are assigned
+// but never read, statements that follow an unconditional exit, return, exec,
+// break, or continue, and case arms that follow a '*' pattern.
+//
+// Variables set by the shell, or used to configure it, such as IFS, are not
+// reported, nor are exported variables and functions. Functions are not
+// reported when the file contains commands with non-literal names, as they
+// may call any function, and variables are not reported when it uses 'eval'
+// or indirect expansion, '${!name}', as they may read any variable.
+func Find(f *bash.File) []Finding {
+	var findings []Finding
+
+	findings = append(findings, unusedFunctions(f)...)
+	findings = append(findings, unusedVariables(f)...)
+	findings = append(findings, unreachable(f)...)
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Compare(a.Tokens[0].Pos, b.Tokens[0].Pos)
+	})
+
+	return findings
+}
+
+func unusedFunctions(f *bash.File) []Finding {
+	g := callgraph.Build(f)
+
+	for _, c := range g.Calls {
+		if c.Kind == callgraph.CallDynamic {
+			return nil
+		}
+	}
+
+	var (
+		findings []Finding
+		reached  = g.Reachable()
+		exported = exportedFunctions(f)
+	)
+
+	statements := statementsOf(f, func(s *bash.Statement) bash.Type {
+		if c := s.Pipeline.CommandOrCompound.Compound; c != nil && c.FunctionCompound != nil && s.Statement == nil && s.Pipeline.Pipeline == nil {
+			return c.FunctionCompound
+		}
+
+		return nil
+	})
+
+	for _, fn := range g.Functions {
+		if slices.Contains(reached, fn) || exported[fn.Name] {
+			continue
+		}
+
+		findings = append(findings, Finding{Kind: UnusedFunction, Name: fn.Name, Tokens: fn.Definition.Tokens, Node: statements[fn.Definition]})
+	}
+
+	return findings
+}
+
+func exportedFunctions(f *bash.File) map[string]bool {
+	exported := make(map[string]bool)
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if c, ok := t.(*bash.Command); ok && astutil.IsDeclaration(astutil.CommandName(c)) {
+			for _, d := range astutil.Declarations(c) {
+				if strings.Contains(d.Flags, "f") && strings.Contains(d.Flags, "x") {
+					exported[d.Name] = true
+				}
+			}
+		}
+
+		return true
+	})
+
+	return exported
+}
+
+// statementsOf calls fn with each of the removable Statements, those directly
+// within a Line and run in the foreground, mapping the returned nodes to the
+// Statements.
+func statementsOf(f *bash.File, fn func(*bash.Statement) bash.Type) map[bash.Type]*bash.Statement {
+	statements := make(map[bash.Type]*bash.Statement)
+
+	astutil.Inspect(f, func(t bash.Type, parents []bash.Type) bool {
+		if s, ok := t.(*bash.Statement); ok && len(parents) > 0 {
+			if _, inLine := parents[len(parents)-1].(*bash.Line); inLine && s.JobControl == bash.JobControlForeground {
+				if node := fn(s); node != nil {
+					statements[node] = s
+				}
+			}
+		}
+
+		return true
+	})
+
+	return statements
+}
+
+func unusedVariables(f *bash.File) []Finding {
+	if readsDynamically(f) {
+		return nil
+	}
+
+	var (
+		findings []Finding
+		unused   = make(map[*bash.Token]*scope.Symbol)
+	)
+
+	for _, sym := range scope.Resolve(f).Unused() {
+		switch sym.Binding {
+		case scope.BindAssignment, scope.BindDeclaration, scope.BindArithmetic:
+			if !scope.ShellVariables[sym.Name] {
+				unused[sym.Token] = sym
+			}
+		}
+	}
+
+	if len(unused) == 0 {
+		return nil
+	}
+
+	spans := make(map[*bash.Token]bash.Tokens)
+	removable := make(map[*bash.Token]*bash.Statement)
+
+	statementsOf(f, func(s *bash.Statement) bash.Type {
+		c := s.Pipeline.CommandOrCompound.Command
+		if c == nil || s.Statement != nil || s.Pipeline.Pipeline != nil || s.Pipeline.Not || len(c.Redirections) > 0 {
+			return nil
+		}
+
+		var (
+			tokens []*bash.Token
+			values []bash.Type
+		)
+
+		for n := range c.Vars {
+			if a := &c.Vars[n]; a.Identifier.Identifier != nil {
+				tokens = append(tokens, a.Identifier.Identifier)
+				spans[a.Identifier.Identifier] = a.Tokens
+
+				if a.Value != nil {
+					values = append(values, a.Value)
+				}
+			}
+		}
+
+		if len(c.AssignmentsOrWords) > 0 {
+			if !astutil.IsDeclaration(astutil.CommandName(c)) {
+				return nil
+			}
+
+			for _, d := range astutil.Declarations(c) {
+				tokens = append(tokens, d.Token)
+				spans[d.Token] = d.Tokens
+
+				if d.Assignment != nil && d.Assignment.Value != nil {
+					values = append(values, d.Assignment.Value)
+				}
+			}
+		}
+
+		if len(tokens) > 0 && !slices.ContainsFunc(tokens, func(tk *bash.Token) bool { return unused[tk] == nil }) && !slices.ContainsFunc(values, hasSubstitution) {
+			for _, tk := range tokens {
+				removable[tk] = s
+			}
+		}
+
+		return nil
+	})
+
+	for tk, sym := range unused {
+		finding := Finding{Kind: UnusedVariable, Name: sym.Name, Tokens: spans[tk]}
+
+		if finding.Tokens == nil {
+			finding.Tokens = bash.Tokens{*tk}
+		}
+
+		if s := removable[tk]; s != nil {
+			finding.Node = s
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// readsDynamically determines whether the file reads variables whose names
+// are only known when it is run, with 'eval' or indirect expansion.
+func readsDynamically(f *bash.File) bool {
+	var found bool
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.Command:
+			found = astutil.CommandName(t) == "eval"
+		case *bash.ParameterExpansion:
+			found = t.Indirect
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+func hasSubstitution(t bash.Type) bool {
+	var found bool
+
+	astutil.Inspect(t, func(t bash.Type, _ []bash.Type) bool {
+		if _, ok := t.(*bash.CommandSubstitution); ok {
+			found = true
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+func unreachable(f *bash.File) []Finding {
+	var (
+		findings  []Finding
+		reachable = make(map[bash.Type]bool)
+	)
+
+	for _, g := range cfg.Build(f).Graphs {
+		blocks := g.Reachable()
+
+		for _, bl := range g.Blocks {
+			for _, node := range bl.Nodes {
+				reachable[node] = slices.Contains(blocks, bl)
+			}
+		}
+	}
+
+	astutil.Inspect(f, func(t bash.Type, parents []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.PatternLines:
+			if !reachable[t] {
+				findings = append(findings, Finding{Kind: ShadowedCase, Tokens: t.Tokens, Node: t})
+
+				return false
+			}
+		case *bash.Statement:
+			if _, inLine := parents[len(parents)-1].(*bash.Line); inLine && !entryReachable(t, reachable) {
+				findings = append(findings, Finding{Kind: UnreachableCode, Tokens: t.Tokens, Node: t})
+
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return findings
+}
+
+// entryReachable determines whether the first node of the Statement to be run
+// is reachable.
+func entryReachable(s *bash.Statement, reachable map[bash.Type]bool) bool {
+	found, ok := false, true
+
+	astutil.Inspect(s, func(t bash.Type, _ []bash.Type) bool {
+		if found {
+			return false
+		}
+
+		if r, isNode := reachable[t]; isNode {
+			found, ok = true, r
+
+			return false
+		}
+
+		return true
+	})
+
+	return ok
+}
+
+// Remove removes the Nodes of the given Findings from the file.
+//
+// Any Line left without Statements is removed, along with its comments. Code
+// that bash requires to contain at least one statement, such as the body of a
+// function or loop, is left untouched when all of its statements would be
+// removed.
+//
+// As removing code can leave further definitions unused, Find and Remove may
+// need to be run repeatedly to remove all dead code.
+func Remove(f *bash.File, findings []Finding) {
+	remove := make(map[bash.Type]bool)
+
+	for _, finding := range findings {
+		if finding.Node != nil {
+			remove[finding.Node] = true
+		}
+	}
+
+	removeStatements(f, remove, false)
+
+	astutil.Inspect(f, func(t bash.Type, parents []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.File:
+			if len(parents) > 0 {
+				_, optional := parents[len(parents)-1].(*bash.PatternLines)
+
+				removeStatements(t, remove, !optional)
+			}
+		case *bash.CaseCompound:
+			var matches []bash.PatternLines
+
+			for n := range t.Matches {
+				if !remove[&t.Matches[n]] {
+					matches = append(matches, t.Matches[n])
+				}
+			}
+
+			t.Matches = matches
+		}
+
+		return true
+	})
+}
+
+func removeStatements(f *bash.File, remove map[bash.Type]bool, required bool) {
+	var lines []bash.Line
+
+	for n := range f.Lines {
+		l := &f.Lines[n]
+
+		var statements []bash.Statement
+
+		for m := range l.Statements {
+			if !remove[&l.Statements[m]] {
+				statements = append(statements, l.Statements[m])
+			}
+		}
+
+		if len(statements) == len(l.Statements) {
+			lines = append(lines, *l)
+		} else if len(statements) > 0 {
+			line := *l
+			line.Statements = statements
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) > 0 || !required {
+		f.Lines = lines
+	}
+}
@@ -0,0 +1,128 @@
+package deadcode
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func TestFind(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    string
+		Findings []string
+	}{
+		{ // 1
+			"a() {\n\tb\n}\nb() {\n\t:\n}\nc() {\n\td\n}\nd() {\n\t:\n}\na",
+			[]string{"7:1 unused function c (removable)", "10:1 unused function d (removable)"},
+		},
+		{ // 2
+			"f() {\n\t:\n}\n\"$cmd\"",
+			nil,
+		},
+		{ // 3
+			"f() {\n\t:\n}\nexport -f f",
+			nil,
+		},
+		{ // 4
+			"a=1\nb=2\nIFS=,\nexport c=3\necho \"$b\"",
+			[]string{"1:1 unused variable a (removable)"},
+		},
+		{ // 5
+			"f() {\n\tlocal x=1 y\n\t(( z = 5 ))\n\ty=$(date)\n\techo \"$y\"\n}\nf",
+			[]string{"2:8 unused variable x", "3:5 unused variable z"},
+		},
+		{ // 6
+			"a=$(mktemp)\nb=1 c=2\nd=3 cmd",
+			[]string{"1:1 unused variable a", "2:1 unused variable b (removable)", "2:5 unused variable c (removable)"},
+		},
+		{ // 7
+			"echo a\nexit 1\necho b\nif true; then\n\techo c\nfi",
+			[]string{"3:1 unreachable code (removable)", "4:1 unreachable code (removable)"},
+		},
+		{ // 8
+			"f() {\n\treturn 0\n\techo a\n}\nf\nfor i in 1 2; do\n\tcontinue\n\techo \"$i\"\ndone",
+			[]string{"3:2 unreachable code (removable)", "8:2 unreachable code (removable)"},
+		},
+		{ // 9
+			"case $1 in\na) echo a;;\n*) echo b;;\nc) echo c;;\nd) echo d;;\nesac",
+			[]string{"4:1 shadowed case (removable)", "5:1 shadowed case (removable)"},
+		},
+		{ // 10
+			"case $1 in\n*) echo b;;&\nc) echo c;;\nesac",
+			nil,
+		},
+		{ // 11
+			"exec nginx\nf() {\n\t:\n}",
+			[]string{"2:1 unused function f (removable)", "2:1 unreachable code (removable)"},
+		},
+		{ // 12
+			"d=1\nx=2\ndeclare -n r=d\necho \"$r\"",
+			[]string{"2:1 unused variable x (removable)"},
+		},
+		{ // 13
+			"c=1\neval 'echo $c'",
+			nil,
+		},
+		{ // 14
+			"c=1\nname=c\necho \"${!name}\"",
+			nil,
+		},
+	} {
+		var findings []string
+
+		for _, f := range Find(testutil.Parse(t, test.Input)) {
+			finding := fmt.Sprintf("%d:%d %s", f.Tokens[0].Line+1, f.Tokens[0].LinePos+1, f.Kind)
+
+			if f.Name != "" {
+				finding += " " + f.Name
+			}
+
+			if f.Node != nil {
+				finding += " (removable)"
+			}
+
+			findings = append(findings, finding)
+		}
+
+		if !reflect.DeepEqual(findings, test.Findings) {
+			t.Errorf("test %d: expecting findings %q, got %q", n+1, test.Findings, findings)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	for n, test := range [...]struct {
+		Input, Output string
+	}{
+		{ // 1
+			"a() {\n\tb\n}\nb() {\n\t:\n}\nc() {\n\techo c\n}\na\n",
+			"a() { b; }\nb() { :; }\n\na;\n",
+		},
+		{ // 2
+			"x=1\ny=$(date)\necho a; exit; echo b\necho c\n",
+			"y=$(date);\necho a; exit;\n",
+		},
+		{ // 3
+			"f() {\n\tlocal unused=1\n}\nf\n",
+			"f() { local unused=1; }\nf;\n",
+		},
+		{ // 4
+			"case $1 in\n*) echo b;;\nc)\n\techo c\n\t;;\nesac\n",
+			"case $1 in\n*)\n\techo b;;\nesac;\n",
+		},
+		{ // 5
+			"d=1\nx=2\ndeclare -n r=d\necho \"$r\"\n",
+			"d=1;\n\ndeclare -n r=d;\necho \"$r\";\n",
+		},
+	} {
+		f := testutil.Parse(t, test.Input)
+
+		Remove(f, Find(f))
+
+		if output := fmt.Sprintf("%s", f); output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package deadcode_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/deadcode"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "#!/bin/bash\n\nold_helper() {\n\techo unused\n}\n\nversion=1.2\nname=app\n\necho \"$name\"\nexit 0\necho never\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	findings := deadcode.Find(b)
+
+	for _, f := range findings {
+		fmt.Printf("line %d: %s", f.Tokens[0].Line+1, f.Kind)
+
+		if f.Name != "" {
+			fmt.Printf(" %q", f.Name)
+		}
+
+		fmt.Println()
+	}
+
+	deadcode.Remove(b, findings)
+
+	fmt.Printf("%s", b)
+
+	// Output:
+	// line 3: unused function "old_helper"
+	// line 7: unused variable "version"
+	// line 12: unreachable code
+	// #!/bin/bash
+	//
+	// name=app;
+	//
+	// echo "$name";
+	// exit 0;
+}
@@ -0,0 +1,446 @@
+// Package dryrun traces the external commands that a bash script would run,
+// without running them, allowing scripts to be reviewed before they are run
+// for real.
+package dryrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/bash/interp"
+	"vimagination.zapto.org/parser"
+)
+
+// The markers that surround the number of an unknown value within a string.
+//
+// They are private use characters, so are neither split on, nor matched by a
+// pattern, and are unlikely to appear in a script.
+const (
+	markStart = '\uE000'
+	markEnd   = '\uE001'
+	marks     = string(markStart) + string(markEnd)
+	digits    = "0123456789"
+)
+
+// Arg is an argument of a traced command.
+//
+// When the argument contains a value that could not be known without running
+// the script, Resolved is false, and each unknown part of Value is replaced by
+// a description of where it came from, such as '$(git rev-parse HEAD)' for the
+// output of a command, or '$TAG' for a symbolic variable.
+type Arg struct {
+	Value    string `json:"value"`
+	Resolved bool   `json:"resolved"`
+}
+
+// String returns the argument as it would be written by 'set -x'; quoted
+// when it contains characters special to the shell, or, when the argument is
+// not resolved, marked by surrounding it with '«' and '»'.
+func (a Arg) String() string {
+	if !a.Resolved {
+		return "«" + a.Value + "»"
+	}
+
+	if a.Value != "" && !strings.ContainsAny(a.Value, " \t\n'\"\\$`|&;<>()*?[]{}~#!") && !strings.ContainsFunc(a.Value, func(c rune) bool {
+		return !unicode.IsPrint(c)
+	}) {
+		return a.Value
+	}
+
+	return expand.Quote(a.Value)
+}
+
+// Command is an external command that a script would run, along with the
+// working directory it would be run in.
+type Command struct {
+	Args []Arg `json:"args"`
+	Dir  Arg   `json:"dir"`
+}
+
+// Resolved returns true when all of the arguments of the command are
+// resolved.
+func (c Command) Resolved() bool {
+	for _, arg := range c.Args {
+		if !arg.Resolved {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the command as it would be written by 'set -x', without the
+// prefix.
+func (c Command) String() string {
+	args := make([]string, len(c.Args))
+
+	for n, arg := range c.Args {
+		args[n] = arg.String()
+	}
+
+	return strings.Join(args, " ")
+}
+
+// Branch is a condition that was decided on values that could not be known
+// without running the script, so the commands that follow it may not be those
+// that the script would run.
+//
+// Condition is the text of the command that tested the values, such as a '[['
+// command, and True is whether it was taken to be true, or, for a 'case'
+// command, whether a pattern was taken to match. Values are the unknown values
+// that were tested, and Files the files that were tested without an FS. After
+// is the number of commands traced before the condition.
+type Branch struct {
+	Condition string   `json:"condition"`
+	True      bool     `json:"true"`
+	Values    []Arg    `json:"values,omitempty"`
+	Files     []string `json:"files,omitempty"`
+	After     int      `json:"after"`
+}
+
+// String describes the branch, along with the values it depended on.
+func (b Branch) String() string {
+	unknown := make([]string, 0, len(b.Values)+len(b.Files))
+
+	for _, v := range b.Values {
+		unknown = append(unknown, v.String())
+	}
+
+	for _, f := range b.Files {
+		unknown = append(unknown, "file "+Arg{Value: f, Resolved: true}.String())
+	}
+
+	return fmt.Sprintf("%s taken as %t, depending on %s", b.Condition, b.True, strings.Join(unknown, ", "))
+}
+
+// Trace is the result of a dry run; the commands that would be run, in the
+// order they were reached, the conditions decided on unknown values, and the
+// exit status of the script.
+type Trace struct {
+	Commands []Command `json:"commands"`
+	Branches []Branch  `json:"branches"`
+	Status   int       `json:"status"`
+}
+
+// WriteTo writes the commands in the form of 'set -x' output, one per line,
+// each prefixed with '+ ', with each branch written as a comment, prefixed with
+// '# ', in its place among them.
+func (t *Trace) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+
+	branches := t.Branches
+
+	for n := 0; n <= len(t.Commands); n++ {
+		for ; len(branches) > 0 && branches[0].After <= n; branches = branches[1:] {
+			m, err := fmt.Fprintf(w, "# %s\n", branches[0])
+
+			total += int64(m)
+
+			if err != nil {
+				return total, err
+			}
+		}
+
+		if n == len(t.Commands) {
+			break
+		}
+
+		m, err := fmt.Fprintf(w, "+ %s\n", t.Commands[n])
+
+		total += int64(m)
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// Tracer runs scripts without running any of their external commands.
+//
+// Args are the positional parameters of the script, and Env its environment,
+// in the form 'name=value'. Each variable named in Symbolic is added to the
+// environment with a value that is unknown, and each argument it is used in
+// will not be resolved. Dir is the working directory, as with interp.Runner.
+//
+// Stdin is the standard input of the script; when nil, input is empty.
+// Errors reported by the script are written to Stderr, and its output is
+// discarded.
+//
+// FS, when set, is used for pathname expansion, file tests, the directories
+// changed to by 'cd', and the files read by redirections and the 'source'
+// builtin. Without it, nothing is looked up; the contents of files are unknown,
+// words are not expanded to pathnames, any directory can be changed to, and
+// file tests are false, each being recorded as a Branch. Writes to files are
+// always discarded.
+type Tracer struct {
+	Args     []string
+	Env      []string
+	Symbolic []string
+	Dir      string
+	Stdin    io.Reader
+	Stderr   io.Writer
+	FS       fs.FS
+}
+
+// Run traces the external commands that would be run by a script.
+//
+// Builtins and functions are run as normal, but external commands are only
+// recorded; they succeed, and their output, which is unknown, can be read as
+// a single line by the commands that follow them, such as with command
+// substitution, or a pipeline. The path of every command is found, as an
+// unknown value, by the 'type' and 'command' builtins.
+//
+// As only a single run is made, conditions that depend on unknown values are
+// decided using placeholders for those values, so that only one branch is
+// followed; each such decision made by a '[[', 'test', '[', or 'case' command
+// is recorded as a Branch. The commands of a pipeline run concurrently, so may be recorded in
+// any order.
+//
+// The returned error is non-nil only when the Context is cancelled.
+func (t *Tracer) Run(ctx context.Context, f *bash.File) (*Trace, error) {
+	d := dryRun{fs: t.FS}
+	env := append([]string(nil), t.Env...)
+
+	for _, name := range t.Symbolic {
+		env = append(env, name+"="+d.unknown("$"+name))
+	}
+
+	r := interp.Runner{
+		Args:   t.Args,
+		Env:    env,
+		Dir:    t.Dir,
+		Stdin:  t.Stdin,
+		Stderr: t.Stderr,
+		FS:     t.FS,
+		Exec:   &d,
+		Open:   &d,
+	}
+
+	status, err := r.Run(ctx, f)
+
+	return &Trace{Commands: d.commands, Branches: d.branches, Status: status}, err
+}
+
+// RunString parses and traces a script, as with Run.
+func (t *Tracer) RunString(ctx context.Context, src string) (*Trace, error) {
+	tk := parser.NewStringTokeniser(src)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Run(ctx, f)
+}
+
+// dryRun is the interp.ExecHandler, interp.PathHandler,
+// interp.ConditionHandler, and interp.OpenHandler of a single run, which
+// records commands and branches, and tracks unknown values.
+type dryRun struct {
+	fs fs.FS
+
+	mu       sync.Mutex
+	unknowns []string
+	commands []Command
+	branches []Branch
+}
+
+// unknown returns a placeholder for an unknown value, with the given
+// description.
+func (d *dryRun) unknown(desc string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.unknowns = append(d.unknowns, desc)
+
+	return string(markStart) + strconv.Itoa(len(d.unknowns)-1) + string(markEnd)
+}
+
+// resolve replaces the placeholders in a string with the descriptions of the
+// values they represent.
+//
+// A placeholder that has been cut, such as by a substring expansion, is
+// removed, along with the digits of its number, though still causes the
+// string to be unresolved.
+func (d *dryRun) resolve(s string) Arg {
+	if !strings.ContainsAny(s, marks) {
+		return Arg{Value: s, Resolved: true}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var sb strings.Builder
+
+	for s != "" {
+		pos := strings.IndexAny(s, marks)
+		if pos < 0 {
+			sb.WriteString(s)
+
+			break
+		}
+
+		text := s[:pos]
+		c, size := utf8.DecodeRuneInString(s[pos:])
+		s = s[pos+size:]
+
+		if c == markEnd {
+			sb.WriteString(strings.TrimRight(text, digits))
+
+			continue
+		}
+
+		sb.WriteString(text)
+
+		end := strings.IndexAny(s, marks)
+		if end < 0 || !strings.HasPrefix(s[end:], string(markEnd)) {
+			s = strings.TrimLeft(s, digits)
+
+			continue
+		}
+
+		if n, err := strconv.Atoi(s[:end]); err == nil && n < len(d.unknowns) {
+			sb.WriteString(d.unknowns[n])
+		}
+
+		s = s[end+len(string(markEnd)):]
+	}
+
+	return Arg{Value: sb.String()}
+}
+
+// Exec implements the interp.ExecHandler interface, recording the command,
+// and writing an unknown value, describing the command, as its output.
+func (d *dryRun) Exec(_ context.Context, cmd *interp.Command) (int, error) {
+	c := Command{Args: make([]Arg, len(cmd.Args)), Dir: d.resolve(cmd.Dir)}
+
+	for n, arg := range cmd.Args {
+		c.Args[n] = d.resolve(arg)
+	}
+
+	d.mu.Lock()
+	d.commands = append(d.commands, c)
+	d.mu.Unlock()
+
+	if cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, d.unknown("$("+c.String()+")")+"\n")
+	}
+
+	return 0, nil
+}
+
+// LookPath implements the interp.PathHandler interface, finding every command
+// at an unknown path.
+func (d *dryRun) LookPath(_ context.Context, cmd *interp.Command) (string, error) {
+	return d.unknown("$(command -v " + d.resolve(cmd.Args[0]).String() + ")"), nil
+}
+
+// Condition implements the interp.ConditionHandler interface, recording a
+// Branch for a condition that tested an unknown value, or, without an FS, a
+// file.
+func (d *dryRun) Condition(_ context.Context, c *interp.Condition) {
+	var b Branch
+
+	for _, op := range c.Operands {
+		if a := d.resolve(op); !a.Resolved && !slices.Contains(b.Values, a) {
+			b.Values = append(b.Values, a)
+		}
+	}
+
+	if d.fs == nil {
+		for _, name := range c.Files {
+			if f := d.resolve(name).Value; !slices.Contains(b.Files, f) {
+				b.Files = append(b.Files, f)
+			}
+		}
+	}
+
+	if len(b.Values) == 0 && len(b.Files) == 0 {
+		return
+	}
+
+	b.Condition = strings.TrimSpace(c.Command)
+	b.True = c.Status == 0
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b.After = len(d.commands)
+	d.branches = append(d.branches, b)
+}
+
+// Open implements the interp.OpenHandler interface.
+//
+// Files opened for writing discard what is written to them, while those opened
+// for reading are read from the FS, or, without one, contain a single line of
+// unknown contents.
+func (d *dryRun) Open(_ context.Context, name string, flag int, _ fs.FileMode) (io.ReadWriteCloser, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return discard{}, nil
+	} else if d.fs == nil {
+		return readOnly{strings.NewReader(d.unknown("$(< "+d.resolve(name).String()+")") + "\n")}, nil
+	}
+
+	f, err := d.fs.Open(fsPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return readOnly{f}, nil
+}
+
+// fsPath converts an absolute path to the form used by an fs.FS.
+func fsPath(name string) string {
+	if name = strings.TrimPrefix(path.Clean(name), "/"); name == "" {
+		return "."
+	}
+
+	return name
+}
+
+var errReadOnly = errors.New("read-only file")
+
+type readOnly struct {
+	io.Reader
+}
+
+func (readOnly) Write([]byte) (int, error) {
+	return 0, errReadOnly
+}
+
+func (r readOnly) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+type discard struct{}
+
+func (discard) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (discard) Close() error {
+	return nil
+}
@@ -0,0 +1,165 @@
+package dryrun
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRun(t *testing.T) {
+	for n, test := range [...]struct {
+		Script   string
+		Args     []string
+		Env      []string
+		Symbolic []string
+		Stdin    string
+		Trace    string
+		Stderr   string
+		Status   int
+	}{
+		{ // 1
+			Script: "echo hello; ls -l",
+			Trace:  "+ ls -l\n",
+		},
+		{ // 2
+			Script: "deploy \"$1\" \"$ENV\" ''",
+			Args:   []string{"a b"},
+			Env:    []string{"ENV=prod"},
+			Trace:  "+ deploy 'a b' prod ''\n",
+		},
+		{ // 3
+			Script:   "tag --name=\"$TAG\" $TAG",
+			Symbolic: []string{"TAG"},
+			Trace:    "+ tag «--name=$TAG» «$TAG»\n",
+		},
+		{ // 4
+			Script: "rev=$(git rev-parse HEAD); push \"$rev\"",
+			Trace:  "+ git rev-parse HEAD\n+ push «$(git rev-parse HEAD)»\n",
+		},
+		{ // 5
+			Script:   "echo ${TAG:0:3}; release ${TAG:1} x${TAG:0:2}y",
+			Symbolic: []string{"TAG"},
+			Trace:    "+ release «» «xy»\n",
+		},
+		{ // 6
+			Script: "f() { run \"$@\"; }; for h in a b; do f \"$h\"; done",
+			Trace:  "+ run a\n+ run b\n",
+		},
+		{ // 7
+			Script: "if check; then yes; else no; fi",
+			Trace:  "+ check\n+ yes\n",
+		},
+		{ // 8
+			Script: "command -v tool >/dev/null || exit 1; tool",
+			Trace:  "+ tool\n",
+		},
+		{ // 9
+			Script: "cd /srv; build; pwd",
+			Trace:  "+ build\n",
+		},
+		{ // 10
+			Script: "read line; send \"$line\"",
+			Stdin:  "input\n",
+			Trace:  "+ send input\n",
+		},
+		{ // 11
+			Script: "while read f; do rm \"$f\"; done < list.txt",
+			Trace:  "+ rm «$(< /list.txt)»\n",
+		},
+		{ // 12
+			Script: "cat > /etc/conf <<< data; cat < /etc/conf",
+			Trace:  "+ cat\n+ cat\n",
+		},
+		{ // 13
+			Script: "exit 3; unreached",
+			Status: 3,
+		},
+		{ // 14
+			Script: "x=$((1/0))",
+			Stderr: "bash: line 1: 1/0: division by 0 (error token is \"0\")\n",
+			Status: 1,
+		},
+		{ // 15
+			Script: "if [[ -n $(git status --porcelain) ]]; then exit 1; fi; deploy",
+			Trace:  "+ git status --porcelain\n# [[ -n $(git status --porcelain) ]] taken as true, depending on «$(git status --porcelain)»\n",
+			Status: 1,
+		},
+		{ // 16
+			Script: "out=$(check); [[ $out == ok || $out == fine ]] || rm -rf /var/app",
+			Trace:  "+ check\n# [[ $out == ok || $out == fine ]] taken as false, depending on «$(check)»\n+ rm -rf /var/app\n",
+		},
+		{ // 17
+			Script:   "case $MODE in prod) deploy;; *) stage;; esac",
+			Symbolic: []string{"MODE"},
+			Trace:    "# case $MODE in taken as true, depending on «$MODE»\n+ stage\n",
+		},
+		{ // 18
+			Script: "set -e; cd /srv/app; [ -f config ] || make config; make deploy",
+			Trace:  "# [ -f config ] taken as false, depending on file config\n+ make config\n+ make deploy\n",
+		},
+		{ // 19
+			Script: "[[ -n $ENV ]] && test $ENV = prod && deploy",
+			Env:    []string{"ENV=prod"},
+			Trace:  "+ deploy\n",
+		},
+	} {
+		var (
+			stderr strings.Builder
+			trace  strings.Builder
+		)
+
+		tr := Tracer{
+			Args:     test.Args,
+			Env:      test.Env,
+			Symbolic: test.Symbolic,
+			Stdin:    strings.NewReader(test.Stdin),
+			Stderr:   &stderr,
+		}
+
+		if result, err := tr.RunString(context.Background(), test.Script); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if result.WriteTo(&trace); trace.String() != test.Trace {
+			t.Errorf("test %d: expecting trace %q, got %q", n+1, test.Trace, trace.String())
+		} else if result.Status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, result.Status)
+		} else if errs := stderr.String(); errs != test.Stderr {
+			t.Errorf("test %d: expecting stderr %q, got %q", n+1, test.Stderr, errs)
+		}
+	}
+}
+
+func TestRunFS(t *testing.T) {
+	tr := Tracer{
+		Dir: "/srv",
+		FS: fstest.MapFS{
+			"srv/lib.sh":   {Data: []byte("helper() { install \"$1\"; }\n")},
+			"srv/a.pkg":    {Data: []byte{}},
+			"srv/b.pkg":    {Data: []byte{}},
+			"srv/list.txt": {Data: []byte("one\ntwo\n")},
+		},
+	}
+
+	result, err := tr.RunString(context.Background(), "source ./lib.sh; for p in *.pkg; do helper \"$p\"; done; while read x; do rm $x; done < list.txt; [[ -f nosuch ]] && rm nosuch")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var trace strings.Builder
+
+	result.WriteTo(&trace)
+
+	if expected := "+ install a.pkg\n+ install b.pkg\n+ rm one\n+ rm two\n"; trace.String() != expected {
+		t.Errorf("expecting trace %q, got %q", expected, trace.String())
+	}
+
+	if len(result.Branches) != 0 {
+		t.Errorf("expecting no branches, got %v", result.Branches)
+	}
+
+	for _, c := range result.Commands {
+		if c.Dir.Value != "/srv" || !c.Dir.Resolved || !c.Resolved() {
+			t.Errorf("expecting resolved command in /srv, got %v in %s", c, c.Dir)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package dryrun_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"vimagination.zapto.org/bash/dryrun"
+)
+
+func Example() {
+	t := dryrun.Tracer{
+		Args:     []string{"production"},
+		Env:      []string{"REGISTRY=registry.example.com"},
+		Symbolic: []string{"TOKEN"},
+	}
+
+	trace, err := t.RunString(context.Background(), `
+env="${1:-staging}"
+rev="$(git rev-parse --short HEAD)"
+
+docker login -p "$TOKEN" "$REGISTRY"
+docker build -t "$REGISTRY/app:$rev" .
+
+for host in web1 web2; do
+	ssh "$host.$env" "deploy $rev"
+done
+`)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	trace.WriteTo(os.Stdout)
+
+	// Output:
+	// + git rev-parse --short HEAD
+	// + docker login -p «$TOKEN» registry.example.com
+	// + docker build -t «registry.example.com/app:$(git rev-parse --short HEAD)» .
+	// + ssh web1.production «deploy $(git rev-parse --short HEAD)»
+	// + ssh web2.production «deploy $(git rev-parse --short HEAD)»
+}
@@ -0,0 +1,178 @@
+package effects
+
+import (
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+type spec struct {
+	argOptions     string
+	longArgOptions []string
+	mode           bool
+}
+
+var commands = map[string]spec{
+	"rm":    {},
+	"mv":    {argOptions: "St", longArgOptions: []string{"--backup", "--suffix", "--target-directory"}},
+	"cp":    {argOptions: "St", longArgOptions: []string{"--backup", "--suffix", "--target-directory", "--preserve", "--no-preserve", "--reflink", "--sparse", "--update"}},
+	"ln":    {argOptions: "St", longArgOptions: []string{"--backup", "--suffix", "--target-directory"}},
+	"mkdir": {argOptions: "m", longArgOptions: []string{"--mode", "--context"}},
+	"touch": {argOptions: "dtr", longArgOptions: []string{"--date", "--reference", "--time"}},
+	"chmod": {longArgOptions: []string{"--reference"}, mode: true},
+	"tee":   {longArgOptions: []string{"--output-error"}},
+}
+
+// option is an option given to a command, along with its value.
+type option struct {
+	name   string
+	prefix string
+	value  *bash.Word
+}
+
+// parse splits the arguments of a command into its options and operands.
+func (c spec) parse(args []*bash.Word) ([]option, []*bash.Word) {
+	var (
+		options  []option
+		operands []*bash.Word
+	)
+
+	for n := 0; n < len(args); n++ {
+		arg, ok := astutil.Literal(args[n])
+
+		switch {
+		case !ok || arg == "-" || !strings.HasPrefix(arg, "-") || c.mode && isMode(arg):
+			operands = append(operands, args[n])
+		case arg == "--":
+			return options, append(operands, args[n+1:]...)
+		case strings.HasPrefix(arg, "--"):
+			name, _, hasValue := strings.Cut(arg, "=")
+			opt := option{name: name}
+
+			if hasValue {
+				opt.prefix, opt.value = name+"=", args[n]
+			} else if slices.Contains(c.longArgOptions, name) && n+1 < len(args) {
+				n++
+				opt.value = args[n]
+			}
+
+			options = append(options, opt)
+		default:
+			for m, o := range arg[1:] {
+				opt := option{name: "-" + string(o)}
+
+				if strings.ContainsRune(c.argOptions, o) {
+					if m+2 < len(arg) {
+						opt.prefix, opt.value = arg[:m+2], args[n]
+					} else if n+1 < len(args) {
+						n++
+						opt.value = args[n]
+					}
+
+					options = append(options, opt)
+
+					break
+				}
+
+				options = append(options, opt)
+			}
+		}
+	}
+
+	return options, operands
+}
+
+// isMode determines whether an argument to chmod beginning with '-' is a
+// symbolic mode, such as '-x', rather than an option.
+func isMode(arg string) bool {
+	return strings.Trim(arg, "-+=,rwxXstugoa") == ""
+}
+
+func command(c *bash.Command) []Effect {
+	words := astutil.Words(c)
+	if len(words) == 0 {
+		return nil
+	}
+
+	name, cmdWords, _ := astutil.Unwrap(words)
+
+	spec, ok := commands[name]
+	if !ok {
+		return nil
+	}
+
+	tk := cmdWords[0].Parts[0].Part
+	options, operands := spec.parse(cmdWords[1:])
+
+	var (
+		effects []Effect
+		target  *option
+		mode    = Write
+	)
+
+	for n, opt := range options {
+		switch opt.name {
+		case "-t", "--target-directory":
+			if opt.value != nil && name != "touch" {
+				target = &options[n]
+			}
+		case "-r", "--reference":
+			if opt.value != nil && (name == "touch" || name == "chmod") {
+				effects = append(effects, valueEffect(Read, name, tk, opt))
+			}
+		case "-a", "--append":
+			if name == "tee" {
+				mode = Append
+			}
+		}
+	}
+
+	switch name {
+	case "rm":
+		return append(effects, operandEffects(Delete, name, tk, operands)...)
+	case "chmod":
+		if len(operands) > 0 && !slices.ContainsFunc(options, func(o option) bool { return o.name == "--reference" }) {
+			operands = operands[1:]
+		}
+
+		fallthrough
+	case "mkdir", "touch", "tee":
+		return append(effects, operandEffects(mode, name, tk, operands)...)
+	}
+
+	var dest []Effect
+
+	if target != nil {
+		dest = []Effect{valueEffect(Write, name, tk, *target)}
+	} else if len(operands) > 1 {
+		dest = operandEffects(Write, name, tk, operands[len(operands)-1:])
+		operands = operands[:len(operands)-1]
+	}
+
+	mode = Read
+
+	if name == "mv" {
+		mode |= Delete
+	}
+
+	return append(append(effects, operandEffects(mode, name, tk, operands)...), dest...)
+}
+
+func operandEffects(mode Mode, op string, tk *bash.Token, operands []*bash.Word) []Effect {
+	effects := make([]Effect, len(operands))
+
+	for n, w := range operands {
+		effects[n] = newEffect(mode, op, tk, w)
+	}
+
+	return effects
+}
+
+func valueEffect(mode Mode, op string, tk *bash.Token, opt option) Effect {
+	e := newEffect(mode, op, tk, opt.value)
+	e.Path = strings.TrimPrefix(e.Path, opt.prefix)
+
+	return e
+}
@@ -0,0 +1,218 @@
+// Package effects finds the filesystem side effects of a parsed bash file; the
+// paths it may read, write, append to, or delete.
+package effects
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Mode is a set of the ways in which a path is accessed.
+type Mode uint8
+
+// Modes.
+const (
+	Read Mode = 1 << iota
+	Write
+	Append
+	Delete
+)
+
+var modeNames = [...]string{"read", "write", "append", "delete"}
+
+// String implements the fmt.Stringer interface, joining the names of the
+// Modes with '+'.
+func (m Mode) String() string {
+	var names []string
+
+	for n, name := range modeNames {
+		if m&(1<<n) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "+")
+}
+
+// Kind determines how much of a path is known before the script is run.
+type Kind uint8
+
+// Kinds.
+const (
+	Literal Kind = iota
+	Partial
+	Dynamic
+)
+
+// String implements the fmt.Stringer interface.
+func (k Kind) String() string {
+	switch k {
+	case Literal:
+		return "literal"
+	case Partial:
+		return "partial"
+	case Dynamic:
+		return "dynamic"
+	}
+
+	return "unknown"
+}
+
+// Effect is a single access to a path.
+//
+// Op is either the redirection operator, or the name of the command, that
+// accesses the path, and Token is the token of that operator or name.
+//
+// For a Literal path, Path is the path after quote removal, otherwise it is the
+// source of the Word.
+//
+// Heredoc is set for a path written to by a command whose standard input is a
+// heredoc, such as 'cat <<EOF > file', whose content is therefore known.
+type Effect struct {
+	Mode    Mode
+	Op      string
+	Path    string
+	Kind    Kind
+	Heredoc bool
+	Word    *bash.Word
+	Token   *bash.Token
+}
+
+// String implements the fmt.Stringer interface.
+func (e Effect) String() string {
+	tk := e.Word.Tokens[0]
+
+	return fmt.Sprintf("%d:%d %s %s %s (%s)", tk.Line+1, tk.LinePos+1, e.Mode, e.Op, e.Path, e.Kind)
+}
+
+// Find returns the filesystem Effects of a parsed file, in source order.
+//
+// Paths are found from the targets of redirections, other than those that
+// duplicate file descriptors, and the arguments of the rm, mv, cp, ln, mkdir,
+// touch, chmod, and tee commands, including when run through wrappers such as
+// 'sudo'.
+//
+// A path is Literal when it contains no expansions, Dynamic when it is made up
+// entirely of expansions, and Partial otherwise. Unquoted glob patterns and
+// leading tildes are considered to be expansions.
+func Find(f *bash.File) []Effect {
+	var effects []Effect
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.Command:
+			e := command(t)
+			e = append(e, redirections(t.Redirections)...)
+
+			effects = append(effects, heredoc(e, t.Redirections)...)
+		case *bash.Compound:
+			effects = append(effects, heredoc(redirections(t.Redirections), t.Redirections)...)
+		}
+
+		return true
+	})
+
+	slices.SortStableFunc(effects, func(a, b Effect) int {
+		return cmp.Compare(a.Word.Tokens[0].Pos, b.Word.Tokens[0].Pos)
+	})
+
+	return effects
+}
+
+func newEffect(mode Mode, op string, tk *bash.Token, w *bash.Word) Effect {
+	e := Effect{Mode: mode, Op: op, Word: w, Token: tk}
+
+	if lit, ok := astutil.Literal(w); ok && !hasPattern(w) {
+		e.Path = lit
+	} else {
+		e.Path = fmt.Sprintf("%s", w)
+		e.Kind = kind(w)
+	}
+
+	return e
+}
+
+// hasPattern determines whether a literal Word contains an unquoted glob
+// pattern or leading tilde.
+func hasPattern(w *bash.Word) bool {
+	for n, s := range astutil.Segments(w) {
+		if !s.Quoted && (strings.ContainsAny(s.Literal, "*?[") || n == 0 && strings.HasPrefix(s.Literal, "~")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func kind(w *bash.Word) Kind {
+	for _, s := range astutil.Segments(w) {
+		if s.IsLiteral() {
+			return Partial
+		}
+	}
+
+	return Dynamic
+}
+
+var redirectionModes = map[string]Mode{
+	"<":   Read,
+	">":   Write,
+	">|":  Write,
+	">>":  Append,
+	"<>":  Read | Write,
+	"&>":  Write,
+	"&>>": Append,
+	">&":  Write,
+}
+
+func redirections(rs []bash.Redirection) []Effect {
+	var effects []Effect
+
+	for n := range rs {
+		r := &rs[n]
+
+		if r.Redirector == nil || r.Heredoc != nil {
+			continue
+		}
+
+		mode, ok := redirectionModes[r.Redirector.Data]
+		if !ok {
+			continue
+		}
+
+		if r.Redirector.Data == ">&" {
+			if target, ok := astutil.Literal(&r.Output); !ok || target == "-" || strings.Trim(strings.TrimSuffix(target, "-"), "0123456789") == "" {
+				continue
+			}
+		}
+
+		effects = append(effects, newEffect(mode, r.Redirector.Data, r.Redirector, &r.Output))
+	}
+
+	return effects
+}
+
+// heredoc marks the writes of the given Effects when the redirections include
+// a heredoc.
+func heredoc(effects []Effect, rs []bash.Redirection) []Effect {
+	if !slices.ContainsFunc(rs, func(r bash.Redirection) bool { return r.Heredoc != nil }) {
+		return effects
+	}
+
+	for n := range effects {
+		if effects[n].Mode&(Write|Append) != 0 {
+			effects[n].Heredoc = true
+		}
+	}
+
+	return effects
+}
@@ -0,0 +1,80 @@
+package effects
+
+import (
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func TestFind(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Effects []string
+	}{
+		{ // 1
+			"cat < in > out 2>> err",
+			[]string{"1:7 read < in (literal)", "1:12 write > out (literal)", "1:20 append >> err (literal)"},
+		},
+		{ // 2
+			"cmd <> dev &> all &>> log >| force",
+			[]string{"1:8 read+write <> dev (literal)", "1:15 write &> all (literal)", "1:23 append &>> log (literal)", "1:30 write >| force (literal)"},
+		},
+		{ // 3
+			"cmd >&2 2>&1 >&- >&file",
+			[]string{"1:20 write >& file (literal)"},
+		},
+		{ // 4
+			"echo > \"$dir/out\" > $file > \"/tmp/a b\" > ~/x > *.log",
+			[]string{"1:8 write > \"$dir/out\" (partial)", "1:21 write > $file (dynamic)", "1:29 write > /tmp/a b (literal)", "1:42 write > ~/x (partial)", "1:48 write > *.log (partial)"},
+		},
+		{ // 5
+			"rm -rf -- /tmp/a \"$b\"",
+			[]string{"1:11 delete rm /tmp/a (literal)", "1:18 delete rm \"$b\" (dynamic)"},
+		},
+		{ // 6
+			"mv a b c\ncp -r src dst\nln -s target link",
+			[]string{"1:4 read+delete mv a (literal)", "1:6 read+delete mv b (literal)", "1:8 write mv c (literal)", "2:7 read cp src (literal)", "2:11 write cp dst (literal)", "3:7 read ln target (literal)", "3:14 write ln link (literal)"},
+		},
+		{ // 7
+			"cp -t /dest a b\nmv --target-directory=/d x",
+			[]string{"1:7 write cp /dest (literal)", "1:13 read cp a (literal)", "1:15 read cp b (literal)", "2:4 write mv /d (literal)", "2:26 read+delete mv x (literal)"},
+		},
+		{ // 8
+			"mkdir -p -m 755 a b\ntouch -r ref new\nchmod -x f\nchmod 644 g\nchmod --reference=r h",
+			[]string{"1:17 write mkdir a (literal)", "1:19 write mkdir b (literal)", "2:10 read touch ref (literal)", "2:14 write touch new (literal)", "3:10 write chmod f (literal)", "4:11 write chmod g (literal)", "5:7 read chmod r (literal)", "5:21 write chmod h (literal)"},
+		},
+		{ // 9
+			"echo x | tee a\necho y | sudo tee -a b",
+			[]string{"1:14 write tee a (literal)", "2:22 append tee b (literal)"},
+		},
+		{ // 10
+			"while read -r l; do :; done < \"$input\"",
+			[]string{"1:31 read < \"$input\" (dynamic)"},
+		},
+	} {
+		var effects []string
+
+		for _, e := range Find(testutil.Parse(t, test.Input)) {
+			effects = append(effects, e.String())
+		}
+
+		if !reflect.DeepEqual(effects, test.Effects) {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Effects, effects)
+		}
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	effects := Find(testutil.Parse(t, "cat <<EOF > conf\nx\nEOF\ntee out <<EOF\ny\nEOF\ncat <<<\"$z\" > other"))
+
+	if len(effects) != 3 {
+		t.Fatalf("expecting 3 effects, got %d", len(effects))
+	}
+
+	for n, expected := range [...]bool{true, true, false} {
+		if effects[n].Heredoc != expected {
+			t.Errorf("test %d: expecting heredoc %t, got %t", n+1, expected, effects[n].Heredoc)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package effects_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/effects"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "#!/bin/bash\n\nmkdir -p /var/lib/app\ncat <<EOF > /etc/app.conf\nport=8080\nEOF\n\ncp \"$1\" \"/var/lib/app/$(basename \"$1\")\"\nrm -f /tmp/app-*.lock\nrun >> \"$LOG\" 2>&1\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	for _, e := range effects.Find(b) {
+		fmt.Printf("%s %s %s (%s)", e.Mode, e.Op, e.Path, e.Kind)
+
+		if e.Heredoc {
+			fmt.Print(" heredoc")
+		}
+
+		fmt.Println()
+	}
+
+	// Output:
+	// write mkdir /var/lib/app (literal)
+	// write > /etc/app.conf (literal) heredoc
+	// read cp "$1" (dynamic)
+	// write cp "/var/lib/app/$(basename "$1")" (partial)
+	// delete rm /tmp/app-*.lock (partial)
+	// append >> "$LOG" (dynamic)
+}
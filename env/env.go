@@ -0,0 +1,237 @@
+// Package env extracts the environment contract of a parsed bash file; the
+// variables it expects to be given, and those it passes on to the commands it
+// runs.
+package env
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/bash/scope"
+)
+
+// Input is an environment variable read by a script.
+//
+// Defaults contains the source of each distinct default value given with
+// '${VAR:-default}', '${VAR-default}', '${VAR:=default}', or '${VAR=default}'.
+//
+// Required is set when the variable is checked with '${VAR:?message}' or
+// '${VAR?message}', with Message containing the source of the first message
+// given.
+type Input struct {
+	Name     string   `json:"name"`
+	Line     uint64   `json:"line"`
+	Required bool     `json:"required"`
+	Message  string   `json:"message,omitempty"`
+	Defaults []string `json:"defaults,omitempty"`
+}
+
+// Export is a variable passed to the environment of the commands run by a
+// script.
+//
+// Commands contains the names of the commands that the variable is passed to
+// by an assignment before the command name, and is empty when the variable is
+// exported to all commands run after it.
+type Export struct {
+	Name     string   `json:"name"`
+	Line     uint64   `json:"line"`
+	Commands []string `json:"commands,omitempty"`
+}
+
+// Contract contains the Inputs and Exports of a file, each sorted by name.
+type Contract struct {
+	Inputs  []Input  `json:"inputs"`
+	Exports []Export `json:"exports"`
+}
+
+// Extract determines the environment Contract of a parsed file.
+//
+// A variable is an Input when it is read before being assigned to by the code
+// of the same function, or the top-level code. As the order in which functions
+// are called is not known, an assignment within any other function is
+// considered to happen before the read. Naming a variable with a declaration
+// builtin, such as 'export VAR', is not a read, and variables set by the shell,
+// such as HOME and PATH, are not included.
+//
+// Exports are found from the 'export' builtin, the '-x' option of the other
+// declaration builtins, and assignments made before a command name.
+func Extract(f *bash.File) *Contract {
+	e := &extractor{
+		table:    scope.Resolve(f),
+		assigned: make(map[*bash.Token]uint64),
+		declared: make(map[*bash.Token]bool),
+		inputs:   make(map[*bash.Token]bool),
+		global:   make(map[string]bool),
+		contract: new(Contract),
+	}
+
+	astutil.Inspect(f, e.assignments)
+
+	for _, ref := range e.table.References {
+		if ref.Kind == scope.Variable && !scope.ShellVariables[ref.Name] && !e.declared[ref.Token] && !e.isAssigned(ref) {
+			e.inputs[ref.Token] = true
+			e.input(ref.Name, ref.Token)
+		}
+	}
+
+	astutil.Inspect(f, e.inspect)
+
+	for n, ex := range e.contract.Exports {
+		if e.global[ex.Name] {
+			e.contract.Exports[n].Commands = nil
+		}
+	}
+
+	slices.SortFunc(e.contract.Inputs, func(a, b Input) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	slices.SortFunc(e.contract.Exports, func(a, b Export) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return e.contract
+}
+
+type extractor struct {
+	table    *scope.Table
+	assigned map[*bash.Token]uint64
+	declared map[*bash.Token]bool
+	inputs   map[*bash.Token]bool
+	global   map[string]bool
+	contract *Contract
+}
+
+// assignments records the position after each assignment, at which point the
+// variable is set, and the names given to declaration builtins without values,
+// which do not read the variables.
+func (e *extractor) assignments(t bash.Type, _ []bash.Type) bool {
+	switch t := t.(type) {
+	case *bash.Assignment:
+		if t.Identifier.Identifier != nil && len(t.Tokens) > 0 {
+			e.assigned[t.Identifier.Identifier] = t.Tokens[len(t.Tokens)-1].Pos
+		}
+	case *bash.Command:
+		if astutil.IsDeclaration(astutil.CommandName(t)) {
+			for _, d := range astutil.Declarations(t) {
+				if d.Assignment == nil {
+					e.declared[d.Token] = true
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+func (e *extractor) isAssigned(ref *scope.Reference) bool {
+	for _, def := range ref.Definitions {
+		if def.Binding == scope.BindEnvironment {
+			continue
+		}
+
+		if def.Scope != ref.Scope {
+			return true
+		}
+
+		pos, ok := e.assigned[def.Token]
+		if !ok {
+			pos = def.Token.Pos
+		}
+
+		if pos < ref.Token.Pos {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *extractor) input(name string, tk *bash.Token) *Input {
+	for n := range e.contract.Inputs {
+		if e.contract.Inputs[n].Name == name {
+			return &e.contract.Inputs[n]
+		}
+	}
+
+	e.contract.Inputs = append(e.contract.Inputs, Input{Name: name, Line: tk.Line + 1})
+
+	return &e.contract.Inputs[len(e.contract.Inputs)-1]
+}
+
+func (e *extractor) export(name string, tk *bash.Token) *Export {
+	for n := range e.contract.Exports {
+		if e.contract.Exports[n].Name == name {
+			return &e.contract.Exports[n]
+		}
+	}
+
+	e.contract.Exports = append(e.contract.Exports, Export{Name: name, Line: tk.Line + 1})
+
+	return &e.contract.Exports[len(e.contract.Exports)-1]
+}
+
+func (e *extractor) inspect(t bash.Type, _ []bash.Type) bool {
+	switch t := t.(type) {
+	case *bash.ParameterExpansion:
+		if p := t.Parameter.Parameter; p != nil && e.inputs[p] && t.BraceWord != nil {
+			e.parameter(t, p)
+		}
+	case *bash.Command:
+		e.command(t)
+	}
+
+	return true
+}
+
+func (e *extractor) parameter(p *bash.ParameterExpansion, tk *bash.Token) {
+	in := e.input(tk.Data, tk)
+	word := fmt.Sprintf("%s", p.BraceWord)
+
+	switch p.Type {
+	case bash.ParameterSetAssign, bash.ParameterUnsetSetAssign, bash.ParameterSubstitution, bash.ParameterUnsetSubstitution:
+		if !slices.Contains(in.Defaults, word) {
+			in.Defaults = append(in.Defaults, word)
+		}
+	case bash.ParameterAssignment, bash.ParameterUnsetAssignment:
+		if !in.Required {
+			in.Required = true
+			in.Message = word
+		}
+	}
+}
+
+func (e *extractor) command(c *bash.Command) {
+	if len(c.Vars) > 0 && len(c.AssignmentsOrWords) > 0 && c.AssignmentsOrWords[0].Word != nil {
+		name, ok := astutil.Literal(c.AssignmentsOrWords[0].Word)
+		if !ok {
+			name = fmt.Sprintf("%s", c.AssignmentsOrWords[0].Word)
+		}
+
+		for _, v := range c.Vars {
+			if tk := v.Identifier.Identifier; tk != nil {
+				ex := e.export(tk.Data, tk)
+
+				if !slices.Contains(ex.Commands, name) {
+					ex.Commands = append(ex.Commands, name)
+				}
+			}
+		}
+	}
+
+	name := astutil.CommandName(c)
+	if !astutil.IsDeclaration(name) {
+		return
+	}
+
+	for _, d := range astutil.Declarations(c) {
+		if strings.Contains(d.Flags, "x") && !strings.Contains(d.Flags, "f") && (name != "export" || !strings.Contains(d.Flags, "n")) {
+			e.export(d.Name, d.Token)
+			e.global[d.Name] = true
+		}
+	}
+}
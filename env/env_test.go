@@ -0,0 +1,75 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func TestExtract(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    string
+		Contract Contract
+	}{
+		{ // 1
+			"echo $A $HOME\nB=1\necho $B",
+			Contract{
+				Inputs: []Input{{Name: "A", Line: 1}},
+			},
+		},
+		{ // 2
+			"echo $B\nB=1",
+			Contract{
+				Inputs: []Input{{Name: "B", Line: 1}},
+			},
+		},
+		{ // 3
+			"HOST=${HOST:-localhost}\nPORT=\"${PORT-80}\"\n: ${USER_NAME:=admin} ${TOKEN:?\"token required\"}\necho $HOST $USER_NAME",
+			Contract{
+				Inputs: []Input{
+					{Name: "HOST", Line: 1, Defaults: []string{"localhost"}},
+					{Name: "PORT", Line: 2, Defaults: []string{"80"}},
+					{Name: "TOKEN", Line: 3, Required: true, Message: "\"token required\""},
+					{Name: "USER_NAME", Line: 3, Defaults: []string{"admin"}},
+				},
+			},
+		},
+		{ // 4
+			"export A=1\ndeclare -x B\nlocal -x C=2\nexport -n D\nexport -f fn\nE=1 cmd\nF=2 G=3 \"$run\" arg\nF=1 other",
+			Contract{
+				Inputs: []Input{{Name: "run", Line: 7}},
+				Exports: []Export{
+					{Name: "A", Line: 1},
+					{Name: "B", Line: 2},
+					{Name: "C", Line: 3},
+					{Name: "E", Line: 6, Commands: []string{"cmd"}},
+					{Name: "F", Line: 7, Commands: []string{"\"$run\"", "other"}},
+					{Name: "G", Line: 7, Commands: []string{"\"$run\""}},
+				},
+			},
+		},
+		{ // 5
+			"A=1 cmd\nexport A",
+			Contract{
+				Exports: []Export{{Name: "A", Line: 1}},
+			},
+		},
+		{ // 6
+			"f() {\n\techo $A $B\n\tlocal C\n\techo $C\n}\ng() {\n\tA=1\n}\ng\nf",
+			Contract{
+				Inputs: []Input{{Name: "B", Line: 2}},
+			},
+		},
+		{ // 7
+			"echo ${A:-x} ${A:-y} ${A:-x} ${A:?first} ${A:?second}",
+			Contract{
+				Inputs: []Input{{Name: "A", Line: 1, Required: true, Message: "first", Defaults: []string{"x", "y"}}},
+			},
+		},
+	} {
+		if c := Extract(testutil.Parse(t, test.Input)); !reflect.DeepEqual(c, &test.Contract) {
+			t.Errorf("test %d: expecting %v, got %v", n+1, test.Contract, c)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package env_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/env"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "#!/bin/bash\n\nDB_HOST=\"${DB_HOST:-localhost}\"\n: \"${DB_PASSWORD:?must be set}\"\n\nexport DATABASE_URL=\"postgres://$DB_USER:$DB_PASSWORD@$DB_HOST\"\nLOG_LEVEL=debug ./server\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	contract := env.Extract(b)
+
+	for _, in := range contract.Inputs {
+		fmt.Printf("input %s required=%t defaults=%q\n", in.Name, in.Required, in.Defaults)
+	}
+
+	for _, ex := range contract.Exports {
+		fmt.Printf("export %s commands=%q\n", ex.Name, ex.Commands)
+	}
+
+	// Output:
+	// input DB_HOST required=false defaults=["localhost"]
+	// input DB_PASSWORD required=true defaults=[]
+	// input DB_USER required=false defaults=[]
+	// export DATABASE_URL commands=[]
+	// export LOG_LEVEL commands=["./server"]
+}
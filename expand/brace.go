@@ -0,0 +1,445 @@
+package expand
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/parser"
+)
+
+// item is either a single unquoted character of a word, or a part that takes
+// no part in brace expansion, such as a quoted string or an expansion.
+//
+// An unquoted parameter, such as '$name', is marked as an identifier so that
+// any characters that follow it after expansion become part of its name, as
+// they do in bash.
+type item struct {
+	text       string
+	escaped    bool
+	identifier bool
+	part       *bash.WordPart
+	token      *bash.Token
+}
+
+func (i item) is(c byte) bool {
+	return i.part == nil && !i.escaped && len(i.text) == 1 && i.text[0] == c
+}
+
+// Braces performs brace expansion on a word, returning the resulting words in
+// order.
+//
+// Expansion is performed on the source of the word, following the bash
+// algorithm, so that the results match those of bash exactly; both comma
+// separated lists, such as 'a{b,c{d,e}}', and sequences, such as '{1..10..2}',
+// '{a..z}', and '{01..10}', are expanded, while braces that are quoted,
+// escaped, or do not form a valid expansion are left unchanged.
+//
+// A word that contains no brace expansion is returned as the only word.
+func Braces(w *bash.Word) []*bash.Word {
+	items := flatten(w.Parts)
+
+	if !hasBrace(items) {
+		return []*bash.Word{w}
+	}
+
+	var words []*bash.Word
+
+	for _, expanded := range braceExpand(items) {
+		words = append(words, rebuild(expanded, w))
+	}
+
+	return words
+}
+
+func hasBrace(items []item) bool {
+	for _, i := range items {
+		if i.is('{') {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flatten converts the parts of a word into items, restoring the source of any
+// BraceExpansion parts.
+func flatten(parts []bash.WordPart) []item {
+	var (
+		items    []item
+		inString bool
+	)
+
+	for n := range parts {
+		p := &parts[n]
+
+		switch {
+		case p.BraceExpansion != nil:
+			sep := ","
+
+			if p.BraceExpansion.BraceExpansionType == bash.BraceExpansionSequence {
+				sep = ".."
+			}
+
+			items = append(items, item{text: "{"})
+
+			for n, w := range p.BraceExpansion.Words {
+				if n > 0 {
+					items = append(items, literalItems(sep, nil)...)
+				}
+
+				items = append(items, flatten(w.Parts)...)
+			}
+
+			items = append(items, item{text: "}"})
+		case p.Part == nil:
+			items = append(items, item{part: p})
+		case p.Part.Type == bash.TokenStringStart:
+			inString = true
+
+			items = append(items, item{part: p})
+		case p.Part.Type == bash.TokenStringEnd:
+			inString = false
+
+			items = append(items, item{part: p})
+		case inString, p.Part.Type == bash.TokenString, p.Part.Type == bash.TokenPattern:
+			items = append(items, item{part: p})
+		case p.Part.Type == bash.TokenIdentifier:
+			name, rest := astutil.SplitParameter(p.Part.Data)
+			if name == "" {
+				items = append(items, literalItems(p.Part.Data, p.Part)...)
+
+				continue
+			}
+
+			tk := *p.Part
+			tk.Data = "$" + name
+
+			items = append(items, item{part: &bash.WordPart{Part: &tk, Tokens: p.Tokens}, identifier: true})
+			items = append(items, literalItems(rest, p.Part)...)
+		default:
+			items = append(items, literalItems(p.Part.Data, p.Part)...)
+		}
+	}
+
+	return items
+}
+
+func literalItems(text string, tk *bash.Token) []item {
+	items := make([]item, 0, len(text))
+
+	for n := 0; n < len(text); n++ {
+		if text[n] == '\\' && n+1 < len(text) {
+			items = append(items, item{text: text[n : n+2], escaped: true, token: tk})
+			n++
+		} else {
+			items = append(items, item{text: text[n : n+1], token: tk})
+		}
+	}
+
+	return items
+}
+
+// rebuild creates a word from expanded items, combining adjacent characters
+// into single tokens.
+func rebuild(items []item, w *bash.Word) *bash.Word {
+	word := &bash.Word{Tokens: w.Tokens}
+
+	var (
+		sb  strings.Builder
+		tk  *bash.Token
+		typ = bash.TokenWord
+	)
+
+	flush := func() {
+		if sb.Len() > 0 {
+			part := &bash.Token{Token: parser.Token{Type: typ, Data: sb.String()}}
+
+			if tk != nil {
+				part.Pos, part.Line, part.LinePos = tk.Pos, tk.Line, tk.LinePos
+			}
+
+			word.Parts = append(word.Parts, bash.WordPart{Part: part})
+
+			sb.Reset()
+		}
+
+		tk = nil
+		typ = bash.TokenWord
+	}
+
+	for _, i := range items {
+		switch {
+		case i.identifier:
+			flush()
+
+			tk = i.part.Part
+			typ = bash.TokenIdentifier
+
+			sb.WriteString(tk.Data)
+		case i.part != nil:
+			flush()
+
+			word.Parts = append(word.Parts, *i.part)
+		default:
+			if tk == nil {
+				tk = i.token
+			}
+
+			sb.WriteString(i.text)
+		}
+	}
+
+	flush()
+
+	return word
+}
+
+// braceExpand expands the first brace expression of the items, along with any
+// that follow it.
+func braceExpand(items []item) [][]item {
+	start := -1
+
+	for i := 0; ; i++ {
+		var ok bool
+
+		if i, ok = gobble(items, i, '{'); !ok {
+			return [][]item{items}
+		}
+
+		if _, ok := gobble(items, i+1, '}'); ok {
+			start = i
+
+			break
+		}
+	}
+
+	end, _ := gobble(items, start+1, '}')
+	preamble, amble, postamble := items[:start], items[start+1:end], items[end+1:]
+
+	var tack [][]item
+
+	if !slices.ContainsFunc(amble, func(i item) bool { return i.is(',') }) {
+		var ok bool
+
+		if tack, ok = sequence(amble); !ok {
+			if len(postamble) == 0 {
+				return [][]item{items}
+			}
+
+			tack = [][]item{items[start : end+1]}
+		}
+	} else {
+		tack = expandAmble(amble)
+	}
+
+	result := concat([][]item{preamble}, tack)
+
+	if len(postamble) > 0 {
+		result = concat(result, braceExpand(postamble))
+	}
+
+	return result
+}
+
+// gobble finds the next unquoted occurrence of the given character at the top
+// level of nesting, starting at the given position.
+//
+// When searching for a closing brace, the brace only matches once either a
+// comma or '..' has been found. An opening brace at the start of the items
+// followed immediately by a closing brace is ignored.
+func gobble(items []item, i int, satisfy byte) (int, bool) {
+	level := 0
+	commas := 0
+
+	if satisfy != '}' {
+		commas = 1
+	}
+
+	for ; i < len(items); i++ {
+		it := items[i]
+
+		if it.part != nil || it.escaped {
+			continue
+		}
+
+		if it.is(satisfy) && level == 0 && commas > 0 {
+			if satisfy == '{' && i == 0 && i+1 < len(items) && items[i+1].is('}') {
+				continue
+			}
+
+			return i, true
+		}
+
+		switch {
+		case it.is('{'):
+			level++
+		case it.is('}'):
+			if level > 0 {
+				level--
+			}
+		case level == 0 && satisfy == '}' && it.is(','):
+			commas++
+		case level == 0 && satisfy == '}' && it.is('.') && i+2 < len(items) && items[i+1].is('.') && !items[i+2].is('}'):
+			commas++
+		}
+	}
+
+	return i, false
+}
+
+// expandAmble expands each of the comma separated elements of the items inside
+// a brace expression.
+func expandAmble(items []item) [][]item {
+	var result [][]item
+
+	for start, found := 0, true; found; {
+		var end int
+
+		end, found = gobble(items, start, ',')
+		result = append(result, braceExpand(items[start:end])...)
+		start = end + 1
+	}
+
+	return result
+}
+
+// concat returns each combination of an element of a followed by an element of
+// b.
+func concat(a, b [][]item) [][]item {
+	result := make([][]item, 0, len(a)*len(b))
+
+	for _, x := range a {
+		for _, y := range b {
+			result = append(result, append(append(make([]item, 0, len(x)+len(y)), x...), y...))
+		}
+	}
+
+	return result
+}
+
+// sequence expands a sequence expression, such as '1..10..2' or 'a..z'.
+func sequence(items []item) ([][]item, bool) {
+	var sb strings.Builder
+
+	for _, i := range items {
+		if i.part != nil || i.escaped {
+			return nil, false
+		}
+
+		sb.WriteString(i.text)
+	}
+
+	lhs, rhs, ok := strings.Cut(sb.String(), "..")
+	if !ok || lhs == "" || rhs == "" {
+		return nil, false
+	}
+
+	rhs, incrStr, hasIncr := strings.Cut(rhs, "..")
+
+	incr := int64(1)
+
+	if hasIncr {
+		var err error
+
+		if incr, err = strconv.ParseInt(incrStr, 10, 64); err != nil {
+			return nil, false
+		}
+	}
+
+	var (
+		start, end int64
+		width      int
+		char       bool
+	)
+
+	if isAlpha(lhs) && isAlpha(rhs) {
+		start, end, width, char = int64(lhs[0]), int64(rhs[0]), 1, true
+	} else if l, err := parseSeqInt(lhs); err != nil {
+		return nil, false
+	} else if r, err := parseSeqInt(rhs); err != nil {
+		return nil, false
+	} else {
+		start, end = l, r
+
+		if isZeroPadded(lhs) || isZeroPadded(rhs) {
+			width = max(len(lhs), len(rhs))
+		}
+	}
+
+	values, ok := mkseq(start, end, incr, width, char)
+	if !ok {
+		return nil, false
+	}
+
+	result := make([][]item, len(values))
+
+	for n, v := range values {
+		result[n] = literalItems(v, items[0].token)
+	}
+
+	return result, true
+}
+
+func isAlpha(s string) bool {
+	return len(s) == 1 && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
+
+func parseSeqInt(s string) (int64, error) {
+	return strconv.ParseInt(strings.TrimPrefix(s, "+"), 10, 64)
+}
+
+func isZeroPadded(s string) bool {
+	return len(s) > 1 && s[0] == '0' || len(s) > 2 && s[0] == '-' && s[1] == '0'
+}
+
+// mkseq generates the values of a sequence from start to end, inclusive, in
+// steps of incr, whose sign is ignored.
+func mkseq(start, end, incr int64, width int, char bool) ([]string, bool) {
+	if incr == 0 {
+		incr = 1
+	} else if incr == math.MinInt64 {
+		return nil, false
+	}
+
+	if incr < 0 {
+		incr = -incr
+	}
+
+	diff := end - start
+	if start > end {
+		diff = start - end
+		incr = -incr
+	}
+
+	if diff < 0 || diff/max(incr, -incr) > math.MaxInt32-3 {
+		return nil, false
+	}
+
+	values := make([]string, 0, diff/max(incr, -incr)+1)
+
+	for n := start; ; {
+		switch {
+		case char:
+			values = append(values, string(rune(n)))
+		case width > 0:
+			values = append(values, fmt.Sprintf("%0*d", width, n))
+		default:
+			values = append(values, strconv.FormatInt(n, 10))
+		}
+
+		next := n + incr
+
+		if incr > 0 && (next < n || next > end) || incr < 0 && (next > n || next < end) {
+			break
+		}
+
+		n = next
+	}
+
+	return values, true
+}
@@ -0,0 +1,58 @@
+package expand_test
+
+import (
+	"fmt"
+	"testing/fstest"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	tk := parser.NewStringTokeniser(`cp "${SRC:-src}"/*.go ${DEST%/}/${NAME^^}.tar $@`)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	e := expand.Expander{
+		Env: expand.Map{
+			"@":    expand.Indexed("-v", "two words"),
+			"DEST": expand.Scalar("/tmp/"),
+			"NAME": expand.Scalar("backup"),
+		},
+		FS: fstest.MapFS{
+			"src/main.go": {},
+			"src/util.go": {},
+			"src/README":  {},
+		},
+	}
+
+	var words []*bash.Word
+
+	for _, w := range b.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command.AssignmentsOrWords {
+		words = append(words, w.Word)
+	}
+
+	fields, err := e.Fields(words...)
+
+	fmt.Println(err)
+
+	for _, field := range fields {
+		fmt.Printf("%q\n", field)
+	}
+
+	// Output:
+	// <nil>
+	// "cp"
+	// "src/main.go"
+	// "src/util.go"
+	// "/tmp/BACKUP.tar"
+	// "-v"
+	// "two"
+	// "words"
+}
@@ -0,0 +1,673 @@
+// Package expand performs the expansions of bash words, turning them into the
+// strings that would be given to a command.
+package expand
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/pattern"
+)
+
+// Variable is the value and attributes of a shell variable.
+//
+// The value of a scalar is stored in Value, while the elements of an Indexed
+// array are stored in Array, and those of an Associative array in Map.
+type Variable struct {
+	Attributes attributes.Attribute
+	Value      string
+	Array      map[int]string
+	Map        map[string]string
+}
+
+// Scalar returns a Variable with the given value and no attributes.
+func Scalar(value string) Variable {
+	return Variable{Value: value}
+}
+
+// Indexed returns an Indexed array Variable with the given values, starting at
+// index zero.
+func Indexed(values ...string) Variable {
+	v := Variable{Attributes: attributes.Indexed, Array: make(map[int]string, len(values))}
+
+	for n, value := range values {
+		v.Array[n] = value
+	}
+
+	return v
+}
+
+// Associative returns an Associative array Variable with the given values.
+func Associative(values map[string]string) Variable {
+	return Variable{Attributes: attributes.Associative, Map: values}
+}
+
+// Keys returns the sorted indices, or keys, of the elements of the Variable.
+//
+// A scalar has a single element with the key "0".
+func (v Variable) Keys() []string {
+	switch {
+	case v.Attributes.Has(attributes.Associative):
+		keys := make([]string, 0, len(v.Map))
+
+		for key := range v.Map {
+			keys = append(keys, key)
+		}
+
+		slices.Sort(keys)
+
+		return keys
+	case v.Attributes.Has(attributes.Indexed):
+		keys := make([]string, 0, len(v.Array))
+
+		for _, idx := range v.indices() {
+			keys = append(keys, strconv.Itoa(idx))
+		}
+
+		return keys
+	}
+
+	return []string{"0"}
+}
+
+func (v Variable) indices() []int {
+	indices := make([]int, 0, len(v.Array))
+
+	for idx := range v.Array {
+		indices = append(indices, idx)
+	}
+
+	slices.Sort(indices)
+
+	return indices
+}
+
+// Values returns the values of the elements of the Variable, in the order of
+// their Keys.
+func (v Variable) Values() []string {
+	switch {
+	case v.Attributes.Has(attributes.Associative):
+		values := make([]string, 0, len(v.Map))
+
+		for _, key := range v.Keys() {
+			values = append(values, v.Map[key])
+		}
+
+		return values
+	case v.Attributes.Has(attributes.Indexed):
+		values := make([]string, 0, len(v.Array))
+
+		for _, idx := range v.indices() {
+			values = append(values, v.Array[idx])
+		}
+
+		return values
+	}
+
+	return []string{v.Value}
+}
+
+// String returns the value of a scalar, the element at index zero of an
+// Indexed array, or the element with the key "0" of an Associative array.
+func (v Variable) String() string {
+	s, _ := v.Index("0")
+
+	return s
+}
+
+// Index returns the element of the Variable with the given key.
+//
+// For an Indexed array, the key must be an integer, and negative indices count
+// back from the end of the array.
+func (v Variable) Index(key string) (string, bool) {
+	if v.Attributes.Has(attributes.Associative) {
+		s, ok := v.Map[key]
+
+		return s, ok
+	}
+
+	idx, err := strconv.Atoi(key)
+	if err != nil {
+		return "", false
+	}
+
+	if !v.Attributes.Has(attributes.Indexed) {
+		return v.Value, idx == 0 || idx == -1
+	}
+
+	if idx < 0 {
+		if indices := v.indices(); len(indices) > 0 {
+			idx += indices[len(indices)-1] + 1
+		}
+	}
+
+	s, ok := v.Array[idx]
+
+	return s, ok
+}
+
+// Assign returns a copy of the Variable with its value set, which for an array
+// is the element with the index, or key, zero.
+func (v Variable) Assign(value string) Variable {
+	switch {
+	case v.Attributes.Has(attributes.Associative):
+		v.Map = copyMap(v.Map)
+		v.Map["0"] = value
+	case v.Attributes.Has(attributes.Indexed):
+		v.Array = copyMap(v.Array)
+		v.Array[0] = value
+	default:
+		v.Value = value
+	}
+
+	return v
+}
+
+// AssignIndex returns a copy of the Variable with the element with the given
+// key set to value.
+//
+// A scalar is converted to an Indexed array, with its value becoming the
+// element at index zero. For an Indexed array, the key must be an integer, and
+// negative indices count back from the end of the array.
+func (v Variable) AssignIndex(key, value string) (Variable, error) {
+	if v.Attributes.Has(attributes.Associative) {
+		v.Map = copyMap(v.Map)
+		v.Map[key] = value
+
+		return v, nil
+	}
+
+	idx, err := strconv.Atoi(key)
+	if err != nil {
+		return v, ErrBadSubscript
+	}
+
+	if !v.Attributes.Has(attributes.Indexed) {
+		v.Attributes |= attributes.Indexed
+		v.Array = map[int]string{0: v.Value}
+		v.Value = ""
+	} else {
+		v.Array = copyMap(v.Array)
+	}
+
+	if idx < 0 {
+		if indices := v.indices(); len(indices) > 0 {
+			idx += indices[len(indices)-1] + 1
+		}
+
+		if idx < 0 {
+			return v, ErrBadSubscript
+		}
+	}
+
+	v.Array[idx] = value
+
+	return v, nil
+}
+
+func copyMap[K comparable](m map[K]string) map[K]string {
+	c := make(map[K]string, len(m)+1)
+
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
+
+// Environment provides access to the variables of a shell.
+//
+// In addition to named variables, Get is used to retrieve the special
+// parameters, such as '?', '$', and '0'. The positional parameters are
+// retrieved with the name '@', as an Indexed array of their values, from which
+// the parameters '#', '*', and '1' onwards are determined.
+//
+// Implementations are responsible for resolving namerefs.
+type Environment interface {
+	Get(name string) (Variable, bool)
+	Set(name string, v Variable) error
+}
+
+// Map is a simple Environment that stores variables in a map.
+type Map map[string]Variable
+
+// Get implements the Environment interface.
+func (m Map) Get(name string) (Variable, bool) {
+	v, ok := m[name]
+
+	return v, ok
+}
+
+// Set implements the Environment interface, returning an error when the
+// variable is Readonly.
+func (m Map) Set(name string, v Variable) error {
+	if m[name].Attributes.Has(attributes.Readonly) {
+		return fmt.Errorf("%s: %w", name, ErrReadonly)
+	}
+
+	m[name] = v
+
+	return nil
+}
+
+// Names implements the Namer interface.
+func (m Map) Names() []string {
+	names := make([]string, 0, len(m))
+
+	for name := range m {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// RefGetter is an optional interface for an Environment whose Get method
+// follows namerefs, allowing a nameref itself to be retrieved, as needed by
+// the '${!ref}' expansion and the '-R' test.
+type RefGetter interface {
+	GetRef(name string) (Variable, bool)
+}
+
+// Namer is an optional interface for an Environment that allows the names of
+// all set variables to be listed, as needed by the '${!prefix*}' expansion.
+type Namer interface {
+	Names() []string
+}
+
+// Options modifies the behaviour of the Expander, matching the shell options
+// of the same names.
+type Options uint16
+
+// Option flags.
+const (
+	NoUnset     Options = 1 << iota // set -u
+	NoGlob                          // set -f
+	NullGlob                        // shopt -s nullglob
+	FailGlob                        // shopt -s failglob
+	DotGlob                         // shopt -s dotglob
+	NoCaseGlob                      // shopt -s nocaseglob
+	NoCaseMatch                     // shopt -s nocasematch
+	ExtGlob                         // shopt -s extglob
+)
+
+// Errors.
+var (
+	ErrUnbound           = errors.New("unbound variable")
+	ErrReadonly          = errors.New("readonly variable")
+	ErrBadSubstitution   = errors.New("bad substitution")
+	ErrNoMatch           = errors.New("no match")
+	ErrInvalidIndirect   = errors.New("invalid indirect expansion")
+	ErrSubstringNegative = errors.New("substring expression < 0")
+	ErrCannotAssign      = errors.New("cannot assign in this way")
+	ErrNoSubstitution    = errors.New("command substitution unavailable")
+	ErrNoArithmetic      = errors.New("arithmetic expansion unavailable")
+	ErrBadSubscript      = errors.New("bad array subscript")
+)
+
+// ParameterError is returned by the '${name:?message}' expansion when the
+// parameter is unset or null.
+type ParameterError struct {
+	Parameter string
+	Message   string
+}
+
+// Error implements the error interface.
+func (p ParameterError) Error() string {
+	if p.Message == "" {
+		return p.Parameter + ": parameter null or not set"
+	}
+
+	return p.Parameter + ": " + p.Message
+}
+
+// Expander performs the expansion of words using the variables of an
+// Environment.
+//
+// FS is used for pathname expansion, which is disabled when it is nil, and
+// represents the root of the filesystem. Dir is the absolute path of the
+// working directory within FS, with an empty Dir being the root.
+//
+// Home is called to determine the home directory of the named user for tilde
+// expansion; the home directory of the current user is taken from the HOME
+// variable.
+//
+// Substitute is called to run the command of a command or process
+// substitution, returning its output for a command substitution, and the path
+// by which the process can be accessed for a process substitution. Arithmetic
+// is called to evaluate an arithmetic expression, after the expansion of its
+// parameters. Expansions requiring either will fail when they are nil.
+type Expander struct {
+	Env        Environment
+	FS         fs.FS
+	Dir        string
+	Options    Options
+	Home       func(user string) (string, bool)
+	Substitute func(*bash.CommandSubstitution) (string, error)
+	Arithmetic func(expr string) (int64, error)
+}
+
+// Fields expands the given words into fields, as for the arguments of a
+// command.
+//
+// Brace expansion is performed first, then tilde, parameter, arithmetic, and
+// command expansion, followed by word splitting, pathname expansion, and quote
+// removal.
+func (e *Expander) Fields(words ...*bash.Word) ([]string, error) {
+	var fields []string
+
+	for _, word := range words {
+		for _, w := range Braces(word) {
+			b, err := e.expand(w, modeFields)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, r := range b.split(e.ifs()) {
+				matches, err := e.pathnames(r)
+				if err != nil {
+					return nil, err
+				}
+
+				fields = append(fields, matches...)
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// Word expands a single word without word splitting or pathname expansion, as
+// for the target of a redirection or the word of a case statement.
+func (e *Expander) Word(w *bash.Word) (string, error) {
+	b, err := e.expand(w, modeWord)
+	if err != nil {
+		return "", err
+	}
+
+	return b.join(), nil
+}
+
+// Assignment expands the value of an assignment, which is as Word except that
+// a tilde following a colon is also expanded.
+func (e *Expander) Assignment(w *bash.Word) (string, error) {
+	b, err := e.expand(w, modeAssignment)
+	if err != nil {
+		return "", err
+	}
+
+	return b.join(), nil
+}
+
+// Pattern expands a word for use as a pattern, as with Word but with any
+// quoted characters escaped with a backslash so that they match literally.
+func (e *Expander) Pattern(w *bash.Word) (string, error) {
+	b, err := e.expand(w, modePattern)
+	if err != nil {
+		return "", err
+	}
+
+	return b.pattern(), nil
+}
+
+// Regexp expands a word for use as a regular expression, as with the right
+// operand of the '=~' operator of the '[[' command, with any quoted characters
+// escaped so that they match literally.
+func (e *Expander) Regexp(w *bash.Word) (string, error) {
+	b, err := e.expand(w, modePattern)
+	if err != nil {
+		return "", err
+	}
+
+	return b.escaped(regexp.QuoteMeta), nil
+}
+
+func (e *Expander) expand(w *bash.Word, m mode) (*builder, error) {
+	b := newBuilder()
+
+	if err := e.parts(b, w.Parts, m, false); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (e *Expander) get(name string) (Variable, bool) {
+	if e.Env == nil {
+		return Variable{}, false
+	}
+
+	return e.Env.Get(name)
+}
+
+func (e *Expander) ifs() string {
+	if v, ok := e.get("IFS"); ok {
+		return v.String()
+	}
+
+	return " \t\n"
+}
+
+// patternOptions returns the options with which patterns are compiled;
+// nocasematch only applies to pattern substitution.
+func (e *Expander) patternOptions(substitution bool) pattern.Options {
+	var opts pattern.Options
+
+	if e.Options&ExtGlob != 0 {
+		opts |= pattern.ExtGlob
+	}
+
+	if substitution && e.Options&NoCaseMatch != 0 {
+		opts |= pattern.NoCaseMatch
+	}
+
+	return opts
+}
+
+func (e *Expander) arithmetic(expr string) (int64, error) {
+	if strings.TrimSpace(expr) == "" {
+		return 0, nil
+	} else if e.Arithmetic == nil {
+		if n, err := strconv.ParseInt(strings.TrimSpace(expr), 10, 64); err == nil {
+			return n, nil
+		}
+
+		return 0, fmt.Errorf("%s: %w", strings.TrimSpace(expr), ErrNoArithmetic)
+	}
+
+	return e.Arithmetic(expr)
+}
+
+// fragment is a section of an expanded word.
+//
+// Quoted fragments are protected from word splitting and pathname expansion,
+// while split fragments, the results of unquoted expansions, are subject to
+// word splitting.
+type fragment struct {
+	text   string
+	quoted bool
+	split  bool
+}
+
+// builder collects the fragments of the fields of a word; multiple fields are
+// created by the expansion of "$@" and similar.
+type builder struct {
+	fields [][]fragment
+}
+
+func newBuilder() *builder {
+	return &builder{fields: [][]fragment{nil}}
+}
+
+func (b *builder) add(f fragment) {
+	b.fields[len(b.fields)-1] = append(b.fields[len(b.fields)-1], f)
+}
+
+func (b *builder) next() {
+	b.fields = append(b.fields, nil)
+}
+
+func (b *builder) merge(c *builder) {
+	for n, field := range c.fields {
+		if n > 0 {
+			b.next()
+		}
+
+		for _, f := range field {
+			b.add(f)
+		}
+	}
+}
+
+func (b *builder) join() string {
+	var sb strings.Builder
+
+	for n, field := range b.fields {
+		if n > 0 {
+			sb.WriteByte(' ')
+		}
+
+		for _, f := range field {
+			sb.WriteString(f.text)
+		}
+	}
+
+	return sb.String()
+}
+
+func (b *builder) pattern() string {
+	return b.escaped(pattern.Escape)
+}
+
+// escaped joins the fields of the builder, escaping the text of quoted
+// fragments.
+func (b *builder) escaped(escape func(string) string) string {
+	var sb strings.Builder
+
+	for n, field := range b.fields {
+		if n > 0 {
+			sb.WriteByte(' ')
+		}
+
+		for _, f := range field {
+			if f.quoted {
+				sb.WriteString(escape(f.text))
+			} else {
+				sb.WriteString(f.text)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// result is a single field after word splitting, holding both the text of the
+// field and the pattern to be used for pathname expansion.
+type result struct {
+	text    string
+	pattern string
+	glob    bool
+}
+
+type splitter struct {
+	results         []result
+	text, pattern   strings.Builder
+	glob, hasResult bool
+}
+
+func (s *splitter) emit() {
+	s.results = append(s.results, result{text: s.text.String(), pattern: s.pattern.String(), glob: s.glob})
+	s.text.Reset()
+	s.pattern.Reset()
+	s.glob = false
+	s.hasResult = false
+}
+
+func (s *splitter) write(c rune, quoted bool) {
+	s.text.WriteRune(c)
+	s.hasResult = true
+
+	if quoted {
+		s.pattern.WriteString(pattern.Escape(string(c)))
+
+		return
+	} else if strings.ContainsRune("*?[(", c) {
+		s.glob = true
+	}
+
+	s.pattern.WriteRune(c)
+}
+
+// split performs word splitting on the fields of the builder, using the
+// characters of ifs as delimiters.
+//
+// A delimiter is either a sequence of IFS whitespace, or a single other IFS
+// character along with any adjacent IFS whitespace. Fields made up only of
+// unquoted expansions that expand to nothing are removed.
+func (b *builder) split(ifs string) []result {
+	var s splitter
+
+	for _, field := range b.fields {
+		type char struct {
+			c      rune
+			quoted bool
+			split  bool
+		}
+
+		var chars []char
+
+		for _, f := range field {
+			if f.quoted && f.text == "" {
+				s.hasResult = true
+			}
+
+			for _, c := range f.text {
+				chars = append(chars, char{c, f.quoted, f.split && strings.ContainsRune(ifs, c)})
+			}
+		}
+
+		for n := 0; n < len(chars); n++ {
+			if !chars[n].split {
+				s.write(chars[n].c, chars[n].quoted)
+
+				continue
+			}
+
+			nonWhitespace := false
+
+			for ; n < len(chars) && chars[n].split; n++ {
+				if !isIFSWhitespace(chars[n].c) {
+					if nonWhitespace {
+						break
+					}
+
+					nonWhitespace = true
+				}
+			}
+
+			n--
+
+			if nonWhitespace || s.hasResult {
+				s.emit()
+			}
+		}
+
+		if s.hasResult {
+			s.emit()
+		}
+	}
+
+	return s.results
+}
+
+func isIFSWhitespace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
@@ -0,0 +1,612 @@
+package expand
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/parser"
+)
+
+func testVars() Map {
+	return Map{
+		"@":    Indexed("a b", "", "c*"),
+		"0":    Scalar("prog"),
+		"x":    Scalar("hello world"),
+		"e":    Scalar(""),
+		"p":    Scalar("/usr/local/lib/file.tar.gz"),
+		"s":    Scalar("  lead  trail  "),
+		"q":    Scalar("it's"),
+		"c":    Scalar("a:b::c:"),
+		"arr":  Indexed("one", "two words", "", "four"),
+		"HOME": Scalar("/home/u"),
+		"m":    Associative(map[string]string{"k1": "v1", "k 2": "v 2"}),
+		"n":    {Attributes: attributes.Integer, Value: "42"},
+		"ref":  Scalar("x"),
+		"aref": Scalar("arr[1]"),
+		"star": Scalar("*"),
+		"sp":   {Attributes: attributes.Indexed, Array: map[int]string{1: "s1", 5: "s5", 9: "s9"}},
+	}
+}
+
+var testFS = fstest.MapFS{
+	"a.txt":     {},
+	"b.txt":     {},
+	"c.go":      {},
+	"Abc":       {},
+	".hidden":   {},
+	"dir/x.txt": {},
+}
+
+func ifs(s string) *string {
+	return &s
+}
+
+func words(t *testing.T, src string) []*bash.Word {
+	t.Helper()
+
+	tk := parser.NewStringTokeniser("cmd " + src)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %s", err)
+	}
+
+	var words []*bash.Word
+
+	for _, aw := range f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command.AssignmentsOrWords[1:] {
+		words = append(words, aw.Word)
+	}
+
+	return words
+}
+
+func TestFields(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		IFS    *string
+		Output []string
+	}{
+		{ // 1
+			Input:  "$x",
+			Output: []string{"hello", "world"},
+		},
+		{ // 2
+			Input:  `"$x" $e "$e"`,
+			Output: []string{"hello world", ""},
+		},
+		{ // 3
+			Input:  `$@ "$@" "x$@y"`,
+			Output: []string{"a", "b", "c.go", "a b", "", "c*", "xa b", "", "c*y"},
+		},
+		{ // 4
+			Input:  `$* "$*"`,
+			Output: []string{"a", "b", "c.go", "a b  c*"},
+		},
+		{ // 5
+			Input:  `"$*" $c :a::b:`,
+			IFS:    ifs(":"),
+			Output: []string{"a b::c*", "a", "b", "", "c", ":a::b:"},
+		},
+		{ // 6
+			Input:  `$x "${arr[*]}" $@`,
+			IFS:    ifs(""),
+			Output: []string{"hello world", "onetwo wordsfour", "a b", "c.go"},
+		},
+		{ // 7
+			Input:  "$# ${#x} ${#arr[@]} ${#arr} ${#@}",
+			Output: []string{"3", "11", "4", "3", "3"},
+		},
+		{ // 8
+			Input:  `${arr[1]} "${arr[@]}" ${arr[@]} "${arr[*]}"`,
+			Output: []string{"two", "words", "one", "two words", "", "four", "one", "two", "words", "four", "one two words  four"},
+		},
+		{ // 9
+			Input:  `${!arr[@]} "${!sp[@]}" ${sp[@]:2:1} ${sp[@]:5} ${sp[@]: -1}`,
+			Output: []string{"0", "1", "2", "3", "1", "5", "9", "s5", "s5", "s9", "s9"},
+		},
+		{ // 10
+			Input:  `${!ref} ${!aref} ${!x*} "${!a@}"`,
+			Output: []string{"hello", "world", "two", "words", "x", "aref", "arr"},
+		},
+		{ // 11
+			Input:  `${e:-default value} "${e:-default value}" ${e-unset} ${u-unset} ${u:-"a b"}`,
+			Output: []string{"default", "value", "default value", "unset", "a b"},
+		},
+		{ // 12
+			Input:  `${x:+alt} ${e:+alt} ${e+alt} ${u+alt} "${u:+x}" "${u:-}"`,
+			Output: []string{"alt", "alt", "", ""},
+		},
+		{ // 13
+			Input:  "${p#*/} ${p##*/} ${p%.*} ${p%%.*}",
+			Output: []string{"usr/local/lib/file.tar.gz", "file.tar.gz", "/usr/local/lib/file.tar", "/usr/local/lib/file"},
+		},
+		{ // 14
+			Input:  `${p/l/L} ${p//l/L} ${p/#\/usr/X} ${p/%gz/bz2} ${p//[aeiou]/}`,
+			Output: []string{"/usr/Local/lib/file.tar.gz", "/usr/LocaL/Lib/fiLe.tar.gz", "X/local/lib/file.tar.gz", "/usr/local/lib/file.tar.bz2", "/sr/lcl/lb/fl.tr.gz"},
+		},
+		{ // 15
+			Input:  `${x/o/&&} ${x/o/"&"} ${x/#/pre-} ${x/%/-suf} ${x//?/.}`,
+			Output: []string{"helloo", "world", "hell&", "world", "pre-hello", "world", "hello", "world-suf", "..........."},
+		},
+		{ // 16
+			Input:  `${x:1:3} ${x: -5} ${x: -5:2} ${x:2:-2} ${x:20} ${x::3}`,
+			Output: []string{"ell", "world", "wo", "llo", "wor", "hel"},
+		},
+		{ // 17
+			Input:  `${@:2} "${@:0:2}" "${arr[@]:1:2}"`,
+			Output: []string{"c.go", "prog", "a b", "two words", ""},
+		},
+		{ // 18
+			Input:  "${x^} ${x^^} ${x^^[lo]} ${x,,} ${x@U} ${x@u} ${x@L} ${arr[@]^}",
+			Output: []string{"Hello", "world", "HELLO", "WORLD", "heLLO", "wOrLd", "hello", "world", "HELLO", "WORLD", "Hello", "world", "hello", "world", "One", "Two", "words", "Four"},
+		},
+		{ // 19
+			Input:  "${q@Q} ${arr[@]@Q} ${x@A} ${arr[@]@A} ${n@A} ${n@a} ${arr@a}",
+			Output: []string{"'it'\\''s'", "'one'", "'two", "words'", "''", "'four'", "x='hello", "world'", "declare", "-a", "arr=([0]=\"one\"", "[1]=\"two", "words\"", "[2]=\"\"", "[3]=\"four\")", "declare", "-i", "n='42'", "i", "a"},
+		},
+		{ // 20
+			Input:  `"${m[k 2]}" ${m[k1]} "${m[@]}"`,
+			Output: []string{"v 2", "v1", "v 2", "v1"},
+		},
+		{ // 21
+			Input:  `*.txt "*.txt" \*.txt * .* d*/ */*.txt`,
+			Output: []string{"a.txt", "b.txt", "*.txt", "*.txt", "Abc", "a.txt", "b.txt", "c.go", "dir", ".hidden", "dir/", "dir/x.txt"},
+		},
+		{ // 22
+			Input:  `$star "$star" nomatch* [ab].txt [!a].txt [[:alpha:]].txt a?txt`,
+			Output: []string{"Abc", "a.txt", "b.txt", "c.go", "dir", "*", "nomatch*", "a.txt", "b.txt", "b.txt", "a.txt", "b.txt", "a.txt"},
+		},
+		{ // 23
+			Input:  `~ ~/x ~root/y ~nouser "~" a~ ~$x`,
+			Output: []string{"/home/u", "/home/u/x", "/root/y", "~nouser", "~", "a~", "~hello", "world"},
+		},
+		{ // 24
+			Input:  `$s "$s" x${s}y ${s// /_}`,
+			Output: []string{"lead", "trail", "  lead  trail  ", "x", "lead", "trail", "y", "__lead__trail__"},
+		},
+		{ // 25
+			Input:  `'$x' $'a\tb' "a\"b" a\ b "$e$e" ""$e '' ""`,
+			Output: []string{"$x", "a\tb", "a\"b", "a b", "", "", "", ""},
+		},
+		{ // 26
+			Input:  `"${arr[@]/o/0}" ${x#"hello"} ${x#'h'*} "${u-"$x"}" ${u:-$x} "${@:-none}"`,
+			Output: []string{"0ne", "tw0 words", "", "f0ur", "world", "ello", "world", "hello world", "hello", "world", "a b", "", "c*"},
+		},
+		{ // 27
+			Input:  `"$@""" "${arr[@]}""x" x"${arr[@]}"y ${u}x`,
+			Output: []string{"a b", "", "c*", "one", "two words", "", "fourx", "xone", "two words", "", "foury", "x"},
+		},
+		{ // 28
+			Input:  `$1$2 "$1$2$3" ${3} ${10-ten} ${@: -1} ${sp} ${sp[5]}`,
+			Output: []string{"a", "b", "a bc*", "c.go", "ten", "c.go", "s5"},
+		},
+	} {
+		v := testVars()
+
+		if test.IFS != nil {
+			v["IFS"] = Scalar(*test.IFS)
+		}
+
+		e := Expander{Env: v, FS: testFS, Home: func(user string) (string, bool) {
+			return "/" + user, user == "root"
+		}}
+
+		if output, err := e.Fields(words(t, test.Input)...); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestBraces(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  string
+		Output []string
+	}{
+		{ // 1
+			Input:  "a{b,c}d {a,b}{1,2}",
+			Output: []string{"abd", "acd", "a1", "a2", "b1", "b2"},
+		},
+		{ // 2
+			Input:  "{01..10..3} {a..e..2} {3..-3..2} {-03..3..3}",
+			Output: []string{"01", "04", "07", "10", "a", "c", "e", "3", "1", "-1", "-3", "-03", "000", "003"},
+		},
+		{ // 3
+			Input:  "a{b,c{d,e}}f x{,} {a,}{b,}",
+			Output: []string{"abf", "acdf", "acef", "x", "x", "ab", "a", "b"},
+		},
+		{ // 4
+			Input:  "{{a,b}} {a,b}} {{a,b} {a,b}{",
+			Output: []string{"{a}", "{b}", "a}", "b}", "{a", "{b", "a{", "b{"},
+		},
+		{ // 5
+			Input:  "{Z..a}",
+			Output: []string{"Z", "[", "", "]", "^", "_", "`", "a"},
+		},
+		{ // 6
+			Input:  `\{a,b} {a,b\}c} {x} {1..a} "{a,b}"{c,d} {a,"b c"}`,
+			Output: []string{"{a,b}", "a", "b}c", "{x}", "{1..a}", "{a,b}c", "{a,b}d", "a", "b c"},
+		},
+		{ // 7
+			Input:  "pre{x,y,}post {} a{}b{c,d}",
+			Output: []string{"prexpost", "preypost", "prepost", "{}", "a{}bc", "a{}bd"},
+		},
+		{ // 8
+			Input:  "$x{1..2} ${x:-a}{b,c} {$x,y} '{a,b}'",
+			Output: []string{"hello", "worldb", "hello", "worldc", "hello", "world", "y", "{a,b}"},
+		},
+	} {
+		e := Expander{Env: testVars()}
+
+		if output, err := e.Fields(words(t, test.Input)...); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestFieldsEmpty(t *testing.T) {
+	e := Expander{Env: Map{"@": Indexed(), "a": Indexed()}}
+
+	for n, input := range [...]string{
+		`"$@"`,
+		`"${a[@]}"`,
+		`$@ $* $u "${a[@]}${a[@]}"`,
+		`"${!nothing@}"`,
+	} {
+		if output, err := e.Fields(words(t, input)...); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if len(output) != 0 {
+			t.Errorf("test %d: expecting no fields, got %q", n+1, output)
+		}
+	}
+}
+
+func TestFieldsErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Options Options
+		Err     error
+		Message string
+	}{
+		{ // 1
+			Input:   "$u",
+			Options: NoUnset,
+			Err:     ErrUnbound,
+			Message: "u: unbound variable",
+		},
+		{ // 2
+			Input:   "${arr[7]}",
+			Options: NoUnset,
+			Err:     ErrUnbound,
+			Message: "arr[7]: unbound variable",
+		},
+		{ // 3
+			Input:   "${#u}",
+			Options: NoUnset,
+			Err:     ErrUnbound,
+		},
+		{ // 4
+			Input:   "${u:?}",
+			Message: "u: parameter null or not set",
+		},
+		{ // 5
+			Input:   `${e:?"must be set"}`,
+			Message: "e: must be set",
+		},
+		{ // 6
+			Input: "${!u}",
+			Err:   ErrInvalidIndirect,
+		},
+		{ // 7
+			Input: "${x:2:-20}",
+			Err:   ErrSubstringNegative,
+		},
+		{ // 8
+			Input:   "nomatch*",
+			Options: FailGlob,
+			Err:     ErrNoMatch,
+			Message: "nomatch*: no match",
+		},
+		{ // 9
+			Input: "$(echo)",
+			Err:   ErrNoSubstitution,
+		},
+		{ // 10
+			Input: "$((1+2))",
+			Err:   ErrNoArithmetic,
+		},
+		{ // 11
+			Input: "${5:=x}",
+			Err:   ErrCannotAssign,
+		},
+	} {
+		e := Expander{Env: testVars(), FS: testFS, Options: test.Options}
+
+		_, err := e.Fields(words(t, test.Input)...)
+		if err == nil {
+			t.Errorf("test %d: expecting error, got none", n+1)
+		} else if test.Err != nil && !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if test.Message != "" && err.Error() != test.Message {
+			t.Errorf("test %d: expecting message %q, got %q", n+1, test.Message, err.Error())
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Options Options
+		Dir     string
+		Output  []string
+	}{
+		{ // 1
+			Input:   "*.txt nomatch* $@",
+			Options: NoUnset | NullGlob,
+			Output:  []string{"a.txt", "b.txt", "a", "b"},
+		},
+		{ // 2
+			Input:   "*.txt",
+			Options: NoGlob,
+			Output:  []string{"*.txt"},
+		},
+		{ // 3
+			Input:   "*",
+			Options: DotGlob,
+			Output:  []string{".hidden", "Abc", "a.txt", "b.txt", "c.go", "dir"},
+		},
+		{ // 4
+			Input:   "a*",
+			Options: NoCaseGlob,
+			Output:  []string{"Abc", "a.txt"},
+		},
+		{ // 5
+			Input:  "* /*.go ../*.go",
+			Dir:    "/dir",
+			Output: []string{"x.txt", "/c.go", "../c.go"},
+		},
+		{ // 6
+			Input:  `"${x//+(l)/_}"`,
+			Output: []string{"Hello World"},
+		},
+		{ // 7
+			Input:   `"${x//+(l)/_}" "${x##+([A-Za-z])}" "${x/?(z)/_}" "${x//*(l)/-}"`,
+			Options: ExtGlob,
+			Output:  []string{"He_o Wor_d", " World", "_Hello World", "-H-e--o- -W-o-r--d"},
+		},
+		{ // 8
+			Input:   `"${x//h/j}" "${x#h}" "${x/#h/j}"`,
+			Options: NoCaseMatch,
+			Output:  []string{"jello World", "Hello World", "jello World"},
+		},
+	} {
+		e := Expander{Env: Map{"@": Indexed("a", "b"), "x": Scalar("Hello World")}, FS: testFS, Options: test.Options, Dir: test.Dir}
+
+		if output, err := e.Fields(words(t, test.Input)...); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestWord(t *testing.T) {
+	for n, test := range [...]struct {
+		Input, Word, Assignment, Pattern, Regexp string
+	}{
+		{ // 1
+			Input:      "$x",
+			Word:       "hello world",
+			Assignment: "hello world",
+			Pattern:    "hello world",
+			Regexp:     "hello world",
+		},
+		{ // 2
+			Input:      `$@"$*"`,
+			Word:       "a b  c*a b  c*",
+			Assignment: "a b  c*a b  c*",
+			Pattern:    `a b  c*a b  c\*`,
+			Regexp:     `a b  c*a b  c\*`,
+		},
+		{ // 3
+			Input:      "~/a:~/b",
+			Word:       "/home/u/a:~/b",
+			Assignment: "/home/u/a:/home/u/b",
+			Pattern:    "/home/u/a:~/b",
+			Regexp:     "/home/u/a:~/b",
+		},
+		{ // 4
+			Input:      `*."*"\?$star"$star"`,
+			Word:       "*.*?**",
+			Assignment: "*.*?**",
+			Pattern:    `*.\*\?*\*`,
+			Regexp:     `*.\*\?*\*`,
+		},
+		{ // 5
+			Input:      `"a.(b)+"c+.`,
+			Word:       "a.(b)+c+.",
+			Assignment: "a.(b)+c+.",
+			Pattern:    `a.\(b\)\+c+.`,
+			Regexp:     `a\.\(b\)\+c+.`,
+		},
+	} {
+		e := Expander{Env: testVars(), FS: testFS}
+		w := words(t, test.Input)[0]
+
+		if word, err := e.Word(w); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if word != test.Word {
+			t.Errorf("test %d: expecting word %q, got %q", n+1, test.Word, word)
+		} else if assignment, err := e.Assignment(w); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if assignment != test.Assignment {
+			t.Errorf("test %d: expecting assignment %q, got %q", n+1, test.Assignment, assignment)
+		} else if pattern, err := e.Pattern(w); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if pattern != test.Pattern {
+			t.Errorf("test %d: expecting pattern %q, got %q", n+1, test.Pattern, pattern)
+		} else if regexp, err := e.Regexp(w); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if regexp != test.Regexp {
+			t.Errorf("test %d: expecting regexp %q, got %q", n+1, test.Regexp, regexp)
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	v := testVars()
+	e := Expander{Env: v}
+
+	output, err := e.Fields(words(t, `${u:=new value} ${e:=set} ${x:=ignored} ${arr[7]=seven} ${m[k3]:=v3}`)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := []string{"new", "value", "set", "hello", "world", "seven", "v3"}; !reflect.DeepEqual(output, expected) {
+		t.Errorf("expecting output %q, got %q", expected, output)
+	}
+
+	if u := v["u"].String(); u != "new value" {
+		t.Errorf("expecting u to be %q, got %q", "new value", u)
+	}
+
+	if s, _ := v["arr"].Index("7"); s != "seven" {
+		t.Errorf("expecting arr[7] to be %q, got %q", "seven", s)
+	}
+
+	if s, _ := v["m"].Index("k3"); s != "v3" {
+		t.Errorf("expecting m[k3] to be %q, got %q", "v3", s)
+	}
+
+	if _, err := e.Fields(words(t, "${x[2]=two}")...); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if x := v["x"]; !reflect.DeepEqual(x.Keys(), []string{"0", "2"}) || x.String() != "hello world" {
+		t.Errorf("expecting x to be an array with keys [0 2], got %v", x)
+	}
+
+	v["r"] = Variable{Attributes: attributes.Readonly}
+
+	if _, err := e.Fields(words(t, "${r:=x}")...); !errors.Is(err, ErrReadonly) {
+		t.Errorf("expecting error %v, got %v", ErrReadonly, err)
+	}
+}
+
+func TestSubstitutions(t *testing.T) {
+	var commands, exprs []string
+
+	e := Expander{
+		Env: Map{"i": Scalar("3")},
+		Substitute: func(cs *bash.CommandSubstitution) (string, error) {
+			commands = append(commands, cs.Command.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command.AssignmentsOrWords[1].Word.Parts[0].Part.Data)
+
+			if cs.SubstitutionType == bash.SubstitutionProcessInput {
+				return "/dev/fd/63", nil
+			}
+
+			return "a b\n\n", nil
+		},
+		Arithmetic: func(expr string) (int64, error) {
+			var total int64
+
+			exprs = append(exprs, expr)
+
+			for _, f := range strings.Split(expr, "+") {
+				if f = strings.TrimSpace(f); f != "" {
+					n, err := strconv.ParseInt(f, 10, 64)
+					if err != nil {
+						return 0, err
+					}
+
+					total += n
+				}
+			}
+
+			return total, nil
+		},
+	}
+
+	output, err := e.Fields(words(t, "$(echo 1) \"`echo 2`\" <(echo 3) $(( 1 + $i + ${i} )) ${x:$((1+1)):1}")...)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := []string{"a", "b", "a b", "/dev/fd/63", "7"}; !reflect.DeepEqual(output, expected) {
+		t.Errorf("expecting output %q, got %q", expected, output)
+	}
+
+	if expected := []string{"1", "2", "3"}; !slices.Equal(commands, expected) {
+		t.Errorf("expecting commands %q, got %q", expected, commands)
+	}
+
+	if expected := []string{" 1 + 3 + 3 ", "1+1", "2", "1"}; !slices.Equal(exprs, expected) {
+		t.Errorf("expecting expressions %q, got %q", expected, exprs)
+	}
+}
+
+func TestVariable(t *testing.T) {
+	sp := Variable{Attributes: attributes.Indexed, Array: map[int]string{1: "a", 4: "b"}}
+
+	for n, test := range [...]struct {
+		Variable Variable
+		Keys     []string
+		Values   []string
+		String   string
+		Index    string
+		Value    string
+		Set      bool
+	}{
+		{ // 1
+			Variable: Scalar("a"),
+			Keys:     []string{"0"},
+			Values:   []string{"a"},
+			String:   "a",
+			Index:    "0",
+			Value:    "a",
+			Set:      true,
+		},
+		{ // 2
+			Variable: sp,
+			Keys:     []string{"1", "4"},
+			Values:   []string{"a", "b"},
+			Index:    "-1",
+			Value:    "b",
+			Set:      true,
+		},
+		{ // 3
+			Variable: sp,
+			Keys:     []string{"1", "4"},
+			Values:   []string{"a", "b"},
+			Index:    "2",
+		},
+		{ // 4
+			Variable: Associative(map[string]string{"b": "2", "a": "1"}),
+			Keys:     []string{"a", "b"},
+			Values:   []string{"1", "2"},
+			Index:    "b",
+			Value:    "2",
+			Set:      true,
+		},
+	} {
+		if keys := test.Variable.Keys(); !slices.Equal(keys, test.Keys) {
+			t.Errorf("test %d: expecting keys %q, got %q", n+1, test.Keys, keys)
+		} else if values := test.Variable.Values(); !slices.Equal(values, test.Values) {
+			t.Errorf("test %d: expecting values %q, got %q", n+1, test.Values, values)
+		} else if s := test.Variable.String(); s != test.String {
+			t.Errorf("test %d: expecting string %q, got %q", n+1, test.String, s)
+		} else if value, set := test.Variable.Index(test.Index); value != test.Value || set != test.Set {
+			t.Errorf("test %d: expecting index %q to be %q (%t), got %q (%t)", n+1, test.Index, test.Value, test.Set, value, set)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package expand
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash/pattern"
+)
+
+// pathnames performs pathname expansion on a field, returning the sorted
+// matching paths, or the field itself when it is not a pattern or matches
+// nothing.
+func (e *Expander) pathnames(r result) ([]string, error) {
+	if !r.glob || e.FS == nil || e.Options&NoGlob != 0 || !pattern.HasMeta(r.pattern, e.patternOptions(false)) {
+		return []string{r.text}, nil
+	}
+
+	matches := e.glob(r.pattern)
+
+	if len(matches) == 0 {
+		switch {
+		case e.Options&FailGlob != 0:
+			return nil, fmt.Errorf("%s: %w", r.text, ErrNoMatch)
+		case e.Options&NullGlob != 0:
+			return nil, nil
+		}
+
+		return []string{r.text}, nil
+	}
+
+	return matches, nil
+}
+
+// glob matches a pattern against the paths of the filesystem, one path
+// component at a time.
+func (e *Expander) glob(pat string) []string {
+	base := strings.TrimPrefix(e.Dir, "/")
+	prefixes := []string{""}
+
+	if strings.HasPrefix(pat, "/") {
+		base = ""
+		prefixes[0] = "/"
+		pat = strings.TrimLeft(pat, "/")
+	}
+
+	opts := e.patternOptions(false)
+
+	if e.Options&NoCaseGlob != 0 {
+		opts |= pattern.NoCaseMatch
+	}
+
+	components := strings.Split(pat, "/")
+
+	for n, component := range components {
+		last := n == len(components)-1
+
+		if component == "" {
+			if last {
+				break
+			}
+
+			continue
+		}
+
+		var (
+			next     []string
+			compiled *pattern.Pattern
+		)
+
+		if pattern.HasMeta(component, opts) {
+			compiled = pattern.Compile(component, opts)
+		}
+
+		for _, prefix := range prefixes {
+			dir := e.fsPath(base, prefix)
+
+			if compiled == nil {
+				name := pattern.Unescape(component)
+
+				if _, err := fs.Stat(e.FS, path.Join(dir, name)); err == nil {
+					next = append(next, prefix+name+separator(last))
+				}
+
+				continue
+			}
+
+			entries, err := fs.ReadDir(e.FS, dir)
+			if err != nil {
+				continue
+			}
+
+			for _, entry := range entries {
+				name := entry.Name()
+
+				if strings.HasPrefix(name, ".") && e.Options&DotGlob == 0 && !strings.HasPrefix(component, ".") && !strings.HasPrefix(component, "\\.") {
+					continue
+				}
+
+				if !compiled.Match(name) {
+					continue
+				}
+
+				if !last || strings.HasSuffix(pat, "/") {
+					if fi, err := fs.Stat(e.FS, path.Join(dir, name)); err != nil || !fi.IsDir() {
+						continue
+					}
+				}
+
+				next = append(next, prefix+name+separator(last))
+			}
+		}
+
+		prefixes = next
+	}
+
+	if strings.HasSuffix(pat, "/") {
+		for n := range prefixes {
+			prefixes[n] = strings.TrimSuffix(prefixes[n], "/") + "/"
+		}
+	}
+
+	slices.Sort(prefixes)
+
+	return prefixes
+}
+
+func separator(last bool) string {
+	if last {
+		return ""
+	}
+
+	return "/"
+}
+
+// fsPath converts a path produced by glob into a path within the filesystem.
+func (e *Expander) fsPath(base, p string) string {
+	if strings.HasPrefix(p, "/") {
+		base, p = "", p[1:]
+	}
+
+	return path.Clean(path.Join(".", base, p))
+}
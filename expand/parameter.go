@@ -0,0 +1,834 @@
+package expand
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/bash/pattern"
+)
+
+// parameter is a resolved parameter, along with the values it expands to.
+//
+// Array is set when the parameter expands to all of the elements of an array,
+// or all of the positional parameters, with Star set when these would be
+// joined into a single field within double quotes.
+type parameter struct {
+	name     string
+	variable Variable
+	exists   bool
+	key      string
+	hasKey   bool
+	values   []string
+	keys     []string
+	set      bool
+	array    bool
+	star     bool
+}
+
+// isNull determines whether the parameter is unset or, when colon is set,
+// null.
+func (p *parameter) isNull(colon bool) bool {
+	if !p.set {
+		return true
+	}
+
+	return colon && (len(p.values) == 0 || len(p.values) == 1 && p.values[0] == "")
+}
+
+func isAll(p bash.Parameter) bool {
+	_, ok := allSubscript(p)
+
+	return ok
+}
+
+func allSubscript(p bash.Parameter) (string, bool) {
+	if len(p.Array) != 1 || p.Array[0].Word == nil {
+		return "", false
+	}
+
+	lit, ok := astutil.Literal(p.Array[0].Word)
+	if !ok || lit != "@" && lit != "*" {
+		return "", false
+	}
+
+	return lit, true
+}
+
+// parameterExpansion performs a parameter expansion, adding the resulting
+// fragments to the builder.
+func (e *Expander) parameterExpansion(b *builder, p *bash.ParameterExpansion, m mode, quoted bool) error {
+	if p.Parameter.Parameter == nil {
+		return ErrBadSubstitution
+	}
+
+	param, err := e.lookup(p)
+	if err != nil {
+		return err
+	}
+
+	switch p.Type {
+	case bash.ParameterSetAssign, bash.ParameterUnsetSetAssign:
+		if param.isNull(p.Type == bash.ParameterSetAssign) {
+			return e.braceWord(b, p.BraceWord, m, quoted)
+		}
+	case bash.ParameterMessage, bash.ParameterUnsetMessage:
+		if !param.isNull(p.Type == bash.ParameterMessage) {
+			return e.braceWord(b, p.BraceWord, m, quoted)
+		}
+
+		return nil
+	case bash.ParameterSubstitution, bash.ParameterUnsetSubstitution:
+		if param.isNull(p.Type == bash.ParameterSubstitution) {
+			value, err := e.braceWordString(p.BraceWord)
+			if err != nil {
+				return err
+			}
+
+			if err := e.assign(param, value); err != nil {
+				return err
+			}
+
+			param.values, param.array, param.set = []string{value}, false, true
+		}
+	case bash.ParameterAssignment, bash.ParameterUnsetAssignment:
+		if param.isNull(p.Type == bash.ParameterAssignment) {
+			msg, err := e.braceWordString(p.BraceWord)
+			if err != nil {
+				return err
+			}
+
+			return ParameterError{Parameter: param.name, Message: msg}
+		}
+	default:
+		if !param.set && e.Options&NoUnset != 0 && !param.array && p.Type != bash.ParameterPrefix && p.Type != bash.ParameterPrefixSeperate {
+			return fmt.Errorf("%s: %w", param.name, ErrUnbound)
+		}
+
+		if err := e.operation(p, &param); err != nil {
+			return err
+		}
+	}
+
+	e.addValues(b, &param, m, quoted)
+
+	return nil
+}
+
+func (e *Expander) addValues(b *builder, param *parameter, m mode, quoted bool) {
+	if !param.array {
+		if len(param.values) > 0 {
+			b.add(fragment{text: param.values[0], quoted: quoted, split: !quoted})
+		}
+
+		return
+	}
+
+	if param.star && (quoted || m != modeFields) {
+		sep := e.ifs()
+		if len(sep) > 1 {
+			_, size := utf8.DecodeRuneInString(sep)
+			sep = sep[:size]
+		}
+
+		b.add(fragment{text: strings.Join(param.values, sep), quoted: quoted, split: !quoted})
+
+		return
+	}
+
+	for n, value := range param.values {
+		if n > 0 {
+			b.next()
+		}
+
+		b.add(fragment{text: value, quoted: quoted, split: !quoted})
+	}
+}
+
+// braceWord expands the word of a '${name:-word}' or '${name:+word}'
+// expansion into the builder.
+func (e *Expander) braceWord(b *builder, bw *bash.BraceWord, m mode, quoted bool) error {
+	if bw == nil {
+		if quoted {
+			b.add(fragment{quoted: true})
+		}
+
+		return nil
+	}
+
+	if !quoted {
+		return e.parts(b, bw.Parts, m, true)
+	}
+
+	for _, p := range bw.Parts {
+		if err := e.part(b, &p, m, false, true, true); err != nil {
+			return err
+		}
+	}
+
+	if len(bw.Parts) == 0 {
+		b.add(fragment{quoted: true})
+	}
+
+	return nil
+}
+
+func (e *Expander) braceWordString(bw *bash.BraceWord) (string, error) {
+	if bw == nil {
+		return "", nil
+	}
+
+	b := newBuilder()
+
+	if err := e.parts(b, bw.Parts, modeWord, true); err != nil {
+		return "", err
+	}
+
+	return b.join(), nil
+}
+
+// braceWordPattern expands the word of a '${name#pattern}' or similar
+// expansion into a pattern.
+func (e *Expander) braceWordPattern(bw *bash.BraceWord) (string, error) {
+	if bw == nil {
+		return "", nil
+	}
+
+	b := newBuilder()
+
+	if err := e.parts(b, bw.Parts, modePattern, true); err != nil {
+		return "", err
+	}
+
+	return b.pattern(), nil
+}
+
+// nameref returns the named variable, without following namerefs, when it
+// is a nameref.
+func (e *Expander) nameref(name string) (Variable, bool) {
+	rg, ok := e.Env.(RefGetter)
+	if !ok {
+		return Variable{}, false
+	}
+
+	v, ok := rg.GetRef(name)
+
+	return v, ok && v.Attributes.Has(attributes.Nameref)
+}
+
+// lookup resolves the parameter of an expansion, including any indirection.
+//
+// The indirect expansion of a nameref, '${!ref}', expands to the name of the
+// variable it refers to.
+func (e *Expander) lookup(p *bash.ParameterExpansion) (parameter, error) {
+	name := p.Parameter.Parameter.Data
+
+	switch p.Type {
+	case bash.ParameterPrefix, bash.ParameterPrefixSeperate:
+		return e.prefixed(name, p.Type == bash.ParameterPrefix), nil
+	}
+
+	if p.Indirect {
+		if all, ok := allSubscript(p.Parameter); ok {
+			param, err := e.resolve(name, nil, "", false)
+			if err != nil {
+				return param, err
+			}
+
+			param.values = param.keys
+			param.array, param.star = true, all == "*"
+
+			return param, nil
+		}
+
+		if ref, ok := e.nameref(name); ok && len(p.Parameter.Array) == 0 {
+			return parameter{name: name, values: []string{ref.Value}, set: true}, nil
+		}
+
+		target, err := e.resolve(name, p.Parameter.Array, "", false)
+		if err != nil {
+			return target, err
+		}
+
+		if !target.set || len(target.values) == 0 || target.values[0] == "" {
+			if e.Options&NoUnset != 0 && !target.set {
+				return target, fmt.Errorf("%s: %w", target.name, ErrUnbound)
+			}
+
+			return target, fmt.Errorf("%s: %w", target.name, ErrInvalidIndirect)
+		}
+
+		name = strings.Join(target.values, " ")
+
+		if open := strings.IndexByte(name, '['); open > 0 && strings.HasSuffix(name, "]") {
+			return e.resolve(name[:open], nil, name[open+1:len(name)-1], true)
+		}
+
+		if !isParameterName(name) {
+			return target, fmt.Errorf("%s: %w", name, ErrBadSubstitution)
+		}
+
+		return e.resolve(name, nil, "", false)
+	}
+
+	param, err := e.resolve(name, p.Parameter.Array, "", false)
+	if err != nil {
+		return param, err
+	}
+
+	if p.Type == bash.ParameterLength {
+		if param.array {
+			param.values = []string{strconv.Itoa(len(param.values))}
+		} else if param.set {
+			param.values = []string{strconv.Itoa(utf8.RuneCountInString(param.values[0]))}
+		} else if e.Options&NoUnset != 0 {
+			return param, fmt.Errorf("%s: %w", param.name, ErrUnbound)
+		} else {
+			param.values = []string{"0"}
+		}
+
+		param.set, param.array = true, false
+	}
+
+	return param, nil
+}
+
+func isParameterName(name string) bool {
+	if astutil.IsName(name) || len(name) == 1 && strings.Contains("@*#?-$!0", name) {
+		return true
+	}
+
+	_, err := strconv.ParseUint(name, 10, 64)
+
+	return err == nil
+}
+
+// prefixed returns the sorted names of the set variables that start with the
+// given prefix.
+func (e *Expander) prefixed(prefix string, star bool) parameter {
+	param := parameter{name: prefix, set: true, array: true, star: star}
+
+	if n, ok := e.Env.(Namer); ok {
+		for _, name := range n.Names() {
+			if strings.HasPrefix(name, prefix) {
+				param.values = append(param.values, name)
+			}
+		}
+	}
+
+	slices.Sort(param.values)
+
+	return param
+}
+
+// resolve retrieves the values of a parameter, which may be subscripted either
+// by the words of the subscript, or by the given key when subscripted is set.
+func (e *Expander) resolve(name string, subscript []bash.WordOrOperator, key string, subscripted bool) (parameter, error) {
+	param := parameter{name: name}
+
+	if all, ok := allSubscript(bash.Parameter{Array: subscript}); ok {
+		subscript, key, subscripted = nil, all, true
+	} else if len(subscript) > 0 {
+		var (
+			sb  strings.Builder
+			end uint64
+		)
+
+		for n, wo := range subscript {
+			if len(wo.Tokens) > 0 {
+				if n > 0 && wo.Tokens[0].Pos > end {
+					sb.WriteByte(' ')
+				}
+
+				last := wo.Tokens[len(wo.Tokens)-1]
+				end = last.Pos + uint64(len(last.Data))
+			}
+
+			if wo.Operator != nil {
+				sb.WriteString(wo.Operator.Data)
+			} else if wo.Word != nil {
+				s, err := e.Word(wo.Word)
+				if err != nil {
+					return param, err
+				}
+
+				sb.WriteString(s)
+			}
+		}
+
+		key, subscripted = sb.String(), true
+	}
+
+	switch {
+	case name == "@" || name == "*":
+		at, _ := e.get("@")
+		param.values = at.Values()
+		param.set, param.array, param.star = true, true, name == "*"
+		param.keys = make([]string, len(param.values))
+
+		for n := range param.keys {
+			param.keys[n] = strconv.Itoa(n + 1)
+		}
+
+		return param, nil
+	case name == "#":
+		at, _ := e.get("@")
+		param.values, param.set = []string{strconv.Itoa(len(at.Values()))}, true
+
+		return param, nil
+	case name != "0" && name[0] >= '0' && name[0] <= '9':
+		idx, _ := strconv.Atoi(name)
+
+		at, _ := e.get("@")
+		if values := at.Values(); idx <= len(values) {
+			param.values, param.set = []string{values[idx-1]}, true
+		}
+
+		return param, nil
+	}
+
+	param.variable, param.exists = e.get(name)
+	param.keys = param.variable.Keys()
+
+	if !subscripted {
+		if value, ok := param.variable.Index("0"); param.exists && ok {
+			param.values, param.set = []string{value}, true
+		}
+
+		return param, nil
+	}
+
+	if key == "@" || key == "*" {
+		if param.exists {
+			param.values = param.variable.Values()
+		}
+
+		param.set, param.array, param.star = param.exists, true, key == "*"
+
+		return param, nil
+	}
+
+	if !param.variable.Attributes.Has(attributes.Associative) {
+		idx, err := e.arithmetic(key)
+		if err != nil {
+			return param, err
+		}
+
+		key = strconv.FormatInt(idx, 10)
+	}
+
+	param.name = name + "[" + key + "]"
+	param.key, param.hasKey = key, true
+
+	if value, ok := param.variable.Index(key); param.exists && ok {
+		param.values, param.set = []string{value}, true
+	}
+
+	return param, nil
+}
+
+// assign sets the value of a parameter for the '${name:=word}' expansion.
+func (e *Expander) assign(param parameter, value string) error {
+	name, _, _ := strings.Cut(param.name, "[")
+
+	if e.Env == nil || !astutil.IsName(name) || param.array {
+		return fmt.Errorf("$%s: %w", param.name, ErrCannotAssign)
+	}
+
+	v := param.variable
+
+	if !param.hasKey {
+		return e.Env.Set(name, v.Assign(value))
+	} else if !param.exists {
+		v = Indexed()
+	}
+
+	v, err := v.AssignIndex(param.key, value)
+	if err != nil {
+		return fmt.Errorf("%s[%s]: %w", name, param.key, err)
+	}
+
+	return e.Env.Set(name, v)
+}
+
+// operation applies the operation of an expansion to each of the values of
+// the parameter.
+func (e *Expander) operation(p *bash.ParameterExpansion, param *parameter) error {
+	switch p.Type {
+	case bash.ParameterSubstring:
+		return e.substring(p, param)
+	case bash.ParameterRemoveStartShortest, bash.ParameterRemoveStartLongest, bash.ParameterRemoveEndShortest, bash.ParameterRemoveEndLongest:
+		pat, err := e.braceWordPattern(p.BraceWord)
+		if err != nil {
+			return err
+		}
+
+		compiled := pattern.Compile(pat, e.patternOptions(false))
+
+		longest := p.Type == bash.ParameterRemoveStartLongest || p.Type == bash.ParameterRemoveEndLongest
+		start := p.Type == bash.ParameterRemoveStartShortest || p.Type == bash.ParameterRemoveStartLongest
+
+		param.each(func(s string) string {
+			if start {
+				if end := compiled.Prefix(s, longest); end >= 0 {
+					return s[end:]
+				}
+			} else if start := compiled.Suffix(s, longest); start >= 0 {
+				return s[:start]
+			}
+
+			return s
+		})
+	case bash.ParameterReplace, bash.ParameterReplaceAll, bash.ParameterReplaceStart, bash.ParameterReplaceEnd:
+		return e.replace(p, param)
+	case bash.ParameterUppercaseFirstMatch, bash.ParameterUppercaseAllMatches, bash.ParameterLowercaseFirstMatch, bash.ParameterLowercaseAllMatches:
+		pat := "?"
+
+		if p.Pattern != nil && p.Pattern.Data != "" {
+			b := newBuilder()
+
+			if err := e.raw(b, p.Pattern.Data, modePattern, false); err != nil {
+				return err
+			}
+
+			pat = b.pattern()
+		}
+
+		compiled := pattern.Compile(pat, e.patternOptions(false))
+
+		conv := unicode.ToUpper
+		if p.Type == bash.ParameterLowercaseFirstMatch || p.Type == bash.ParameterLowercaseAllMatches {
+			conv = unicode.ToLower
+		}
+
+		all := p.Type == bash.ParameterUppercaseAllMatches || p.Type == bash.ParameterLowercaseAllMatches
+
+		param.each(func(s string) string {
+			return convertCase(s, compiled, conv, all)
+		})
+	case bash.ParameterUppercase:
+		param.each(strings.ToUpper)
+	case bash.ParameterLowercase:
+		param.each(strings.ToLower)
+	case bash.ParameterUppercaseFirst:
+		param.each(func(s string) string {
+			return convertCase(s, anyChar, unicode.ToUpper, false)
+		})
+	case bash.ParameterQuoted:
+		param.each(Quote)
+	case bash.ParameterEscaped:
+		param.each(astutil.ANSIC)
+	case bash.ParameterPrompt:
+		param.each(e.prompt)
+	case bash.ParameterDeclare:
+		if param.set {
+			param.values, param.array = []string{declaration(param)}, false
+		}
+	case bash.ParameterAttributes:
+		attrs := strings.TrimPrefix(strings.TrimPrefix(param.variable.Attributes.String(), "-"), "-")
+
+		param.each(func(string) string { return attrs })
+	case bash.ParameterQuotedArrays, bash.ParameterQuotedArraysSeperate:
+		keyValues(p.Type == bash.ParameterQuotedArraysSeperate, param)
+	}
+
+	return nil
+}
+
+func (p *parameter) each(fn func(string) string) {
+	values := make([]string, len(p.values))
+
+	for n, value := range p.values {
+		values[n] = fn(value)
+	}
+
+	p.values = values
+}
+
+var anyChar = pattern.Compile("?", 0)
+
+func convertCase(s string, pat *pattern.Pattern, conv func(rune) rune, all bool) string {
+	if !all {
+		c, size := utf8.DecodeRuneInString(s)
+		if size == 0 || !pat.Match(string(c)) {
+			return s
+		}
+
+		return string(conv(c)) + s[size:]
+	}
+
+	var sb strings.Builder
+
+	for _, c := range s {
+		if pat.Match(string(c)) {
+			c = conv(c)
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+
+// substring performs the '${name:offset:length}' expansion.
+func (e *Expander) substring(p *bash.ParameterExpansion, param *parameter) error {
+	offset, err := e.wordArithmetic(p.SubstringStart)
+	if err != nil {
+		return err
+	}
+
+	length := int64(-1)
+	hasLength := p.SubstringEnd != nil
+
+	if hasLength {
+		if length, err = e.wordArithmetic(p.SubstringEnd); err != nil {
+			return err
+		}
+	}
+
+	if !param.array {
+		if !param.set {
+			return nil
+		}
+
+		runes := []rune(param.values[0])
+		start, end, err := bounds(int64(len(runes)), offset, length, hasLength)
+		if err != nil {
+			return fmt.Errorf("%d: %w", length, err)
+		}
+
+		param.values[0] = string(runes[start:end])
+
+		return nil
+	}
+
+	if hasLength && length < 0 {
+		return fmt.Errorf("%d: %w", length, ErrSubstringNegative)
+	}
+
+	values := param.values
+
+	if p.Parameter.Parameter.Data == "@" || p.Parameter.Parameter.Data == "*" {
+		zero, _ := e.get("0")
+		values = append([]string{zero.String()}, values...)
+	} else if param.variable.Attributes.Has(attributes.Indexed) {
+		indices := param.variable.indices()
+
+		if offset < 0 && len(indices) > 0 {
+			offset += int64(indices[len(indices)-1]) + 1
+		}
+
+		pos, _ := slices.BinarySearch(indices, int(max(offset, 0)))
+		if offset < 0 {
+			pos = len(indices)
+		}
+
+		offset = int64(pos)
+	}
+
+	if offset < 0 {
+		offset += int64(len(values))
+	}
+
+	if offset < 0 || offset > int64(len(values)) {
+		param.values = nil
+
+		return nil
+	}
+
+	end := int64(len(values))
+	if hasLength {
+		end = min(end, offset+length)
+	}
+
+	param.values = values[offset:end]
+
+	return nil
+}
+
+func bounds(size, offset, length int64, hasLength bool) (int64, int64, error) {
+	if offset < 0 {
+		offset += size
+	}
+
+	if offset < 0 || offset > size {
+		return 0, 0, nil
+	}
+
+	end := size
+
+	if hasLength {
+		if length < 0 {
+			end = size + length
+			if end < offset {
+				return 0, 0, ErrSubstringNegative
+			}
+		} else {
+			end = min(size, offset+length)
+		}
+	}
+
+	return offset, end, nil
+}
+
+func (e *Expander) wordArithmetic(w *bash.Word) (int64, error) {
+	if w == nil {
+		return 0, nil
+	}
+
+	s, err := e.Word(w)
+	if err != nil {
+		return 0, err
+	}
+
+	return e.arithmetic(s)
+}
+
+// replace performs the pattern substitution expansions.
+func (e *Expander) replace(p *bash.ParameterExpansion, param *parameter) error {
+	var pat string
+
+	if p.Pattern != nil {
+		b := newBuilder()
+
+		if err := e.raw(b, p.Pattern.Data, modePattern, false); err != nil {
+			return err
+		}
+
+		pat = b.pattern()
+	}
+
+	var replacement []fragment
+
+	if p.String != nil {
+		b := newBuilder()
+
+		for _, wt := range p.String.WordsOrTokens {
+			if wt.Word != nil {
+				if err := e.parts(b, wt.Word.Parts, modeWord, true); err != nil {
+					return err
+				}
+			} else if wt.Token != nil {
+				b.add(fragment{text: wt.Token.Data})
+			}
+		}
+
+		for _, field := range b.fields {
+			replacement = append(replacement, field...)
+		}
+	}
+
+	if pat == "" && (p.Type == bash.ParameterReplace || p.Type == bash.ParameterReplaceAll) {
+		return nil
+	}
+
+	compiled := pattern.Compile(pat, e.patternOptions(true))
+
+	param.each(func(s string) string {
+		var sb strings.Builder
+
+		switch p.Type {
+		case bash.ParameterReplaceStart:
+			end := compiled.Prefix(s, true)
+			if end < 0 {
+				return s
+			}
+
+			sb.WriteString(substitution(replacement, s[:end]))
+			sb.WriteString(s[end:])
+		case bash.ParameterReplaceEnd:
+			start := compiled.Suffix(s, true)
+			if start < 0 {
+				return s
+			}
+
+			sb.WriteString(s[:start])
+			sb.WriteString(substitution(replacement, s[start:]))
+		default:
+			for pos := 0; pos < len(s); {
+				if end := compiled.Prefix(s[pos:], true); end >= 0 {
+					sb.WriteString(substitution(replacement, s[pos:pos+end]))
+
+					if p.Type == bash.ParameterReplace {
+						sb.WriteString(s[pos+end:])
+
+						break
+					} else if pos += end; end > 0 {
+						continue
+					}
+				}
+
+				_, size := utf8.DecodeRuneInString(s[pos:])
+				sb.WriteString(s[pos : pos+size])
+				pos += size
+			}
+		}
+
+		return sb.String()
+	})
+
+	return nil
+}
+
+// substitution builds the replacement string for a matched section, with any
+// unquoted '&' being replaced by the match.
+func substitution(replacement []fragment, match string) string {
+	var sb strings.Builder
+
+	for _, f := range replacement {
+		if f.quoted {
+			sb.WriteString(f.text)
+		} else {
+			sb.WriteString(strings.ReplaceAll(f.text, "&", match))
+		}
+	}
+
+	return sb.String()
+}
+
+// keyValues performs the '${name@K}' and '${name@k}' expansions.
+func keyValues(separate bool, param *parameter) {
+	if !param.set {
+		return
+	}
+
+	if !param.variable.Attributes.IsArray() || !param.array && !separate {
+		param.each(Quote)
+
+		return
+	}
+
+	values := param.variable.Values()
+
+	if separate {
+		param.values = nil
+
+		for n, key := range param.keys {
+			param.values = append(param.values, key, values[n])
+		}
+
+		param.array = true
+
+		return
+	}
+
+	var sb strings.Builder
+
+	for n, key := range param.keys {
+		if n > 0 {
+			sb.WriteByte(' ')
+		}
+
+		sb.WriteString(key)
+		sb.WriteByte(' ')
+		sb.WriteString(doubleQuote(values[n]))
+	}
+
+	param.values, param.array = []string{sb.String()}, false
+}
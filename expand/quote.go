@@ -0,0 +1,219 @@
+package expand
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"vimagination.zapto.org/bash/attributes"
+)
+
+// Quote quotes a string in the manner of the '${name@Q}' expansion; in single
+// quotes, unless it contains non-printable characters, in which case ANSI-C
+// quoting is used.
+func Quote(s string) string {
+	for _, c := range s {
+		if !unicode.IsPrint(c) {
+			return ansiC(s)
+		}
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func ansiC(s string) string {
+	var sb strings.Builder
+
+	sb.WriteString("$'")
+
+	for _, c := range s {
+		switch c {
+		case '\a':
+			sb.WriteString(`\a`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case 0x1b:
+			sb.WriteString(`\E`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\v':
+			sb.WriteString(`\v`)
+		case '\\', '\'':
+			sb.WriteByte('\\')
+			sb.WriteRune(c)
+		default:
+			if unicode.IsPrint(c) {
+				sb.WriteRune(c)
+			} else if c < 0x100 {
+				fmt.Fprintf(&sb, "\\%03o", c)
+			} else {
+				fmt.Fprintf(&sb, "\\u%04x", c)
+			}
+		}
+	}
+
+	sb.WriteByte('\'')
+
+	return sb.String()
+}
+
+// doubleQuote quotes a string in double quotes, escaping the characters that
+// are special within them.
+func doubleQuote(s string) string {
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+
+	for _, c := range s {
+		if strings.ContainsRune("\"\\$`", c) {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(c)
+	}
+
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+// declaration returns the statement that would recreate a parameter, for the
+// '${name@A}' expansion.
+func declaration(param *parameter) string {
+	name, _, _ := strings.Cut(param.name, "[")
+	attrs := param.variable.Attributes
+
+	if param.hasKey || !attrs.IsArray() {
+		value := Quote(strings.Join(param.values, " "))
+
+		if param.hasKey {
+			return name + "[" + param.key + "]=" + value
+		} else if attrs == 0 {
+			return name + "=" + value
+		}
+
+		return "declare " + attrs.String() + " " + name + "=" + value
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("declare ")
+	sb.WriteString(attrs.String())
+	sb.WriteByte(' ')
+	sb.WriteString(name)
+	sb.WriteString("=(")
+
+	values := param.variable.Values()
+
+	for n, key := range param.keys {
+		if attrs.Has(attributes.Indexed) && n > 0 {
+			sb.WriteByte(' ')
+		}
+
+		sb.WriteByte('[')
+
+		if attrs.Has(attributes.Associative) && strings.ContainsAny(key, " \t\n\"'\\$`;&|<>()[]*?") {
+			sb.WriteString(doubleQuote(key))
+		} else {
+			sb.WriteString(key)
+		}
+
+		sb.WriteString("]=")
+		sb.WriteString(doubleQuote(values[n]))
+
+		if attrs.Has(attributes.Associative) {
+			sb.WriteByte(' ')
+		}
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// prompt expands the backslash escapes of a prompt string, for the
+// '${name@P}' expansion.
+func (e *Expander) prompt(s string) string {
+	var sb strings.Builder
+
+	value := func(name string) string {
+		v, _ := e.get(name)
+
+		return v.String()
+	}
+
+	for n := 0; n < len(s); n++ {
+		if s[n] != '\\' || n+1 == len(s) {
+			sb.WriteByte(s[n])
+
+			continue
+		}
+
+		n++
+
+		switch s[n] {
+		case 'u':
+			sb.WriteString(value("USER"))
+		case 'h':
+			host, _, _ := strings.Cut(value("HOSTNAME"), ".")
+			sb.WriteString(host)
+		case 'H':
+			sb.WriteString(value("HOSTNAME"))
+		case 'w', 'W':
+			dir := value("PWD")
+
+			if home := value("HOME"); home != "" && (dir == home || strings.HasPrefix(dir, home+"/")) {
+				dir = "~" + dir[len(home):]
+			}
+
+			if s[n] == 'W' && dir != "/" && dir != "~" {
+				dir = path.Base(dir)
+			}
+
+			sb.WriteString(dir)
+		case 's':
+			sb.WriteString(path.Base(value("0")))
+		case '$':
+			if value("EUID") == "0" {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('$')
+			}
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'a':
+			sb.WriteByte('\a')
+		case 'e':
+			sb.WriteByte(0x1b)
+		case '\\':
+			sb.WriteByte('\\')
+		case '[', ']':
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := n + 1
+
+			for end < len(s) && end < n+3 && s[end] >= '0' && s[end] <= '7' {
+				end++
+			}
+
+			c, _ := strconv.ParseUint(s[n:end], 8, 8)
+			sb.WriteByte(byte(c))
+
+			n = end - 1
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(s[n])
+		}
+	}
+
+	return sb.String()
+}
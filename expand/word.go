@@ -0,0 +1,491 @@
+package expand
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/parser"
+)
+
+// mode determines the context in which a word is expanded.
+type mode uint8
+
+const (
+	modeFields mode = iota
+	modeWord
+	modeAssignment
+	modePattern
+)
+
+// parts expands the parts of a word, adding the resulting fragments to the
+// builder.
+//
+// The quoted flag is set for parts within double quotes, and the nested flag
+// is set for the parts of the word of an expansion, such as the default value
+// of '${name:-default}', whose unquoted literal text is subject to word
+// splitting.
+func (e *Expander) parts(b *builder, parts []bash.WordPart, m mode, nested bool) error {
+	for n := 0; n < len(parts); n++ {
+		p := &parts[n]
+
+		if p.Part != nil && p.Part.Type == bash.TokenStringStart {
+			end := n + 1
+
+			for end < len(parts) && (parts[end].Part == nil || parts[end].Part.Type != bash.TokenStringEnd) {
+				end++
+			}
+
+			if err := e.doubleQuoted(b, parts[n:min(end+1, len(parts))], m); err != nil {
+				return err
+			}
+
+			n = end
+
+			continue
+		}
+
+		first := n == 0 && !nested && (len(parts) == 1 || p.Part != nil && strings.ContainsAny(p.Part.Data, "/:"))
+
+		if err := e.part(b, p, m, first, false, nested); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doubleQuoted expands a double-quoted string that contains expansions.
+//
+// As in bash, a string containing only expansions of arrays, such as "$@", that
+// have no elements expands to nothing, rather than to an empty field.
+func (e *Expander) doubleQuoted(b *builder, parts []bash.WordPart, m mode) error {
+	c := newBuilder()
+	empty := true
+
+	for n := range parts {
+		p := &parts[n]
+
+		if p.Part != nil && (p.Part.Type == bash.TokenStringStart || p.Part.Type == bash.TokenStringMid || p.Part.Type == bash.TokenStringEnd) {
+			text := astutil.Unquote(p.Part.Data, p.Part.Type)
+			empty = empty && text == ""
+
+			c.add(fragment{text: text, quoted: true})
+
+			continue
+		}
+
+		before := len(c.fields[len(c.fields)-1])
+
+		if err := e.part(c, p, m, false, true, false); err != nil {
+			return err
+		}
+
+		if len(c.fields) > 1 || len(c.fields[0]) > before || !isArrayExpansion(p) {
+			empty = false
+		}
+	}
+
+	if !empty {
+		b.merge(c)
+	}
+
+	return nil
+}
+
+func isArrayExpansion(p *bash.WordPart) bool {
+	if p.ParameterExpansion != nil {
+		return isAll(p.ParameterExpansion.Parameter) || p.ParameterExpansion.Type == bash.ParameterPrefixSeperate
+	} else if p.Part != nil && p.Part.Type == bash.TokenIdentifier {
+		name, rest := astutil.SplitParameter(p.Part.Data)
+
+		return name == "@" && rest == ""
+	}
+
+	return false
+}
+
+// part expands a single part of a word.
+func (e *Expander) part(b *builder, p *bash.WordPart, m mode, first, quoted, nested bool) error {
+	switch {
+	case p.ParameterExpansion != nil:
+		return e.parameterExpansion(b, p.ParameterExpansion, m, quoted)
+	case p.CommandSubstitution != nil:
+		out, err := e.substitute(p.CommandSubstitution)
+		if err != nil {
+			return err
+		}
+
+		b.add(fragment{text: out, quoted: quoted, split: !quoted})
+	case p.ArithmeticExpansion != nil:
+		n, err := e.arithmeticExpansion(p.ArithmeticExpansion)
+		if err != nil {
+			return err
+		}
+
+		b.add(fragment{text: strconv.FormatInt(n, 10), quoted: quoted, split: !quoted})
+	case p.BraceExpansion != nil:
+		e.literal(b, fmt.Sprintf("%s", p.BraceExpansion), m, false, false, nested)
+	case p.Part != nil:
+		return e.token(b, p.Part, m, first, quoted, nested)
+	}
+
+	return nil
+}
+
+func (e *Expander) token(b *builder, tk *bash.Token, m mode, first, quoted, nested bool) error {
+	switch tk.Type {
+	case bash.TokenString, bash.TokenStringStart, bash.TokenStringMid, bash.TokenStringEnd:
+		b.add(fragment{text: astutil.Unquote(tk.Data, tk.Type), quoted: true})
+	case bash.TokenIdentifier:
+		name, rest := astutil.SplitParameter(tk.Data)
+		if name == "" {
+			e.literal(b, tk.Data, m, first, quoted, nested)
+
+			return nil
+		}
+
+		if err := e.parameterExpansion(b, &bash.ParameterExpansion{Parameter: bash.Parameter{Parameter: &bash.Token{Token: parser.Token{Type: bash.TokenIdentifier, Data: name}}}}, m, quoted); err != nil {
+			return err
+		}
+
+		if rest != "" {
+			e.literal(b, rest, m, false, quoted, nested)
+		}
+	case bash.TokenPattern:
+		return e.raw(b, tk.Data, m, quoted)
+	default:
+		e.literal(b, tk.Data, m, first, quoted, nested)
+	}
+
+	return nil
+}
+
+// literal adds the literal text of a word, performing quote removal and tilde
+// expansion.
+func (e *Expander) literal(b *builder, text string, m mode, first, quoted, nested bool) {
+	if quoted {
+		b.add(fragment{text: unescapeDouble(text), quoted: true})
+
+		return
+	}
+
+	if first {
+		text = e.tilde(b, text, m)
+	}
+
+	var sb strings.Builder
+
+	flush := func() {
+		if sb.Len() > 0 {
+			b.add(fragment{text: sb.String(), split: nested})
+			sb.Reset()
+		}
+	}
+
+	for n := 0; n < len(text); n++ {
+		switch c := text[n]; c {
+		case '\\':
+			if n++; n == len(text) {
+				flush()
+				b.add(fragment{quoted: true})
+			} else if text[n] != '\n' {
+				flush()
+				b.add(fragment{text: text[n : n+1], quoted: true})
+			}
+		case ':':
+			sb.WriteByte(c)
+
+			if m == modeAssignment && strings.HasPrefix(text[n+1:], "~") {
+				flush()
+
+				rest := e.tilde(b, text[n+1:], m)
+				text = text[:n+1] + rest
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	flush()
+}
+
+// tilde performs tilde expansion on the start of the given text, adding the
+// expansion to the builder and returning the remaining text.
+//
+// The tilde-prefix is ended by a slash or, in an assignment, a colon; when the
+// prefix cannot be expanded it is left unchanged.
+func (e *Expander) tilde(b *builder, text string, m mode) string {
+	if !strings.HasPrefix(text, "~") {
+		return text
+	}
+
+	end := len(text)
+
+	if m == modeAssignment {
+		if pos := strings.IndexAny(text, "/:"); pos >= 0 {
+			end = pos
+		}
+	} else if pos := strings.IndexByte(text, '/'); pos >= 0 {
+		end = pos
+	}
+
+	prefix := text[1:end]
+
+	var (
+		dir string
+		ok  bool
+	)
+
+	switch prefix {
+	case "":
+		var v Variable
+
+		if v, ok = e.get("HOME"); ok {
+			dir = v.String()
+		} else if e.Home != nil {
+			dir, ok = e.Home("")
+		}
+	case "+", "-":
+		name := "PWD"
+		if prefix == "-" {
+			name = "OLDPWD"
+		}
+
+		var v Variable
+
+		v, ok = e.get(name)
+		dir = v.String()
+	default:
+		if e.Home != nil && !strings.ContainsAny(prefix, "\\'\"$`") {
+			dir, ok = e.Home(prefix)
+		}
+	}
+
+	if !ok {
+		return text
+	}
+
+	b.add(fragment{text: dir, quoted: true})
+
+	return text[end:]
+}
+
+func unescapeDouble(text string) string {
+	return astutil.Unquote(text, bash.TokenStringMid)
+}
+
+func (e *Expander) substitute(cs *bash.CommandSubstitution) (string, error) {
+	if e.Substitute == nil {
+		return "", ErrNoSubstitution
+	}
+
+	out, err := e.Substitute(cs)
+	if err != nil {
+		return "", err
+	}
+
+	if cs.SubstitutionType == bash.SubstitutionNew || cs.SubstitutionType == bash.SubstitutionBacktick {
+		out = strings.TrimRight(out, "\n")
+	}
+
+	return out, nil
+}
+
+// arithmeticExpansion expands the words of an arithmetic expression, as if
+// they were double-quoted, and evaluates the result.
+func (e *Expander) arithmeticExpansion(a *bash.ArithmeticExpansion) (int64, error) {
+	expr, err := astutil.ArithmeticText(a, func(w *bash.Word) (string, error) {
+		c := newBuilder()
+
+		for _, p := range w.Parts {
+			if err := e.part(c, &p, modeWord, false, true, false); err != nil {
+				return "", err
+			}
+		}
+
+		return c.join(), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return e.arithmetic(expr)
+}
+
+// raw expands the raw text of a pattern token, which has not been split into
+// the parts of a word by the parser.
+func (e *Expander) raw(b *builder, text string, m mode, quoted bool) error {
+	var lit strings.Builder
+
+	flush := func() {
+		if lit.Len() > 0 {
+			b.add(fragment{text: lit.String(), quoted: quoted, split: !quoted && m == modeFields})
+			lit.Reset()
+		}
+	}
+
+	for n := 0; n < len(text); n++ {
+		c := text[n]
+
+		switch {
+		case c == '\\' && n+1 < len(text):
+			n++
+
+			if quoted && !strings.ContainsRune("$`\"\\\n", rune(text[n])) {
+				lit.WriteByte('\\')
+				lit.WriteByte(text[n])
+			} else if text[n] != '\n' {
+				flush()
+				b.add(fragment{text: text[n : n+1], quoted: true})
+			}
+		case c == '\'' && !quoted:
+			end := strings.IndexByte(text[n+1:], '\'')
+			if end < 0 {
+				end = len(text) - n - 1
+			}
+
+			flush()
+			b.add(fragment{text: text[n+1 : n+1+end], quoted: true})
+
+			n += end + 1
+		case c == '"':
+			flush()
+
+			if !quoted {
+				b.add(fragment{quoted: true})
+			}
+
+			quoted = !quoted
+		case c == '$' && !quoted && strings.HasPrefix(text[n:], "$'"):
+			end := n + 2
+
+			for end < len(text) && text[end] != '\'' {
+				if text[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			flush()
+			b.add(fragment{text: astutil.ANSIC(text[n+2 : min(end, len(text))]), quoted: true})
+
+			n = end
+		case c == '$' || c == '`':
+			end := expansionEnd(text, n)
+			if end == n+1 && c == '$' {
+				lit.WriteByte(c)
+
+				continue
+			}
+
+			flush()
+
+			if err := e.rawExpansion(b, text[n:end], m, quoted); err != nil {
+				return err
+			}
+
+			n = end - 1
+		default:
+			lit.WriteByte(c)
+		}
+	}
+
+	flush()
+
+	return nil
+}
+
+// expansionEnd returns the position after the expansion starting at the given
+// position of the text.
+func expansionEnd(text string, pos int) int {
+	if text[pos] == '`' {
+		for n := pos + 1; n < len(text); n++ {
+			if text[n] == '\\' {
+				n++
+			} else if text[n] == '`' {
+				return n + 1
+			}
+		}
+
+		return len(text)
+	}
+
+	if pos+1 >= len(text) {
+		return pos + 1
+	}
+
+	switch c := text[pos+1]; {
+	case c == '{' || c == '(':
+		close := byte('}')
+		if c == '(' {
+			close = ')'
+		}
+
+		depth := 0
+
+		for n := pos + 1; n < len(text); n++ {
+			switch text[n] {
+			case '\\':
+				n++
+			case '\'':
+				if close == '}' {
+					if end := strings.IndexByte(text[n+1:], '\''); end >= 0 {
+						n += end + 1
+					}
+				}
+			case c:
+				depth++
+			case close:
+				if depth--; depth == 0 {
+					return n + 1
+				}
+			}
+		}
+
+		return len(text)
+	case c >= '0' && c <= '9', strings.IndexByte("!?@*#$-", c) >= 0:
+		return pos + 2
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		n := pos + 2
+
+		for n < len(text) && (text[n] == '_' || text[n] >= 'a' && text[n] <= 'z' || text[n] >= 'A' && text[n] <= 'Z' || text[n] >= '0' && text[n] <= '9') {
+			n++
+		}
+
+		return n
+	}
+
+	return pos + 1
+}
+
+// rawExpansion parses and expands a single expansion from the raw text of a
+// pattern.
+func (e *Expander) rawExpansion(b *builder, text string, m mode, quoted bool) error {
+	tk := parser.NewStringTokeniser(text)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		return err
+	}
+
+	if len(f.Lines) != 1 || len(f.Lines[0].Statements) != 1 {
+		return ErrBadSubstitution
+	}
+
+	c := f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command
+	if c == nil || len(c.AssignmentsOrWords) != 1 || c.AssignmentsOrWords[0].Word == nil {
+		return ErrBadSubstitution
+	}
+
+	for _, p := range c.AssignmentsOrWords[0].Word.Parts {
+		if err := e.part(b, &p, m, false, quoted, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package astutil
+
+import (
+	"strings"
+
+	"vimagination.zapto.org/bash"
+)
+
+// ArithmeticText returns the text of an arithmetic expression, with each of
+// its words replaced by the string returned by fn.
+//
+// The source between the words and operators is kept, up to any closing '))',
+// so that the text matches that which bash evaluates, and quotes in its
+// errors. When the tokens of the expression are unavailable, the words and
+// operators are separated by a single space.
+func ArithmeticText(a *bash.ArithmeticExpansion, fn func(*bash.Word) (string, error)) (string, error) {
+	var (
+		sb   strings.Builder
+		next int
+		end  uint64
+	)
+
+	add := func(wo bash.WordOrOperator) error {
+		if wo.Operator != nil {
+			sb.WriteString(wo.Operator.Data)
+		} else if wo.Word != nil {
+			s, err := fn(wo.Word)
+			if err != nil {
+				return err
+			}
+
+			sb.WriteString(s)
+		}
+
+		return nil
+	}
+
+	for n, tk := range a.Tokens {
+		if n == 0 && (tk.Data == "$((" || tk.Data == "((") || n == len(a.Tokens)-1 && tk.Data == "))" || tk.Pos < end {
+			continue
+		}
+
+		if next == len(a.WordsAndOperators) || len(a.WordsAndOperators[next].Tokens) == 0 || tk.Pos != a.WordsAndOperators[next].Tokens[0].Pos {
+			sb.WriteString(tk.Data)
+
+			continue
+		}
+
+		end = End(a.WordsAndOperators[next].Tokens).Pos
+
+		if err := add(a.WordsAndOperators[next]); err != nil {
+			return "", err
+		}
+
+		next++
+	}
+
+	for _, wo := range a.WordsAndOperators[next:] {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+
+		if err := add(wo); err != nil {
+			return "", err
+		}
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,57 @@
+package astutil
+
+import (
+	"fmt"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/parser"
+)
+
+func TestArithmeticText(t *testing.T) {
+	for n, test := range [...]struct {
+		Input, Output string
+	}{
+		{ // 1
+			"$(( 1 + 2 ))",
+			" 1 + 2 ",
+		},
+		{ // 2
+			"$((a*\t$b  ))",
+			"a*\t<$b>  ",
+		},
+		{ // 3
+			"$(( x[1] += ${y:-2}))",
+			" x[1] += <${y:-2}>",
+		},
+	} {
+		tk := parser.NewStringTokeniser("echo " + test.Input)
+
+		f, err := bash.Parse(&tk)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error parsing script: %s", n+1, err)
+		}
+
+		var a *bash.ArithmeticExpansion
+
+		Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+			if e, ok := t.(*bash.ArithmeticExpansion); ok && a == nil {
+				a = e
+			}
+
+			return a == nil
+		})
+
+		if output, err := ArithmeticText(a, func(w *bash.Word) (string, error) {
+			if s, ok := Literal(w); ok {
+				return s, nil
+			}
+
+			return fmt.Sprintf("<%s>", w), nil
+		}); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if output != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+// Package astutil contains helpers shared by the bash analysis packages.
+package astutil
+
+import (
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/walk"
+	"vimagination.zapto.org/parser"
+)
+
+// Inspect calls fn, in depth-first order, for the given type and each of its
+// descendants, passing the chain of ancestors of each type.
+//
+// If fn returns false, the children of that type are not visited.
+func Inspect(t bash.Type, fn func(t bash.Type, parents []bash.Type) bool) {
+	var (
+		parents []bash.Type
+		handler walk.Handler
+	)
+
+	handler = walk.HandlerFunc(func(t bash.Type) error {
+		if !fn(t, parents) {
+			return nil
+		}
+
+		parents = append(parents, t)
+		err := walk.Walk(t, handler)
+		parents = parents[:len(parents)-1]
+
+		return err
+	})
+
+	handler.Handle(t)
+}
+
+// CommandName returns the literal name of the command being called, or an
+// empty string if the Command has no words or the name is not a literal.
+func CommandName(c *bash.Command) string {
+	if c == nil || len(c.AssignmentsOrWords) == 0 || c.AssignmentsOrWords[0].Word == nil {
+		return ""
+	}
+
+	name, _ := Literal(c.AssignmentsOrWords[0].Word)
+
+	return name
+}
+
+// Args returns the words of a command following the command name.
+//
+// Assignments given as arguments, such as those to the 'declare' builtin, are
+// not included.
+func Args(c *bash.Command) []*bash.Word {
+	var words []*bash.Word
+
+	for n := 1; n < len(c.AssignmentsOrWords); n++ {
+		if w := c.AssignmentsOrWords[n].Word; w != nil {
+			words = append(words, w)
+		}
+	}
+
+	return words
+}
+
+// Literal returns the value of the Word after quote removal, and whether the
+// Word is made up entirely of literal parts.
+//
+// When the Word contains expansions, the returned string contains only the
+// literal parts that preceded the first expansion.
+func Literal(w *bash.Word) (string, bool) {
+	if w == nil {
+		return "", false
+	}
+
+	var sb strings.Builder
+
+	for _, p := range w.Parts {
+		if p.Part == nil {
+			return sb.String(), false
+		}
+
+		switch p.Part.Type {
+		case bash.TokenIdentifier:
+			return sb.String(), false
+		default:
+			sb.WriteString(Unquote(p.Part.Data, p.Part.Type))
+		}
+	}
+
+	return sb.String(), true
+}
+
+// IsQuoted returns true when the Word part is within, or is, a quoted string.
+func IsQuoted(w *bash.Word, part int) bool {
+	inString := false
+
+	for n, p := range w.Parts {
+		if p.Part != nil {
+			switch p.Part.Type {
+			case bash.TokenString:
+				if n == part {
+					return true
+				}
+			case bash.TokenStringStart:
+				inString = true
+			case bash.TokenStringEnd:
+				if n == part {
+					return true
+				}
+
+				inString = false
+			}
+		}
+
+		if n == part {
+			return inString
+		}
+	}
+
+	return false
+}
+
+// Unquote removes the quoting from the data of a single token.
+func Unquote(data string, typ parser.TokenType) string {
+	switch typ {
+	case bash.TokenString:
+		if strings.HasPrefix(data, "'") {
+			return strings.TrimSuffix(data[1:], "'")
+		} else if strings.HasPrefix(data, "$'") {
+			return ANSIC(strings.TrimSuffix(data[2:], "'"))
+		} else if strings.HasPrefix(data, "$\"") {
+			return unescapeDouble(strings.TrimSuffix(data[2:], "\""))
+		}
+
+		return unescapeDouble(strings.TrimSuffix(strings.TrimPrefix(data, "\""), "\""))
+	case bash.TokenStringStart:
+		return unescapeDouble(strings.TrimPrefix(strings.TrimPrefix(data, "$"), "\""))
+	case bash.TokenStringMid:
+		return unescapeDouble(data)
+	case bash.TokenStringEnd:
+		return unescapeDouble(strings.TrimSuffix(data, "\""))
+	case bash.TokenHeredoc:
+		return data
+	}
+
+	return unescape(data)
+}
+
+func unescape(data string) string {
+	if !strings.Contains(data, "\\") {
+		return data
+	}
+
+	var sb strings.Builder
+
+	escaped := false
+
+	for _, c := range data {
+		if escaped {
+			escaped = false
+
+			if c == '\n' {
+				continue
+			}
+		} else if c == '\\' {
+			escaped = true
+
+			continue
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+
+func unescapeDouble(data string) string {
+	if !strings.Contains(data, "\\") {
+		return data
+	}
+
+	var sb strings.Builder
+
+	escaped := false
+
+	for _, c := range data {
+		if escaped {
+			escaped = false
+
+			switch c {
+			case '\n':
+				continue
+			case '$', '`', '"', '\\':
+			default:
+				sb.WriteByte('\\')
+			}
+		} else if c == '\\' {
+			escaped = true
+
+			continue
+		}
+
+		sb.WriteRune(c)
+	}
+
+	if escaped {
+		sb.WriteByte('\\')
+	}
+
+	return sb.String()
+}
+
+// ANSIC decodes the backslash escapes of the body of a $'...' string.
+func ANSIC(data string) string {
+	var sb strings.Builder
+
+	for len(data) > 0 {
+		c := data[0]
+		data = data[1:]
+
+		if c != '\\' || len(data) == 0 {
+			sb.WriteByte(c)
+
+			continue
+		}
+
+		c = data[0]
+		data = data[1:]
+
+		switch c {
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'e', 'E':
+			sb.WriteByte(0x1b)
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			sb.WriteByte(c)
+		case 'c':
+			if len(data) > 0 {
+				sb.WriteByte(data[0] & 0x1f)
+
+				data = data[1:]
+			}
+		case 'x', 'u', 'U':
+			max := 2
+
+			if c == 'u' {
+				max = 4
+			} else if c == 'U' {
+				max = 8
+			}
+
+			l := 0
+
+			for l < max && l < len(data) && strings.IndexByte("0123456789abcdefABCDEF", data[l]) >= 0 {
+				l++
+			}
+
+			if l == 0 {
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+
+				continue
+			}
+
+			n, _ := strconv.ParseUint(data[:l], 16, 32)
+			data = data[l:]
+
+			if c == 'x' {
+				sb.WriteByte(byte(n))
+			} else {
+				sb.WriteRune(rune(n))
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			l := 0
+
+			for l < 2 && l < len(data) && data[l] >= '0' && data[l] <= '7' {
+				l++
+			}
+
+			n, _ := strconv.ParseUint(string(c)+data[:l], 8, 16)
+			data = data[l:]
+
+			sb.WriteByte(byte(n))
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
+// End returns the position just after the last of the given tokens.
+func End(tks bash.Tokens) bash.Token {
+	if len(tks) == 0 {
+		return bash.Token{}
+	}
+
+	last := tks[len(tks)-1]
+	end := bash.Token{Pos: last.Pos + uint64(len(last.Data)), Line: last.Line, LinePos: last.LinePos}
+
+	for _, c := range last.Data {
+		if c == '\n' {
+			end.Line++
+			end.LinePos = 0
+		} else {
+			end.LinePos++
+		}
+	}
+
+	return end
+}
+
+// SplitParameter splits the data of a TokenIdentifier, such as '$name/path',
+// into the parameter name and any literal text that follows it.
+func SplitParameter(data string) (string, string) {
+	s := strings.TrimPrefix(data, "$")
+
+	if s == "" {
+		return "", data
+	}
+
+	switch c := s[0]; {
+	case c >= '0' && c <= '9', strings.IndexByte("!?@*#$-", c) >= 0:
+		return s[:1], s[1:]
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		n := 1
+
+		for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || s[n] >= '0' && s[n] <= '9') {
+			n++
+		}
+
+		return s[:n], s[n:]
+	}
+
+	return "", data
+}
+
+// Segment represents either a literal section of a Word, after quote removal,
+// or a single expansion.
+//
+// For an expansion, Part is set to the WordPart containing it and, for a simple
+// '$name' expansion, Parameter is set to the name. Literal segments have
+// neither set.
+type Segment struct {
+	Literal   string
+	Parameter string
+	Part      *bash.WordPart
+	Quoted    bool
+}
+
+// IsLiteral returns true if the Segment contains no expansion.
+func (s Segment) IsLiteral() bool {
+	return s.Part == nil
+}
+
+// Segments splits a word into its literal and expanded sections, with adjacent
+// literal sections of the same quoting combined.
+func Segments(w *bash.Word) []Segment {
+	var (
+		segments []Segment
+		inString bool
+	)
+
+	addLiteral := func(lit string, quoted bool) {
+		if lit == "" {
+			return
+		}
+
+		if l := len(segments) - 1; l >= 0 && segments[l].IsLiteral() && segments[l].Quoted == quoted {
+			segments[l].Literal += lit
+		} else {
+			segments = append(segments, Segment{Literal: lit, Quoted: quoted})
+		}
+	}
+
+	for n := range w.Parts {
+		p := &w.Parts[n]
+
+		if p.Part == nil {
+			segments = append(segments, Segment{Part: p, Quoted: inString})
+
+			continue
+		}
+
+		switch p.Part.Type {
+		case bash.TokenIdentifier:
+			name, rest := SplitParameter(p.Part.Data)
+
+			if name == "" {
+				addLiteral(rest, inString)
+			} else {
+				segments = append(segments, Segment{Parameter: name, Part: p, Quoted: inString})
+
+				if inString {
+					addLiteral(unescapeDouble(rest), true)
+				} else {
+					addLiteral(unescape(rest), false)
+				}
+			}
+		case bash.TokenString:
+			addLiteral(Unquote(p.Part.Data, p.Part.Type), true)
+		case bash.TokenStringStart:
+			inString = true
+
+			addLiteral(Unquote(p.Part.Data, p.Part.Type), true)
+		case bash.TokenStringMid:
+			addLiteral(Unquote(p.Part.Data, p.Part.Type), true)
+		case bash.TokenStringEnd:
+			inString = false
+
+			addLiteral(Unquote(p.Part.Data, p.Part.Type), true)
+		default:
+			addLiteral(Unquote(p.Part.Data, p.Part.Type), inString)
+		}
+	}
+
+	return segments
+}
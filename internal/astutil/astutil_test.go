@@ -0,0 +1,66 @@
+package astutil
+
+import (
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/parser"
+)
+
+func TestLiteral(t *testing.T) {
+	for n, test := range [...]struct {
+		Input   string
+		Output  string
+		Literal bool
+	}{
+		{ // 1
+			"abc",
+			"abc",
+			true,
+		},
+		{ // 2
+			"a\\ b'c d'\"e\\$f\"",
+			"a bc de$f",
+			true,
+		},
+		{ // 3
+			"$'a\\tb\\x41\\101\\u00e9'",
+			"a\tbAAé",
+			true,
+		},
+		{ // 4
+			"ab$c",
+			"ab",
+			false,
+		},
+		{ // 5
+			"\"a${b}c\"",
+			"a",
+			false,
+		},
+		{ // 6
+			"\"a\\nb\"",
+			"a\\nb",
+			true,
+		},
+	} {
+		tk := parser.NewStringTokeniser("echo " + test.Input)
+
+		f, err := bash.Parse(&tk)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+
+			continue
+		}
+
+		c := f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command
+
+		if CommandName(c) != "echo" {
+			t.Errorf("test %d: expecting command name %q, got %q", n+1, "echo", CommandName(c))
+		} else if out, literal := Literal(Args(c)[0]); out != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, out)
+		} else if literal != test.Literal {
+			t.Errorf("test %d: expecting literal %v, got %v", n+1, test.Literal, literal)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package astutil
+
+import (
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+)
+
+type wrapper struct {
+	argOptions     string
+	longArgOptions []string
+	noRun          string
+	assignments    bool
+	positional     int
+}
+
+var wrappers = map[string]wrapper{
+	"sudo": {
+		argOptions:     "ugCDhprtUT",
+		longArgOptions: []string{"--user", "--group", "--close-from", "--chdir", "--host", "--prompt", "--role", "--type", "--other-user", "--command-timeout"},
+		noRun:          "lvkKV",
+		assignments:    true,
+	},
+	"doas":    {argOptions: "uC"},
+	"env":     {argOptions: "uCS", longArgOptions: []string{"--unset", "--chdir", "--split-string"}, assignments: true},
+	"exec":    {argOptions: "a"},
+	"command": {noRun: "vV"},
+	"time":    {argOptions: "fo", longArgOptions: []string{"--format", "--output"}},
+	"nohup":   {},
+	"nice":    {argOptions: "n", longArgOptions: []string{"--adjustment"}},
+	"timeout": {argOptions: "sk", longArgOptions: []string{"--signal", "--kill-after"}, positional: 1},
+	"xargs":   {argOptions: "ILnPdEsa", longArgOptions: []string{"--max-lines", "--max-args", "--max-procs", "--delimiter", "--max-chars", "--arg-file"}},
+	"stdbuf":  {argOptions: "ioe"},
+	"setsid":  {},
+	"chroot":  {positional: 1},
+	"ionice":  {argOptions: "cnp"},
+}
+
+// IsWrapper returns true if the named command is one that runs another
+// command given as its arguments, such as 'sudo' or 'xargs'.
+func IsWrapper(name string) bool {
+	_, ok := wrappers[name]
+
+	return ok
+}
+
+// Unwrap determines the command that will be run by a list of command words,
+// skipping over any wrapper commands, such as 'sudo', 'env', and 'exec', and
+// their options.
+//
+// Returns the name of the command that will be run, or an empty string if
+// it cannot be statically determined, the words of that command, starting
+// with its name, and the names of the wrappers skipped.
+//
+// For a wrapper that doesn't run a command, such as 'command -v', the wrapper
+// itself is returned as the command.
+func Unwrap(words []*bash.Word) (string, []*bash.Word, []string) {
+	var wrapped []string
+
+	for len(words) > 0 {
+		name, ok := Literal(words[0])
+		if !ok {
+			return "", words, wrapped
+		}
+
+		w, isWrapper := wrappers[name]
+		if !isWrapper {
+			return name, words, wrapped
+		}
+
+		rest, runs := w.skip(words[1:])
+		if !runs || len(rest) == 0 {
+			return name, words, wrapped
+		}
+
+		wrapped = append(wrapped, name)
+		words = rest
+	}
+
+	return "", nil, wrapped
+}
+
+// Words returns all of the words of a command, including its name, skipping
+// any assignments.
+func Words(c *bash.Command) []*bash.Word {
+	var words []*bash.Word
+
+	for _, aw := range c.AssignmentsOrWords {
+		if aw.Word != nil {
+			words = append(words, aw.Word)
+		}
+	}
+
+	return words
+}
+
+func (w wrapper) skip(words []*bash.Word) ([]*bash.Word, bool) {
+	positional := w.positional
+
+	for len(words) > 0 {
+		arg, ok := Literal(words[0])
+		if !ok {
+			break
+		}
+
+		if arg == "--" {
+			words = words[1:]
+
+			break
+		} else if strings.HasPrefix(arg, "--") {
+			words = words[1:]
+
+			if !strings.Contains(arg, "=") && slices.Contains(w.longArgOptions, arg) && len(words) > 0 {
+				words = words[1:]
+			}
+		} else if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			words = words[1:]
+
+			for n, c := range arg[1:] {
+				if strings.ContainsRune(w.noRun, c) {
+					return words, false
+				} else if strings.ContainsRune(w.argOptions, c) {
+					if n+2 == len(arg) && len(words) > 0 {
+						words = words[1:]
+					}
+
+					break
+				}
+			}
+		} else if w.assignments && isAssignment(arg) {
+			words = words[1:]
+		} else if positional > 0 {
+			positional--
+			words = words[1:]
+		} else {
+			break
+		}
+	}
+
+	for ; positional > 0 && len(words) > 0; positional-- {
+		words = words[1:]
+	}
+
+	return words, true
+}
+
+func isAssignment(arg string) bool {
+	name, _, ok := strings.Cut(arg, "=")
+
+	return ok && IsName(name)
+}
+
+// IsName returns true if the given string is a valid variable name.
+func IsName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for n, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (n == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,92 @@
+package astutil
+
+import (
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/parser"
+)
+
+func TestUnwrap(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    string
+		Name     string
+		Args     int
+		Wrappers []string
+	}{
+		{ // 1
+			"ls -l",
+			"ls",
+			1,
+			nil,
+		},
+		{ // 2
+			"sudo -u root -E rm -rf dir",
+			"rm",
+			2,
+			[]string{"sudo"},
+		},
+		{ // 3
+			"env -i A=1 B=2 nice -n 5 make all",
+			"make",
+			1,
+			[]string{"env", "nice"},
+		},
+		{ // 4
+			"command -v git",
+			"command",
+			2,
+			nil,
+		},
+		{ // 5
+			"timeout -s KILL 10s curl url",
+			"curl",
+			1,
+			[]string{"timeout"},
+		},
+		{ // 6
+			"sudo \"$cmd\" arg",
+			"",
+			1,
+			[]string{"sudo"},
+		},
+		{ // 7
+			"xargs -I{} -- cp {} dir",
+			"cp",
+			2,
+			[]string{"xargs"},
+		},
+		{ // 8
+			"exec -a name bash -l",
+			"bash",
+			1,
+			[]string{"exec"},
+		},
+		{ // 9
+			"nohup",
+			"nohup",
+			0,
+			nil,
+		},
+	} {
+		tk := parser.NewStringTokeniser(test.Input)
+
+		f, err := bash.Parse(&tk)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+
+			continue
+		}
+
+		name, words, wrappers := Unwrap(Words(f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command))
+
+		if name != test.Name {
+			t.Errorf("test %d: expecting name %q, got %q", n+1, test.Name, name)
+		} else if len(words)-1 != test.Args {
+			t.Errorf("test %d: expecting %d args, got %d", n+1, test.Args, len(words)-1)
+		} else if !reflect.DeepEqual(wrappers, test.Wrappers) {
+			t.Errorf("test %d: expecting wrappers %q, got %q", n+1, test.Wrappers, wrappers)
+		}
+	}
+}
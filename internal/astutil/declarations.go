@@ -0,0 +1,175 @@
+package astutil
+
+import (
+	"strings"
+
+	"vimagination.zapto.org/bash"
+)
+
+// Declaration represents a variable named by a declaration builtin, such as
+// 'declare' or 'readonly'.
+//
+// Flags contains all of the option letters given to the builtin, with those
+// implied by the builtin, such as 'r' for 'readonly', included. Assignment is
+// set when the variable is also assigned a value.
+type Declaration struct {
+	Name       string
+	Flags      string
+	Token      *bash.Token
+	Assignment *bash.Assignment
+	Tokens     bash.Tokens
+}
+
+var declarationFlags = map[string]string{
+	"declare":  "",
+	"typeset":  "",
+	"local":    "",
+	"export":   "x",
+	"readonly": "r",
+}
+
+// IsDeclaration returns true if the named command is a declaration builtin.
+func IsDeclaration(name string) bool {
+	_, ok := declarationFlags[name]
+
+	return ok
+}
+
+// Declarations returns the variables named by a declaration builtin, along
+// with the attribute flags set on them.
+func Declarations(c *bash.Command) []Declaration {
+	flags, ok := declarationFlags[CommandName(c)]
+	if !ok {
+		return nil
+	}
+
+	var decls []Declaration
+
+	for _, aw := range c.AssignmentsOrWords[1:] {
+		if a := aw.Assignment; a != nil {
+			if a.Identifier.Identifier != nil {
+				decls = append(decls, Declaration{Name: a.Identifier.Identifier.Data, Token: a.Identifier.Identifier, Assignment: a, Tokens: a.Tokens})
+			}
+		} else if arg, ok := Literal(aw.Word); !ok {
+			continue
+		} else if strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+") {
+			if arg[0] == '-' {
+				flags += arg[1:]
+			}
+		} else if IsName(arg) {
+			decls = append(decls, Declaration{Name: arg, Token: aw.Word.Parts[0].Part, Tokens: aw.Tokens})
+		}
+	}
+
+	for n := range decls {
+		decls[n].Flags = flags
+	}
+
+	return decls
+}
+
+// Name is a variable name given as an argument to a builtin, along with the
+// Word containing it.
+type Name struct {
+	Name string
+	Word *bash.Word
+}
+
+// ReadNames returns the names of the variables set by the 'read' builtin,
+// given its arguments, and whether they are set as an array with the '-a'
+// option.
+//
+// When no names are given, 'read' sets REPLY, which is returned with a nil
+// Word.
+func ReadNames(args []*bash.Word) ([]Name, bool) {
+	n := 0
+
+Loop:
+	for ; n < len(args); n++ {
+		arg, _ := Literal(args[n])
+
+		if arg == "--" {
+			n++
+
+			break
+		} else if len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+
+		for m, c := range arg[1:] {
+			if !strings.ContainsRune("adinNptu", c) {
+				continue
+			}
+
+			value, word := arg[m+2:], args[n]
+
+			if value == "" && n+1 < len(args) {
+				n++
+				word = args[n]
+				value, _ = Literal(word)
+			}
+
+			if c == 'a' {
+				return []Name{{Name: value, Word: word}}, true
+			}
+
+			continue Loop
+		}
+	}
+
+	var names []Name
+
+	for _, w := range args[n:] {
+		if name, ok := Literal(w); ok && IsName(name) {
+			names = append(names, Name{Name: name, Word: w})
+		}
+	}
+
+	if len(names) == 0 {
+		names = append(names, Name{Name: "REPLY"})
+	}
+
+	return names, false
+}
+
+// AssignedNames returns the names of the variables set by commands that assign
+// to variables named in their arguments, other than the declaration builtins.
+//
+// The commands understood are 'read', 'mapfile', 'readarray', 'printf -v',
+// and 'getopts'. The returned bool is true if the variables are arrays.
+func AssignedNames(c *bash.Command) ([]Name, bool) {
+	args := Args(c)
+
+	switch CommandName(c) {
+	case "read":
+		return ReadNames(args)
+	case "mapfile", "readarray":
+		if len(args) > 0 {
+			if name, ok := Literal(args[len(args)-1]); ok && IsName(name) {
+				return []Name{{Name: name, Word: args[len(args)-1]}}, true
+			}
+		}
+
+		return []Name{{Name: "MAPFILE"}}, true
+	case "printf":
+		if len(args) > 1 {
+			if opt, _ := Literal(args[0]); opt == "-v" {
+				if name, ok := Literal(args[1]); ok {
+					name, _, _ = strings.Cut(name, "[")
+
+					if IsName(name) {
+						return []Name{{Name: name, Word: args[1]}}, false
+					}
+				}
+			}
+		}
+	case "getopts":
+		if len(args) > 1 {
+			if name, ok := Literal(args[1]); ok && IsName(name) {
+				return []Name{{Name: name, Word: args[1]}, {Name: "OPTARG"}, {Name: "OPTIND"}}, false
+			}
+		}
+	}
+
+	return nil, false
+}
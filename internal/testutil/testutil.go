@@ -0,0 +1,24 @@
+// Package testutil contains helpers shared by the tests of the bash analysis
+// packages.
+package testutil
+
+import (
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/parser"
+)
+
+// Parse parses a script for a test, failing the test if it cannot be parsed.
+func Parse(tb testing.TB, src string) *bash.File {
+	tb.Helper()
+
+	tk := parser.NewStringTokeniser(src)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		tb.Fatalf("unexpected error parsing script: %s", err)
+	}
+
+	return f
+}
@@ -0,0 +1,654 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+// builtin is a command implemented by the shell, which is given its arguments,
+// including its name, and returns its exit status.
+//
+// The error returned is either one that controls the flow of the script, such
+// as from 'break', or a Context error.
+type builtin func(ctx context.Context, r *Runner, args []string) (int, error)
+
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		":":         builtinTrue,
+		"true":      builtinTrue,
+		"false":     builtinFalse,
+		"break":     builtinBreak,
+		"continue":  builtinContinue,
+		"return":    builtinReturn,
+		"exit":      builtinExit,
+		"shift":     builtinShift,
+		"eval":      builtinEval,
+		"source":    builtinSource,
+		".":         builtinSource,
+		"test":      builtinTest,
+		"[":         builtinTest,
+		"cd":        builtinCd,
+		"pwd":       builtinPwd,
+		"wait":      builtinWait,
+		"exec":      builtinExec,
+		"type":      builtinType,
+		"command":   builtinCommand,
+		"declare":   builtinDeclare,
+		"typeset":   builtinDeclare,
+		"local":     builtinDeclare,
+		"export":    builtinDeclare,
+		"readonly":  builtinDeclare,
+		"unset":     builtinUnset,
+		"let":       builtinLet,
+		"echo":      builtinEcho,
+		"printf":    builtinPrintf,
+		"read":      builtinRead,
+		"mapfile":   builtinMapfile,
+		"readarray": builtinMapfile,
+		"set":       builtinSet,
+		"shopt":     builtinShopt,
+		"getopts":   builtinGetopts,
+		"trap":      builtinTrap,
+	}
+}
+
+// usages are the synopses of the builtins, as reported after an invalid
+// option.
+var usages = map[string]string{
+	"declare":   "declare [-aAfFgiIlnrtux] [name[=value] ...] or declare -p [-aAfFilnrtux] [name ...]",
+	"typeset":   "typeset [-aAfFgiIlnrtux] name[=value] ... or typeset -p [-aAfFilnrtux] [name ...]",
+	"local":     "local [option] name[=value] ...",
+	"export":    "export [-fn] [name[=value] ...] or export -p",
+	"readonly":  "readonly [-aAf] [name[=value] ...] or readonly -p",
+	"let":       "let arg [arg ...]",
+	"printf":    "printf [-v var] format [arguments]",
+	"read":      "read [-ers] [-a array] [-d delim] [-i text] [-n nchars] [-N nchars] [-p prompt] [-t timeout] [-u fd] [name ...]",
+	"set":       "set [-abefhkmnptuvxBCEHPT] [-o option-name] [--] [-] [arg ...]",
+	"shopt":     "shopt [-pqsu] [-o] [optname ...]",
+	"getopts":   "getopts optstring name [arg ...]",
+	"cd":        "cd [-L|[-P [-e]] [-@]] [dir]",
+	"pwd":       "pwd [-LP]",
+	"unset":     "unset [-f] [-v] [-n] [name ...]",
+	"source":    "source filename [arguments]",
+	".":         ". filename [arguments]",
+	"trap":      "trap [-lp] [[arg] signal_spec ...]",
+	"mapfile":   "mapfile [-d delim] [-n count] [-O origin] [-s count] [-t] [-u fd] [-C callback] [-c quantum] [array]",
+	"readarray": "readarray [-d delim] [-n count] [-O origin] [-s count] [-t] [-u fd] [-C callback] [-c quantum] [array]",
+	"type":      "type [-afptP] name [name ...]",
+	"command":   "command [-pVv] command [arg ...]",
+	"wait":      "wait [id ...]",
+	"exec":      "exec [-cl] [-a name] [command [argument ...]] [redirection ...]",
+}
+
+// usage reports an error in the use of a builtin, followed by its synopsis,
+// returning the exit status two.
+func (r *Runner) usage(name, msg string) int {
+	r.errorf("%s: %s", name, msg)
+
+	return r.printUsage(name)
+}
+
+// printUsage writes the synopsis of a builtin to stderr, returning the exit
+// status two.
+func (r *Runner) printUsage(name string) int {
+	if u, ok := usages[name]; ok {
+		fmt.Fprintf(r.stderr(), "%s: usage: %s\n", name, u)
+	}
+
+	return 2
+}
+
+// parseOptions parses the options of a builtin, which precede its operands,
+// returning them mapped to their arguments, along with the operands.
+//
+// The letters of the accepted options are given in spec, each followed by a
+// ':' if it takes an argument. Parsing stops at the first operand, or after
+// '--'. When an invalid option is given, it is reported, and the exit status
+// two returned.
+func (r *Runner) parseOptions(args []string, spec string) (map[byte]string, []string, int) {
+	opts := make(map[byte]string)
+	n := 1
+
+	for ; n < len(args); n++ {
+		arg := args[n]
+
+		if arg == "--" {
+			n++
+
+			break
+		} else if len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			c := arg[i]
+
+			pos := strings.IndexByte(spec, c)
+			if pos < 0 || c == ':' {
+				return nil, nil, r.usage(args[0], "-"+string(c)+": invalid option")
+			} else if pos+1 == len(spec) || spec[pos+1] != ':' {
+				opts[c] = ""
+
+				continue
+			}
+
+			if i+1 < len(arg) {
+				opts[c] = arg[i+1:]
+			} else if n+1 < len(args) {
+				n++
+				opts[c] = args[n]
+			} else {
+				return nil, nil, r.usage(args[0], "-"+string(c)+": option requires an argument")
+			}
+
+			break
+		}
+	}
+
+	return opts, args[n:], 0
+}
+
+func builtinTrue(context.Context, *Runner, []string) (int, error) {
+	return 0, nil
+}
+
+func builtinFalse(context.Context, *Runner, []string) (int, error) {
+	return 1, nil
+}
+
+func builtinBreak(_ context.Context, r *Runner, args []string) (int, error) {
+	return r.loopControl(args, false)
+}
+
+func builtinContinue(_ context.Context, r *Runner, args []string) (int, error) {
+	return r.loopControl(args, true)
+}
+
+// loopControl implements the 'break' and 'continue' builtins, which act on the
+// given number of enclosing loops, defaulting to one.
+//
+// As in bash, a count less than one is reported as an error, but still acts
+// on the innermost loop.
+func (r *Runner) loopControl(args []string, cont bool) (int, error) {
+	n, status := 1, 0
+
+	if len(args) > 2 {
+		return r.usage(args[0], "too many arguments"), nil
+	} else if len(args) == 2 {
+		var err error
+
+		if n, err = strconv.Atoi(args[1]); err != nil {
+			r.errorf("%s: %s: numeric argument required", args[0], args[1])
+
+			return 128, errExit
+		} else if n < 1 {
+			r.errorf("%s: %s: loop count out of range", args[0], args[1])
+
+			status, n = 1, 1
+		}
+	}
+
+	if r.loops == 0 {
+		r.errorf("%s: only meaningful in a `for', `while', or `until' loop", args[0])
+
+		return 0, nil
+	}
+
+	return status, loopControl{n: min(n, r.loops), cont: cont}
+}
+
+// builtinReturn returns from a function or sourced script, with the given
+// exit status, or that of the last command.
+func builtinReturn(_ context.Context, r *Runner, args []string) (int, error) {
+	if len(r.funcNames) == 0 && r.sources == 0 {
+		r.errorf("return: can only `return' from a function or sourced script")
+
+		return 2, nil
+	} else if len(args) > 2 {
+		r.errorf("return: too many arguments")
+
+		return 2, errReturn
+	}
+
+	status, _ := r.exitStatus(args)
+
+	return status, errReturn
+}
+
+// builtinExit exits the shell, or the current subshell, with the given exit
+// status, or that of the last command.
+func builtinExit(_ context.Context, r *Runner, args []string) (int, error) {
+	if len(args) > 2 {
+		r.errorf("exit: too many arguments")
+
+		return 1, nil
+	}
+
+	status, _ := r.exitStatus(args)
+
+	return status, errExit
+}
+
+// exitStatus parses the optional exit status argument of 'return' or 'exit',
+// which defaults to the status of the last command, and is taken modulo 256.
+//
+// An argument that is not a number is reported, and gives the status two.
+func (r *Runner) exitStatus(args []string) (int, bool) {
+	if len(args) < 2 {
+		return r.status, true
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(args[1]), 10, 64)
+	if err != nil {
+		r.errorf("%s: %s: numeric argument required", args[0], args[1])
+
+		return 2, false
+	}
+
+	return int(n & 0xff), true
+}
+
+// builtinShift removes the given number of positional parameters, defaulting
+// to one, failing if there are fewer than that.
+func builtinShift(_ context.Context, r *Runner, args []string) (int, error) {
+	n := 1
+
+	if len(args) > 2 {
+		r.errorf("shift: too many arguments")
+
+		return 1, nil
+	} else if len(args) == 2 {
+		var err error
+
+		if n, err = strconv.Atoi(strings.TrimSpace(args[1])); err != nil {
+			r.errorf("shift: %s: numeric argument required", args[1])
+
+			return 1, nil
+		} else if n < 0 {
+			r.errorf("shift: %s: shift count out of range", args[1])
+
+			return 1, nil
+		}
+	}
+
+	if n > len(r.Args) {
+		return 1, nil
+	}
+
+	r.Args = r.Args[n:]
+
+	return 0, nil
+}
+
+// builtinEval runs its arguments, joined with spaces, as a script in the
+// current shell.
+func builtinEval(ctx context.Context, r *Runner, args []string) (int, error) {
+	return r.eval(ctx, "eval", strings.Join(args[1:], " "))
+}
+
+// eval parses and runs a string in the current shell, with its line numbers
+// following on from the current line, returning the exit status of the last
+// command run.
+//
+// An error that would abandon the current line, such as a failed expansion,
+// instead ends only the evaluation of the string.
+func (r *Runner) eval(ctx context.Context, name, src string) (int, error) {
+	tk := parser.NewStringTokeniser(src)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		r.errorf("%s: %s", name, err)
+
+		return 2, nil
+	}
+
+	offset := r.lineOffset
+	r.lineOffset = r.lineno - 1
+	r.status = 0
+
+	err = r.file(ctx, f)
+
+	r.lineOffset = offset
+
+	if err == errDiscard {
+		err = nil
+	}
+
+	return r.status, err
+}
+
+// builtinSource runs the script in the named file in the current shell, with
+// the remaining arguments, if any, as its positional parameters.
+//
+// A name without a slash is searched for in the directories of PATH, and then
+// in the working directory. The RETURN trap, if set, is run once the script
+// finishes.
+func builtinSource(ctx context.Context, r *Runner, args []string) (int, error) {
+	if len(args) < 2 {
+		return r.usage(args[0], "filename argument required"), nil
+	}
+
+	f, err := r.open(ctx, r.sourcePath(args[1]), os.O_RDONLY)
+	if err != nil {
+		r.errorf("%s", message(&fs.PathError{Path: args[1], Err: unwrapPathError(err)}))
+
+		return 1, nil
+	}
+
+	data, err := io.ReadAll(f)
+
+	f.unref()
+
+	if err != nil {
+		r.errorf("%s: %s", args[0], message(&fs.PathError{Path: args[1], Err: unwrapPathError(err)}))
+
+		return 1, nil
+	}
+
+	tk := parser.NewStringTokeniser(string(data))
+
+	script, err := bash.Parse(&tk)
+	if err != nil {
+		r.errorf("%s: %s", args[1], err)
+
+		return 2, nil
+	}
+
+	if len(args) > 2 {
+		oldArgs := r.Args
+		r.Args = args[2:]
+
+		defer func() { r.Args = oldArgs }()
+	}
+
+	offset := r.lineOffset
+	r.lineOffset = 0
+	r.sources++
+	r.status = 0
+
+	err = r.file(ctx, script)
+
+	r.sources--
+	r.lineOffset = offset
+
+	if err == nil || err == errReturn {
+		err = r.trap(ctx, "RETURN")
+	}
+
+	return r.status, err
+}
+
+// sourcePath returns the path of a file to be sourced.
+func (r *Runner) sourcePath(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+
+	p, _ := r.Get("PATH")
+
+	for _, dir := range strings.Split(p.String(), ":") {
+		if dir == "" {
+			continue
+		}
+
+		candidate := path.Join(dir, name)
+
+		if fi, err := r.stat(candidate); err == nil && fi.Mode().IsRegular() {
+			return candidate
+		}
+	}
+
+	return name
+}
+
+// stat returns information about a file in the FS.
+func (r *Runner) stat(name string) (fs.FileInfo, error) {
+	if r.FS == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	return fs.Stat(r.FS, fsPath(r.path(name)))
+}
+
+// builtinTest evaluates a conditional expression, as with the 'test' and '['
+// builtins, the latter of which requires a closing ']'.
+func builtinTest(ctx context.Context, r *Runner, args []string) (int, error) {
+	name, args := args[0], args[1:]
+
+	if name == "[" {
+		if len(args) == 0 || args[len(args)-1] != "]" {
+			r.errorf("[: missing `]'")
+
+			return 2, nil
+		}
+
+		args = args[:len(args)-1]
+	}
+
+	ev, cd := r.condEvaluator(ctx)
+
+	if cd != nil {
+		cd.Operands = append(cd.Operands, args...)
+	}
+
+	ok, err := ev.Test(args)
+	if err != nil {
+		r.errorf("%s: %s", name, err)
+
+		return 2, nil
+	}
+
+	status := 0
+
+	if !ok {
+		status = 1
+	}
+
+	r.condition(ctx, cd, status)
+
+	return status, nil
+}
+
+// builtinCd changes the working directory to the given directory, or HOME,
+// setting PWD and OLDPWD; with the argument '-', it changes to OLDPWD and
+// writes the new directory to stdout.
+//
+// A relative directory is searched for in the directories of CDPATH. When
+// the Runner has an FS, the directory must exist within it; otherwise, it is
+// not checked.
+func builtinCd(_ context.Context, r *Runner, args []string) (int, error) {
+	_, operands, status := r.parseOptions(args, "LPe@")
+	if status != 0 {
+		return status, nil
+	} else if len(operands) > 1 {
+		r.errorf("cd: too many arguments")
+
+		return 1, nil
+	}
+
+	var (
+		dir   string
+		print bool
+	)
+
+	switch {
+	case len(operands) == 0:
+		home, ok := r.Get("HOME")
+		if !ok {
+			r.errorf("cd: HOME not set")
+
+			return 1, nil
+		} else if dir = home.String(); dir == "" {
+			return 0, nil
+		}
+	case operands[0] == "-":
+		old, ok := r.Get("OLDPWD")
+		if !ok {
+			r.errorf("cd: OLDPWD not set")
+
+			return 1, nil
+		}
+
+		dir, print = old.String(), true
+	default:
+		dir = operands[0]
+	}
+
+	p, found := r.cdPath(dir)
+	if err := r.isDirectory(p); err != nil {
+		r.errorf("cd: %s", message(&fs.PathError{Path: dir, Err: err}))
+
+		return 1, nil
+	}
+
+	r.setVar("OLDPWD", r.Dir)
+	r.Dir = p
+	r.setVar("PWD", p)
+
+	if print || found {
+		fmt.Fprintln(r.stdout(), p)
+	}
+
+	return 0, nil
+}
+
+// cdPath returns the absolute path of the directory to change to, and whether
+// it was found in CDPATH.
+func (r *Runner) cdPath(dir string) (string, bool) {
+	if cdpath, ok := r.Get("CDPATH"); ok && !path.IsAbs(dir) && !strings.HasPrefix(dir, "./") && !strings.HasPrefix(dir, "../") && dir != "." && dir != ".." {
+		for _, base := range strings.Split(cdpath.String(), ":") {
+			if base == "" {
+				continue
+			}
+
+			if p := r.path(path.Join(base, dir)); r.isDirectory(p) == nil {
+				return p, true
+			}
+		}
+	}
+
+	return r.path(dir), false
+}
+
+// isDirectory checks that a path is a directory in the FS, if the Runner has
+// one.
+func (r *Runner) isDirectory(p string) error {
+	if r.FS == nil {
+		return nil
+	}
+
+	fi, err := r.stat(p)
+	if err != nil {
+		return unwrapPathError(err)
+	} else if !fi.IsDir() {
+		return ErrNotDirectory
+	}
+
+	return nil
+}
+
+// setVar sets a variable, ignoring any error, such as from it being readonly.
+func (r *Runner) setVar(name, value string) {
+	r.Set(name, expand.Scalar(value))
+}
+
+// builtinPwd writes the working directory to stdout.
+func builtinPwd(_ context.Context, r *Runner, args []string) (int, error) {
+	if _, _, status := r.parseOptions(args, "LP"); status != 0 {
+		return status, nil
+	}
+
+	fmt.Fprintln(r.stdout(), r.Dir)
+
+	return 0, nil
+}
+
+// builtinWait waits for the given background jobs, or all of them, to
+// complete, returning the exit status of the last job given.
+func builtinWait(ctx context.Context, r *Runner, args []string) (int, error) {
+	_, ids, status := r.parseOptions(args, "")
+	if status != 0 {
+		return status, nil
+	}
+
+	if len(ids) == 0 {
+		for pid, j := range r.jobs {
+			if err := j.wait(ctx); err != nil {
+				return 0, err
+			}
+
+			delete(r.jobs, pid)
+		}
+
+		return 0, nil
+	}
+
+	for _, id := range ids {
+		pid, err := strconv.Atoi(id)
+		if err != nil {
+			r.errorf("wait: `%s': not a pid or valid job spec", id)
+
+			status = 2
+
+			continue
+		}
+
+		j, ok := r.jobs[pid]
+		if !ok {
+			r.errorf("wait: pid %d is not a child of this shell", pid)
+
+			status = 127
+
+			continue
+		}
+
+		if err := j.wait(ctx); err != nil {
+			return 0, err
+		}
+
+		status = j.status
+	}
+
+	return status, nil
+}
+
+// wait waits for a job to complete, or for the Context to be cancelled.
+func (j *job) wait(ctx context.Context) error {
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// builtinExec replaces the shell with an external command, by running it and
+// then exiting with its exit status.
+//
+// Without a command, the redirections of 'exec' remain in effect in the
+// current shell; these are performed by the Runner before the builtin is
+// called.
+func builtinExec(ctx context.Context, r *Runner, args []string) (int, error) {
+	_, operands, status := r.parseOptions(args, "cla:")
+	if status != 0 || len(operands) == 0 {
+		return status, nil
+	}
+
+	if err := r.exec(ctx, operands, r.scopes[len(r.scopes)-1]); err != nil {
+		return r.status, err
+	}
+
+	return r.status, errExit
+}
@@ -0,0 +1,833 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"vimagination.zapto.org/bash/expand"
+)
+
+// builtinEcho writes its arguments, separated by spaces and followed by a
+// newline, to stdout.
+//
+// Leading options, which may be combined, are -n, which omits the newline, and
+// -e and -E, which enable and disable the interpretation of backslash escapes;
+// the first argument that is not an option, and all that follow it, are
+// written.
+func builtinEcho(_ context.Context, r *Runner, args []string) (int, error) {
+	newline, escapes := true, false
+	args = args[1:]
+
+	for len(args) > 0 && isEchoOption(args[0]) {
+		for _, c := range args[0][1:] {
+			switch c {
+			case 'n':
+				newline = false
+			case 'e':
+				escapes = true
+			case 'E':
+				escapes = false
+			}
+		}
+
+		args = args[1:]
+	}
+
+	var sb strings.Builder
+
+	for n, arg := range args {
+		if n > 0 {
+			sb.WriteByte(' ')
+		}
+
+		if !escapes {
+			sb.WriteString(arg)
+
+			continue
+		}
+
+		s, stop := unescape(arg, escapeEcho)
+
+		sb.WriteString(s)
+
+		if stop {
+			newline = false
+
+			break
+		}
+	}
+
+	if newline {
+		sb.WriteByte('\n')
+	}
+
+	return r.write("echo", sb.String()), nil
+}
+
+func isEchoOption(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && strings.Trim(arg[1:], "neE") == ""
+}
+
+// write writes the output of a builtin to stdout, returning the exit status;
+// one if the output could not be written, which is reported unless the output
+// is a pipe that has been closed, as a shell would be stopped by SIGPIPE.
+func (r *Runner) write(name, s string) int {
+	if _, err := io.WriteString(r.stdout(), s); errors.Is(err, io.ErrClosedPipe) {
+		return 1
+	} else if err != nil {
+		r.errorf("%s: %s", name, message(&fs.PathError{Path: "write error", Err: unwrapPathError(err)}))
+
+		return 1
+	}
+
+	return 0
+}
+
+// escapeMode determines which backslash escapes are recognised by unescape.
+type escapeMode uint8
+
+const (
+	escapeEcho     escapeMode = iota // echo -e
+	escapeArgument                   // the %b conversion of printf
+	escapeFormat                     // the format string of printf
+)
+
+// unescape interprets the backslash escapes in a string, returning whether a
+// '\c' escape, which ends all output, was found.
+//
+// Octal escapes are given as '\0nnn' by echo, '\nnn' in a printf format, and
+// either for the %b conversion. Only in a printf format are '\"', '\”, and
+// '\?' escapes, and '\c' is not.
+func unescape(s string, mode escapeMode) (string, bool) {
+	var sb strings.Builder
+
+	for n := 0; n < len(s); n++ {
+		if s[n] != '\\' || n+1 == len(s) {
+			sb.WriteByte(s[n])
+
+			continue
+		}
+
+		n++
+
+		switch c := s[n]; c {
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'e', 'E':
+			sb.WriteByte(0x1b)
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case '\\':
+			sb.WriteByte('\\')
+		case 'c':
+			if mode == escapeFormat {
+				sb.WriteString(`\c`)
+
+				break
+			}
+
+			return sb.String(), true
+		case '"', '\'', '?':
+			if mode != escapeFormat {
+				sb.WriteByte('\\')
+			}
+
+			sb.WriteByte(c)
+		case 'x', 'u', 'U':
+			size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+			digits := prefixLen(s[n+1:], size, isHex)
+
+			if digits == 0 {
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+
+				break
+			}
+
+			v, _ := strconv.ParseUint(s[n+1:n+1+digits], 16, 32)
+
+			if c == 'x' {
+				sb.WriteByte(byte(v))
+			} else {
+				sb.WriteRune(rune(v))
+			}
+
+			n += digits
+		default:
+			start := n
+
+			switch {
+			case c == '0' && mode != escapeFormat:
+				start++
+			case !isOctal(c) || mode == escapeEcho:
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+
+				continue
+			}
+
+			digits := prefixLen(s[start:], 3, isOctal)
+			v, _ := strconv.ParseUint("0"+s[start:start+digits], 8, 16)
+
+			sb.WriteByte(byte(v))
+
+			n = start + digits - 1
+		}
+	}
+
+	return sb.String(), false
+}
+
+// prefixLen returns the number of bytes, up to max, at the start of a string
+// that satisfy the given function.
+func prefixLen(s string, max int, fn func(byte) bool) int {
+	n := 0
+
+	for n < max && n < len(s) && fn(s[n]) {
+		n++
+	}
+
+	return n
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isOctal(c byte) bool {
+	return '0' <= c && c <= '7'
+}
+
+// builtinPrintf writes its arguments, formatted according to a format string,
+// to stdout, or, with the -v option, assigns them to a variable.
+//
+// The format is reused as long as arguments remain, with missing arguments
+// taken as empty, or zero. In addition to the conversions of C's printf, %b
+// expands backslash escapes in its argument, %q quotes its argument for reuse
+// as shell input, and %(fmt)T formats a time, given in seconds since the
+// epoch, with strftime.
+func builtinPrintf(_ context.Context, r *Runner, args []string) (int, error) {
+	opts, operands, status := r.parseOptions(args, "v:")
+	if status != 0 {
+		return status, nil
+	} else if len(operands) == 0 {
+		return r.printUsage("printf"), nil
+	}
+
+	p := printer{Runner: r, args: operands[1:]}
+
+	for {
+		p.used = false
+
+		p.format(operands[0])
+
+		if p.stop || !p.used || len(p.args) == 0 {
+			break
+		}
+	}
+
+	if name, ok := opts['v']; ok {
+		if base, _, keyed := splitSubscript(name); !isName(base) || keyed && !strings.HasSuffix(name, "]") {
+			r.errorf("printf: `%s': not a valid identifier", name)
+
+			return 2, nil
+		} else if err := r.assignScalar(name, p.String(), false); err != nil {
+			r.errorf("printf: %s", err)
+
+			return 1, nil
+		}
+	} else if s := r.write("printf", p.String()); s != 0 {
+		return s, nil
+	}
+
+	return p.status, nil
+}
+
+// printer holds the state of the 'printf' builtin; its output, its remaining
+// arguments, and its exit status.
+type printer struct {
+	*Runner
+	strings.Builder
+	args   []string
+	used   bool
+	stop   bool
+	status int
+}
+
+// format writes the output of a single pass of the format string.
+func (p *printer) format(format string) {
+	for n := 0; n < len(format) && !p.stop; n++ {
+		switch format[n] {
+		case '\\':
+			end := n + 1
+
+			if end < len(format) {
+				end++
+			}
+
+			switch c := format[n+1 : end]; {
+			case c == "x" || c == "u" || c == "U":
+				end += prefixLen(format[end:], map[string]int{"x": 2, "u": 4, "U": 8}[c], isHex)
+			case c != "" && isOctal(c[0]):
+				end += prefixLen(format[end:], 2, isOctal)
+			}
+
+			s, _ := unescape(format[n:end], escapeFormat)
+
+			p.WriteString(s)
+
+			n = end - 1
+		case '%':
+			n = p.directive(format, n+1)
+		default:
+			p.WriteByte(format[n])
+		}
+	}
+}
+
+// directive formats a single conversion, starting after its '%', returning
+// the position of its last byte.
+func (p *printer) directive(format string, n int) int {
+	if n < len(format) && format[n] == '%' {
+		p.WriteByte('%')
+
+		return n
+	}
+
+	var (
+		flags     string
+		width     = -1
+		precision = -1
+	)
+
+	for ; n < len(format) && strings.IndexByte("-+ #0", format[n]) >= 0; n++ {
+		flags += format[n : n+1]
+	}
+
+	n, w, ok := p.number(format, n)
+	if ok {
+		if width = w; width < 0 {
+			flags += "-"
+			width = -width
+		}
+	}
+
+	if n < len(format) && format[n] == '.' {
+		if n, precision, ok = p.number(format, n+1); !ok {
+			precision = 0
+		} else if precision < 0 {
+			precision = -1
+		}
+	}
+
+	for n < len(format) && strings.IndexByte("hlLjzt", format[n]) >= 0 {
+		n++
+	}
+
+	var timeFormat string
+
+	if n < len(format) && format[n] == '(' {
+		end := strings.IndexByte(format[n:], ')')
+		if end < 0 {
+			p.fail("`(': missing time format specification")
+
+			return len(format)
+		}
+
+		timeFormat = format[n+1 : n+end]
+		n += end + 1
+
+		if n == len(format) || format[n] != 'T' {
+			return p.invalid(format, n)
+		}
+	}
+
+	if n == len(format) {
+		p.errorf("printf: `%%': missing format character")
+
+		p.status = 1
+		p.stop = true
+
+		return n
+	}
+
+	switch verb := format[n]; verb {
+	case 'd', 'i':
+		p.pad(flags, width, precision, 'd', p.integer())
+	case 'o', 'u', 'x', 'X':
+		if verb == 'u' {
+			verb = 'd'
+		}
+
+		p.pad(flags, width, precision, verb, uint64(p.integer()))
+	case 'e', 'E', 'f', 'F', 'g', 'G', 'a', 'A':
+		p.float(flags, width, precision, verb, p.floatArg())
+	case 'c':
+		arg := p.arg()
+
+		if arg == "" {
+			arg = "\x00"
+		} else {
+			_, size := utf8.DecodeRuneInString(arg)
+			arg = arg[:size]
+		}
+
+		p.pad(flags, width, -1, 's', arg)
+	case 's':
+		p.pad(flags, width, precision, 's', p.arg())
+	case 'b':
+		s, stop := unescape(p.arg(), escapeArgument)
+
+		p.pad(flags, width, precision, 's', s)
+
+		p.stop = p.stop || stop
+	case 'q':
+		p.pad(flags, width, precision, 's', printfQuote(p.arg()))
+	case 'T':
+		if timeFormat == "" && format[n-1] != ')' {
+			return p.invalid(format, n)
+		}
+
+		p.pad(flags, width, precision, 's', p.time(timeFormat))
+	default:
+		return p.invalid(format, n)
+	}
+
+	return n
+}
+
+// invalid reports an invalid conversion, which ends the output.
+func (p *printer) invalid(format string, n int) int {
+	if n >= len(format) {
+		n = len(format) - 1
+	}
+
+	p.fail("`" + format[n:n+1] + "': invalid format character")
+
+	p.stop = true
+
+	return len(format)
+}
+
+func (p *printer) fail(msg string) {
+	p.errorf("printf: %s", msg)
+
+	p.status = 1
+}
+
+// number parses a width or precision, which is either a decimal number, or a
+// '*', taking its value from the next argument, returning whether either was
+// given.
+func (p *printer) number(format string, n int) (int, int, bool) {
+	if n < len(format) && format[n] == '*' {
+		return n + 1, int(p.integer()), true
+	}
+
+	digits := prefixLen(format[n:], len(format), func(c byte) bool { return '0' <= c && c <= '9' })
+	if digits == 0 {
+		return n, 0, false
+	}
+
+	v, _ := strconv.Atoi(format[n : n+digits])
+
+	return n + digits, v, true
+}
+
+// arg returns the next argument, or an empty string if none remain.
+func (p *printer) arg() string {
+	if len(p.args) == 0 {
+		return ""
+	}
+
+	arg := p.args[0]
+	p.args = p.args[1:]
+	p.used = true
+
+	return arg
+}
+
+// integer returns the next argument as an integer.
+//
+// An argument may be a decimal, octal, or hexadecimal number, as in C, or a
+// quote followed by a character, which gives the code of that character. An
+// invalid number is reported, giving the value of the valid number at its
+// start, if any.
+func (p *printer) integer() int64 {
+	arg := p.arg()
+	s := strings.TrimLeft(arg, " \t\n")
+
+	if s == "" {
+		return 0
+	} else if s[0] == '\'' || s[0] == '"' {
+		c, _ := utf8.DecodeRuneInString(s[1:])
+
+		if c == utf8.RuneError {
+			return 0
+		}
+
+		return int64(c)
+	}
+
+	start, base := 0, 10
+
+	if s[0] == '-' || s[0] == '+' {
+		start++
+	}
+
+	if strings.HasPrefix(s[start:], "0x") || strings.HasPrefix(s[start:], "0X") {
+		start, base = start+2, 16
+	} else if strings.HasPrefix(s[start:], "0") {
+		base = 8
+	}
+
+	digits := prefixLen(s[start:], len(s), func(c byte) bool {
+		d := strings.IndexByte("0123456789abcdef", byte(unicode.ToLower(rune(c))))
+
+		return d >= 0 && d < base
+	})
+
+	var n int64
+
+	if digits > 0 {
+		u, err := strconv.ParseUint(s[start:start+digits], base, 64)
+		if err != nil || u > math.MaxInt64 {
+			if u != math.MaxUint64 || s[0] == '-' {
+				p.errorf("printf: warning: %s: Numerical result out of range", arg)
+			}
+
+			u = math.MaxInt64
+		}
+
+		if n = int64(u); s[0] == '-' {
+			n = -n
+		}
+	}
+
+	if digits == 0 || start+digits != len(s) {
+		p.fail(arg + ": invalid number")
+	}
+
+	return n
+}
+
+// floatArg returns the next argument as a floating point number, which may
+// also be given as a quote followed by a character.
+func (p *printer) floatArg() float64 {
+	arg := p.arg()
+	s := strings.TrimLeft(arg, " \t\n")
+
+	if s == "" {
+		return 0
+	} else if s[0] == '\'' || s[0] == '"' {
+		c, _ := utf8.DecodeRuneInString(s[1:])
+
+		return float64(c)
+	}
+
+	for end := len(s); end > 0; end-- {
+		if f, err := strconv.ParseFloat(s[:end], 64); err == nil {
+			if end != len(s) {
+				p.fail(arg + ": invalid number")
+			}
+
+			return f
+		}
+	}
+
+	p.fail(arg + ": invalid number")
+
+	return 0
+}
+
+// pad formats a value with the given flags, width, and precision, as with
+// the fmt package, which follows C for the flags used by printf.
+func (p *printer) pad(flags string, width, precision int, verb byte, v any) {
+	if verb == 's' {
+		flags = strings.Map(func(c rune) rune {
+			if c == '-' {
+				return c
+			}
+
+			return -1
+		}, flags)
+	}
+
+	spec := "%" + flags
+
+	if width >= 0 {
+		spec += strconv.Itoa(width)
+	}
+
+	if precision >= 0 {
+		spec += "." + strconv.Itoa(precision)
+	}
+
+	fmt.Fprintf(p, spec+string(verb), v)
+}
+
+// float formats a floating point number.
+//
+// Infinities and NaNs are written as in C, and the %a conversion gives the
+// leading hexadecimal digit of a long double.
+func (p *printer) float(flags string, width, precision int, verb byte, f float64) {
+	upper := unicode.IsUpper(rune(verb))
+
+	switch {
+	case math.IsInf(f, 0) || math.IsNaN(f):
+		s := "inf"
+
+		if math.IsNaN(f) {
+			s = "nan"
+		}
+
+		if f < 0 {
+			s = "-" + s
+		} else if strings.Contains(flags, "+") && !math.IsNaN(f) {
+			s = "+" + s
+		}
+
+		if upper {
+			s = strings.ToUpper(s)
+		}
+
+		p.pad(flags, width, -1, 's', s)
+	case verb == 'a' || verb == 'A':
+		s := hexFloat(f, precision, strings.Contains(flags, "+"))
+
+		if upper {
+			s = strings.ToUpper(s)
+		}
+
+		p.pad(flags, width, -1, 's', s)
+	default:
+		if precision < 0 && (verb == 'g' || verb == 'G') {
+			precision = 6
+		}
+
+		p.pad(flags, width, precision, verb, f)
+	}
+}
+
+// hexFloat formats a number in the form of the %a conversion of C for a long
+// double, which has an explicit leading bit, making the leading hexadecimal
+// digit of its mantissa between 8 and f.
+func hexFloat(f float64, precision int, plus bool) string {
+	sign := ""
+
+	if math.Signbit(f) {
+		sign, f = "-", -f
+	} else if plus {
+		sign = "+"
+	}
+
+	if f == 0 {
+		if precision > 0 {
+			return sign + "0x0." + strings.Repeat("0", precision) + "p+0"
+		}
+
+		return sign + "0x0p+0"
+	}
+
+	frac, exp := math.Frexp(f)
+	mantissa := uint64(math.Ldexp(frac, 64))
+	exp -= 4
+
+	if precision >= 0 && precision < 15 {
+		shift := uint(4 * (15 - precision))
+
+		rounded, carry := bits.Add64(mantissa, 1<<(shift-1), 0)
+		if carry != 0 {
+			rounded, exp = 1<<63|rounded>>1, exp+1
+		}
+
+		mantissa = rounded >> shift << shift
+	}
+
+	digits := fmt.Sprintf("%016x", mantissa)
+	fraction := digits[1:]
+
+	if precision < 0 {
+		fraction = strings.TrimRight(fraction, "0")
+	} else if precision < len(fraction) {
+		fraction = fraction[:precision]
+	} else {
+		fraction += strings.Repeat("0", precision-len(fraction))
+	}
+
+	if fraction != "" {
+		fraction = "." + fraction
+	}
+
+	return fmt.Sprintf("%s0x%c%sp%+d", sign, digits[0], fraction, exp)
+}
+
+// time formats the time given by the next argument, in seconds since the
+// epoch, or the current time, for -1, or the time the shell started, for -2.
+func (p *printer) time(format string) string {
+	var t time.Time
+
+	if len(p.args) == 0 {
+		t = time.Now()
+	} else {
+		switch n := p.integer(); n {
+		case -1:
+			t = time.Now()
+		case -2:
+			t = p.start
+		default:
+			t = time.Unix(n, 0)
+		}
+	}
+
+	if format == "" {
+		format = "%X"
+	}
+
+	return strftime(format, t)
+}
+
+// strftime formats a time as with the strftime function of C, in the C
+// locale.
+func strftime(format string, t time.Time) string {
+	var sb strings.Builder
+
+	for n := 0; n < len(format); n++ {
+		if format[n] != '%' || n+1 == len(format) {
+			sb.WriteByte(format[n])
+
+			continue
+		}
+
+		n++
+
+		switch format[n] {
+		case 'a':
+			sb.WriteString(t.Format("Mon"))
+		case 'A':
+			sb.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			sb.WriteString(t.Format("Jan"))
+		case 'B':
+			sb.WriteString(t.Format("January"))
+		case 'c':
+			sb.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&sb, "%02d", t.Year()/100)
+		case 'd':
+			sb.WriteString(t.Format("02"))
+		case 'D', 'x':
+			sb.WriteString(t.Format("01/02/06"))
+		case 'e':
+			sb.WriteString(t.Format("_2"))
+		case 'F':
+			sb.WriteString(t.Format("2006-01-02"))
+		case 'g':
+			year, _ := t.ISOWeek()
+
+			fmt.Fprintf(&sb, "%02d", year%100)
+		case 'G':
+			year, _ := t.ISOWeek()
+
+			fmt.Fprintf(&sb, "%d", year)
+		case 'H':
+			sb.WriteString(t.Format("15"))
+		case 'I':
+			sb.WriteString(t.Format("03"))
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&sb, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&sb, "%2d", (t.Hour()+11)%12+1)
+		case 'm':
+			sb.WriteString(t.Format("01"))
+		case 'M':
+			sb.WriteString(t.Format("04"))
+		case 'n':
+			sb.WriteByte('\n')
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'r':
+			sb.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			sb.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&sb, "%d", t.Unix())
+		case 'S':
+			sb.WriteString(t.Format("05"))
+		case 't':
+			sb.WriteByte('\t')
+		case 'T', 'X':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'u':
+			fmt.Fprintf(&sb, "%d", (int(t.Weekday())+6)%7+1)
+		case 'U':
+			fmt.Fprintf(&sb, "%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+		case 'V':
+			_, week := t.ISOWeek()
+
+			fmt.Fprintf(&sb, "%02d", week)
+		case 'w':
+			fmt.Fprintf(&sb, "%d", t.Weekday())
+		case 'W':
+			fmt.Fprintf(&sb, "%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+		case 'y':
+			sb.WriteString(t.Format("06"))
+		case 'Y':
+			fmt.Fprintf(&sb, "%d", t.Year())
+		case 'z':
+			sb.WriteString(t.Format("-0700"))
+		case 'Z':
+			sb.WriteString(t.Format("MST"))
+		case '%':
+			sb.WriteByte('%')
+		default:
+			sb.WriteString(format[n-1 : n+1])
+		}
+	}
+
+	return sb.String()
+}
+
+// printfQuote quotes a string for reuse as shell input, as with the %q
+// conversion of printf; with backslashes, or, if it contains non-printable
+// characters, with ANSI-C quoting.
+func printfQuote(s string) string {
+	if s == "" {
+		return "''"
+	} else if strings.ContainsFunc(s, func(c rune) bool { return !unicode.IsPrint(c) }) {
+		return expand.Quote(s)
+	}
+
+	var sb strings.Builder
+
+	for n, c := range s {
+		if strings.ContainsRune(" \t\n'\"\\|&;()<>!{}*[?]^$`,", c) || n == 0 && (c == '~' || c == '#') {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,498 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"vimagination.zapto.org/bash/expand"
+)
+
+// builtinRead reads a line from stdin, splitting it into fields with IFS, and
+// assigning them to the named variables, or the whole line to REPLY when none
+// are named.
+//
+// Each variable but the last is assigned a single field, with the last taking
+// the remainder of the line. With the -a option, each field is assigned to an
+// element of the named array.
+//
+// Unless the -r option is given, a backslash escapes the following character,
+// which prevents it being a delimiter or being split on, and a backslash
+// followed by a newline continues the line. The -d option sets the delimiter
+// that ends the line, -n stops reading after the given number of characters,
+// and -N reads exactly that number, ignoring the delimiter. The -u option
+// reads from the given file descriptor.
+//
+// As input is never a terminal, the -p, -e, -i, and -s options have no
+// effect, and timeouts given with -t are ignored, except that a timeout of
+// zero succeeds without reading.
+//
+// The exit status is one if the end of the input was reached before the
+// delimiter, though any characters read are still assigned.
+func builtinRead(_ context.Context, r *Runner, args []string) (int, error) {
+	opts, names, status := r.parseOptions(args, "ersa:d:i:n:N:p:t:u:")
+	if status != 0 {
+		return status, nil
+	}
+
+	array, isArray := opts['a']
+
+	if isArray {
+		names = []string{array}
+	}
+
+	for _, name := range names {
+		if !isName(name) {
+			r.errorf("read: `%s': not a valid identifier", name)
+
+			return 1, nil
+		}
+	}
+
+	rd := lineReader{delim: '\n', limit: -1}
+
+	if d, ok := opts['d']; ok {
+		rd.delim = 0
+
+		if d != "" {
+			rd.delim = d[0]
+		}
+	}
+
+	for _, o := range [...]byte{'n', 'N'} {
+		if n, ok := opts[o]; ok {
+			limit, err := strconv.Atoi(n)
+			if err != nil || limit < 0 {
+				r.errorf("read: %s: invalid number", n)
+
+				return 1, nil
+			}
+
+			rd.limit, rd.exact = limit, o == 'N'
+		}
+	}
+
+	if t, ok := opts['t']; ok {
+		if timeout, err := strconv.ParseFloat(t, 64); err != nil || timeout < 0 {
+			r.errorf("read: %s: invalid timeout specification", t)
+
+			return 1, nil
+		} else if timeout == 0 {
+			return 0, nil
+		}
+	}
+
+	f, ok := r.inputFD("read", opts['u'])
+	if !ok {
+		return 1, nil
+	}
+
+	_, rd.raw = opts['r']
+
+	line, err := rd.read(f)
+	if err != nil && !errors.Is(err, io.EOF) {
+		fd := opts['u']
+
+		if fd == "" {
+			fd = "0"
+		}
+
+		r.errorf("read: read error: %s", message(&fs.PathError{Path: fd, Err: unwrapPathError(err)}))
+
+		return 1, nil
+	} else if err != nil {
+		status = 1
+	}
+
+	if len(names) == 0 {
+		return r.assignRead("REPLY", line.String()), nil
+	}
+
+	ifs := " \t\n"
+
+	if v, ok := r.Get("IFS"); ok {
+		ifs = v.String()
+	}
+
+	if isArray {
+		values := line.fields(ifs)
+		elems := make([]element, len(values))
+
+		for n, value := range values {
+			elems[n] = element{value: value}
+		}
+
+		if err := r.assignArray(array, elems, false); err != nil {
+			r.errorf("read: %s", err)
+
+			return 1, nil
+		}
+
+		return status, nil
+	}
+
+	line.trimLeft(ifs)
+
+	for n, name := range names {
+		var value string
+
+		if n == len(names)-1 {
+			value = line.remainder(ifs)
+		} else {
+			value = line.field(ifs)
+		}
+
+		if s := r.assignRead(name, value); s != 0 {
+			return s, nil
+		}
+	}
+
+	return status, nil
+}
+
+// assignRead assigns a value read by the 'read' builtin.
+func (r *Runner) assignRead(name, value string) int {
+	if err := r.Set(name, expand.Scalar(value)); err != nil {
+		r.errorf("read: %s", err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// inputFD returns the file referred to by the file descriptor given to the -u
+// option of a builtin, or stdin.
+func (r *Runner) inputFD(name, fd string) (*file, bool) {
+	n := 0
+
+	if fd != "" {
+		var err error
+
+		if n, err = strconv.Atoi(fd); err != nil {
+			n = -1
+		}
+	} else {
+		fd = "0"
+	}
+
+	f, ok := r.fds[n]
+	if !ok {
+		r.errorf("%s: %s: invalid file descriptor: Bad file descriptor", name, fd)
+	}
+
+	return f, ok
+}
+
+// lineReader reads a line of input for the 'read' builtin.
+type lineReader struct {
+	delim byte
+	limit int
+	exact bool
+	raw   bool
+}
+
+// inputLine is a line read by the 'read' builtin, with each character marked
+// as to whether it was escaped by a backslash.
+type inputLine struct {
+	chars   []rune
+	escaped []bool
+}
+
+// read reads a line, one byte at a time, so that no input following the line
+// is consumed, returning io.EOF if the input ended before the delimiter.
+func (l *lineReader) read(rd io.Reader) (*inputLine, error) {
+	var (
+		line    inputLine
+		pending []byte
+		escape  bool
+	)
+
+	add := func(c byte, escaped bool) {
+		if pending = append(pending, c); !utf8.FullRune(pending) {
+			return
+		}
+
+		for len(pending) > 0 {
+			c, size := utf8.DecodeRune(pending)
+			line.chars = append(line.chars, c)
+			line.escaped = append(line.escaped, escaped)
+			pending = pending[size:]
+		}
+	}
+
+	for l.limit < 0 || len(line.chars) < l.limit {
+		c, err := readByte(rd)
+		if err != nil {
+			for _, c := range pending {
+				line.chars = append(line.chars, rune(c))
+				line.escaped = append(line.escaped, false)
+			}
+
+			return &line, err
+		}
+
+		switch {
+		case escape:
+			escape = false
+
+			if c != '\n' {
+				add(c, true)
+			}
+		case c == l.delim && !l.exact:
+			return &line, nil
+		case c == '\\' && !l.raw:
+			escape = true
+		default:
+			add(c, false)
+		}
+	}
+
+	return &line, nil
+}
+
+func readByte(rd io.Reader) (byte, error) {
+	var buf [1]byte
+
+	for {
+		n, err := rd.Read(buf[:])
+		if n == 1 {
+			return buf[0], nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (l *inputLine) String() string {
+	return string(l.chars)
+}
+
+// isIFS determines whether the character at the given position is an
+// unescaped IFS character, and if so, whether it is IFS whitespace.
+func (l *inputLine) isIFS(ifs string, pos int) (bool, bool) {
+	c := l.chars[pos]
+
+	if l.escaped[pos] || !strings.ContainsRune(ifs, c) {
+		return false, false
+	}
+
+	return true, c == ' ' || c == '\t' || c == '\n'
+}
+
+// trimLeft removes leading IFS whitespace.
+func (l *inputLine) trimLeft(ifs string) {
+	for len(l.chars) > 0 {
+		if _, space := l.isIFS(ifs, 0); !space {
+			break
+		}
+
+		l.chars, l.escaped = l.chars[1:], l.escaped[1:]
+	}
+}
+
+// field removes and returns the next field, along with the delimiter that
+// follows it, which is either IFS whitespace, or a single other IFS
+// character, along with any IFS whitespace surrounding it.
+func (l *inputLine) field(ifs string) string {
+	end := 0
+
+	for end < len(l.chars) {
+		if ok, _ := l.isIFS(ifs, end); ok {
+			break
+		}
+
+		end++
+	}
+
+	field := string(l.chars[:end])
+	l.chars, l.escaped = l.chars[end:], l.escaped[end:]
+
+	l.trimLeft(ifs)
+
+	if len(l.chars) > 0 {
+		if ok, space := l.isIFS(ifs, 0); ok && !space {
+			l.chars, l.escaped = l.chars[1:], l.escaped[1:]
+
+			l.trimLeft(ifs)
+		}
+	}
+
+	return field
+}
+
+// remainder returns the rest of the line, as assigned to the last variable,
+// with trailing IFS whitespace removed.
+//
+// As in bash, when the remainder is a single field followed by a delimiter,
+// the delimiter is also removed.
+func (l *inputLine) remainder(ifs string) string {
+	end := len(l.chars)
+
+	for end > 0 {
+		if _, space := l.isIFS(ifs, end-1); !space {
+			break
+		}
+
+		end--
+	}
+
+	rest := inputLine{chars: l.chars[:end], escaped: l.escaped[:end]}
+	fields := rest.fields(ifs)
+
+	if len(fields) == 1 && end > 0 {
+		if ok, _ := rest.isIFS(ifs, end-1); ok {
+			return fields[0]
+		}
+	}
+
+	return string(rest.chars)
+}
+
+// fields splits the whole line into fields, as for 'read -a'.
+func (l *inputLine) fields(ifs string) []string {
+	rest := *l
+
+	rest.trimLeft(ifs)
+
+	var fields []string
+
+	for len(rest.chars) > 0 {
+		fields = append(fields, rest.field(ifs))
+	}
+
+	return fields
+}
+
+// builtinMapfile implements the 'mapfile' builtin, also known as 'readarray',
+// which reads lines from stdin into the elements of an indexed array,
+// MAPFILE by default.
+//
+// The -d option sets the delimiter that ends each line, and -t removes it from
+// the elements. The -n option limits the number of lines read, -s skips a
+// number of lines, and -O sets the index of the first element, with the array
+// being cleared first when it is not given. The -u option reads from the
+// given file descriptor.
+//
+// With the -C option, the given command is evaluated, with the index of the
+// next element and its line as arguments, after every quantum of lines, as
+// set by -c, which defaults to 5000.
+func builtinMapfile(ctx context.Context, r *Runner, args []string) (int, error) {
+	opts, operands, status := r.parseOptions(args, "d:n:O:s:tu:C:c:")
+	if status != 0 {
+		return status, nil
+	} else if len(operands) > 1 {
+		return r.usage(args[0], "too many arguments"), nil
+	}
+
+	name := "MAPFILE"
+
+	if len(operands) == 1 {
+		if name = operands[0]; !isName(name) {
+			r.errorf("%s: `%s': not a valid identifier", args[0], name)
+
+			return 1, nil
+		}
+	}
+
+	delim := byte('\n')
+
+	if d, ok := opts['d']; ok {
+		delim = 0
+
+		if d != "" {
+			delim = d[0]
+		}
+	}
+
+	numbers := map[byte]int{'n': 0, 'O': 0, 's': 0, 'c': 5000}
+
+	for o := range numbers {
+		if s, ok := opts[o]; ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || o == 'c' && n == 0 {
+				r.errorf("%s: %s: invalid %s", args[0], s, map[byte]string{'n': "line count", 'O': "array origin", 's': "line count", 'c': "callback quantum"}[o])
+
+				return 1, nil
+			}
+
+			numbers[o] = n
+		}
+	}
+
+	f, ok := r.inputFD(args[0], opts['u'])
+	if !ok {
+		return 1, nil
+	}
+
+	_, trim := opts['t']
+	_, origin := opts['O']
+	callback, hasCallback := opts['C']
+	index := numbers['O']
+
+	var elems []element
+
+	if origin {
+		if _, v, ok := r.lookup(name); ok && !v.unset {
+			for _, key := range v.Keys() {
+				value, _ := v.Index(key)
+				elems = append(elems, element{key: key, value: value, keyed: true})
+			}
+		}
+	}
+
+	for count := 0; numbers['n'] == 0 || count < numbers['n']+numbers['s']; count++ {
+		line, err := readDelimited(f, delim)
+		if line == "" && err != nil {
+			break
+		} else if count < numbers['s'] {
+			continue
+		}
+
+		value := line
+
+		if trim {
+			value = strings.TrimSuffix(line, string(delim))
+		}
+
+		if hasCallback && (count-numbers['s']+1)%numbers['c'] == 0 {
+			if _, err := r.eval(ctx, args[0], callback+" "+strconv.Itoa(index)+" "+printfQuote(value)); err != nil {
+				return 1, err
+			}
+		}
+
+		elems = append(elems, element{key: strconv.Itoa(index), value: value, keyed: true})
+		index++
+	}
+
+	if err := r.assignArray(name, elems, false); err != nil {
+		r.errorf("%s: %s", args[0], err)
+
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// readDelimited reads up to, and including, the next delimiter, one byte at a
+// time.
+func readDelimited(rd io.Reader, delim byte) (string, error) {
+	var sb strings.Builder
+
+	for {
+		c, err := readByte(rd)
+		if err != nil {
+			return sb.String(), err
+		}
+
+		sb.WriteByte(c)
+
+		if c == delim {
+			return sb.String(), nil
+		}
+	}
+}
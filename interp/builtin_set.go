@@ -0,0 +1,507 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash/expand"
+)
+
+// alwaysSet are the options of 'set' that are always enabled, and are
+// accepted, but have no effect.
+var alwaysSet = [...]struct {
+	name   string
+	letter byte
+}{
+	{"braceexpand", 'B'},
+	{"hashall", 'h'},
+}
+
+// builtinSet sets or unsets shell options, given either by letter, or by name
+// with the -o option, and sets the positional parameters to any remaining
+// arguments; an argument of '--' ends the options, setting the positional
+// parameters even when no arguments follow.
+//
+// Without arguments, all variables and functions are listed; the -o option,
+// without a name, lists the options.
+func builtinSet(_ context.Context, r *Runner, args []string) (int, error) {
+	if len(args) == 1 {
+		r.listVariables()
+
+		return 0, nil
+	}
+
+	n := 1
+
+	for ; n < len(args); n++ {
+		arg := args[n]
+
+		if arg == "--" {
+			r.Args = slices.Clone(args[n+1:])
+
+			return 0, nil
+		} else if arg == "-" {
+			r.Options &^= XTrace
+			n++
+
+			break
+		} else if len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			break
+		}
+
+		on := arg[0] == '-'
+
+		for _, c := range []byte(arg[1:]) {
+			if c == 'o' {
+				if n+1 == len(args) {
+					r.printSetOptions(on)
+
+					continue
+				}
+
+				n++
+
+				if !r.setNamedOption(args[n], on) {
+					r.errorf("set: %s: invalid option name", args[n])
+
+					return r.printUsage("set"), nil
+				}
+
+				continue
+			}
+
+			if !r.setLetterOption(c, on) {
+				return r.usage("set", arg[:1]+string(c)+": invalid option"), nil
+			}
+		}
+	}
+
+	if n < len(args) {
+		r.Args = slices.Clone(args[n:])
+	}
+
+	return 0, nil
+}
+
+// setNamedOption sets or unsets an option of 'set' by name, returning false if
+// there is no such option.
+func (r *Runner) setNamedOption(name string, on bool) bool {
+	for _, o := range alwaysSet {
+		if o.name == name {
+			return true
+		}
+	}
+
+	o, ok := setOption(name)
+	if !ok {
+		return false
+	}
+
+	r.enable(o, on)
+
+	return true
+}
+
+// setLetterOption sets or unsets an option of 'set' by letter, returning false
+// if there is no such option.
+func (r *Runner) setLetterOption(c byte, on bool) bool {
+	for _, o := range alwaysSet {
+		if o.letter == c {
+			return true
+		}
+	}
+
+	for _, o := range setOptions {
+		if o.letter == c {
+			r.enable(o.option, on)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// enable sets or unsets the given options.
+func (r *Runner) enable(o Options, on bool) {
+	if on {
+		r.Options |= o
+	} else {
+		r.Options &^= o
+	}
+}
+
+// printSetOptions lists the options of 'set'; as a table of their states, or,
+// for 'set +o', as the commands that would restore them.
+func (r *Runner) printSetOptions(table bool) {
+	for _, o := range setOptions {
+		enabled := r.Options&o.option != 0
+
+		switch {
+		case table:
+			fmt.Fprintf(r.stdout(), "%-15s\t%s\n", o.name, onOff(enabled))
+		case enabled:
+			fmt.Fprintf(r.stdout(), "set -o %s\n", o.name)
+		default:
+			fmt.Fprintf(r.stdout(), "set +o %s\n", o.name)
+		}
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+
+	return "off"
+}
+
+// builtinShopt sets, with the -s option, or unsets, with -u, the named shell
+// options, or, with neither, reports whether they are set; the -o option
+// selects the options of 'set -o' instead.
+//
+// Without names, the options are listed, limited to those that are set, or
+// unset, with -s or -u. The -p option lists the options as the commands that
+// would restore them, and -q suppresses output, with the exit status alone
+// reporting whether all of the named options are set.
+func builtinShopt(_ context.Context, r *Runner, args []string) (int, error) {
+	opts, names, status := r.parseOptions(args, "pqsuo")
+	if status != 0 {
+		return status, nil
+	}
+
+	_, set := opts['s']
+	_, unset := opts['u']
+	_, print := opts['p']
+	_, quiet := opts['q']
+	_, setO := opts['o']
+
+	if set && unset {
+		r.errorf("shopt: cannot set and unset shell options simultaneously")
+
+		return 1, nil
+	}
+
+	type option struct {
+		name   string
+		option Options
+	}
+
+	var options []option
+
+	if setO {
+		for _, o := range setOptions {
+			options = append(options, option{o.name, o.option})
+		}
+	} else {
+		for _, o := range shoptOptions {
+			options = append(options, option{o.name, o.option})
+		}
+	}
+
+	named := len(names) > 0
+
+	if !named {
+		for _, o := range options {
+			names = append(names, o.name)
+		}
+	}
+
+	for _, name := range names {
+		n := slices.IndexFunc(options, func(o option) bool { return o.name == name })
+		if n < 0 {
+			if setO {
+				r.errorf("shopt: %s: invalid option name", name)
+			} else {
+				r.errorf("shopt: %s: invalid shell option name", name)
+			}
+
+			status = 1
+
+			continue
+		}
+
+		o := options[n]
+		on := r.Options&o.option != 0
+
+		switch {
+		case named && (set || unset):
+			r.enable(o.option, set)
+		case named && !on:
+			status = 1
+
+			fallthrough
+		case named, !set && !unset, set == on:
+			if !quiet {
+				r.printShoptOption(o.name, on, setO, print)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// printShoptOption writes the state of an option for 'shopt'.
+func (r *Runner) printShoptOption(name string, on, setO, print bool) {
+	switch {
+	case !print:
+		fmt.Fprintf(r.stdout(), "%-15s\t%s\n", name, onOff(on))
+	case setO && on:
+		fmt.Fprintf(r.stdout(), "set -o %s\n", name)
+	case setO:
+		fmt.Fprintf(r.stdout(), "set +o %s\n", name)
+	case on:
+		fmt.Fprintf(r.stdout(), "shopt -s %s\n", name)
+	default:
+		fmt.Fprintf(r.stdout(), "shopt -u %s\n", name)
+	}
+}
+
+// builtinGetopts parses the options in the positional parameters, or in the
+// given arguments, one at a time, assigning each to the named variable.
+//
+// The index of the next argument to be parsed is kept in OPTIND, and the
+// argument of an option that takes one, as marked by a following ':' in the
+// option string, is assigned to OPTARG. An invalid option, or a missing
+// argument, is reported, and gives the option '?', unless the option string
+// starts with a ':', in which case nothing is reported, and the option is '?'
+// for an invalid option, or ':' for a missing argument, with OPTARG set to
+// the option character.
+//
+// The exit status is one once the options have been exhausted.
+func builtinGetopts(_ context.Context, r *Runner, args []string) (int, error) {
+	if len(args) < 3 {
+		return r.printUsage("getopts"), nil
+	}
+
+	optstring, name, params := args[1], args[2], r.Args
+
+	if !isName(name) {
+		r.errorf("getopts: `%s': not a valid identifier", name)
+
+		return 1, nil
+	} else if len(args) > 3 {
+		params = args[3:]
+	}
+
+	silent := strings.HasPrefix(optstring, ":")
+	optstring = strings.TrimPrefix(optstring, ":")
+	optind := 1
+
+	if v, ok := r.Get("OPTIND"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v.String())); err == nil && n > 0 {
+			optind = n
+		}
+	}
+
+	if optind != r.optIndex {
+		r.optChar = 0
+	}
+
+	if r.optChar == 0 {
+		if optind > len(params) || !strings.HasPrefix(params[optind-1], "-") || params[optind-1] == "-" {
+			return 1, r.getoptsResult(name, "?", optind, nil)
+		} else if params[optind-1] == "--" {
+			return 1, r.getoptsResult(name, "?", optind+1, nil)
+		}
+
+		r.optChar = 1
+	}
+
+	arg := params[optind-1]
+	c := arg[r.optChar]
+
+	if r.optChar++; r.optChar == len(arg) {
+		optind++
+		r.optChar = 0
+	}
+
+	pos := strings.IndexByte(optstring, c)
+
+	switch {
+	case c == ':' || pos < 0:
+		if silent {
+			optarg := string(c)
+
+			return 0, r.getoptsResult(name, "?", optind, &optarg)
+		}
+
+		fmt.Fprintf(r.stderr(), "%s: illegal option -- %c\n", r.Name, c)
+
+		return 0, r.getoptsResult(name, "?", optind, nil)
+	case pos+1 == len(optstring) || optstring[pos+1] != ':':
+		return 0, r.getoptsResult(name, string(c), optind, nil)
+	case r.optChar != 0:
+		optarg := arg[r.optChar:]
+		r.optChar = 0
+
+		return 0, r.getoptsResult(name, string(c), optind+1, &optarg)
+	case optind <= len(params):
+		return 0, r.getoptsResult(name, string(c), optind+1, &params[optind-1])
+	case silent:
+		optarg := string(c)
+
+		return 0, r.getoptsResult(name, ":", optind, &optarg)
+	}
+
+	fmt.Fprintf(r.stderr(), "%s: option requires an argument -- %c\n", r.Name, c)
+
+	return 0, r.getoptsResult(name, "?", optind, nil)
+}
+
+// getoptsResult assigns the results of 'getopts'; the option, OPTIND, and
+// OPTARG, which is unset when nil.
+func (r *Runner) getoptsResult(name, option string, optind int, optarg *string) error {
+	r.optIndex = optind
+
+	if err := r.Set("OPTIND", expand.Scalar(strconv.Itoa(optind))); err != nil {
+		return r.failed(err)
+	}
+
+	if optarg != nil {
+		if err := r.Set("OPTARG", expand.Scalar(*optarg)); err != nil {
+			return r.failed(err)
+		}
+	} else if level := r.scopeOf("OPTARG"); level >= 0 {
+		r.unsetVariable(level, "OPTARG")
+	}
+
+	if err := r.Set(name, expand.Scalar(option)); err != nil {
+		return r.failed(err)
+	}
+
+	return nil
+}
+
+// signals are the names of the signals that can be trapped, indexed by their
+// numbers, with zero for the EXIT condition.
+var signals = [...]string{
+	"EXIT", "HUP", "INT", "QUIT", "ILL", "TRAP", "ABRT", "BUS", "FPE", "KILL",
+	"USR1", "SEGV", "USR2", "PIPE", "ALRM", "TERM", "STKFLT", "CHLD", "CONT",
+	"STOP", "TSTP", "TTIN", "TTOU", "URG", "XCPU", "XFSZ", "VTALRM", "PROF",
+	"WINCH", "IO", "PWR", "SYS",
+}
+
+// conditions are the names of the traps that are run by the shell, rather
+// than for a signal, other than EXIT.
+var conditions = [...]string{"DEBUG", "ERR", "RETURN"}
+
+// builtinTrap sets the action to be run for each of the given signals or
+// conditions; an action of '-', or a lone signal, resets them, while an empty
+// action ignores them.
+//
+// Without an action, or with the -p option, the actions of the given signals,
+// or all that are set, are written in the form of the commands that would set
+// them. The -l option lists the names of the signals.
+func builtinTrap(_ context.Context, r *Runner, args []string) (int, error) {
+	opts, operands, status := r.parseOptions(args, "lp")
+	if status != 0 {
+		return status, nil
+	} else if _, ok := opts['l']; ok {
+		r.listSignals()
+
+		return 0, nil
+	}
+
+	if _, ok := opts['p']; ok || len(operands) == 0 {
+		return r.printTraps(operands), nil
+	}
+
+	action, specs := operands[0], operands[1:]
+
+	if len(operands) == 1 || isNumber(action) {
+		action, specs = "-", operands
+	}
+
+	for _, spec := range specs {
+		signal, ok := signalName(spec)
+		if !ok {
+			r.errorf("trap: %s: invalid signal specification", spec)
+
+			status = 1
+		} else if action == "-" {
+			delete(r.traps, signal)
+		} else {
+			r.traps[signal] = action
+		}
+	}
+
+	return status, nil
+}
+
+// signalName returns the name by which a trap is stored for a signal or
+// condition, given either by name, with or without a 'SIG' prefix, and in any
+// case, or by number.
+func signalName(spec string) (string, bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 0 || n >= len(signals) {
+			return "", false
+		}
+
+		return signals[n], true
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+
+	if slices.Contains(signals[:], name) || slices.Contains(conditions[:], name) {
+		return name, true
+	}
+
+	return "", false
+}
+
+// printTraps writes the actions of the given signals, or all that are set.
+func (r *Runner) printTraps(specs []string) int {
+	status := 0
+
+	if len(specs) == 0 {
+		specs = append(specs, signals[:]...)
+		specs = append(specs, conditions[:]...)
+	}
+
+	for _, spec := range specs {
+		signal, ok := signalName(spec)
+		if !ok {
+			r.errorf("trap: %s: invalid signal specification", spec)
+
+			status = 1
+
+			continue
+		}
+
+		action, ok := r.traps[signal]
+		if !ok {
+			continue
+		}
+
+		if signal != "EXIT" && !slices.Contains(conditions[:], signal) {
+			signal = "SIG" + signal
+		}
+
+		fmt.Fprintf(r.stdout(), "trap -- %s %s\n", expand.Quote(action), signal)
+	}
+
+	return status
+}
+
+// listSignals writes the numbers and names of the signals, five to a line.
+func (r *Runner) listSignals() {
+	var sb strings.Builder
+
+	for n, name := range signals[1:] {
+		if n%5 > 0 {
+			sb.WriteByte('\t')
+		}
+
+		fmt.Fprintf(&sb, "%2d) SIG%s", n+1, name)
+
+		if n%5 == 4 || n == len(signals)-2 {
+			sb.WriteByte('\n')
+		}
+	}
+
+	r.write("trap", sb.String())
+}
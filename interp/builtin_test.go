@@ -0,0 +1,758 @@
+package interp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type builtinCase struct {
+	Script string
+	Stdin  string
+	Args   []string
+	Stdout string
+	Stderr string
+	Status int
+}
+
+type testHandler struct{}
+
+func (testHandler) Exec(ctx context.Context, cmd *Command) (int, error) {
+	return testExec(ctx, cmd)
+}
+
+func (testHandler) LookPath(_ context.Context, cmd *Command) (string, error) {
+	switch cmd.Args[0] {
+	case "cat", "env", "status":
+		return "/usr/bin/" + cmd.Args[0], nil
+	}
+
+	return "", ErrNotFound
+}
+
+func testBuiltin(t *testing.T, tests []builtinCase) {
+	t.Helper()
+
+	for n, test := range tests {
+		var stdout, stderr strings.Builder
+
+		r := Runner{
+			Args:   test.Args,
+			Env:    []string{"HOME=/home/user", "PWD=/home/user", "PATH=/usr/bin"},
+			Stdin:  strings.NewReader(test.Stdin),
+			Stdout: &stdout,
+			Stderr: &stderr,
+			FS: fstest.MapFS{
+				"home/user/dir/file.txt": {Data: []byte("contents\n")},
+				"home/user/lib.sh":       {Data: []byte("echo sourced \"$@\"\nx=1\nreturn 3\necho unreached\n")},
+				"usr/bin/tool.sh":        {Data: []byte("echo tool $LINENO\n")},
+			},
+			Exec: testHandler{},
+		}
+
+		if status, err := r.RunString(context.Background(), test.Script); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		} else if out := stdout.String(); out != test.Stdout {
+			t.Errorf("test %d: expecting stdout %q, got %q", n+1, test.Stdout, out)
+		} else if errs := stderr.String(); errs != test.Stderr {
+			t.Errorf("test %d: expecting stderr %q, got %q", n+1, test.Stderr, errs)
+		}
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "declare -i x=3+4; echo $x; declare -p x",
+			Stdout: "7\ndeclare -i x=\"7\"\n",
+		},
+		{ // 2
+			Script: "declare -a a=(x y); a+=(z); declare -p a",
+			Stdout: "declare -a a=([0]=\"x\" [1]=\"y\" [2]=\"z\")\n",
+		},
+		{ // 3
+			Script: "declare -A m=([k]=v); m[l]=w; echo ${m[k]}${m[l]}",
+			Stdout: "vw\n",
+		},
+		{ // 4
+			Script: "declare -l lo=ABC; declare -u up=abc; echo $lo $up",
+			Stdout: "abc ABC\n",
+		},
+		{ // 5
+			Script: "f() { local x=1; echo $x; }; x=2; f; echo $x",
+			Stdout: "1\n2\n",
+		},
+		{ // 6
+			Script: "f() { local a=1 b; local; }; f",
+			Stdout: "declare -- a=\"1\"\ndeclare -- b\n",
+		},
+		{ // 7
+			Script: "local x",
+			Stderr: "bash: line 1: local: can only be used in a function\n",
+			Status: 1,
+		},
+		{ // 8
+			Script: "f() { local -n r=$1; r=9; }; f v; echo $v",
+			Stdout: "9\n",
+		},
+		{ // 9
+			Script: "f() { declare -g x=1; }; f; echo $x",
+			Stdout: "1\n",
+		},
+		{ // 10
+			Script: "export Z=5; env Z; declare -p Z; export -n Z; declare -p Z; env Z",
+			Stdout: "Z=5\ndeclare -x Z=\"5\"\ndeclare -- Z=\"5\"\nZ=\n",
+		},
+		{ // 11
+			Script: "readonly R=1; R=2; echo unreached",
+			Stderr: "bash: line 1: R: readonly variable\n",
+			Status: 1,
+		},
+		{ // 12
+			Script: "readonly R=1; declare R=2",
+			Stderr: "bash: line 1: declare: R: readonly variable\n",
+			Status: 1,
+		},
+		{ // 13
+			Script: "typeset -r T=1; readonly -p",
+			Stdout: "declare -r T=\"1\"\n",
+		},
+		{ // 14
+			Script: "declare 1x=1",
+			Stderr: "bash: line 1: declare: `1x=1': not a valid identifier\n",
+			Status: 1,
+		},
+		{ // 15
+			Script: "f() { :; }; declare -F; declare -f f",
+			Stdout: "declare -f f\nf () \n{\n\t:;\n}\n",
+		},
+		{ // 16
+			Script: "declare +Z",
+			Stderr: "bash: line 1: declare: +Z: invalid option\ndeclare: usage: declare [-aAfFgiIlnrtux] [name[=value] ...] or declare -p [-aAfFilnrtux] [name ...]\n",
+			Status: 2,
+		},
+		{ // 17
+			Script: "declare -n q=q",
+			Stderr: "bash: line 1: declare: q: nameref variable self references not allowed\n",
+			Status: 1,
+		},
+	})
+}
+
+func TestUnset(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "x=1; unset x; echo ${x-unset}",
+			Stdout: "unset\n",
+		},
+		{ // 2
+			Script: "f() { :; }; unset -f f; f",
+			Stderr: "bash: line 1: f: command not found\n",
+			Status: 127,
+		},
+		{ // 3
+			Script: "a=(1 2 3); unset 'a[1]'; echo ${a[@]} ${#a[@]}",
+			Stdout: "1 3 2\n",
+		},
+		{ // 4
+			Script: "x=1; f() { local x=2; unset x; echo ${x-unset}; }; f; echo $x",
+			Stdout: "unset\n1\n",
+		},
+		{ // 5
+			Script: "readonly r=1; unset r",
+			Stderr: "bash: line 1: unset: r: cannot unset: readonly variable\n",
+			Status: 1,
+		},
+		{ // 6
+			Script: "unset -v nope",
+		},
+	})
+}
+
+func TestLet(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "let x=2*3 y=x+1; echo $x $y",
+			Stdout: "6 7\n",
+		},
+		{ // 2
+			Script: "let 0",
+			Status: 1,
+		},
+		{ // 3
+			Script: "let",
+			Stderr: "bash: line 1: let: expression expected\n",
+			Status: 1,
+		},
+	})
+}
+
+func TestEcho(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "echo a  b",
+			Stdout: "a b\n",
+		},
+		{ // 2
+			Script: "echo -n a; echo -e 'b\\tc'; echo -E 'd\\te'",
+			Stdout: "ab\tc\nd\\te\n",
+		},
+		{ // 3
+			Script: "echo -e 'a\\cb'; echo -e '\\0101\\x42'",
+			Stdout: "aAB\n",
+		},
+		{ // 4
+			Script: "echo -x -",
+			Stdout: "-x -\n",
+		},
+	})
+}
+
+func TestPrintf(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "printf '%s-%d\\n' a 1 b 2",
+			Stdout: "a-1\nb-2\n",
+		},
+		{ // 2
+			Script: "printf -v v '%05.2f' 3.14159; echo $v",
+			Stdout: "03.14\n",
+		},
+		{ // 3
+			Script: "printf '%x %o %X %#x %u\\n' 255 8 255 255 -1",
+			Stdout: "ff 10 FF 0xff 18446744073709551615\n",
+		},
+		{ // 4
+			Script: "printf '%e %g %a\\n' 1234.5 0.0001 1",
+			Stdout: "1.234500e+03 0.0001 0x8p-3\n",
+		},
+		{ // 5
+			Script: "printf '%5s|%-5s|%.2s|%*d|\\n' ab cd efg 3 1",
+			Stdout: "   ab|cd   |ef|  1|\n",
+		},
+		{ // 6
+			Script: "printf '%c%c\\n' hello world",
+			Stdout: "hw\n",
+		},
+		{ // 7
+			Script: "printf '%b|%q\\n' 'a\\tb' 'c d'",
+			Stdout: "a\tb|c\\ d\n",
+		},
+		{ // 8
+			Script: "printf '%d\\n' \"'A\" 0x10 010",
+			Stdout: "65\n16\n8\n",
+		},
+		{ // 9
+			Script: "printf '%d\\n' 12abc",
+			Stdout: "12\n",
+			Stderr: "bash: line 1: printf: 12abc: invalid number\n",
+			Status: 1,
+		},
+		{ // 10
+			Script: "printf 'a%yb'",
+			Stdout: "a",
+			Stderr: "bash: line 1: printf: `y': invalid format character\n",
+			Status: 1,
+		},
+		{ // 11
+			Script: "printf '%(%Y)T\\n' 0",
+			Stdout: "1970\n",
+		},
+		{ // 12
+			Script: "printf",
+			Stderr: "printf: usage: printf [-v var] format [arguments]\n",
+			Status: 2,
+		},
+		{ // 13
+			Script: "printf '\\101\\x42\\c%%\\n'",
+			Stdout: "AB\\c%\n",
+		},
+	})
+}
+
+func TestRead(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "read a b; echo \"$a|$b\"",
+			Stdin:  "  one two  three  \n",
+			Stdout: "one|two  three\n",
+		},
+		{ // 2
+			Script: "read; echo \"[$REPLY]\"",
+			Stdin:  "  line  \n",
+			Stdout: "[  line  ]\n",
+		},
+		{ // 3
+			Script: "read x; echo $x; read -r y; echo $y",
+			Stdin:  "a\\b\\\nc\nd\\e\n",
+			Stdout: "abc\nd\\e\n",
+		},
+		{ // 4
+			Script: "IFS=: read -a arr; declare -p arr",
+			Stdin:  "x:y::z\n",
+			Stdout: "declare -a arr=([0]=\"x\" [1]=\"y\" [2]=\"\" [3]=\"z\")\n",
+		},
+		{ // 5
+			Script: "IFS=, read a b; echo \"[$a][$b]\"",
+			Stdin:  "p, q ,r\n",
+			Stdout: "[p][ q ,r]\n",
+		},
+		{ // 6
+			Script: "read -n 3 x; read -d , y; echo $x $y",
+			Stdin:  "abcdef,g",
+			Stdout: "abc def\n",
+		},
+		{ // 7
+			Script: "read -N 4 x; echo \"$x\"",
+			Stdin:  "a\nbcd",
+			Stdout: "a\nbc\n",
+		},
+		{ // 8
+			Script: "read x; echo $? $x",
+			Stdin:  "partial",
+			Stdout: "1 partial\n",
+		},
+		{ // 9
+			Script: "read -u 3 x",
+			Stderr: "bash: line 1: read: 3: invalid file descriptor: Bad file descriptor\n",
+			Status: 1,
+		},
+		{ // 10
+			Script: "read 1x",
+			Stderr: "bash: line 1: read: `1x': not a valid identifier\n",
+			Status: 1,
+		},
+	})
+}
+
+func TestMapfile(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "mapfile -t arr; declare -p arr",
+			Stdin:  "a\nb\nc\n",
+			Stdout: "declare -a arr=([0]=\"a\" [1]=\"b\" [2]=\"c\")\n",
+		},
+		{ // 2
+			Script: "readarray; echo \"${MAPFILE[1]}\"",
+			Stdin:  "a\nb\n",
+			Stdout: "b\n\n",
+		},
+		{ // 3
+			Script: "a=(x y z); mapfile -t -s 1 -n 1 -O 1 a; declare -p a",
+			Stdin:  "1\n2\n3\n",
+			Stdout: "declare -a a=([0]=\"x\" [1]=\"2\" [2]=\"z\")\n",
+		},
+		{ // 4
+			Script: "mapfile -t -d , -C 'echo cb' -c 2 arr; declare -p arr",
+			Stdin:  "p,q,r",
+			Stdout: "cb 1 q\ndeclare -a arr=([0]=\"p\" [1]=\"q\" [2]=\"r\")\n",
+		},
+	})
+}
+
+func TestTest(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "test 1 -lt 2 && [ a = a ] && echo yes",
+			Stdout: "yes\n",
+		},
+		{ // 2
+			Script: "[ -f dir/file.txt ] && [ -d dir ] && [ ! -e nope ]",
+		},
+		{ // 3
+			Script: "[ 1 -eq 2 ]",
+			Status: 1,
+		},
+		{ // 4
+			Script: "[ a = a",
+			Stderr: "bash: line 1: [: missing `]'\n",
+			Status: 2,
+		},
+		{ // 5
+			Script: "test 1 -eq a",
+			Stderr: "bash: line 1: test: a: integer expression expected\n",
+			Status: 2,
+		},
+		{ // 6
+			Script: "test; test ''",
+			Status: 1,
+		},
+	})
+}
+
+func TestShift(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "shift; echo $@; shift 2; echo $@",
+			Args:   []string{"a", "b", "c", "d"},
+			Stdout: "b c d\nd\n",
+		},
+		{ // 2
+			Script: "shift 2",
+			Args:   []string{"a"},
+			Status: 1,
+		},
+		{ // 3
+			Script: "shift x",
+			Stderr: "bash: line 1: shift: x: numeric argument required\n",
+			Status: 1,
+		},
+	})
+}
+
+func TestSet(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "set -- a b; echo $# $@; set --; echo $#",
+			Stdout: "2 a b\n0\n",
+		},
+		{ // 2
+			Script: "set -eu -o pipefail; echo $-; set +eu; echo $-",
+			Stdout: "ehuB\nhB\n",
+		},
+		{ // 3
+			Script: "set -o pipefail; set +o",
+			Stdout: "set +o allexport\nset +o errexit\nset +o errtrace\nset +o noclobber\nset +o noexec\nset +o noglob\nset +o nounset\nset -o pipefail\nset +o xtrace\n",
+		},
+		{ // 4
+			Script: "set -f x y; echo *; echo $1",
+			Stdout: "*\nx\n",
+		},
+		{ // 5
+			Script: "set -e; false; echo unreached",
+			Status: 1,
+		},
+		{ // 6
+			Script: "set -Z",
+			Stderr: "bash: line 1: set: -Z: invalid option\nset: usage: set [-abefhkmnptuvxBCEHPT] [-o option-name] [--] [-] [arg ...]\n",
+			Status: 2,
+		},
+		{ // 7
+			Script: "set -o nope",
+			Stderr: "bash: line 1: set: nope: invalid option name\nset: usage: set [-abefhkmnptuvxBCEHPT] [-o option-name] [--] [-] [arg ...]\n",
+			Status: 2,
+		},
+	})
+}
+
+func TestShopt(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "shopt -s extglob; shopt extglob; shopt -p extglob nullglob",
+			Stdout: "extglob        \ton\nshopt -s extglob\nshopt -u nullglob\n",
+			Status: 1,
+		},
+		{ // 2
+			Script: "shopt -s nullglob dotglob; shopt -s",
+			Stdout: "dotglob        \ton\nnullglob       \ton\n",
+		},
+		{ // 3
+			Script: "shopt -q extglob || echo off",
+			Stdout: "off\n",
+		},
+		{ // 4
+			Script: "shopt -so pipefail; shopt -o pipefail; shopt -po pipefail",
+			Stdout: "pipefail       \ton\nset -o pipefail\n",
+		},
+		{ // 5
+			Script: "shopt -u nope",
+			Stderr: "bash: line 1: shopt: nope: invalid shell option name\n",
+			Status: 1,
+		},
+		{ // 6
+			Script: "shopt -s -u extglob",
+			Stderr: "bash: line 1: shopt: cannot set and unset shell options simultaneously\n",
+			Status: 1,
+		},
+	})
+}
+
+func TestGetopts(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "while getopts ab:c o; do echo $o ${OPTARG-unset}; done; echo $OPTIND",
+			Args:   []string{"-a", "-b", "foo", "-cbbar", "rest"},
+			Stdout: "a unset\nb foo\nc unset\nb bar\n5\n",
+		},
+		{ // 2
+			Script: "getopts a o -x; echo $o ${OPTARG-unset}",
+			Stdout: "? unset\n",
+			Stderr: "bash: illegal option -- x\n",
+		},
+		{ // 3
+			Script: "getopts :a: o -x; echo $o $OPTARG; OPTIND=1; getopts :a: o -a; echo $o $OPTARG",
+			Stdout: "? x\n: a\n",
+		},
+		{ // 4
+			Script: "getopts a o -- -a; echo $? $o $OPTIND",
+			Stdout: "1 ? 2\n",
+		},
+		{ // 5
+			Script: "getopts ab o -ab; echo $o $OPTIND; getopts ab o -ab; echo $o $OPTIND",
+			Stdout: "a 1\nb 2\n",
+		},
+		{ // 6
+			Script: "getopts",
+			Stderr: "getopts: usage: getopts optstring name [arg ...]\n",
+			Status: 2,
+		},
+	})
+}
+
+func TestCd(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "cd dir; pwd; echo $OLDPWD; cd ..; pwd",
+			Stdout: "/home/user/dir\n/home/user\n/home/user\n",
+		},
+		{ // 2
+			Script: "cd /; cd; pwd; cd -",
+			Stdout: "/home/user\n/\n",
+		},
+		{ // 3
+			Script: "cd nope",
+			Stderr: "bash: line 1: cd: nope: No such file or directory\n",
+			Status: 1,
+		},
+		{ // 4
+			Script: "cd dir/file.txt",
+			Stderr: "bash: line 1: cd: dir/file.txt: Not a directory\n",
+			Status: 1,
+		},
+		{ // 5
+			Script: "CDPATH=/home/user; cd /; cd dir",
+			Stdout: "/home/user/dir\n",
+		},
+		{ // 6
+			Script: "cd dir; env PWD",
+			Stdout: "PWD=/home/user/dir\n",
+		},
+		{ // 7
+			Script: "cd a b",
+			Stderr: "bash: line 1: cd: too many arguments\n",
+			Status: 1,
+		},
+	})
+}
+
+func TestReturn(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "f() { return 3; echo unreached; }; f; echo $?",
+			Stdout: "3\n",
+		},
+		{ // 2
+			Script: "f() { false; return; }; f",
+			Status: 1,
+		},
+		{ // 3
+			Script: "return; echo $?",
+			Stdout: "2\n",
+			Stderr: "bash: line 1: return: can only `return' from a function or sourced script\n",
+		},
+		{ // 4
+			Script: "f() { return x; }; f",
+			Stderr: "bash: line 1: return: x: numeric argument required\n",
+			Status: 2,
+		},
+	})
+}
+
+func TestExit(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "exit 7; echo unreached",
+			Status: 7,
+		},
+		{ // 2
+			Script: "(exit 4); echo $?",
+			Stdout: "4\n",
+		},
+		{ // 3
+			Script: "false; exit",
+			Status: 1,
+		},
+		{ // 4
+			Script: "exit x",
+			Stderr: "bash: line 1: exit: x: numeric argument required\n",
+			Status: 2,
+		},
+	})
+}
+
+func TestEval(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "eval 'x=5; echo $((x+1))'; echo $x",
+			Stdout: "6\n5\n",
+		},
+		{ // 2
+			Script: "eval 'false'",
+			Status: 1,
+		},
+		{ // 3
+			Script: "\n\neval 'echo $LINENO\necho $LINENO'",
+			Stdout: "3\n4\n",
+		},
+		{ // 4
+			Script: "eval 'if'; echo $?",
+			Stdout: "2\n",
+			Stderr: "bash: line 1: eval: Tokens: error at position 3 (1:3):\nunexpected EOF\n",
+		},
+	})
+}
+
+func TestSource(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "source ./lib.sh a b; echo $? $x",
+			Stdout: "sourced a b\n3 1\n",
+		},
+		{ // 2
+			Script: ". tool.sh",
+			Stdout: "tool 1\n",
+		},
+		{ // 3
+			Script: "source nope.sh",
+			Stderr: "bash: line 1: nope.sh: No such file or directory\n",
+			Status: 1,
+		},
+		{ // 4
+			Script: "source",
+			Stderr: "bash: line 1: source: filename argument required\nsource: usage: source filename [arguments]\n",
+			Status: 2,
+		},
+	})
+}
+
+func TestTrap(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "trap 'echo bye' EXIT; echo hi",
+			Stdout: "hi\nbye\n",
+		},
+		{ // 2
+			Script: "trap 'echo int' INT; trap '' 15; trap -p",
+			Stdout: "trap -- 'echo int' SIGINT\ntrap -- '' SIGTERM\n",
+		},
+		{ // 3
+			Script: "trap 'echo x' EXIT; trap - EXIT; trap -p EXIT",
+		},
+		{ // 4
+			Script: "trap 'echo e' ERR; false; true",
+			Stdout: "e\n",
+		},
+		{ // 5
+			Script: "trap -l",
+			Stdout: " 1) SIGHUP\t 2) SIGINT\t 3) SIGQUIT\t 4) SIGILL\t 5) SIGTRAP\n 6) SIGABRT\t 7) SIGBUS\t 8) SIGFPE\t 9) SIGKILL\t10) SIGUSR1\n11) SIGSEGV\t12) SIGUSR2\t13) SIGPIPE\t14) SIGALRM\t15) SIGTERM\n16) SIGSTKFLT\t17) SIGCHLD\t18) SIGCONT\t19) SIGSTOP\t20) SIGTSTP\n21) SIGTTIN\t22) SIGTTOU\t23) SIGURG\t24) SIGXCPU\t25) SIGXFSZ\n26) SIGVTALRM\t27) SIGPROF\t28) SIGWINCH\t29) SIGIO\t30) SIGPWR\n31) SIGSYS\n",
+		},
+		{ // 6
+			Script: "trap 'echo x' NOPE",
+			Stderr: "bash: line 1: trap: NOPE: invalid signal specification\n",
+			Status: 1,
+		},
+		{ // 7
+			Script: "trap 'echo e' ERR; if false; then :; fi; false && :; false || :; ! false; while false; do :; done; until true; do :; done; echo end",
+			Stdout: "end\n",
+		},
+		{ // 8
+			Script: "trap 'echo e' ERR; f() { false; echo f; }; f; set -E; f",
+			Stdout: "f\ne\nf\n",
+		},
+		{ // 9
+			Script: "trap 'echo e' ERR; (false); x=$(false); echo $x end",
+			Stdout: "e\ne\nend\n",
+		},
+		{ // 10
+			Script: "set -e; trap 'echo e' ERR; false; echo unreached",
+			Stdout: "e\n",
+			Status: 1,
+		},
+		{ // 11
+			Script: "trap 'echo \"dbg $x\"' DEBUG; x=1; f() { echo f; }; f; for i in 1; do :; done; trap - DEBUG",
+			Stdout: "dbg \ndbg 1\nf\ndbg 1\ndbg 1\ndbg 1\n",
+		},
+		{ // 12
+			Script: "trap 'echo ret' RETURN; f() { echo f; }; f; . ./lib.sh a; echo $?",
+			Stdout: "f\nsourced a\nret\n3\n",
+		},
+		{ // 13
+			Script: "f() { trap 'echo ret $FUNCNAME' RETURN; echo f; }; g() { echo g; }; f; g; trap -p RETURN",
+			Stdout: "f\nret f\ng\ntrap -- 'echo ret $FUNCNAME' RETURN\n",
+		},
+		{ // 14
+			Script: "trap 'echo ret' RETURN; f() { . ./lib.sh; }; f; echo $?",
+			Stdout: "sourced\n3\n",
+		},
+		{ // 15
+			Script: "trap 'echo e' ERR; { false; }; if true; then false; fi; for i in 1; do false; done",
+			Stdout: "e\ne\ne\n",
+			Status: 1,
+		},
+		{ // 16
+			Script: "trap ': a' DEBUG; false | true b; echo ${PIPESTATUS[@]} $_",
+			Stdout: "1 0 a\n",
+		},
+		{ // 17
+			Script: "trap 'echo \"ERR at $LINENO: $BASH_COMMAND\"' ERR\n\nfalse  x\n[[ a == b ]]\nf() {\n\treturn 2\n}\nf",
+			Stdout: "ERR at 3: false x\nERR at 4: [[ a == b ]]\nERR at 8: return 2\n",
+			Status: 2,
+		},
+		{ // 18
+			Script: "trap 'echo \"[$LINENO] $BASH_COMMAND\"' DEBUG\nx=1 y=2\n((  x  + 1 ))\ncase $x in 1) : ;; esac\nfor i in a; do :; done\nfor (( i = 0 ; i < 1 ; i++ )); do :; done",
+			Stdout: "[2] x=1 y=2\n[3] ((  x  + 1 ))\n[4] case $x in \n[4] :\n[5] for i in a\n[5] :\n[6] ((i = 0 ))\n[6] ((i < 1 ))\n[6] :\n[6] ((i++ ))\n[6] ((i < 1 ))\n",
+		},
+		{ // 19
+			Script: "trap 'echo \"$LINENO $BASH_COMMAND\"' EXIT\necho a\n\nexit 3",
+			Stdout: "a\n1 exit 3\n",
+			Status: 3,
+		},
+	})
+}
+
+func TestType(t *testing.T) {
+	testBuiltin(t, []builtinCase{
+		{ // 1
+			Script: "f() { :; }; type if f echo cat",
+			Stdout: "if is a shell keyword\nf is a function\nf () \n{\n\t:;\n}\necho is a shell builtin\ncat is /usr/bin/cat\n",
+		},
+		{ // 2
+			Script: "f() { :; }; type -t if f echo cat",
+			Stdout: "keyword\nfunction\nbuiltin\nfile\n",
+		},
+		{ // 3
+			Script: "type -p echo cat; type -P env",
+			Stdout: "/usr/bin/cat\n/usr/bin/env\n",
+		},
+		{ // 4
+			Script: "type nope; type -t nope",
+			Stderr: "bash: line 1: type: nope: not found\n",
+			Status: 1,
+		},
+		{ // 5
+			Script: "f() { echo f; }; command -v f echo cat nope",
+			Stdout: "f\necho\n/usr/bin/cat\n",
+		},
+		{ // 6
+			Script: "command -V echo nope",
+			Stdout: "echo is a shell builtin\n",
+			Stderr: "bash: line 1: command: nope: not found\n",
+		},
+		{ // 7
+			Script: "cat() { echo function; }; command cat",
+			Stdin:  "stdin\n",
+			Stdout: "stdin\n",
+		},
+		{ // 8
+			Script: "echo() { :; }; command echo builtin",
+			Stdout: "builtin\n",
+		},
+		{ // 9
+			Script: "x=1 command env x",
+			Stdout: "x=1\n",
+		},
+	})
+}
@@ -0,0 +1,205 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// keywords are the reserved words of the shell, as reported by 'type'.
+var keywords = [...]string{
+	"if", "then", "else", "elif", "fi", "case", "esac", "for", "select",
+	"while", "until", "do", "done", "in", "function", "time", "{", "}", "!",
+	"[[", "]]", "coproc",
+}
+
+// commandKind is the kind of command a name refers to.
+type commandKind uint8
+
+const (
+	kindKeyword commandKind = iota
+	kindFunction
+	kindBuiltin
+	kindFile
+)
+
+// commandKinds are the names of each commandKind, as printed by 'type -t'.
+var commandKinds = [...]string{"keyword", "function", "builtin", "file"}
+
+// resolved is a command found by commandsOf.
+type resolved struct {
+	kind commandKind
+	path string
+}
+
+// commandsOf returns each of the commands that a name refers to, in the order in
+// which they are chosen, limited to external commands when files is true,
+// and excluding functions when noFuncs is true.
+//
+// When all is false, only the first is returned.
+func (r *Runner) commandsOf(ctx context.Context, name string, all, files, noFuncs bool) []resolved {
+	var found []resolved
+
+	if !files {
+		if slices.Contains(keywords[:], name) {
+			found = append(found, resolved{kind: kindKeyword})
+		}
+
+		if _, ok := r.funcs[name]; ok && !noFuncs {
+			found = append(found, resolved{kind: kindFunction})
+		}
+
+		if _, ok := builtins[name]; ok {
+			found = append(found, resolved{kind: kindBuiltin})
+		}
+
+		if len(found) > 0 && !all {
+			return found[:1]
+		}
+	}
+
+	if path, ok := r.lookPath(ctx, name); ok {
+		found = append(found, resolved{kind: kindFile, path: path})
+	}
+
+	return found
+}
+
+// lookPath finds the path of an external command with the ExecHandler, if it
+// implements the PathHandler interface.
+func (r *Runner) lookPath(ctx context.Context, name string) (string, bool) {
+	ph, ok := r.Exec.(PathHandler)
+	if !ok {
+		return "", false
+	}
+
+	path, err := ph.LookPath(ctx, &Command{Args: []string{name}, Env: r.environ(), Dir: r.Dir})
+
+	return path, err == nil
+}
+
+// builtinType describes how each of the given names would be interpreted when
+// used as a command; as a keyword, function, builtin, or external command.
+//
+// The -t option prints only the kind of command, and the -p option the path of
+// an external command, with the -P option searching for one even when the
+// name would be interpreted otherwise. The -a option describes all of the
+// commands a name could refer to, rather than only the one that would be
+// chosen, and -f excludes functions.
+//
+// External commands are found only when the ExecHandler implements the
+// PathHandler interface.
+//
+// The exit status is one if any of the names could not be found.
+func builtinType(ctx context.Context, r *Runner, args []string) (int, error) {
+	opts, names, status := r.parseOptions(args, "afptP")
+	if status != 0 {
+		return status, nil
+	}
+
+	_, all := opts['a']
+	_, noFuncs := opts['f']
+	_, path := opts['p']
+	_, kind := opts['t']
+	_, forcePath := opts['P']
+
+	for _, name := range names {
+		found := r.commandsOf(ctx, name, all, forcePath, noFuncs)
+		if len(found) == 0 {
+			if !kind && !path && !forcePath {
+				r.errorf("type: %s: not found", name)
+			}
+
+			status = 1
+
+			continue
+		}
+
+		for _, f := range found {
+			switch {
+			case kind:
+				fmt.Fprintln(r.stdout(), commandKinds[f.kind])
+			case path || forcePath:
+				if f.kind == kindFile {
+					fmt.Fprintln(r.stdout(), f.path)
+				}
+			default:
+				r.describe(name, f)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// describe writes the description of a command, as printed by 'type' and
+// 'command -V'.
+func (r *Runner) describe(name string, f resolved) {
+	switch f.kind {
+	case kindKeyword:
+		fmt.Fprintf(r.stdout(), "%s is a shell keyword\n", name)
+	case kindFunction:
+		fmt.Fprintf(r.stdout(), "%s is a function\n", name)
+		printFunction(r.stdout(), name, r.funcs[name])
+	case kindBuiltin:
+		fmt.Fprintf(r.stdout(), "%s is a shell builtin\n", name)
+	default:
+		fmt.Fprintf(r.stdout(), "%s is %s\n", name, f.path)
+	}
+}
+
+// builtinCommand runs a command, ignoring any function of the same name.
+//
+// With the -v option, the command is not run, and instead the name of each of
+// the given commands is printed, or its path, for an external command; the -V
+// option describes each, as with 'type'. The exit status is then one if none
+// of the commands could be found.
+//
+// The -p option is accepted, but has no effect, as commands are always found
+// with the PATH variable of the shell.
+func builtinCommand(ctx context.Context, r *Runner, args []string) (int, error) {
+	opts, operands, status := r.parseOptions(args, "pvV")
+	if status != 0 || len(operands) == 0 {
+		return status, nil
+	}
+
+	_, short := opts['v']
+	_, verbose := opts['V']
+
+	if !short && !verbose {
+		if b, ok := builtins[operands[0]]; ok {
+			return b(ctx, r, operands)
+		}
+
+		if err := r.exec(ctx, operands, r.scopes[len(r.scopes)-1]); err != nil {
+			return r.status, err
+		}
+
+		return r.status, nil
+	}
+
+	status = 1
+
+	for _, name := range operands {
+		found := r.commandsOf(ctx, name, false, false, false)
+
+		switch {
+		case len(found) == 0:
+			if verbose {
+				r.errorf("command: %s: not found", name)
+			}
+
+			continue
+		case verbose:
+			r.describe(name, found[0])
+		case found[0].kind == kindFile:
+			fmt.Fprintln(r.stdout(), found[0].path)
+		default:
+			fmt.Fprintln(r.stdout(), name)
+		}
+
+		status = 0
+	}
+
+	return status, nil
+}
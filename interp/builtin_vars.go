@@ -0,0 +1,653 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+// declarationOptions are the options accepted by each of the declaration
+// builtins.
+var declarationOptions = map[string]string{
+	"declare":  "aAfFgiIlnprtux",
+	"typeset":  "aAfFgiIlnprtux",
+	"local":    "aAfFiIlnprtux",
+	"export":   "fnp",
+	"readonly": "aAfp",
+}
+
+// declaration holds the options given to a declaration builtin; the attributes
+// to set and to clear, and the other options that change its behaviour.
+type declaration struct {
+	name      string
+	set       attributes.Attribute
+	clear     attributes.Attribute
+	funcs     bool
+	funcNames bool
+	global    bool
+	print     bool
+}
+
+// builtinDeclare implements the 'declare' and 'typeset' builtins, along with
+// 'local', 'export', and 'readonly', which set the values and attributes of
+// variables, or print them.
+//
+// Within a function, 'declare' and 'local' declare variables local to the
+// function, unless the -g option is given, while 'export' and 'readonly' act
+// on the variable that is visible.
+func builtinDeclare(ctx context.Context, r *Runner, args []string) (int, error) {
+	d, operands, status := r.parseDeclaration(args)
+	if status != 0 {
+		return status, nil
+	} else if d.name == "local" && r.locals == 0 {
+		r.errorf("local: can only be used in a function")
+
+		return 1, nil
+	}
+
+	switch {
+	case d.funcs:
+		return r.declareFunctions(d, operands), nil
+	case len(operands) == 0:
+		r.listDeclarations(d)
+
+		return 0, nil
+	case d.print:
+		return r.printDeclarations(d, operands), nil
+	}
+
+	for _, arg := range operands {
+		s, err := r.declare(ctx, d, arg)
+		if err != nil {
+			return s, err
+		} else if s != 0 {
+			status = s
+		}
+	}
+
+	return status, nil
+}
+
+// parseDeclaration parses the options of a declaration builtin, of which those
+// starting with a '+', rather than a '-', clear attributes instead of setting
+// them.
+func (r *Runner) parseDeclaration(args []string) (*declaration, []string, int) {
+	d := &declaration{name: args[0]}
+	spec := declarationOptions[d.name]
+
+	switch d.name {
+	case "export":
+		d.set = attributes.Exported
+	case "readonly":
+		d.set = attributes.Readonly
+	}
+
+	n := 1
+
+	for ; n < len(args); n++ {
+		arg := args[n]
+
+		if arg == "--" {
+			n++
+
+			break
+		} else if len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			break
+		}
+
+		for _, c := range arg[1:] {
+			if !strings.ContainsRune(spec, c) {
+				return nil, nil, r.usage(d.name, arg[:1]+string(c)+": invalid option")
+			}
+
+			switch c {
+			case 'f':
+				d.funcs = true
+			case 'F':
+				d.funcs, d.funcNames = true, true
+			case 'g':
+				d.global = true
+			case 'p':
+				d.print = true
+			case 'I', 't':
+			default:
+				a, set := attributes.Parse(string(c)), arg[0] == '-'
+
+				if d.name == "export" && c == 'n' {
+					a, set = attributes.Exported, !set
+				}
+
+				if set {
+					d.set |= a
+					d.clear &^= a
+				} else {
+					d.clear |= a
+					d.set &^= a
+				}
+			}
+		}
+	}
+
+	return d, args[n:], 0
+}
+
+// declare declares a single variable, given in the form 'name', 'name=value',
+// 'name+=value', or 'name=(...)', with the given attributes.
+func (r *Runner) declare(ctx context.Context, d *declaration, arg string) (int, error) {
+	name, value, hasValue := strings.Cut(arg, "=")
+	name, appending := strings.CutSuffix(name, "+")
+	base, _, keyed := splitSubscript(name)
+
+	if !isName(base) || keyed && !strings.HasSuffix(name, "]") || appending && !hasValue {
+		r.errorf("%s: `%s': not a valid identifier", d.name, arg)
+
+		return 1, nil
+	}
+
+	level := r.declarationScope(d, base)
+	s := r.scopes[level]
+	old, exists := s[base]
+
+	if exists && !old.unset && old.Attributes.Has(attributes.Nameref) && (d.set|d.clear)&attributes.Nameref == 0 {
+		if target, err := r.resolve(base); err == nil && target != base && !keyed {
+			return r.declare(ctx, d, target+arg[len(base):])
+		}
+	}
+
+	if old.Attributes.Has(attributes.Readonly) && (hasValue || d.set&^(attributes.Readonly|attributes.Exported) != 0 || d.clear != 0) {
+		r.errorf("%s: %s: readonly variable", d.name, base)
+
+		return 1, nil
+	}
+
+	switch {
+	case old.Attributes.Has(attributes.Associative) && d.set.Has(attributes.Indexed):
+		r.errorf("%s: %s: cannot convert associative to indexed array", d.name, base)
+
+		return 1, nil
+	case old.Attributes.Has(attributes.Indexed) && d.set.Has(attributes.Associative):
+		r.errorf("%s: %s: cannot convert indexed to associative array", d.name, base)
+
+		return 1, nil
+	case old.Attributes&d.clear&(attributes.Indexed|attributes.Associative) != 0:
+		r.errorf("%s: %s: cannot destroy array variables in this way", d.name, base)
+
+		return 1, nil
+	}
+
+	v := old.Variable
+	v.Attributes = (v.Attributes | d.set) &^ d.clear &^ attributes.Readonly
+
+	if d.set.Has(attributes.Lowercase) {
+		v.Attributes &^= attributes.Uppercase
+	} else if d.set.Has(attributes.Uppercase) {
+		v.Attributes &^= attributes.Lowercase
+	}
+
+	if keyed && !v.Attributes.IsArray() {
+		v.Attributes |= attributes.Indexed
+	}
+
+	unset := !exists || old.unset
+
+	switch {
+	case old.Attributes.IsArray() || !v.Attributes.IsArray():
+	case unset:
+		v.Value = ""
+	case v.Attributes.Has(attributes.Associative):
+		v.Map, v.Value = map[string]string{"0": v.Value}, ""
+	default:
+		v.Array, v.Value = map[int]string{0: v.Value}, ""
+	}
+
+	if v.Attributes.Has(attributes.Nameref) && hasValue {
+		if value == base {
+			r.errorf("%s: %s: nameref variable self references not allowed", d.name, base)
+
+			return 1, nil
+		}
+
+		v.Value, unset, hasValue = value, false, false
+	}
+
+	s[base] = variable{Variable: v, unset: unset}
+
+	if hasValue {
+		defer r.truncateScopes(level)()
+
+		var err error
+
+		if elems, ok := r.arrayValue(ctx, value); ok && !keyed {
+			err = r.assignArray(base, elems, appending)
+		} else {
+			err = r.assignScalar(name, value, appending)
+		}
+
+		if err != nil {
+			r.errorf("%s: %s", d.name, err)
+
+			return 1, errDiscard
+		}
+	}
+
+	if d.set.Has(attributes.Readonly) {
+		v := s[base]
+		v.Attributes |= attributes.Readonly
+		s[base] = v
+	}
+
+	return 0, nil
+}
+
+// declarationScope returns the index of the scope in which a variable is to be
+// declared.
+func (r *Runner) declarationScope(d *declaration, name string) int {
+	switch {
+	case d.global:
+		return 0
+	case d.name == "export" || d.name == "readonly":
+		for n := r.locals; n > 0; n-- {
+			if _, ok := r.scopes[n][name]; ok {
+				return n
+			}
+		}
+
+		return 0
+	}
+
+	return r.locals
+}
+
+// truncateScopes removes the scopes inside the given scope, so that variables
+// are assigned within it, returning a function that restores them.
+func (r *Runner) truncateScopes(level int) func() {
+	scopes := r.scopes
+	r.scopes = r.scopes[:level+1]
+
+	return func() {
+		r.scopes = scopes
+	}
+}
+
+// arrayValue parses the elements of an array value, in the form '(...)', as
+// given to a declaration builtin.
+func (r *Runner) arrayValue(ctx context.Context, value string) ([]element, bool) {
+	if !strings.HasPrefix(value, "(") || !strings.HasSuffix(value, ")") {
+		return nil, false
+	}
+
+	tk := parser.NewStringTokeniser("a=" + value)
+
+	f, err := bash.Parse(&tk)
+	if err != nil || len(f.Lines) != 1 || len(f.Lines[0].Statements) != 1 {
+		return nil, false
+	}
+
+	c := f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command
+	if c == nil || len(c.Vars) != 1 || len(c.AssignmentsOrWords) != 0 || c.Vars[0].Value == nil || c.Vars[0].Value.Word != nil {
+		return nil, false
+	}
+
+	elems, err := r.elements(r.expander(ctx), c.Vars[0].Value.Array)
+	if err != nil {
+		return nil, false
+	}
+
+	return elems, true
+}
+
+// isName determines whether a string is a valid variable name.
+func isName(s string) bool {
+	for n, c := range s {
+		if c != '_' && !unicode.IsLetter(c) && (n == 0 || !unicode.IsDigit(c)) || c > unicode.MaxASCII {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// declareFunctions implements the -f and -F options of the declaration
+// builtins, printing the definitions, or names, of the given functions, or of
+// all functions.
+//
+// With 'export' and 'readonly', the functions are only checked to exist, as
+// neither attribute is kept for functions.
+func (r *Runner) declareFunctions(d *declaration, names []string) int {
+	modify := d.name == "export" || d.name == "readonly"
+	status := 0
+
+	if len(names) == 0 {
+		if modify {
+			return 0
+		}
+
+		names = slices.Sorted(maps.Keys(r.funcs))
+	}
+
+	for _, name := range names {
+		body, ok := r.funcs[name]
+
+		switch {
+		case !ok:
+			if modify {
+				r.errorf("%s: %s: not a function", d.name, name)
+			}
+
+			status = 1
+		case modify:
+		case d.funcNames:
+			fmt.Fprintf(r.stdout(), "declare -f %s\n", name)
+		default:
+			printFunction(r.stdout(), name, body)
+		}
+	}
+
+	return status
+}
+
+// printFunction writes the definition of a function.
+func printFunction(w io.Writer, name string, body *bash.Compound) {
+	fmt.Fprintf(w, "%s () \n%+s\n", name, body)
+}
+
+// listDeclarations implements a declaration builtin given no names; 'declare'
+// and 'typeset', without options, list all variables and functions as with
+// 'set', while the others print the declarations of the variables that have
+// the given attributes.
+//
+// For 'local', only the variables local to the current function are printed.
+func (r *Runner) listDeclarations(d *declaration) {
+	if (d.name == "declare" || d.name == "typeset") && d.set == 0 && d.clear == 0 && !d.print {
+		r.listVariables()
+
+		return
+	}
+
+	scopes := r.scopes
+
+	if d.name == "local" {
+		scopes = scopes[r.locals : r.locals+1]
+	}
+
+	vars := make(map[string]variable)
+
+	for _, s := range scopes {
+		maps.Copy(vars, s)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		if v := vars[name]; v.Attributes.Has(d.set) {
+			fmt.Fprintln(r.stdout(), declarationString(name, v))
+		}
+	}
+}
+
+// printDeclarations prints the declarations of the named variables.
+func (r *Runner) printDeclarations(d *declaration, names []string) int {
+	status := 0
+
+	for _, name := range names {
+		if _, v, ok := r.lookup(name); ok {
+			fmt.Fprintln(r.stdout(), declarationString(name, v))
+		} else {
+			r.errorf("%s: %s: not found", d.name, name)
+
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// listVariables writes all set variables, in the form 'name=value', followed by
+// the definitions of all functions, as listed by 'set' without arguments.
+func (r *Runner) listVariables() {
+	w := r.stdout()
+
+	for _, name := range r.Names() {
+		_, v, _ := r.lookup(name)
+
+		if v.Attributes.IsArray() {
+			fmt.Fprintf(w, "%s=%s\n", name, arrayDeclaration(v.Variable))
+		} else if v.Value == "" {
+			fmt.Fprintf(w, "%s=\n", name)
+		} else {
+			fmt.Fprintf(w, "%s=%s\n", name, traceQuote(v.Value))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(r.funcs)) {
+		printFunction(w, name, r.funcs[name])
+	}
+}
+
+// declarationString returns the 'declare' command that would recreate a
+// variable, as printed by 'declare -p'.
+func declarationString(name string, v variable) string {
+	decl := "declare " + v.Attributes.String() + " " + name
+
+	switch {
+	case v.unset:
+		return decl
+	case v.Attributes.IsArray():
+		return decl + "=" + arrayDeclaration(v.Variable)
+	}
+
+	return decl + "=" + declarationQuote(v.Value)
+}
+
+// arrayDeclaration returns the elements of an array in the form '(...)', as
+// printed by 'declare -p'.
+func arrayDeclaration(v expand.Variable) string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+
+	associative := v.Attributes.Has(attributes.Associative)
+
+	for n, key := range v.Keys() {
+		value, _ := v.Index(key)
+
+		if associative && strings.ContainsAny(key, " \t\n\"'\\$`;&|<>()[]*?") {
+			key = declarationQuote(key)
+		} else if n > 0 && !associative {
+			sb.WriteByte(' ')
+		}
+
+		sb.WriteString("[" + key + "]=" + declarationQuote(value))
+
+		if associative {
+			sb.WriteByte(' ')
+		}
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// declarationQuote quotes a value as printed by 'declare -p'; in double quotes,
+// unless it contains non-printable characters, in which case ANSI-C quoting is
+// used.
+func declarationQuote(s string) string {
+	if strings.ContainsFunc(s, func(c rune) bool { return !unicode.IsPrint(c) }) {
+		return expand.Quote(s)
+	}
+
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+
+	for _, c := range s {
+		if strings.ContainsRune("\"\\$`", c) {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(c)
+	}
+
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+// builtinUnset unsets variables, or functions with the -f option; a name that
+// is not a variable is taken as a function, unless the -v option is given.
+//
+// A nameref is followed to the variable it refers to, unless the -n option is
+// given, and a name with a subscript unsets an element of an array.
+func builtinUnset(_ context.Context, r *Runner, args []string) (int, error) {
+	opts, names, status := r.parseOptions(args, "fvn")
+	if status != 0 {
+		return status, nil
+	}
+
+	_, funcs := opts['f']
+	_, vars := opts['v']
+	_, nameref := opts['n']
+
+	for _, name := range names {
+		if funcs {
+			delete(r.funcs, name)
+
+			continue
+		}
+
+		if base, _, keyed := splitSubscript(name); !isName(base) || keyed && !strings.HasSuffix(name, "]") {
+			r.errorf("unset: `%s': not a valid identifier", name)
+
+			status = 1
+
+			continue
+		}
+
+		if !nameref {
+			var err error
+
+			if name, err = r.resolve(name); err != nil {
+				r.errorf("unset: %s", err)
+
+				status = 1
+
+				continue
+			}
+		}
+
+		base, key, keyed := splitSubscript(name)
+		level := r.scopeOf(base)
+
+		if level < 0 || r.scopes[level][base].unset {
+			if level < 0 && !vars {
+				delete(r.funcs, name)
+			}
+
+			continue
+		}
+
+		s := r.scopes[level]
+
+		if v := s[base]; v.Attributes.Has(attributes.Readonly) {
+			r.errorf("unset: %s: cannot unset: readonly variable", base)
+
+			status = 1
+		} else if keyed && v.Attributes.IsArray() && key != "@" && key != "*" {
+			if err := r.unsetElement(s, base, v, key); err != nil {
+				r.errorf("unset: %s", err)
+
+				status = 1
+			}
+		} else {
+			r.unsetVariable(level, base)
+		}
+	}
+
+	return status, nil
+}
+
+// scopeOf returns the index of the innermost scope in which a variable is
+// declared, or -1 if it is not declared.
+func (r *Runner) scopeOf(name string) int {
+	for n := len(r.scopes) - 1; n >= 0; n-- {
+		if _, ok := r.scopes[n][name]; ok {
+			return n
+		}
+	}
+
+	return -1
+}
+
+// unsetVariable unsets a variable in the scope with the given index; a global
+// variable is removed, while one in an inner scope remains declared, hiding
+// any variable of the same name in an outer scope.
+func (r *Runner) unsetVariable(level int, name string) {
+	if level == 0 {
+		delete(r.scopes[0], name)
+	} else {
+		r.scopes[level][name] = variable{unset: true}
+	}
+}
+
+// unsetElement removes an element from an array.
+func (r *Runner) unsetElement(s scope, name string, v variable, key string) error {
+	key, err := r.subscript(v.Variable, key)
+	if err != nil {
+		return err
+	}
+
+	if v.Attributes.Has(attributes.Associative) {
+		v.Map = maps.Clone(v.Map)
+
+		delete(v.Map, key)
+	} else {
+		v.Array = maps.Clone(v.Array)
+		idx, _ := strconv.Atoi(key)
+
+		if keys := v.Keys(); idx < 0 && len(keys) > 0 {
+			last, _ := strconv.Atoi(keys[len(keys)-1])
+			idx += last + 1
+		}
+
+		delete(v.Array, idx)
+	}
+
+	s[name] = v
+
+	return nil
+}
+
+// builtinLet evaluates each of its arguments as an arithmetic expression,
+// succeeding if the value of the last is non-zero.
+func builtinLet(_ context.Context, r *Runner, args []string) (int, error) {
+	if len(args) < 2 {
+		r.errorf("let: expression expected")
+
+		return 1, nil
+	}
+
+	var n int64
+
+	for _, expr := range args[1:] {
+		var err error
+
+		if n, err = r.arithmetic(expr); err != nil {
+			return 1, r.arithmeticError("let", err)
+		}
+	}
+
+	if n == 0 {
+		return 1, nil
+	}
+
+	return 0, nil
+}
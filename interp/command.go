@@ -0,0 +1,721 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+// command runs a simple command.
+//
+// The words of the command are expanded first, then its redirections are
+// performed, and then its assignments. Without any words, the assignments
+// are made in the current shell, and the exit status is that of the last
+// command substitution, if any; otherwise, the command is run with the
+// assignments exported to it alone. The redirections of 'exec' without a
+// command are kept in effect.
+//
+// Once the command has run, the '_' variable is set to its last argument.
+func (r *Runner) command(ctx context.Context, c *bash.Command) error {
+	r.setLine(c.Tokens)
+
+	defer r.closeProcSubs(len(r.procSubs))
+
+	if err := r.debug(ctx, c); err != nil {
+		return err
+	}
+
+	r.subStatus = 0
+
+	args, err := r.arguments(ctx, c.AssignmentsOrWords)
+	if err != nil {
+		return r.expansion(err)
+	}
+
+	defer r.lastArg(args)
+
+	if _, ok := r.funcs["exec"]; !ok && len(args) == 1 && args[0] == "exec" {
+		if err := r.execRedirect(ctx, c.Redirections); err != nil {
+			return r.failed(err)
+		}
+
+		r.status = 0
+
+		return nil
+	}
+
+	restore, err := r.redirect(ctx, c.Redirections)
+	if err != nil {
+		return r.failed(err)
+	}
+
+	defer restore()
+
+	if len(args) == 0 {
+		return r.assignments(ctx, c.Vars)
+	}
+
+	temp := make(scope)
+
+	for n := range c.Vars {
+		if err := r.assign(ctx, &c.Vars[n], temp); errors.Is(err, expand.ErrReadonly) {
+			r.errorf("%s", err)
+		} else if err != nil {
+			return r.expansion(err)
+		}
+	}
+
+	if r.Options&XTrace != 0 {
+		var words []string
+
+		for n := range c.Vars {
+			name := c.Vars[n].Identifier.Identifier.Data
+
+			if v, ok := temp[name]; ok {
+				words = append(words, name+"="+traceQuote(v.Value))
+			}
+		}
+
+		for _, arg := range args {
+			words = append(words, traceQuote(arg))
+		}
+
+		r.trace(ctx, words...)
+	}
+
+	return r.run(ctx, args, temp)
+}
+
+// lastArg sets the '_' variable to the last of the arguments of a command, or
+// to the empty string when there are none.
+func (r *Runner) lastArg(args []string) {
+	v := r.scopes[0]["_"]
+	v.Value, v.unset = "", false
+
+	if len(args) > 0 {
+		v.Value = args[len(args)-1]
+	}
+
+	r.scopes[0]["_"] = v
+}
+
+// setLine sets the current line number from the first token of a command,
+// offset by the line on which the script being evaluated, if any, began.
+func (r *Runner) setLine(tks bash.Tokens) {
+	if len(tks) > 0 {
+		r.lineno = r.lineOffset + tks[0].Line + 1
+	}
+}
+
+// arguments expands the words of a command into its arguments.
+//
+// The assignments given as arguments to declaration builtins, such as
+// 'declare', are expanded without word splitting or pathname expansion, with
+// an array assignment giving a single argument in the form 'name=(...)'.
+func (r *Runner) arguments(ctx context.Context, words []bash.AssignmentOrWord) ([]string, error) {
+	var args []string
+
+	ex := r.expander(ctx)
+
+	for _, aw := range words {
+		if aw.Word != nil {
+			fields, err := ex.Fields(aw.Word)
+			if err != nil {
+				return nil, err
+			}
+
+			args = append(args, fields...)
+		} else if aw.Assignment != nil {
+			arg, err := r.assignmentArgument(ex, aw.Assignment)
+			if err != nil {
+				return nil, err
+			}
+
+			args = append(args, arg)
+		}
+	}
+
+	return args, nil
+}
+
+func (r *Runner) assignmentArgument(ex *expand.Expander, a *bash.Assignment) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString(a.Identifier.Identifier.Data)
+
+	if len(a.Identifier.Subscript) > 0 {
+		key, err := expandOperators(ex, a.Identifier.Subscript)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString("[" + key + "]")
+	}
+
+	if a.Assignment == bash.AssignmentAppend {
+		sb.WriteString("+=")
+	} else {
+		sb.WriteString("=")
+	}
+
+	switch {
+	case a.Value == nil:
+		expr, err := expandOperators(ex, a.Expression)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(expr)
+	case a.Value.Word != nil:
+		value, err := ex.Assignment(a.Value.Word)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(value)
+	default:
+		elems, err := r.elements(ex, a.Value.Array)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(arrayString(elems, expand.Quote))
+	}
+
+	return sb.String(), nil
+}
+
+// expandOperators expands the words of a subscript or arithmetic expression,
+// joining them with the operators between them.
+func expandOperators(ex *expand.Expander, wos []bash.WordOrOperator) (string, error) {
+	var sb strings.Builder
+
+	for _, wo := range wos {
+		if wo.Operator != nil {
+			sb.WriteString(wo.Operator.Data)
+		} else if wo.Word != nil {
+			s, err := ex.Word(wo.Word)
+			if err != nil {
+				return "", err
+			}
+
+			sb.WriteString(s)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// element is an element of an array assignment; either a value, or a value
+// with a key, as in '[key]=value' or '[key]+=value'.
+type element struct {
+	key    string
+	value  string
+	keyed  bool
+	append bool
+}
+
+// elements expands the words of an array assignment.
+//
+// The key and value of a keyed element are each expanded as a single word,
+// while other words are expanded into fields, each an element.
+func (r *Runner) elements(ex *expand.Expander, words []bash.ArrayWord) ([]element, error) {
+	var elems []element
+
+	for n := range words {
+		if key, value, appending, ok := splitElement(&words[n].Word); ok {
+			k, err := ex.Word(key)
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := ex.Assignment(value)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, element{key: k, value: v, keyed: true, append: appending})
+
+			continue
+		}
+
+		fields, err := ex.Fields(&words[n].Word)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fields {
+			elems = append(elems, element{value: f})
+		}
+	}
+
+	return elems, nil
+}
+
+// splitElement splits a word of the form '[key]=value', or '[key]+=value',
+// into the words of its key and value.
+func splitElement(w *bash.Word) (*bash.Word, *bash.Word, bool, bool) {
+	if len(w.Parts) == 0 || w.Parts[0].Part == nil || w.Parts[0].Part.Type != bash.TokenWord || !strings.HasPrefix(w.Parts[0].Part.Data, "[") {
+		return nil, nil, false, false
+	}
+
+	for n, p := range w.Parts {
+		if p.Part == nil || p.Part.Type != bash.TokenWord && p.Part.Type != bash.TokenIdentifier {
+			continue
+		}
+
+		data := p.Part.Data
+		if n == 0 {
+			data = data[1:]
+		}
+
+		end := strings.Index(data, "]=")
+		appending := false
+
+		if add := strings.Index(data, "]+="); add >= 0 && (end < 0 || add < end) {
+			end, appending = add, true
+		}
+
+		if end < 0 {
+			continue
+		}
+
+		sep := end + 2
+
+		if appending {
+			sep++
+		}
+
+		key := &bash.Word{Parts: append(slices.Clone(w.Parts[:n]), partWithData(p, data[:end]))}
+		value := &bash.Word{Parts: append([]bash.WordPart{partWithData(p, data[sep:])}, w.Parts[n+1:]...)}
+
+		if n > 0 {
+			key.Parts[0] = partWithData(key.Parts[0], key.Parts[0].Part.Data[1:])
+		}
+
+		return key, value, appending, true
+	}
+
+	return nil, nil, false, false
+}
+
+func partWithData(p bash.WordPart, data string) bash.WordPart {
+	tk := *p.Part
+	tk.Data = data
+
+	return bash.WordPart{Part: &tk}
+}
+
+// arrayString returns the elements of an array assignment in the form
+// '(...)', as given to a declaration builtin, with each key and value quoted
+// by the given function.
+func arrayString(elems []element, quote func(string) string) string {
+	var sb strings.Builder
+
+	sb.WriteByte('(')
+
+	for n, e := range elems {
+		if n > 0 {
+			sb.WriteByte(' ')
+		}
+
+		if e.keyed {
+			sb.WriteString("[" + quote(e.key) + "]")
+
+			if e.append {
+				sb.WriteByte('+')
+			}
+
+			sb.WriteByte('=')
+		}
+
+		sb.WriteString(quote(e.value))
+	}
+
+	sb.WriteByte(')')
+
+	return sb.String()
+}
+
+// assignments performs the assignments of a command without words.
+func (r *Runner) assignments(ctx context.Context, vars []bash.Assignment) error {
+	for n := range vars {
+		if err := r.assign(ctx, &vars[n], nil); err != nil {
+			return r.expansion(err)
+		}
+	}
+
+	r.status = r.subStatus
+
+	return nil
+}
+
+// assign performs an assignment; in the current shell, or, when temp is not
+// nil, as an exported variable in temp, for the duration of a command.
+func (r *Runner) assign(ctx context.Context, a *bash.Assignment, temp scope) error {
+	ex := r.expander(ctx)
+	name := a.Identifier.Identifier.Data
+	appending := a.Assignment == bash.AssignmentAppend
+	op := "="
+
+	if appending {
+		op = "+="
+	}
+
+	if len(a.Identifier.Subscript) > 0 {
+		key, err := expandOperators(ex, a.Identifier.Subscript)
+		if err != nil {
+			return err
+		}
+
+		name += "[" + key + "]"
+	}
+
+	if a.Value != nil && a.Value.Word == nil {
+		elems, err := r.elements(ex, a.Value.Array)
+		if err != nil {
+			return err
+		}
+
+		r.trace(ctx, name+op+arrayString(elems, traceQuote))
+
+		return r.assignArray(name, elems, appending)
+	}
+
+	var value string
+
+	if a.Value != nil {
+		v, err := ex.Assignment(a.Value.Word)
+		if err != nil {
+			return err
+		}
+
+		value = v
+	}
+
+	if temp != nil {
+		if _, old, _ := r.lookup(name); old.Attributes.Has(attributes.Readonly) {
+			return fmt.Errorf("%s: %w", name, expand.ErrReadonly)
+		}
+
+		temp[name] = variable{Variable: expand.Variable{Attributes: attributes.Exported, Value: value}}
+
+		return nil
+	}
+
+	r.trace(ctx, name+op+traceQuote(value))
+
+	return r.assignScalar(name, value, appending)
+}
+
+// assignScalar assigns a value to a variable, or to an element of an array
+// when the name includes a subscript.
+//
+// When appending, the value is added to that of an Integer variable, and
+// appended to that of any other.
+func (r *Runner) assignScalar(name, value string, appending bool) error {
+	if appending {
+		base, _, _ := splitSubscript(name)
+		v, _ := r.Get(base)
+		old, _ := r.Get(name)
+
+		if v.Attributes.Has(attributes.Integer) {
+			a, err := r.arithmetic(old.String())
+			if err != nil {
+				return err
+			}
+
+			b, err := r.arithmetic(value)
+			if err != nil {
+				return err
+			}
+
+			value = strconv.FormatInt(a+b, 10)
+		} else {
+			value = old.String() + value
+		}
+	}
+
+	return r.Set(name, expand.Scalar(value))
+}
+
+// assignArray assigns the elements of an array assignment.
+//
+// Elements without a key are assigned consecutive indices, following the
+// largest index when appending; for an Associative array, they are taken in
+// pairs of keys and values.
+func (r *Runner) assignArray(name string, elems []element, appending bool) error {
+	name, err := r.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	s, old, _ := r.lookup(name)
+	if old.Attributes.Has(attributes.Readonly) {
+		return fmt.Errorf("%s: %w", name, expand.ErrReadonly)
+	}
+
+	v := expand.Variable{Attributes: old.Attributes}
+
+	if !v.Attributes.IsArray() {
+		v.Attributes |= attributes.Indexed
+	}
+
+	next := 0
+
+	if appending && !old.unset {
+		v = old.Variable
+		v.Array = maps.Clone(old.Array)
+		v.Map = maps.Clone(old.Map)
+
+		if !old.Attributes.IsArray() {
+			v.Attributes |= attributes.Indexed
+			v.Array = map[int]string{0: old.Value}
+			v.Value = ""
+		}
+
+		for idx := range v.Array {
+			next = max(next, idx+1)
+		}
+	}
+
+	associative := v.Attributes.Has(attributes.Associative)
+
+	if associative && v.Map == nil {
+		v.Map = make(map[string]string)
+	} else if !associative && v.Array == nil {
+		v.Array = make(map[int]string)
+	}
+
+	for n := 0; n < len(elems); n++ {
+		e := elems[n]
+
+		switch {
+		case e.keyed:
+			if e.key, err = r.subscript(v, e.key); err != nil {
+				return err
+			}
+		case associative:
+			e.key = e.value
+			e.value = ""
+
+			if n++; n < len(elems) {
+				e.value = elems[n].value
+			}
+		default:
+			e.key = strconv.Itoa(next)
+		}
+
+		if e.append {
+			old, _ := v.Index(e.key)
+			e.value = old + e.value
+		}
+
+		if v, err = v.AssignIndex(e.key, e.value); err != nil {
+			return fmt.Errorf("%s[%s]: %w", name, e.key, err)
+		}
+
+		if !associative {
+			idx, _ := strconv.Atoi(e.key)
+
+			if idx < 0 {
+				idx += next
+			}
+
+			next = max(next, idx+1)
+		}
+	}
+
+	return r.store(s, name, v)
+}
+
+// run runs a command, which is either a function, a builtin, or an external
+// command run with the ExecHandler.
+func (r *Runner) run(ctx context.Context, args []string, temp scope) error {
+	if fn, ok := r.funcs[args[0]]; ok {
+		defer r.pushScope(temp)()
+
+		return r.call(ctx, args[0], fn, args[1:])
+	}
+
+	if b, ok := builtins[args[0]]; ok {
+		defer r.pushScope(temp)()
+
+		status, err := b(ctx, r, args)
+		r.status = status
+
+		return err
+	}
+
+	return r.exec(ctx, args, temp)
+}
+
+// call calls a function, with the given positional parameters, in a new scope
+// for its local variables.
+//
+// As functions do not inherit the RETURN trap, it is unset while the function
+// runs; a RETURN trap set by the function is run when it returns, and remains
+// set afterwards, otherwise the previous trap is restored.
+func (r *Runner) call(ctx context.Context, name string, body *bash.Compound, args []string) error {
+	oldArgs, oldLocals, oldLine := r.Args, r.locals, r.lineno
+	oldTrap, hadTrap := r.traps["RETURN"]
+
+	delete(r.traps, "RETURN")
+
+	r.Args = args
+	r.funcNames = append(r.funcNames, name)
+	pop := r.pushScope(make(scope))
+	r.locals = len(r.scopes) - 1
+
+	err := r.compound(ctx, body)
+	if err == errReturn {
+		err = nil
+	}
+
+	if _, ok := r.traps["RETURN"]; ok && err == nil {
+		err = r.trap(ctx, "RETURN")
+	}
+
+	if _, ok := r.traps["RETURN"]; !ok && hadTrap {
+		r.traps["RETURN"] = oldTrap
+	}
+
+	pop()
+
+	r.funcNames = r.funcNames[:len(r.funcNames)-1]
+	r.Args = oldArgs
+	r.locals = oldLocals
+	r.lineno = oldLine
+
+	return err
+}
+
+// exec runs an external command with the ExecHandler, with the exported
+// variables of the shell, and those assigned for the command, as its
+// environment.
+func (r *Runner) exec(ctx context.Context, args []string, temp scope) error {
+	if r.Exec == nil {
+		return r.execError(args[0], ErrNotFound)
+	}
+
+	env := r.environ()
+
+	for _, name := range slices.Sorted(maps.Keys(temp)) {
+		env = slices.DeleteFunc(env, func(kv string) bool {
+			return strings.HasPrefix(kv, name+"=")
+		})
+		env = append(env, name+"="+temp[name].Value)
+	}
+
+	status, err := r.Exec.Exec(ctx, &Command{
+		Args:   args,
+		Env:    env,
+		Dir:    r.Dir,
+		Stdin:  r.stdin(),
+		Stdout: r.fds[1].writer(),
+		Stderr: r.fds[2].writer(),
+	})
+	if err != nil {
+		return r.execError(args[0], err)
+	}
+
+	r.status = status
+
+	return nil
+}
+
+// execError reports an error running an external command, setting the exit
+// status to 127 if the command was not found, and 126 otherwise.
+func (r *Runner) execError(name string, err error) error {
+	if isFlow(err) {
+		return err
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		r.status = 127
+
+		r.errorf("%s: %s", name, ErrNotFound)
+	} else {
+		r.status = 126
+
+		r.errorf("%s", message(&fs.PathError{Path: name, Err: unwrapPathError(err)}))
+	}
+
+	return nil
+}
+
+// trace writes a command, after expansion, to stderr, when 'set -x' is set.
+//
+// Each line is prefixed with the expansion of PS4, the first character of
+// which is repeated for each level of command substitution.
+func (r *Runner) trace(ctx context.Context, words ...string) {
+	if r.Options&XTrace == 0 {
+		return
+	}
+
+	ps4, _ := r.Get("PS4")
+	prefix := r.expandString(ctx, ps4.String())
+
+	if c, _ := utf8.DecodeRuneInString(prefix); prefix != "" {
+		prefix = strings.Repeat(string(c), r.substitutions) + prefix
+	}
+
+	fmt.Fprintf(r.stderr(), "%s%s\n", prefix, strings.Join(words, " "))
+}
+
+// traceQuote quotes a word for 'set -x' output when it is empty, or contains
+// characters special to the shell.
+func traceQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`|&;<>()*?[]{}~#!") && !strings.ContainsFunc(s, func(c rune) bool {
+		return !unicode.IsPrint(c)
+	}) {
+		return s
+	}
+
+	return expand.Quote(s)
+}
+
+// expandString performs parameter, command, and arithmetic expansion on a
+// string, as for the value of PS4; the string is returned unchanged if it
+// cannot be expanded.
+func (r *Runner) expandString(ctx context.Context, s string) string {
+	if !strings.ContainsAny(s, "$`") {
+		return s
+	}
+
+	tk := parser.NewStringTokeniser("\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\"")
+
+	f, err := bash.Parse(&tk)
+	if err != nil || len(f.Lines) != 1 || len(f.Lines[0].Statements) != 1 {
+		return s
+	}
+
+	c := f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Command
+	if c == nil || len(c.AssignmentsOrWords) != 1 || c.AssignmentsOrWords[0].Word == nil {
+		return s
+	}
+
+	status := r.status
+
+	out, err := r.expander(ctx).Word(c.AssignmentsOrWords[0].Word)
+
+	r.status = status
+
+	if err != nil {
+		return s
+	}
+
+	return out
+}
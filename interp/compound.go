@@ -0,0 +1,575 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/arith"
+	"vimagination.zapto.org/bash/cond"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/bash/pattern"
+)
+
+// compound runs a compound command, with its redirections.
+func (r *Runner) compound(ctx context.Context, c *bash.Compound) error {
+	r.setLine(c.Tokens)
+
+	defer r.closeProcSubs(len(r.procSubs))
+
+	restore, err := r.redirect(ctx, c.Redirections)
+	if err != nil {
+		return r.failed(err)
+	}
+
+	defer restore()
+
+	switch {
+	case c.IfCompound != nil:
+		return r.ifCompound(ctx, c.IfCompound)
+	case c.CaseCompound != nil:
+		return r.caseCompound(ctx, c.CaseCompound)
+	case c.LoopCompound != nil:
+		return r.loopCompound(ctx, c.LoopCompound)
+	case c.ForCompound != nil:
+		return r.forCompound(ctx, c.ForCompound)
+	case c.SelectCompound != nil:
+		return r.selectCompound(ctx, c.SelectCompound)
+	case c.GroupingCompound != nil:
+		return r.groupingCompound(ctx, c.GroupingCompound)
+	case c.TestCompound != nil:
+		return r.testCompound(ctx, c.TestCompound)
+	case c.ArithmeticCompound != nil:
+		return r.arithmeticCompound(ctx, c.ArithmeticCompound)
+	case c.FunctionCompound != nil:
+		r.funcs[c.FunctionCompound.Identifier.Data] = &c.FunctionCompound.Body
+		r.status = 0
+	}
+
+	return nil
+}
+
+func (r *Runner) ifCompound(ctx context.Context, c *bash.IfCompound) error {
+	for n := -1; n < len(c.ElIf); n++ {
+		tc := &c.If
+
+		if n >= 0 {
+			tc = &c.ElIf[n]
+		}
+
+		if ok, err := r.test(ctx, &tc.Test); err != nil {
+			return err
+		} else if ok {
+			return r.file(ctx, &tc.Consequence)
+		}
+	}
+
+	r.status = 0
+
+	if c.Else != nil {
+		return r.file(ctx, c.Else)
+	}
+
+	return nil
+}
+
+// caseCompound runs a case statement.
+//
+// The lines of the first arm with a matching pattern are run, after which ';&'
+// continues by running the lines of the next arm, and ';;&' by testing the
+// patterns of the following arms.
+func (r *Runner) caseCompound(ctx context.Context, c *bash.CaseCompound) error {
+	if err := r.debug(ctx, fmt.Sprintf("case %s in ", &c.Word)); err != nil {
+		return err
+	}
+
+	ex := r.expander(ctx)
+
+	word, err := ex.Word(&c.Word)
+	if err != nil {
+		return r.expansion(err)
+	}
+
+	var opts pattern.Options
+
+	if r.Options&ExtGlob != 0 {
+		opts |= pattern.ExtGlob
+	}
+
+	if r.Options&NoCaseMatch != 0 {
+		opts |= pattern.NoCaseMatch
+	}
+
+	r.status = 0
+	matched := false
+	cd := &Condition{Command: fmt.Sprintf("%s", r.bashCommand), Operands: []string{word}, Status: 1}
+
+	for n := range c.Matches {
+		m := &c.Matches[n]
+
+		for p := 0; p < len(m.Patterns) && !matched; p++ {
+			pat, err := ex.Pattern(&m.Patterns[p])
+			if err != nil {
+				return r.expansion(err)
+			}
+
+			cd.Operands = append(cd.Operands, pat)
+			matched = pattern.Compile(pat, opts).Match(word)
+		}
+
+		if !matched {
+			continue
+		}
+
+		if cd.Status != 0 {
+			r.condition(ctx, cd, 0)
+		}
+
+		if err := r.file(ctx, &m.Lines); err != nil {
+			return err
+		}
+
+		switch m.CaseTerminationType {
+		case bash.CaseTerminationContinue:
+		case bash.CaseTerminationFallthrough:
+			matched = false
+		default:
+			return nil
+		}
+	}
+
+	if cd.Status != 0 {
+		r.condition(ctx, cd, 1)
+	}
+
+	return nil
+}
+
+// loop runs the body of a loop, returning whether the loop should stop, and
+// any error to be returned from it, such as a 'break' or 'continue' for an
+// enclosing loop.
+func (r *Runner) loop(ctx context.Context, f *bash.File) (bool, error) {
+	err := r.file(ctx, f)
+
+	lc, ok := err.(loopControl)
+	if !ok {
+		return err != nil, err
+	} else if lc.n > 1 {
+		lc.n--
+
+		return true, lc
+	}
+
+	return !lc.cont, nil
+}
+
+// loopCompound runs a 'while' or 'until' loop.
+//
+// The exit status is that of the last command run in the body, or zero if the
+// body was not run.
+func (r *Runner) loopCompound(ctx context.Context, c *bash.LoopCompound) error {
+	r.loops++
+	defer func() { r.loops-- }()
+
+	status := 0
+
+	for {
+		if ok, err := r.test(ctx, &c.Statement); err != nil {
+			return err
+		} else if ok == c.Until {
+			break
+		}
+
+		stop, err := r.loop(ctx, &c.File)
+		status = r.status
+
+		if stop {
+			r.status = status
+
+			return err
+		}
+	}
+
+	r.status = status
+
+	return nil
+}
+
+// forCompound runs a 'for' loop, over the given words, or the positional
+// parameters when there is no 'in' clause.
+func (r *Runner) forCompound(ctx context.Context, c *bash.ForCompound) error {
+	if c.ArithmeticExpansion != nil {
+		return r.arithmeticFor(ctx, c)
+	}
+
+	words, err := r.loopWords(ctx, c.Words, c.Tokens)
+	if err != nil {
+		return err
+	}
+
+	r.loops++
+	defer func() { r.loops-- }()
+
+	r.status = 0
+
+	head := forHead(c)
+
+	for _, word := range words {
+		if err := r.debug(ctx, head); err != nil {
+			return err
+		}
+
+		if err := r.Set(c.Identifier.Data, expand.Scalar(word)); err != nil {
+			return r.expansion(err)
+		}
+
+		if stop, err := r.loop(ctx, &c.File); stop {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loopWords expands the words of a 'for' or 'select' command, which are the
+// positional parameters when there is no 'in' clause.
+func (r *Runner) loopWords(ctx context.Context, words []bash.Word, tks bash.Tokens) ([]string, error) {
+	if len(words) == 0 && !hasIn(tks) {
+		return r.Args, nil
+	}
+
+	ptrs := make([]*bash.Word, len(words))
+
+	for n := range words {
+		ptrs[n] = &words[n]
+	}
+
+	fields, err := r.expander(ctx).Fields(ptrs...)
+	if err != nil {
+		return nil, r.expansion(err)
+	}
+
+	return fields, nil
+}
+
+// forHead returns the head of a 'for' loop, as the value of BASH_COMMAND.
+func forHead(c *bash.ForCompound) string {
+	head := "for " + c.Identifier.Data
+
+	if hasIn(c.Tokens) {
+		head += " in"
+
+		for n := range c.Words {
+			head += fmt.Sprintf(" %s", &c.Words[n])
+		}
+	}
+
+	return head
+}
+
+// tokensText returns the source of the given tokens.
+func tokensText(tks bash.Tokens) string {
+	var sb strings.Builder
+
+	for _, tk := range tks {
+		sb.WriteString(tk.Data)
+	}
+
+	return sb.String()
+}
+
+// hasIn determines whether the first keyword after 'for' or 'select' is 'in',
+// rather than 'do'.
+func hasIn(tks bash.Tokens) bool {
+	for _, tk := range tks[1:] {
+		if tk.Type == bash.TokenKeyword {
+			return tk.Data == "in"
+		}
+	}
+
+	return false
+}
+
+// arithmeticFor runs a 'for (( init; condition; update ))' loop, in which an
+// empty condition is true.
+func (r *Runner) arithmeticFor(ctx context.Context, c *bash.ForCompound) error {
+	var (
+		exprs [3]bash.ArithmeticExpansion
+		seps  []uint64
+	)
+
+	for _, wo := range c.ArithmeticExpansion.WordsAndOperators {
+		if wo.Operator != nil && wo.Operator.Data == ";" && len(seps) < 2 {
+			seps = append(seps, wo.Operator.Pos)
+		} else {
+			exprs[len(seps)].WordsAndOperators = append(exprs[len(seps)].WordsAndOperators, wo)
+		}
+	}
+
+	if tks := c.ArithmeticExpansion.Tokens; len(tks) > 1 {
+		for _, tk := range tks[1 : len(tks)-1] {
+			n := 0
+
+			for n < len(seps) && seps[n] <= tk.Pos {
+				n++
+			}
+
+			if !slices.Contains(seps, tk.Pos) {
+				exprs[n].Tokens = append(exprs[n].Tokens, tk)
+			}
+		}
+	}
+
+	failed := false
+	eval := func(expr *bash.ArithmeticExpansion) (bool, error) {
+		if err := r.debug(ctx, "(("+strings.TrimLeft(tokensText(expr.Tokens), " \t\n")+"))"); err != nil {
+			return false, err
+		} else if len(expr.WordsAndOperators) == 0 {
+			return true, nil
+		}
+
+		v, _, err := r.arithEvaluator(ctx).Expansion(expr)
+		if err != nil {
+			failed = true
+
+			return false, r.arithmeticError("((", err)
+		}
+
+		return v != 0, nil
+	}
+
+	r.loops++
+	defer func() { r.loops-- }()
+
+	r.status = 0
+
+	if _, err := eval(&exprs[0]); err != nil || failed {
+		return err
+	}
+
+	for {
+		if ok, err := eval(&exprs[1]); err != nil || !ok {
+			return err
+		}
+
+		if stop, err := r.loop(ctx, &c.File); stop {
+			return err
+		}
+
+		if _, err := eval(&exprs[2]); err != nil || failed {
+			return err
+		}
+	}
+}
+
+// selectCompound runs a 'select' loop, which writes a numbered menu of the
+// words to stderr, followed by the PS3 prompt, and then reads a line from
+// stdin into REPLY, setting the variable to the chosen word, or to the empty
+// string when the line is not the number of a word.
+//
+// The menu is shown again after an empty line, and the loop ends at the end
+// of input.
+func (r *Runner) selectCompound(ctx context.Context, c *bash.SelectCompound) error {
+	words, err := r.loopWords(ctx, c.Words, c.Tokens)
+	if err != nil {
+		return err
+	}
+
+	r.loops++
+	defer func() { r.loops-- }()
+
+	r.status = 0
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	menu := true
+
+	for {
+		if menu {
+			for n, word := range words {
+				fmt.Fprintf(r.stderr(), "%d) %s\n", n+1, word)
+			}
+		}
+
+		ps3, ok := r.Get("PS3")
+		if !ok {
+			ps3 = expand.Scalar("#? ")
+		}
+
+		io.WriteString(r.stderr(), r.expandString(ctx, ps3.String()))
+
+		line, err := readLine(r.stdin())
+		if err != nil {
+			io.WriteString(r.stderr(), "\n")
+
+			r.status = 1
+
+			return nil
+		}
+
+		line = strings.TrimSpace(line)
+
+		if menu = line == ""; menu {
+			continue
+		}
+
+		var choice string
+
+		if n, err := strconv.Atoi(line); err == nil && n > 0 && n <= len(words) {
+			choice = words[n-1]
+		}
+
+		if err := r.Set("REPLY", expand.Scalar(line)); err != nil {
+			return r.expansion(err)
+		} else if err := r.Set(c.Identifier.Data, expand.Scalar(choice)); err != nil {
+			return r.expansion(err)
+		}
+
+		if stop, err := r.loop(ctx, &c.File); stop {
+			return err
+		}
+	}
+}
+
+// readLine reads a line from a reader, a byte at a time so as not to consume
+// any input after the line, returning the line without its terminating
+// newline.
+//
+// An error is returned only when the input ends before any bytes are read.
+func readLine(rd io.Reader) (string, error) {
+	if rd == nil {
+		return "", io.EOF
+	}
+
+	var (
+		sb  strings.Builder
+		buf [1]byte
+	)
+
+	for {
+		n, err := rd.Read(buf[:])
+		if n == 1 {
+			if buf[0] == '\n' {
+				return sb.String(), nil
+			}
+
+			sb.WriteByte(buf[0])
+		} else if err != nil {
+			if sb.Len() == 0 {
+				return "", err
+			}
+
+			return sb.String(), nil
+		}
+	}
+}
+
+func (r *Runner) groupingCompound(ctx context.Context, c *bash.GroupingCompound) error {
+	if !c.SubShell {
+		return r.file(ctx, &c.File)
+	}
+
+	status, err := r.runSubshell(ctx, func(s *Runner) error {
+		return s.file(ctx, &c.File)
+	})
+
+	r.status = status
+
+	return err
+}
+
+// testCompound runs a '[[' command.
+func (r *Runner) testCompound(ctx context.Context, c *bash.TestCompound) error {
+	if err := r.debug(ctx, c); err != nil {
+		return err
+	}
+
+	ev, cd := r.condEvaluator(ctx)
+
+	status, err := ev.Compound(c)
+	if err != nil {
+		return r.arithmeticError("[[", err)
+	}
+
+	r.status = status
+
+	r.condition(ctx, cd, status)
+
+	return nil
+}
+
+// condEvaluator returns a cond.Evaluator for a '[[' command or the 'test'
+// builtin, and, when the ExecHandler implements the ConditionHandler
+// interface, a Condition to which the evaluator adds the tested operands.
+func (r *Runner) condEvaluator(ctx context.Context) (*cond.Evaluator, *Condition) {
+	ev := &cond.Evaluator{Expander: r.expander(ctx), Option: r.isSetOption}
+
+	if _, ok := r.Exec.(ConditionHandler); !ok {
+		return ev, nil
+	}
+
+	c := &Condition{Command: fmt.Sprintf("%s", r.bashCommand)}
+
+	ev.Operand = func(value string, file bool) {
+		if file {
+			c.Files = append(c.Files, value)
+		} else {
+			c.Operands = append(c.Operands, value)
+		}
+	}
+
+	return ev, c
+}
+
+// condition reports a tested Condition to the ExecHandler, when it implements
+// the ConditionHandler interface.
+func (r *Runner) condition(ctx context.Context, c *Condition, status int) {
+	if ch, ok := r.Exec.(ConditionHandler); ok && c != nil {
+		c.Status = status
+
+		ch.Condition(ctx, c)
+	}
+}
+
+// arithmeticCompound runs a '(( ))' command, whose exit status is zero when
+// the value of the expression is non-zero.
+func (r *Runner) arithmeticCompound(ctx context.Context, c *bash.ArithmeticExpansion) error {
+	if err := r.debug(ctx, tokensText(c.Tokens)); err != nil {
+		return err
+	}
+
+	_, status, err := r.arithEvaluator(ctx).Expansion(c)
+	if err != nil {
+		return r.arithmeticError("((", err)
+	}
+
+	r.status = status
+
+	return nil
+}
+
+// arithmeticError reports an error from a '(( ))' or '[[' command, or an
+// arithmetic 'for' loop.
+//
+// Unlike an error in an arithmetic expansion, an error in the evaluation of
+// an expression causes only the command to fail, with the exit status one.
+func (r *Runner) arithmeticError(name string, err error) error {
+	var ae arith.Error
+
+	if !errors.As(err, &ae) {
+		return r.expansion(err)
+	}
+
+	r.status = 1
+
+	r.errorf("%s: %s", name, err)
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package interp_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"vimagination.zapto.org/bash/interp"
+)
+
+func Example() {
+	r := interp.Runner{
+		Args:   []string{"world"},
+		Stdout: os.Stdout,
+		Stderr: os.Stdout,
+		Exec: interp.ExecFunc(func(_ context.Context, cmd *interp.Command) (int, error) {
+			if cmd.Args[0] != "greet" {
+				return 0, interp.ErrNotFound
+			}
+
+			fmt.Fprintln(cmd.Stdout, strings.ToUpper(strings.Join(cmd.Args[1:], " ")))
+
+			return 0, nil
+		}),
+	}
+
+	status, err := r.RunString(context.Background(), `
+greeting() {
+	greet "hello, ${1:-nobody}" $2
+}
+
+for (( i = 1; i <= 2; i++ )); do
+	greeting "$@" $i
+done
+
+greeting
+
+missing "$1"
+`)
+
+	fmt.Println(status, err)
+
+	// Output:
+	// HELLO, WORLD 1
+	// HELLO, WORLD 2
+	// HELLO, NOBODY
+	// bash: line 12: missing: command not found
+	// 127 <nil>
+}
@@ -0,0 +1,186 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Command is an external command to be run by an ExecHandler.
+//
+// Args contains the name of the command followed by its arguments, and Env
+// the exported variables of the shell, in the form 'name=value'. Dir is the
+// working directory of the shell.
+type Command struct {
+	Args   []string
+	Env    []string
+	Dir    string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Getenv returns the value of the named variable from Env.
+func (c *Command) Getenv(name string) string {
+	for _, kv := range c.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == name {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// ExecHandler runs the external commands of a script; those that are neither
+// functions nor builtins.
+//
+// Exec returns the exit status of the command, or an error if it could not be
+// run, in which case the status is 127 if the error is ErrNotFound, and 126
+// otherwise.
+type ExecHandler interface {
+	Exec(ctx context.Context, cmd *Command) (int, error)
+}
+
+// ExecFunc is a function that implements the ExecHandler interface.
+type ExecFunc func(ctx context.Context, cmd *Command) (int, error)
+
+// Exec implements the ExecHandler interface.
+func (e ExecFunc) Exec(ctx context.Context, cmd *Command) (int, error) {
+	return e(ctx, cmd)
+}
+
+// PathHandler is an optional interface of an ExecHandler, used by the 'type'
+// and 'command' builtins to find the path of an external command without
+// running it.
+//
+// LookPath returns the path of the command named by the first of Args, or
+// ErrNotFound if there is no such command.
+type PathHandler interface {
+	LookPath(ctx context.Context, cmd *Command) (string, error)
+}
+
+// Condition is a test made by the shell itself that decides which commands are
+// run; that of a '[[' command, a 'test' or '[' builtin, or a 'case' command.
+//
+// Command is the text of the command, as given by BASH_COMMAND. Operands are
+// the expanded values that were tested, being the arguments of a builtin, and
+// the word and patterns of a 'case' command, and Files the names of the files
+// whose information was tested. Status is the exit status of the test, or, for
+// a 'case' command, is zero when a pattern was matched, and one otherwise.
+type Condition struct {
+	Command  string
+	Operands []string
+	Files    []string
+	Status   int
+}
+
+// ConditionHandler is an optional interface of an ExecHandler, which is told
+// of each Condition after it has been tested.
+type ConditionHandler interface {
+	Condition(ctx context.Context, c *Condition)
+}
+
+// OpenHandler opens the files named by redirections.
+//
+// The name is an absolute path, and flag and perm are as for os.OpenFile.
+type OpenHandler interface {
+	Open(ctx context.Context, name string, flag int, perm fs.FileMode) (io.ReadWriteCloser, error)
+}
+
+// OpenFunc is a function that implements the OpenHandler interface.
+type OpenFunc func(ctx context.Context, name string, flag int, perm fs.FileMode) (io.ReadWriteCloser, error)
+
+// Open implements the OpenHandler interface.
+func (o OpenFunc) Open(ctx context.Context, name string, flag int, perm fs.FileMode) (io.ReadWriteCloser, error) {
+	return o(ctx, name, flag, perm)
+}
+
+// OS is an ExecHandler and OpenHandler that runs commands and opens files
+// using the operating system.
+//
+// Commands are found by searching the PATH variable of the shell.
+type OS struct{}
+
+// Exec implements the ExecHandler interface.
+func (OS) Exec(ctx context.Context, cmd *Command) (int, error) {
+	path, err := lookPath(cmd.Args[0], cmd.Getenv("PATH"), cmd.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	c := exec.CommandContext(ctx, path, cmd.Args[1:]...)
+	c.Args[0] = cmd.Args[0]
+	c.Env = cmd.Env
+	c.Dir = cmd.Dir
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+
+	if err := c.Run(); err != nil {
+		var ee *exec.ExitError
+
+		if !errors.As(err, &ee) {
+			return 0, err
+		} else if code := ee.ExitCode(); code >= 0 {
+			return code, nil
+		}
+
+		return 255, nil
+	}
+
+	return 0, nil
+}
+
+// LookPath implements the PathHandler interface.
+func (OS) LookPath(_ context.Context, cmd *Command) (string, error) {
+	return lookPath(cmd.Args[0], cmd.Getenv("PATH"), cmd.Dir)
+}
+
+func lookPath(name, path, dir string) (string, error) {
+	if strings.Contains(name, "/") {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+
+		return name, isExecutable(name)
+	}
+
+	for _, p := range filepath.SplitList(path) {
+		if p == "" {
+			p = "."
+		}
+
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+
+		if candidate := filepath.Join(p, name); isExecutable(candidate) == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", ErrNotFound
+}
+
+func isExecutable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	} else if fi.IsDir() {
+		return ErrIsDirectory
+	} else if fi.Mode().Perm()&0o111 == 0 {
+		return fs.ErrPermission
+	}
+
+	return nil
+}
+
+// Open implements the OpenHandler interface.
+func (OS) Open(_ context.Context, name string, flag int, perm fs.FileMode) (io.ReadWriteCloser, error) {
+	return os.OpenFile(name, flag, perm)
+}
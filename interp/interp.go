@@ -0,0 +1,507 @@
+// Package interp implements an interpreter for bash scripts.
+//
+// External commands are run with an ExecHandler, and the files named by
+// redirections are opened with an OpenHandler, allowing scripts to be run
+// against the operating system, or fully sandboxed or mocked. The builtins of
+// the shell, such as 'declare', 'printf', and 'read', are implemented in Go,
+// and never run as external commands.
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/arith"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+// Runner runs bash scripts, keeping the state of the shell, such as its
+// variables, functions, and traps, between runs.
+//
+// Name is the name of the shell, which is the value of '$0' and prefixes error
+// messages, and defaults to 'bash'. Args are the positional parameters, and
+// Env the initial exported variables, in the form 'name=value'.
+//
+// Dir is the absolute path of the working directory, which defaults to the
+// value of PWD from Env, or '/'.
+//
+// The standard input, output, and error of the shell are Stdin, Stdout, and
+// Stderr; when nil, input is empty and output is discarded.
+//
+// FS, when set, represents the root of the filesystem, and is used for
+// pathname expansion and file tests, and, when Open is nil, for reading the
+// files of input redirections; with neither set, no files can be opened.
+// External commands are run with Exec; when it is nil, no external commands
+// can be found.
+//
+// Args, Dir, and Options are updated as the script runs, such as by the
+// 'shift', 'cd', and 'set' builtins.
+type Runner struct {
+	Name    string
+	Args    []string
+	Env     []string
+	Dir     string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	FS      fs.FS
+	Exec    ExecHandler
+	Open    OpenHandler
+	Options Options
+
+	shared        *shared
+	scopes        []scope
+	funcs         map[string]*bash.Compound
+	traps         map[string]string
+	fds           fdTable
+	procSubs      []int
+	status        int
+	subStatus     int
+	lineno        uint64
+	lineOffset    uint64
+	start         time.Time
+	pid           int
+	lastJob       int
+	subshells     int
+	substitutions int
+	funcNames     []string
+	locals        int
+	sources       int
+	loops         int
+	noErrExit     int
+	inTrap        bool
+	bashCommand   any
+	optIndex      int
+	optChar       int
+	jobs          map[int]*job
+}
+
+// shared is the state shared between a shell and all of its subshells.
+type shared struct {
+	pid  int
+	jobs sync.WaitGroup
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	lastPID int
+}
+
+func (s *shared) random() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rand.IntN(32768)
+}
+
+func (s *shared) seed(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rand = rand.New(rand.NewPCG(uint64(n), 0))
+}
+
+// newPID returns a new process ID, for a subshell or background job.
+func (s *shared) newPID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastPID++
+
+	return s.lastPID
+}
+
+// init initialises the state of the shell, the first time it is run.
+func (r *Runner) init() {
+	if r.shared != nil {
+		return
+	}
+
+	pid := os.Getpid()
+
+	r.shared = &shared{pid: pid, lastPID: pid, rand: rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0))}
+	r.pid = pid
+	r.start = time.Now()
+	r.scopes = []scope{{}}
+	r.funcs = make(map[string]*bash.Compound)
+	r.traps = make(map[string]string)
+
+	if r.Name == "" {
+		r.Name = "bash"
+	}
+
+	for _, kv := range r.Env {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			r.scopes[0][name] = variable{Variable: expand.Variable{Attributes: attributes.Exported, Value: value}}
+		}
+	}
+
+	if r.Dir == "" {
+		r.Dir = "/"
+
+		if pwd, ok := r.scopes[0]["PWD"]; ok && path.IsAbs(pwd.Value) {
+			r.Dir = path.Clean(pwd.Value)
+		}
+	}
+
+	for name, value := range map[string]string{
+		"IFS":    " \t\n",
+		"PS4":    "+ ",
+		"OPTIND": "1",
+		"PWD":    r.Dir,
+	} {
+		v := r.scopes[0][name]
+		v.Value = value
+		r.scopes[0][name] = v
+	}
+
+	r.fds = fdTable{
+		0: newFile(orEmpty(r.Stdin), nil, nil),
+		1: newFile(nil, orDiscard(r.Stdout), nil),
+		2: newFile(nil, orDiscard(r.Stderr), nil),
+	}
+}
+
+func orEmpty(r io.Reader) io.Reader {
+	if r == nil {
+		return strings.NewReader("")
+	}
+
+	return r
+}
+
+func orDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+
+	return w
+}
+
+// Run runs a parsed script, returning its exit status; that of the last
+// command run, or that given to 'exit'.
+//
+// The EXIT trap, if set, is run once the script completes, and Run waits for
+// any background jobs to finish before returning.
+//
+// Errors in the script are reported to Stderr, as bash would, and do not cause
+// an error to be returned; the returned error is non-nil only when the Context
+// is cancelled.
+func (r *Runner) Run(ctx context.Context, f *bash.File) (int, error) {
+	r.init()
+
+	err := r.script(ctx, f)
+	if err == nil || err == errExit {
+		err = r.exit(ctx)
+	}
+
+	r.shared.jobs.Wait()
+
+	if err == errExit {
+		err = nil
+	}
+
+	return r.status, err
+}
+
+// RunString parses and runs a script, as with Run.
+func (r *Runner) RunString(ctx context.Context, src string) (int, error) {
+	tk := parser.NewStringTokeniser(src)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		return 2, err
+	}
+
+	return r.Run(ctx, f)
+}
+
+// exit runs the EXIT trap, if set.
+func (r *Runner) exit(ctx context.Context) error {
+	err := r.trap(ctx, "EXIT")
+
+	delete(r.traps, "EXIT")
+
+	return err
+}
+
+// subshell returns a copy of the shell, as run by a subshell, a pipeline, or a
+// background job.
+//
+// Traps, other than those that are ignored, are reset.
+func (r *Runner) subshell() *Runner {
+	s := *r
+
+	s.scopes = r.copyScopes()
+	s.funcs = make(map[string]*bash.Compound, len(r.funcs))
+	s.traps = make(map[string]string)
+	s.fds = r.fds.copy()
+	s.jobs = nil
+	s.pid = r.shared.newPID()
+	s.subshells++
+	s.Args = append([]string(nil), r.Args...)
+
+	for name, fn := range r.funcs {
+		s.funcs[name] = fn
+	}
+
+	for signal, action := range r.traps {
+		if action == "" {
+			s.traps[signal] = action
+		}
+	}
+
+	return &s
+}
+
+// runSubshell runs a function in a subshell, returning its exit status.
+func (r *Runner) runSubshell(ctx context.Context, fn func(*Runner) error) (int, error) {
+	s := r.subshell()
+
+	return s.inSubshell(ctx, func() error {
+		return fn(s)
+	})
+}
+
+// inSubshell runs a function as the whole of a subshell, returning its exit
+// status, and closing its file descriptors once the EXIT trap has run.
+//
+// Errors that would stop the shell, or abandon the current line, instead
+// stop only the subshell.
+func (s *Runner) inSubshell(ctx context.Context, fn func() error) (int, error) {
+	defer s.fds.close()
+
+	err := fn()
+	if err == nil || isFlow(err) && ctx.Err() == nil {
+		err = s.exit(ctx)
+	}
+
+	if err != nil && ctx.Err() == nil {
+		err = nil
+	}
+
+	return s.status, err
+}
+
+// expander returns an expand.Expander for the current state of the shell.
+func (r *Runner) expander(ctx context.Context) *expand.Expander {
+	return &expand.Expander{
+		Env:     r,
+		FS:      r.FS,
+		Dir:     r.Dir,
+		Options: r.Options.expand(),
+		Substitute: func(cs *bash.CommandSubstitution) (string, error) {
+			return r.substitute(ctx, cs)
+		},
+		Arithmetic: r.arithmetic,
+	}
+}
+
+// arithEvaluator returns an arith.Evaluator for the '(( ))' command and the
+// arithmetic 'for' loop.
+func (r *Runner) arithEvaluator(ctx context.Context) *arith.Evaluator {
+	return &arith.Evaluator{
+		Vars:    arith.Env(r),
+		NoUnset: r.Options&NoUnset != 0,
+		Expand:  r.expander(ctx).Word,
+	}
+}
+
+// substitute runs the command of a command or process substitution.
+func (r *Runner) substitute(ctx context.Context, cs *bash.CommandSubstitution) (string, error) {
+	if cs.SubstitutionType == bash.SubstitutionProcessInput || cs.SubstitutionType == bash.SubstitutionProcessOutput {
+		return r.processSubstitution(ctx, cs)
+	}
+
+	var buf strings.Builder
+
+	status, err := r.runSubshell(ctx, func(s *Runner) error {
+		s.Options &^= ErrExit
+		s.substitutions++
+		s.fds.set(1, newFile(nil, &buf, nil))
+
+		return s.file(ctx, &cs.Command)
+	})
+
+	r.status = status
+	r.subStatus = status
+
+	return buf.String(), err
+}
+
+// processSubstitution runs the command of a process substitution in the
+// background, connected by a pipe to a new file descriptor, returning the path
+// by which that file descriptor can be opened.
+//
+// The file descriptor is closed once the command using it has completed. As
+// it exists only within the shell, it can be opened by redirections, but not
+// by external commands.
+func (r *Runner) processSubstitution(ctx context.Context, cs *bash.CommandSubstitution) (string, error) {
+	pr, pw := io.Pipe()
+	reader, writer := newFile(pr, nil, pr), newFile(nil, pw, pw)
+	s := r.subshell()
+	fd := r.fds.free()
+	sctx, cancel := context.WithCancel(ctx)
+
+	if cs.SubstitutionType == bash.SubstitutionProcessOutput {
+		s.fds.set(0, reader)
+		r.fds.set(fd, writer)
+	} else {
+		writer.broken = cancel
+
+		s.fds.set(1, writer)
+		r.fds.set(fd, reader)
+	}
+
+	r.procSubs = append(r.procSubs, fd)
+
+	r.shared.jobs.Add(1)
+
+	go func() {
+		defer r.shared.jobs.Done()
+		defer cancel()
+
+		s.inSubshell(sctx, func() error {
+			return s.file(sctx, &cs.Command)
+		})
+	}()
+
+	return fmt.Sprintf("/dev/fd/%d", fd), nil
+}
+
+// closeProcSubs closes the file descriptors of the process substitutions
+// made since the given number had been made.
+func (r *Runner) closeProcSubs(n int) {
+	for _, fd := range r.procSubs[n:] {
+		r.fds.set(fd, nil)
+	}
+
+	r.procSubs = r.procSubs[:n]
+}
+
+// Control flow.
+var (
+	errExit    = errors.New("exit")
+	errReturn  = errors.New("return")
+	errDiscard = errors.New("discard")
+)
+
+// loopControl is returned by the 'break' and 'continue' builtins to unwind
+// the given number of enclosing loops.
+type loopControl struct {
+	n    int
+	cont bool
+}
+
+func (l loopControl) Error() string {
+	if l.cont {
+		return "continue"
+	}
+
+	return "break"
+}
+
+// isFlow determines whether an error is one that controls the flow of the
+// script, or stops it, as opposed to a failure to be reported.
+func isFlow(err error) bool {
+	switch err {
+	case errExit, errReturn, errDiscard:
+		return true
+	}
+
+	_, ok := err.(loopControl)
+
+	return ok || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// failed reports a failure of a command, setting the exit status to one.
+//
+// Errors that control the flow of the script are returned unchanged.
+func (r *Runner) failed(err error) error {
+	if isFlow(err) {
+		return err
+	}
+
+	r.status = 1
+
+	r.errorf("%s", message(err))
+
+	return nil
+}
+
+// expansion reports an error in the expansion of a word, returning the error
+// that stops the script, for an unset parameter, or that abandons the current
+// command otherwise.
+func (r *Runner) expansion(err error) error {
+	if isFlow(err) {
+		return err
+	}
+
+	r.status = 1
+
+	r.errorf("%s", message(err))
+
+	var pe expand.ParameterError
+
+	if errors.Is(err, expand.ErrUnbound) || errors.As(err, &pe) {
+		return errExit
+	}
+
+	return errDiscard
+}
+
+// errorf writes an error message to stderr, prefixed with the name of the
+// shell and the current line number.
+func (r *Runner) errorf(format string, a ...any) {
+	fmt.Fprintf(r.stderr(), "%s: line %d: %s\n", r.Name, r.lineno, fmt.Sprintf(format, a...))
+}
+
+func (r *Runner) warn(err error) {
+	r.errorf("warning: %s", err)
+}
+
+// message returns the message bash would print for an error.
+func message(err error) string {
+	var pe *fs.PathError
+
+	if !errors.As(err, &pe) {
+		return err.Error()
+	}
+
+	switch {
+	case errors.Is(pe.Err, fs.ErrNotExist):
+		return pe.Path + ": No such file or directory"
+	case errors.Is(pe.Err, ErrNoClobber):
+		return pe.Path + ": " + pe.Err.Error()
+	}
+
+	msg := pe.Err.Error()
+	c, size := utf8.DecodeRuneInString(msg)
+
+	return pe.Path + ": " + string(unicode.ToUpper(c)) + msg[size:]
+}
+
+// Errors.
+var (
+	ErrNotFound        = errors.New("command not found")
+	ErrIsDirectory     = errors.New("is a directory")
+	ErrNotDirectory    = errors.New("not a directory")
+	ErrBadFD           = errors.New("bad file descriptor")
+	ErrReadOnly        = errors.New("read-only file system")
+	ErrNoClobber       = errors.New("cannot overwrite existing file")
+	ErrAmbiguous       = errors.New("ambiguous redirect")
+	ErrCircularNameref = errors.New("circular name reference")
+)
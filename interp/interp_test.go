@@ -0,0 +1,620 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testExec implements a few external commands for testing.
+func testExec(_ context.Context, cmd *Command) (int, error) {
+	stdout := cmd.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+
+	switch cmd.Args[0] {
+	case "echo":
+		fmt.Fprintln(stdout, strings.Join(cmd.Args[1:], " "))
+	case "err":
+		fmt.Fprintln(cmd.Stderr, strings.Join(cmd.Args[1:], " "))
+	case "cat":
+		if cmd.Stdin != nil {
+			io.Copy(stdout, cmd.Stdin)
+		}
+	case "env":
+		for _, name := range cmd.Args[1:] {
+			fmt.Fprintf(stdout, "%s=%s\n", name, cmd.Getenv(name))
+		}
+	case "pwd":
+		fmt.Fprintln(stdout, cmd.Dir)
+	case "status":
+		status, _ := strconv.Atoi(cmd.Args[1])
+
+		return status, nil
+	case "yes":
+		for {
+			if _, err := fmt.Fprintln(stdout, "y"); err != nil {
+				return 1, nil
+			}
+		}
+	case "head":
+		line, err := readLine(cmd.Stdin)
+		if err == nil {
+			fmt.Fprintln(stdout, line)
+		}
+	case "noexec":
+		return 0, os.ErrPermission
+	default:
+		return 0, ErrNotFound
+	}
+
+	return 0, nil
+}
+
+func TestRun(t *testing.T) {
+	for n, test := range [...]struct {
+		Script  string
+		Options Options
+		Stdin   string
+		Args    []string
+		Stdout  string
+		Stderr  string
+		Status  int
+	}{
+		{ // 1
+			Script: "echo hello world",
+			Stdout: "hello world\n",
+		},
+		{ // 2
+			Script: "x=1 y=$x; echo $x $y",
+			Stdout: "1 1\n",
+		},
+		{ // 3
+			Script: "nosuch a b",
+			Stderr: "bash: line 1: nosuch: command not found\n",
+			Status: 127,
+		},
+		{ // 4
+			Script: "noexec",
+			Stderr: "bash: line 1: noexec: Permission denied\n",
+			Status: 126,
+		},
+		{ // 5
+			Script: "status 3; echo $?",
+			Stdout: "3\n",
+		},
+		{ // 6
+			Script: "x=5 env x; echo \"[$x]\"",
+			Stdout: "x=5\n[]\n",
+		},
+		{ // 7
+			Script: "status 1 && echo a || echo b; true || echo c && echo d",
+			Stdout: "b\nd\n",
+		},
+		{ // 8
+			Script: "! status 3; echo $?; ! true; echo $?",
+			Stdout: "0\n1\n",
+		},
+		{ // 9
+			Script: "echo a | cat; true | status 2; echo $? ${PIPESTATUS[@]}",
+			Stdout: "a\n2 0 2\n",
+		},
+		{ // 10
+			Script:  "status 2 | true; echo $?",
+			Options: PipeFail,
+			Stdout:  "2\n",
+		},
+		{ // 11
+			Script: "x=1; echo a | x=2; echo $x",
+			Stdout: "1\n",
+		},
+		{ // 12
+			Script:  "x=1; echo a | x=2; echo $x",
+			Options: LastPipe,
+			Stdout:  "2\n",
+		},
+		{ // 13
+			Script: "yes | head; echo ${PIPESTATUS[@]}",
+			Stdout: "y\n141 0\n",
+		},
+		{ // 14
+			Script: "x=1; (x=2; echo $x $BASH_SUBSHELL); echo $x $BASH_SUBSHELL",
+			Stdout: "2 1\n1 0\n",
+		},
+		{ // 15
+			Script: "(status 4); echo $?",
+			Stdout: "4\n",
+		},
+		{ // 16
+			Script: "echo $(echo a; status 3) $?; x=$(status 2); echo $?",
+			Stdout: "a 3\n2\n",
+		},
+		{ // 17
+			Script: "x=$(printf_missing 2>&1); echo \"[$x]\"",
+			Stdout: "[bash: line 1: printf_missing: command not found]\n",
+		},
+		{ // 18
+			Script: "f() { echo \"$# $1 $2\" $FUNCNAME; }; f a \"b c\"; echo $#",
+			Args:   []string{"x"},
+			Stdout: "2 a b c f\n1\n",
+		},
+		{ // 19
+			Script: "f() { x=in; g; }; g() { echo $x ${FUNCNAME[@]}; }; x=out; f; echo $x",
+			Stdout: "in g f main\nin\n",
+		},
+		{ // 20
+			Script: "f() { echo $x; env x; }; x=1 f; echo \"[$x]\"",
+			Stdout: "1\nx=1\n[]\n",
+		},
+		{ // 21
+			Script: "f() { echo out; echo err >&2; } 2>&1 >/dev/null; f",
+			Stdout: "err\n",
+		},
+		{ // 22
+			Script: "if status 1; then echo a; elif true; then echo b; else echo c; fi",
+			Stdout: "b\n",
+		},
+		{ // 23
+			Script: "if status 1; then echo a; fi; echo $?",
+			Stdout: "0\n",
+		},
+		{ // 24
+			Script: "case abc in a*) echo 1;& x) echo 2;; *) echo 3;; esac",
+			Stdout: "1\n2\n",
+		},
+		{ // 25
+			Script: "case abc in a*) echo 1;;& x) echo 2;; *c) echo 3;; *) echo 4;; esac",
+			Stdout: "1\n3\n",
+		},
+		{ // 26
+			Script:  "case ABC in a?c) echo match;; esac",
+			Options: NoCaseMatch,
+			Stdout:  "match\n",
+		},
+		{ // 27
+			Script: "case \"*\" in \"*\") echo quoted;; esac; x=a; case $x in \"$x\") echo var;; esac",
+			Stdout: "quoted\nvar\n",
+		},
+		{ // 28
+			Script: "i=0; while (( i < 3 )); do echo $i; (( i++ )); done; echo $?",
+			Stdout: "0\n1\n2\n0\n",
+		},
+		{ // 29
+			Script: "i=0; until (( i == 2 )); do (( i++ )); done; echo $i",
+			Stdout: "2\n",
+		},
+		{ // 30
+			Script: "for i in 1 2 3; do [[ $i == 2 ]] && continue; echo $i; done",
+			Stdout: "1\n3\n",
+		},
+		{ // 31
+			Script: "for i in 1 2; do for j in a b; do [[ $j == b ]] && continue 2; [[ $i == 2 ]] && break 2; echo $i$j; done; done; echo end",
+			Stdout: "1a\nend\n",
+		},
+		{ // 32
+			Script: "for x; do echo $x; done; for y in; do echo $y; done",
+			Args:   []string{"a", "b c"},
+			Stdout: "a\nb c\n",
+		},
+		{ // 33
+			Script: "for (( i = 0; i < 3; i++ )); do echo $i; done; for ((;;)); do break; done",
+			Stdout: "0\n1\n2\n",
+		},
+		{ // 34
+			Script: "select x in a b c; do echo \"$x $REPLY\"; [[ $REPLY == 3 ]] && break; done",
+			Stdin:  "2\n\nz\n3\n",
+			Stdout: "b 2\n z\nc 3\n",
+			Stderr: "1) a\n2) b\n3) c\n#? #? 1) a\n2) b\n3) c\n#? #? ",
+		},
+		{ // 35
+			Script: "for i in 1 2; do break 0; echo $i; done; echo $?",
+			Stdout: "1\n",
+			Stderr: "bash: line 1: break: 0: loop count out of range\n",
+		},
+		{ // 36
+			Script: "[[ abc =~ a(b)c ]] && echo ${BASH_REMATCH[1]}; [[ -o pipefail ]]; echo $?",
+			Stdout: "b\n1\n",
+		},
+		{ // 37
+			Script: "(( x = 3 * 4 )); echo $x $?; (( 0 )); echo $?",
+			Stdout: "12 0\n1\n",
+		},
+		{ // 38
+			Script: "echo a; (( 1 / 0 )); echo $?\necho b",
+			Stdout: "a\n1\nb\n",
+			Stderr: "bash: line 1: ((: 1 / 0 : division by 0 (error token is \"0 \")\n",
+		},
+		{ // 39
+			Script: "echo a; echo $(( 1 / 0 )); echo b\necho c",
+			Stdout: "a\nc\n",
+			Stderr: "bash: line 1: 1 / 0 : division by 0 (error token is \"0 \")\n",
+			Status: 0,
+		},
+		{ // 40
+			Script: "echo ${x:?unset}; echo b\necho c",
+			Stderr: "bash: line 1: x: unset\n",
+			Status: 1,
+		},
+		{ // 41
+			Script:  "echo a\necho $x\necho b",
+			Options: NoUnset,
+			Stdout:  "a\n",
+			Stderr:  "bash: line 2: x: unbound variable\n",
+			Status:  1,
+		},
+		{ // 42
+			Script:  "(echo $x); echo $?",
+			Options: NoUnset,
+			Stdout:  "1\n",
+			Stderr:  "bash: line 1: x: unbound variable\n",
+		},
+		{ // 43
+			Script:  "status 1 || true; if status 2; then :; fi; ! true; echo a; status 3; echo b",
+			Options: ErrExit,
+			Stdout:  "a\n",
+			Status:  3,
+		},
+		{ // 44
+			Script:  "(status 2; echo no); echo $?",
+			Options: ErrExit,
+			Status:  2,
+		},
+		{ // 45
+			Script:  "x=$(status 2; echo yes); echo $x",
+			Options: ErrExit,
+			Stdout:  "yes\n",
+		},
+		{ // 46
+			Script:  "x=1\necho $x $(echo y)",
+			Options: XTrace,
+			Stdout:  "1 y\n",
+			Stderr:  "+ x=1\n++ echo y\n+ echo 1 y\n",
+		},
+		{ // 47
+			Script:  "PS4='[$LINENO] '; echo 'a b' \"\" 'c'",
+			Options: XTrace,
+			Stdout:  "a b  c\n",
+			Stderr:  "+ PS4='[$LINENO] '\n[1] echo 'a b' '' c\n",
+		},
+		{ // 48
+			Script:  "a=(x 'y z'); b=$(echo c) d=1 env d",
+			Options: XTrace,
+			Stdout:  "d=1\n",
+			Stderr:  "+ a=(x 'y z')\n++ echo c\n+ b=c d=1 env d\n",
+		},
+		{ // 49
+			Script: "echo $LINENO\n\necho $LINENO",
+			Stdout: "1\n3\n",
+		},
+		{ // 50
+			Script: "a=(1 2 3); a+=(4); a[1]+=x; echo ${#a[@]} ${a[@]}",
+			Stdout: "4 1 2x 3 4\n",
+		},
+		{ // 51
+			Script: "a=(x [5]=y z); echo ${!a[@]} ${a[@]}; k=2; b=([$k]=v [k+1]=w); echo ${!b[@]}",
+			Stdout: "0 5 6 x y z\n2 3\n",
+		},
+		{ // 52
+			Script: "v='a b'; a=($v \"$v\" *.none); echo ${#a[@]}",
+			Stdout: "4\n",
+		},
+		{ // 53
+			Script: "x=a; x+=b; echo $x; a=(1 2); a=3; echo ${a[@]}",
+			Stdout: "ab\n3 2\n",
+		},
+		{ // 54
+			Script: "echo a$#b s$? $-",
+			Stdout: "a0b s0 hB\n",
+		},
+		{ // 55
+			Script: "echo $0; echo ${RANDOM//[0-9]/}",
+			Stdout: "bash\n\n",
+		},
+		{ // 56
+			Script: "true & [[ -n $! ]] && echo b",
+			Stdout: "b\n",
+		},
+		{ // 57
+			Script: "cat & echo bg",
+			Stdin:  "not read\n",
+			Stdout: "bg\n",
+		},
+		{ // 58
+			Script: "cat",
+			Stdin:  "input\n",
+			Stdout: "input\n",
+		},
+		{ // 59
+			Script: "echo a b; echo \"$_\"; x=1; echo \"[$_]\"; f() { :; }; f c; echo \"$_\"; echo d | true e; echo \"$_\"",
+			Stdout: "a b\nb\n[]\nc\nc\n",
+		},
+		{ // 60
+			Script: "true | false; if true; then false | true; fi; echo ${PIPESTATUS[@]}; false | true; case x in y) ;; esac; echo ${PIPESTATUS[@]}; true | false; [[ x ]]; echo ${PIPESTATUS[@]}",
+			Stdout: "1 0\n1 0\n0\n",
+		},
+		{ // 61
+			Script: "set -e; { false && :; }; if true; then false || false && :; fi; echo a; { false; }; echo unreached",
+			Stdout: "a\n",
+			Status: 1,
+		},
+		{ // 62
+			Script: "for ((  i = 1/0 ; ; )); do :; done; for (( i = 0; i < 1/0  ; )); do :; done; for (( i = 0; i < 1; i = 1/0 )); do :; done",
+			Stderr: "bash: line 1: ((: i = 1/0 : division by 0 (error token is \"0 \")\nbash: line 1: ((: i < 1/0  : division by 0 (error token is \"0  \")\nbash: line 1: ((: i = 1/0 : division by 0 (error token is \"0 \")\n",
+			Status: 1,
+		},
+		{ // 63
+			Script: "declare -n r=s; s=1; [[ -R r ]]; echo $?; test -R r; echo $?; [ -R s ]; echo $?; echo ${!r}; declare -n e; [[ -R e ]]; echo $?; f() { local -n q=$1; echo ${!q} $q; }; f s",
+			Stdout: "0\n0\n1\ns\n1\ns 1\n",
+		},
+	} {
+		var stdout, stderr strings.Builder
+
+		r := Runner{
+			Args:    test.Args,
+			Stdin:   strings.NewReader(test.Stdin),
+			Stdout:  &stdout,
+			Stderr:  &stderr,
+			Exec:    ExecFunc(testExec),
+			Options: test.Options,
+		}
+
+		if status, err := r.RunString(context.Background(), test.Script); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		} else if out := stdout.String(); out != test.Stdout {
+			t.Errorf("test %d: expecting stdout %q, got %q", n+1, test.Stdout, out)
+		} else if errs := stderr.String(); errs != test.Stderr {
+			t.Errorf("test %d: expecting stderr %q, got %q", n+1, test.Stderr, errs)
+		}
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	for n, test := range [...]struct {
+		Script  string
+		Options Options
+		Stdout  string
+		Stderr  string
+		Status  int
+		Files   map[string]string
+	}{
+		{ // 1
+			Script: "echo a > file; echo b >> file; cat < file",
+			Stdout: "a\nb\n",
+			Files:  map[string]string{"file": "a\nb\n"},
+		},
+		{ // 2
+			Script: "echo a >&2; err b 2>&1",
+			Stdout: "b\n",
+			Stderr: "a\n",
+		},
+		{ // 3
+			Script: "{ echo out; err err; } &> file; cat <file",
+			Stdout: "out\nerr\n",
+			Files:  map[string]string{"file": "out\nerr\n"},
+		},
+		{ // 4
+			Script: "{ echo out; err err; } 2>&1 >/dev/null | cat",
+			Stdout: "err\n",
+		},
+		{ // 5
+			Script: "cat < nosuch; echo $?",
+			Stdout: "1\n",
+			Stderr: "bash: line 1: nosuch: No such file or directory\n",
+		},
+		{ // 6
+			Script: "echo a >&3; echo $?",
+			Stdout: "1\n",
+			Stderr: "bash: line 1: 3: Bad file descriptor\n",
+		},
+		{ // 7
+			Script: "x='a b'; echo a > $x; echo $?",
+			Stdout: "1\n",
+			Stderr: "bash: line 1: $x: ambiguous redirect\n",
+		},
+		{ // 8
+			Script:  "echo a > file; echo b > file; echo c >| file; cat <file",
+			Options: NoClobber,
+			Stdout:  "c\n",
+			Stderr:  "bash: line 1: file: cannot overwrite existing file\n",
+			Files:   map[string]string{"file": "c\n"},
+		},
+		{ // 9
+			Script: "echo a > .; echo $?",
+			Stdout: "1\n",
+			Stderr: "bash: line 1: .: Is a directory\n",
+		},
+		{ // 10
+			Script: "cat <<EOF\na $((1 + 2)) \\$x \\\\ \\\nb\nEOF",
+			Stdout: "a 3 $x \\ b\n",
+		},
+		{ // 11
+			Script: "cat <<'EOF'\na $((1 + 2)) \\$x\nEOF",
+			Stdout: "a $((1 + 2)) \\$x\n",
+		},
+		{ // 12
+			Script: "cat <<-EOF\n\tindented\n\tEOF",
+			Stdout: "indented\n",
+		},
+		{ // 13
+			Script: "cat <<< \"a b\"",
+			Stdout: "a b\n",
+		},
+		{ // 14
+			Script: "echo a 3>file >&3; cat <file",
+			Stdout: "a\n",
+			Files:  map[string]string{"file": "a\n"},
+		},
+		{ // 15
+			Script: "echo data >file; cat 3<file <&3; cat <&3; echo $?",
+			Stdout: "data\n1\n",
+			Stderr: "bash: line 1: 3: Bad file descriptor\n",
+			Files:  map[string]string{"file": "data\n"},
+		},
+		{ // 16
+			Script: "echo a >&-; echo $?",
+			Stdout: "0\n",
+		},
+		{ // 17
+			Script: "cat <(echo a) < <(echo b); cat < <(echo c)",
+			Stdout: "b\nc\n",
+		},
+		{ // 18
+			Script: "echo a > >(cat)",
+			Stdout: "a\n",
+		},
+		{ // 19
+			Script: "if true; then echo a; echo b; fi > file; cat < file",
+			Stdout: "a\nb\n",
+			Files:  map[string]string{"file": "a\nb\n"},
+		},
+		{ // 20
+			Script: "cat </dev/stdin; echo a >/dev/stderr",
+			Stderr: "a\n",
+		},
+	} {
+		var stdout, stderr strings.Builder
+
+		dir := t.TempDir()
+		r := Runner{
+			Dir:     dir,
+			Stdout:  &stdout,
+			Stderr:  &stderr,
+			Exec:    ExecFunc(testExec),
+			Open:    OS{},
+			Options: test.Options,
+		}
+
+		if status, err := r.RunString(context.Background(), test.Script); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		} else if out := stdout.String(); out != test.Stdout {
+			t.Errorf("test %d: expecting stdout %q, got %q", n+1, test.Stdout, out)
+		} else if errs := stderr.String(); errs != test.Stderr {
+			t.Errorf("test %d: expecting stderr %q, got %q", n+1, test.Stderr, errs)
+		}
+
+		for name, contents := range test.Files {
+			if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil {
+				t.Errorf("test %d: unexpected error reading %s: %s", n+1, name, err)
+			} else if string(data) != contents {
+				t.Errorf("test %d: expecting file %s to contain %q, got %q", n+1, name, contents, data)
+			}
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	var (
+		cmd   *Command
+		stdin string
+	)
+
+	r := Runner{
+		Env: []string{"HOME=/home/user", "PWD=/home/user/dir"},
+		FS:  fstest.MapFS{"home/user/dir/file.txt": {Data: []byte("contents\n")}},
+		Exec: ExecFunc(func(_ context.Context, c *Command) (int, error) {
+			cmd = c
+
+			if c.Stdin != nil {
+				data, _ := io.ReadAll(c.Stdin)
+				stdin = string(data)
+			}
+
+			return 0, nil
+		}),
+	}
+
+	if _, err := r.RunString(context.Background(), "x=1; y=2 cmd *.txt ~ $HOME < file.txt"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if cmd == nil {
+		t.Fatal("expecting command to be run")
+	} else if args := strings.Join(cmd.Args, " "); args != "cmd file.txt /home/user /home/user" {
+		t.Errorf("expecting args %q, got %q", "cmd file.txt /home/user /home/user", args)
+	} else if cmd.Dir != "/home/user/dir" {
+		t.Errorf("expecting dir %q, got %q", "/home/user/dir", cmd.Dir)
+	} else if home, x, y := cmd.Getenv("HOME"), cmd.Getenv("x"), cmd.Getenv("y"); home != "/home/user" || x != "" || y != "2" {
+		t.Errorf("expecting environment HOME=/home/user, x=, and y=2, got HOME=%s, x=%s, and y=%s", home, x, y)
+	} else if stdin != "contents\n" {
+		t.Errorf("expecting stdin %q, got %q", "contents\n", stdin)
+	}
+
+	if status, _ := r.RunString(context.Background(), "cmd > file.txt"); status != 1 {
+		t.Errorf("expecting status 1 writing without an OpenHandler, got %d", status)
+	}
+}
+
+type conditionHandler struct {
+	ExecFunc
+	conditions []Condition
+}
+
+func (c *conditionHandler) Condition(_ context.Context, cd *Condition) {
+	c.conditions = append(c.conditions, *cd)
+}
+
+func TestConditions(t *testing.T) {
+	for n, test := range [...]struct {
+		Script     string
+		Conditions []Condition
+	}{
+		{ // 1
+			Script:     "[[ -n $x && $x == a* ]]",
+			Conditions: []Condition{{Command: "[[ -n $x && $x == a* ]]", Operands: []string{"abc", "abc", "a*"}}},
+		},
+		{ // 2
+			Script:     "[[ -f file.txt || -d $x ]]",
+			Conditions: []Condition{{Command: "[[ -f file.txt || -d $x ]]", Operands: []string{"file.txt"}, Files: []string{"file.txt"}}},
+		},
+		{ // 3
+			Script:     "test -e nosuch",
+			Conditions: []Condition{{Command: "test -e nosuch", Operands: []string{"-e", "nosuch"}, Files: []string{"nosuch"}, Status: 1}},
+		},
+		{ // 4
+			Script:     "case $x in a) ;; abc) ;; esac",
+			Conditions: []Condition{{Command: "case $x in ", Operands: []string{"abc", "a", "abc"}}},
+		},
+		{ // 5
+			Script:     "case $x in a) ;; esac",
+			Conditions: []Condition{{Command: "case $x in ", Operands: []string{"abc", "a"}, Status: 1}},
+		},
+		{ // 6
+			Script: "echo $x",
+		},
+	} {
+		h := conditionHandler{ExecFunc: testExec}
+		r := Runner{
+			Env:  []string{"x=abc", "PWD=/home/user/dir"},
+			FS:   fstest.MapFS{"home/user/dir/file.txt": {}},
+			Exec: &h,
+		}
+
+		if _, err := r.RunString(context.Background(), test.Script); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !reflect.DeepEqual(h.conditions, test.Conditions) {
+			t.Errorf("test %d: expecting conditions %v, got %v", n+1, test.Conditions, h.conditions)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	r := Runner{}
+
+	if _, err := r.RunString(ctx, "while true; do :; done"); err != context.DeadlineExceeded {
+		t.Errorf("expecting error %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,132 @@
+package interp
+
+import (
+	"strings"
+
+	"vimagination.zapto.org/bash/expand"
+)
+
+// Options are the shell options of a Runner, as set by the 'set' and 'shopt'
+// builtins.
+type Options uint32
+
+// Option flags.
+const (
+	AllExport   Options = 1 << iota // set -a
+	ErrExit                         // set -e
+	NoGlob                          // set -f
+	NoExec                          // set -n
+	NoUnset                         // set -u
+	XTrace                          // set -x
+	NoClobber                       // set -C
+	ErrTrace                        // set -E
+	PipeFail                        // set -o pipefail
+	NullGlob                        // shopt -s nullglob
+	FailGlob                        // shopt -s failglob
+	DotGlob                         // shopt -s dotglob
+	NoCaseGlob                      // shopt -s nocaseglob
+	NoCaseMatch                     // shopt -s nocasematch
+	ExtGlob                         // shopt -s extglob
+	LastPipe                        // shopt -s lastpipe
+)
+
+// setOptions are the options set by 'set -o', in the order they are listed by
+// bash.
+var setOptions = [...]struct {
+	name   string
+	letter byte
+	option Options
+}{
+	{"allexport", 'a', AllExport},
+	{"errexit", 'e', ErrExit},
+	{"errtrace", 'E', ErrTrace},
+	{"noclobber", 'C', NoClobber},
+	{"noexec", 'n', NoExec},
+	{"noglob", 'f', NoGlob},
+	{"nounset", 'u', NoUnset},
+	{"pipefail", 0, PipeFail},
+	{"xtrace", 'x', XTrace},
+}
+
+// shoptOptions are the options set by 'shopt -s', in the order they are listed
+// by bash.
+var shoptOptions = [...]struct {
+	name   string
+	option Options
+}{
+	{"dotglob", DotGlob},
+	{"extglob", ExtGlob},
+	{"failglob", FailGlob},
+	{"lastpipe", LastPipe},
+	{"nocaseglob", NoCaseGlob},
+	{"nocasematch", NoCaseMatch},
+	{"nullglob", NullGlob},
+}
+
+// setOption returns the option set by 'set -o' with the given name.
+func setOption(name string) (Options, bool) {
+	for _, o := range setOptions {
+		if o.name == name {
+			return o.option, true
+		}
+	}
+
+	return 0, false
+}
+
+// isSetOption determines whether the option set by 'set -o' with the given
+// name is enabled.
+func (r *Runner) isSetOption(name string) bool {
+	o, ok := setOption(name)
+
+	return ok && r.Options&o != 0
+}
+
+// flags returns the letters of the set options, as the value of the '$-'
+// parameter, including those of the hashall and braceexpand options, which
+// are always set.
+func (o Options) flags() string {
+	var sb strings.Builder
+
+	for _, c := range []byte("aefhnuxBCE") {
+		if c == 'h' || c == 'B' {
+			sb.WriteByte(c)
+
+			continue
+		}
+
+		for _, opt := range setOptions {
+			if opt.letter == c && o&opt.option != 0 {
+				sb.WriteByte(c)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// expand returns the options of an expand.Expander that correspond to the
+// shell options.
+func (o Options) expand() expand.Options {
+	var opts expand.Options
+
+	for _, m := range [...]struct {
+		option Options
+		expand expand.Options
+	}{
+		{NoUnset, expand.NoUnset},
+		{NoGlob, expand.NoGlob},
+		{NullGlob, expand.NullGlob},
+		{FailGlob, expand.FailGlob},
+		{DotGlob, expand.DotGlob},
+		{NoCaseGlob, expand.NoCaseGlob},
+		{NoCaseMatch, expand.NoCaseMatch},
+		{ExtGlob, expand.ExtGlob},
+	} {
+		if o&m.option != 0 {
+			opts |= m.expand
+		}
+	}
+
+	return opts
+}
@@ -0,0 +1,598 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/expand"
+)
+
+// file is an open file description, which may be referred to by several file
+// descriptors, in this shell and its subshells.
+//
+// Writes are serialised, as the same file may be written to by concurrently
+// running commands, and the underlying file is closed once no descriptors
+// refer to it.
+type file struct {
+	r      io.Reader
+	w      io.Writer
+	closer io.Closer
+	broken func()
+
+	mu   sync.Mutex
+	refs int
+}
+
+func newFile(r io.Reader, w io.Writer, closer io.Closer) *file {
+	return &file{r: r, w: w, closer: closer, refs: 1}
+}
+
+// Read implements the io.Reader interface.
+func (f *file) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, ErrBadFD
+	}
+
+	return f.r.Read(p)
+}
+
+// Write implements the io.Writer interface.
+//
+// A write to a pipe whose reader has been closed calls the broken function,
+// which stops the writing subshell, as with SIGPIPE.
+func (f *file) Write(p []byte) (int, error) {
+	if f.w == nil {
+		return 0, ErrBadFD
+	}
+
+	f.mu.Lock()
+	n, err := f.w.Write(p)
+	f.mu.Unlock()
+
+	if errors.Is(err, io.ErrClosedPipe) && f.broken != nil {
+		f.broken()
+	}
+
+	return n, err
+}
+
+func (f *file) ref() *file {
+	f.mu.Lock()
+	f.refs++
+	f.mu.Unlock()
+
+	return f
+}
+
+func (f *file) unref() {
+	f.mu.Lock()
+	f.refs--
+	last := f.refs == 0
+	f.mu.Unlock()
+
+	if last && f.closer != nil {
+		f.closer.Close()
+	}
+}
+
+// reader returns the underlying reader, which allows an *os.File to be given
+// directly to an external command.
+func (f *file) reader() io.Reader {
+	if f == nil || f.r == nil {
+		return nil
+	} else if _, ok := f.r.(*os.File); ok {
+		return f.r
+	}
+
+	return f
+}
+
+// writer returns the underlying writer, which allows an *os.File to be given
+// directly to an external command.
+func (f *file) writer() io.Writer {
+	if f == nil || f.w == nil {
+		return nil
+	} else if _, ok := f.w.(*os.File); ok {
+		return f.w
+	}
+
+	return f
+}
+
+// fdTable maps file descriptors to open files.
+type fdTable map[int]*file
+
+// copy returns a copy of the table, as inherited by a subshell.
+func (t fdTable) copy() fdTable {
+	c := make(fdTable, len(t))
+
+	for fd, f := range t {
+		c[fd] = f.ref()
+	}
+
+	return c
+}
+
+// close closes all of the file descriptors in the table.
+func (t fdTable) close() {
+	for fd, f := range t {
+		f.unref()
+		delete(t, fd)
+	}
+}
+
+// set sets a file descriptor, closing any file it previously referred to.
+func (t fdTable) set(fd int, f *file) {
+	if old, ok := t[fd]; ok {
+		old.unref()
+	}
+
+	if f == nil {
+		delete(t, fd)
+	} else {
+		t[fd] = f
+	}
+}
+
+// free returns the lowest unused file descriptor that is at least 10, as
+// allocated by a '{varname}' redirection.
+func (t fdTable) free() int {
+	fd := 10
+
+	for t[fd] != nil {
+		fd++
+	}
+
+	return fd
+}
+
+func (r *Runner) stdin() io.Reader {
+	return r.fds[0].reader()
+}
+
+func (r *Runner) stdout() io.Writer {
+	if f := r.fds[1]; f != nil {
+		return f
+	}
+
+	return io.Discard
+}
+
+func (r *Runner) stderr() io.Writer {
+	if f := r.fds[2]; f != nil {
+		return f
+	}
+
+	return io.Discard
+}
+
+// redirect performs the redirections of a command, returning a function that
+// restores the file descriptors that were changed.
+//
+// When a redirection fails, any already performed are undone.
+func (r *Runner) redirect(ctx context.Context, rs []bash.Redirection) (func(), error) {
+	if len(rs) == 0 {
+		return func() {}, nil
+	}
+
+	saved := make(map[int]*file)
+	restore := func() {
+		for fd, f := range saved {
+			r.fds.set(fd, f)
+		}
+	}
+
+	for n := range rs {
+		if err := r.redirection(ctx, &rs[n], saved); err != nil {
+			restore()
+
+			return nil, err
+		}
+	}
+
+	return restore, nil
+}
+
+// execRedirect performs the redirections of 'exec' without a command, which
+// remain in effect in the current shell.
+//
+// When a redirection fails, those already performed are kept.
+func (r *Runner) execRedirect(ctx context.Context, rs []bash.Redirection) error {
+	saved := make(map[int]*file)
+
+	defer func() {
+		for _, f := range saved {
+			if f != nil {
+				f.unref()
+			}
+		}
+	}()
+
+	for n := range rs {
+		if err := r.redirection(ctx, &rs[n], saved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) redirection(ctx context.Context, rd *bash.Redirection, saved map[int]*file) error {
+	op := rd.Redirector.Data
+	fd := 1
+
+	if strings.HasPrefix(op, "<") {
+		fd = 0
+	}
+
+	if rd.Input != nil && rd.Input.Type != bash.TokenBraceWord {
+		fd, _ = strconv.Atoi(rd.Input.Data)
+	}
+
+	var (
+		target *file
+		move   = -1
+	)
+
+	switch op {
+	case "<<", "<<-":
+		doc, err := r.heredoc(ctx, rd)
+		if err != nil {
+			return err
+		}
+
+		target = newFile(strings.NewReader(doc), nil, nil)
+	case "<<<":
+		word, err := r.expander(ctx).Word(&rd.Output)
+		if err != nil {
+			return r.expansion(err)
+		}
+
+		target = newFile(strings.NewReader(word+"\n"), nil, nil)
+	case "<&", ">&":
+		word, err := r.expander(ctx).Word(&rd.Output)
+		if err != nil {
+			return r.expansion(err)
+		}
+
+		src, moved := strings.CutSuffix(word, "-")
+
+		switch {
+		case word == "-":
+		case isNumber(src):
+			n, _ := strconv.Atoi(src)
+
+			f, ok := r.fds[n]
+			if !ok {
+				return &fs.PathError{Op: "dup", Path: src, Err: ErrBadFD}
+			}
+
+			target = f.ref()
+
+			if moved {
+				move = n
+			}
+		case op == ">&" && rd.Input == nil:
+			return r.redirectBoth(ctx, rd, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, saved)
+		default:
+			return fmt.Errorf("%s: %w", rd.Output, ErrAmbiguous)
+		}
+	case "&>", "&>>":
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+		if op == "&>>" {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+
+		return r.redirectBoth(ctx, rd, flag, saved)
+	default:
+		f, err := r.openRedirection(ctx, rd, op)
+		if err != nil {
+			return err
+		}
+
+		target = f
+	}
+
+	if rd.Input != nil && rd.Input.Type == bash.TokenBraceWord {
+		return r.redirectVar(strings.Trim(rd.Input.Data, "{}"), target)
+	}
+
+	r.save(saved, fd)
+	r.fds.set(fd, target)
+
+	if move >= 0 && move != fd {
+		r.save(saved, move)
+		r.fds.set(move, nil)
+	}
+
+	return nil
+}
+
+// save records the file referred to by a file descriptor, so that it can be
+// restored after the redirections of a command.
+func (r *Runner) save(saved map[int]*file, fd int) {
+	if _, ok := saved[fd]; ok {
+		return
+	} else if old := r.fds[fd]; old != nil {
+		saved[fd] = old.ref()
+	} else {
+		saved[fd] = nil
+	}
+}
+
+// redirectVar performs a '{varname}' redirection, which allocates a new file
+// descriptor and assigns its number to the variable, or, when closing, closes
+// the file descriptor whose number is the value of the variable.
+//
+// These file descriptors are not restored after the command.
+func (r *Runner) redirectVar(name string, target *file) error {
+	if target == nil {
+		v, _ := r.Get(name)
+
+		fd, err := strconv.Atoi(v.String())
+		if err != nil || r.fds[fd] == nil {
+			return &fs.PathError{Op: "close", Path: v.String(), Err: ErrBadFD}
+		}
+
+		r.fds.set(fd, nil)
+
+		return nil
+	}
+
+	fd := r.fds.free()
+
+	if err := r.Set(name, expand.Scalar(strconv.Itoa(fd))); err != nil {
+		target.unref()
+
+		return err
+	}
+
+	r.fds.set(fd, target)
+
+	return nil
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// redirectBoth performs the '&>' and '&>>' redirections, and '>&' when used
+// with a filename, which redirect both stdout and stderr to a file.
+func (r *Runner) redirectBoth(ctx context.Context, rd *bash.Redirection, flag int, saved map[int]*file) error {
+	name, err := r.redirectionTarget(ctx, rd)
+	if err != nil {
+		return err
+	}
+
+	f, err := r.open(ctx, name, flag)
+	if err != nil {
+		return err
+	}
+
+	r.save(saved, 1)
+	r.save(saved, 2)
+	r.fds.set(1, f)
+	r.fds.set(2, f.ref())
+
+	return nil
+}
+
+func (r *Runner) openRedirection(ctx context.Context, rd *bash.Redirection, op string) (*file, error) {
+	name, err := r.redirectionTarget(ctx, rd)
+	if err != nil {
+		return nil, err
+	}
+
+	var flag int
+
+	switch op {
+	case "<":
+		flag = os.O_RDONLY
+	case ">":
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+		if r.Options&NoClobber != 0 {
+			flag |= os.O_EXCL
+		}
+	case ">|":
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	case ">>":
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	case "<>":
+		flag = os.O_RDWR | os.O_CREATE
+	}
+
+	return r.open(ctx, name, flag)
+}
+
+// redirectionTarget expands the filename of a redirection, which must expand
+// to a single field.
+func (r *Runner) redirectionTarget(ctx context.Context, rd *bash.Redirection) (string, error) {
+	fields, err := r.expander(ctx).Fields(&rd.Output)
+	if err != nil {
+		return "", r.expansion(err)
+	} else if len(fields) != 1 {
+		return "", fmt.Errorf("%s: %w", rd.Output, ErrAmbiguous)
+	}
+
+	return fields[0], nil
+}
+
+// open opens a file for a redirection.
+//
+// The files of the /dev/fd directory, along with /dev/stdin, /dev/stdout, and
+// /dev/stderr, refer to the file descriptors of the shell, and /dev/null is
+// always available; other files are opened with the OpenHandler, or, if it is
+// nil, read from the FS.
+func (r *Runner) open(ctx context.Context, name string, flag int) (*file, error) {
+	switch name {
+	case "/dev/null":
+		return newFile(strings.NewReader(""), io.Discard, nil), nil
+	case "/dev/stdin":
+		name = "/dev/fd/0"
+	case "/dev/stdout":
+		name = "/dev/fd/1"
+	case "/dev/stderr":
+		name = "/dev/fd/2"
+	case "":
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if fd, ok := strings.CutPrefix(name, "/dev/fd/"); ok && isNumber(fd) {
+		n, _ := strconv.Atoi(fd)
+
+		if f, ok := r.fds[n]; ok {
+			return f.ref(), nil
+		}
+
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	p := r.path(name)
+
+	if r.Open != nil {
+		f, err := r.Open.Open(ctx, p, flag, 0o666)
+		if errors.Is(err, fs.ErrExist) && flag&os.O_EXCL != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: ErrNoClobber}
+		} else if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+		}
+
+		var (
+			rd io.Reader = f
+			wr io.Writer = f
+		)
+
+		if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+			wr = nil
+		} else if flag&os.O_WRONLY != 0 {
+			rd = nil
+		}
+
+		return newFile(rd, wr, f), nil
+	} else if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrReadOnly}
+	} else if r.FS == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	f, err := r.FS.Open(fsPath(p))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	} else if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		f.Close()
+
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrIsDirectory}
+	}
+
+	return newFile(f, nil, f), nil
+}
+
+func unwrapPathError(err error) error {
+	var pe *fs.PathError
+
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+
+	return err
+}
+
+// path returns the absolute path of a file, relative to the working directory.
+func (r *Runner) path(name string) string {
+	if path.IsAbs(name) {
+		return path.Clean(name)
+	}
+
+	return path.Join(r.Dir, name)
+}
+
+// fsPath converts an absolute path to one for use with an fs.FS.
+func fsPath(p string) string {
+	if p = strings.TrimPrefix(path.Clean(p), "/"); p == "" {
+		return "."
+	}
+
+	return p
+}
+
+// heredoc expands the body of a here-document.
+//
+// When the delimiter is unquoted, the body has its parameters expanded, and a
+// backslash escapes a following '$', '`', '\', or newline.
+func (r *Runner) heredoc(ctx context.Context, rd *bash.Redirection) (string, error) {
+	if rd.Heredoc == nil {
+		return "", nil
+	}
+
+	quoted := slices.ContainsFunc(rd.Output.Parts, func(p bash.WordPart) bool {
+		return p.Part != nil && strings.ContainsAny(p.Part.Data, "\"'\\")
+	})
+
+	var sb strings.Builder
+
+	for _, p := range rd.Heredoc.HeredocPartsOrWords {
+		if p.HeredocPart != nil {
+			if quoted {
+				sb.WriteString(p.HeredocPart.Data)
+			} else {
+				sb.WriteString(unescapeHeredoc(p.HeredocPart.Data))
+			}
+		} else if p.Word != nil {
+			s, err := r.expander(ctx).Word(p.Word)
+			if err != nil {
+				return "", r.expansion(err)
+			}
+
+			sb.WriteString(s)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func unescapeHeredoc(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var sb strings.Builder
+
+	for n := 0; n < len(s); n++ {
+		if s[n] == '\\' && n+1 < len(s) {
+			switch s[n+1] {
+			case '\n':
+				n++
+
+				continue
+			case '$', '`', '\\':
+				n++
+			}
+		}
+
+		sb.WriteByte(s[n])
+	}
+
+	return sb.String()
+}
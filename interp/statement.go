@@ -0,0 +1,436 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/expand"
+	"vimagination.zapto.org/parser"
+)
+
+// script runs the lines of a script.
+//
+// An error that abandons a line, such as a failed expansion, causes the rest
+// of the line to be skipped, with execution continuing on the next line.
+func (r *Runner) script(ctx context.Context, f *bash.File) error {
+	for n := range f.Lines {
+		if err := r.line(ctx, &f.Lines[n]); err != nil && err != errDiscard {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// file runs the lines of a File, such as the body of a compound command.
+func (r *Runner) file(ctx context.Context, f *bash.File) error {
+	for n := range f.Lines {
+		if err := r.line(ctx, &f.Lines[n]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) line(ctx context.Context, l *bash.Line) error {
+	for n := range l.Statements {
+		if err := ctx.Err(); err != nil {
+			return err
+		} else if r.Options&NoExec != 0 {
+			return nil
+		}
+
+		if err := r.statement(ctx, &l.Statements[n]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statement runs a list of pipelines, separated by '&&' and '||', either in the
+// foreground or as a background job.
+func (r *Runner) statement(ctx context.Context, s *bash.Statement) error {
+	if s.JobControl == bash.JobControlBackground {
+		return r.background(ctx, s)
+	}
+
+	return r.list(ctx, s)
+}
+
+// list runs the pipelines of a list, in which a pipeline following '&&' is run
+// only when the previous pipeline succeeded, and one following '||' only when
+// it failed.
+//
+// The failure of any pipeline except the last does not cause the shell to exit
+// with 'set -e', nor does the failure of a compound command, as the commands
+// within it have already been checked.
+func (r *Runner) list(ctx context.Context, s *bash.Statement) error {
+	for s != nil {
+		last := s.Statement == nil
+
+		if !last {
+			r.noErrExit++
+		}
+
+		err := r.pipeline(ctx, &s.Pipeline)
+
+		if !last {
+			r.noErrExit--
+		}
+
+		if err != nil {
+			return err
+		} else if last && !s.Pipeline.Not && !isCompound(&s.Pipeline) {
+			if err := r.errCheck(ctx); err != nil {
+				return err
+			}
+		}
+
+		op := s.LogicalOperator
+
+		for s = s.Statement; s != nil && (op == bash.LogicalOperatorAnd) == (r.status != 0); s = s.Statement {
+			op = s.LogicalOperator
+		}
+	}
+
+	return nil
+}
+
+// errCheck runs the ERR trap, and, with 'set -e', stops the shell, after a
+// command has failed.
+//
+// Functions do not inherit the ERR trap unless 'set -E' is set.
+func (r *Runner) errCheck(ctx context.Context) error {
+	if r.status == 0 || r.noErrExit > 0 {
+		return nil
+	}
+
+	if len(r.funcNames) == 0 || r.Options&ErrTrace != 0 {
+		if err := r.trap(ctx, "ERR"); err != nil {
+			return err
+		}
+	}
+
+	if r.Options&ErrExit != 0 {
+		return errExit
+	}
+
+	return nil
+}
+
+// test runs the condition of an 'if', 'while', or 'until' command, returning
+// whether it succeeded.
+func (r *Runner) test(ctx context.Context, s *bash.Statement) (bool, error) {
+	r.noErrExit++
+	err := r.statement(ctx, s)
+	r.noErrExit--
+
+	return r.status == 0, err
+}
+
+// job is a background job, whose exit status is set once it is done.
+type job struct {
+	done   chan struct{}
+	status int
+}
+
+// background runs a list as a background job, in a subshell whose input is
+// /dev/null.
+//
+// Run waits for all background jobs to complete before returning.
+func (r *Runner) background(ctx context.Context, s *bash.Statement) error {
+	sub := r.subshell()
+	j := &job{done: make(chan struct{})}
+
+	sub.fds.set(0, newFile(strings.NewReader(""), nil, nil))
+
+	if r.jobs == nil {
+		r.jobs = make(map[int]*job)
+	}
+
+	r.jobs[sub.pid] = j
+	r.lastJob = sub.pid
+	r.status = 0
+
+	r.shared.jobs.Add(1)
+
+	go func() {
+		defer r.shared.jobs.Done()
+		defer close(j.done)
+
+		j.status, _ = sub.inSubshell(ctx, func() error {
+			return sub.list(ctx, s)
+		})
+	}()
+
+	return nil
+}
+
+// pipeline runs a pipeline, timing it if requested, and inverting its status
+// when negated with '!'.
+func (r *Runner) pipeline(ctx context.Context, p *bash.Pipeline) error {
+	start := time.Now()
+
+	if p.Not {
+		r.noErrExit++
+	}
+
+	err := r.stages(ctx, p)
+
+	if p.Not {
+		r.noErrExit--
+
+		if r.status == 0 {
+			r.status = 1
+		} else {
+			r.status = 0
+		}
+	}
+
+	if p.PipelineTime != bash.PipelineTimeNone {
+		r.time(p.PipelineTime, time.Since(start))
+	}
+
+	return err
+}
+
+// time reports the time taken by a pipeline, as with the 'time' keyword.
+//
+// The user and system times are not measured, and are reported as zero.
+func (r *Runner) time(t bash.PipelineTime, d time.Duration) {
+	if t == bash.PipelineTimePosix {
+		fmt.Fprintf(r.stderr(), "real %.2f\nuser 0.00\nsys 0.00\n", d.Seconds())
+
+		return
+	}
+
+	fmt.Fprintf(r.stderr(), "\nreal\t%dm%.3fs\nuser\t0m0.000s\nsys\t0m0.000s\n", int(d/time.Minute), (d % time.Minute).Seconds())
+}
+
+// stages runs the commands of a pipeline, each connected to the next by a pipe,
+// setting the PIPESTATUS variable to their exit statuses.
+//
+// A pipeline of a single compound command, other than a subshell, '[[', or
+// '((', leaves PIPESTATUS as set by the last pipeline run within it.
+//
+// Each command is run concurrently in a subshell, except for the last when
+// 'shopt -s lastpipe' is set, which is run in the current shell. The status
+// of the pipeline is that of the last command, or, with 'set -o pipefail', of
+// the last command to fail.
+func (r *Runner) stages(ctx context.Context, p *bash.Pipeline) error {
+	if p.Pipeline == nil {
+		err := r.commandOrCompound(ctx, &p.CommandOrCompound)
+
+		if !isCompound(p) {
+			r.pipeStatus(r.status)
+		}
+
+		return err
+	}
+
+	var stages []*bash.CommandOrCompound
+
+	for q := p; q != nil; q = q.Pipeline {
+		stages = append(stages, &q.CommandOrCompound)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		statuses = make([]int, len(stages))
+		errs     = make([]error, len(stages))
+		input    *file
+	)
+
+	for n, stage := range stages {
+		last := n == len(stages)-1
+
+		if last && r.Options&LastPipe != 0 {
+			restore := r.pipeInput(input)
+			errs[n] = r.commandOrCompound(ctx, stage)
+			statuses[n] = r.status
+
+			restore()
+
+			break
+		}
+
+		s := r.subshell()
+
+		if input != nil {
+			s.fds.set(0, input)
+		}
+
+		sctx, cancel := context.WithCancel(ctx)
+
+		var broken atomic.Bool
+
+		if !last {
+			pr, pw := io.Pipe()
+			input = newFile(pr, nil, pr)
+			output := newFile(nil, pw, pw)
+			output.broken = func() {
+				broken.Store(true)
+				cancel()
+			}
+
+			s.fds.set(1, output)
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer cancel()
+
+			statuses[n], errs[n] = s.inSubshell(sctx, func() error {
+				return s.commandOrCompound(sctx, stage)
+			})
+
+			if broken.Load() && ctx.Err() == nil {
+				statuses[n], errs[n] = 141, nil
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	r.status = statuses[len(statuses)-1]
+
+	if r.Options&PipeFail != 0 {
+		for _, status := range statuses {
+			if status != 0 {
+				r.status = status
+			}
+		}
+	}
+
+	r.pipeStatus(statuses...)
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isCompound determines whether a pipeline is a single compound command, other
+// than a subshell, '[[', or '((', the status of which is that of the commands
+// run within it.
+func isCompound(p *bash.Pipeline) bool {
+	c := p.CommandOrCompound.Compound
+
+	return p.Pipeline == nil && c != nil && (c.GroupingCompound == nil || !c.GroupingCompound.SubShell) && c.TestCompound == nil && c.ArithmeticCompound == nil
+}
+
+// pipeInput sets the input of the last command of a pipeline run in the
+// current shell, returning a function that restores the previous input.
+func (r *Runner) pipeInput(input *file) func() {
+	var old *file
+
+	if f := r.fds[0]; f != nil {
+		old = f.ref()
+	}
+
+	r.fds.set(0, input)
+
+	return func() {
+		r.fds.set(0, old)
+	}
+}
+
+func (r *Runner) pipeStatus(statuses ...int) {
+	values := make([]string, len(statuses))
+
+	for n, status := range statuses {
+		values[n] = strconv.Itoa(status)
+	}
+
+	r.scopes[0]["PIPESTATUS"] = variable{Variable: expand.Indexed(values...)}
+}
+
+func (r *Runner) commandOrCompound(ctx context.Context, c *bash.CommandOrCompound) error {
+	if c.Command != nil {
+		return r.command(ctx, c.Command)
+	} else if c.Compound != nil {
+		return r.compound(ctx, c.Compound)
+	}
+
+	return nil
+}
+
+// trap runs the action set for a signal or condition by the 'trap' builtin.
+//
+// The exit status and PIPESTATUS are preserved across the running of the
+// action, unless it calls 'exit'. Traps are not run while another trap is
+// running.
+//
+// The lines of the ERR, DEBUG and RETURN traps are numbered from that of the
+// command that triggered them, while those of other traps start from one.
+func (r *Runner) trap(ctx context.Context, signal string) error {
+	action, ok := r.traps[signal]
+	if !ok || action == "" || r.inTrap {
+		return nil
+	}
+
+	tk := parser.NewStringTokeniser(action)
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		r.errorf("%s", err)
+
+		return nil
+	}
+
+	status, pipeStatus := r.status, r.scopes[0]["PIPESTATUS"]
+	lineno, offset := r.lineno, r.lineOffset
+	r.inTrap = true
+	r.lineOffset = 0
+
+	if signal == "ERR" || signal == "DEBUG" || signal == "RETURN" {
+		r.lineOffset = r.lineno - 1
+	}
+
+	err = r.file(ctx, f)
+
+	r.inTrap = false
+	r.lineno, r.lineOffset = lineno, offset
+
+	if err == nil || err == errDiscard {
+		r.status = status
+		r.scopes[0]["PIPESTATUS"] = pipeStatus
+		err = nil
+	}
+
+	return err
+}
+
+// debug records the command about to be run, as the value of BASH_COMMAND,
+// and runs the DEBUG trap, which is run before each simple command, and
+// before the head of each 'for', 'case', '[[', and '((' command, but is not
+// inherited by functions.
+//
+// The command is either a bash.Type, formatted when BASH_COMMAND is read, or
+// the text of a compound command head. While a trap is run, BASH_COMMAND
+// keeps the command that triggered it.
+func (r *Runner) debug(ctx context.Context, command any) error {
+	if !r.inTrap {
+		r.bashCommand = command
+	}
+
+	if len(r.funcNames) > 0 {
+		return nil
+	}
+
+	return r.trap(ctx, "DEBUG")
+}
@@ -0,0 +1,375 @@
+package interp
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"vimagination.zapto.org/bash/arith"
+	"vimagination.zapto.org/bash/attributes"
+	"vimagination.zapto.org/bash/expand"
+)
+
+// variable is a variable as stored in a scope.
+//
+// A variable that has been declared, such as with 'local', but not given a
+// value, is unset, but still has its attributes and hides any variable of the
+// same name in an outer scope.
+type variable struct {
+	expand.Variable
+	unset bool
+}
+
+// scope is a set of variables; either the global variables, those local to a
+// function call, or those assigned for the duration of a single command.
+type scope map[string]variable
+
+// maxNameref is the maximum length of a chain of namerefs.
+const maxNameref = 8
+
+// lookup finds a variable in the innermost scope in which it is declared,
+// returning that scope, or the global scope if it is not declared.
+func (r *Runner) lookup(name string) (scope, variable, bool) {
+	for n := len(r.scopes) - 1; n >= 0; n-- {
+		if v, ok := r.scopes[n][name]; ok {
+			return r.scopes[n], v, true
+		}
+	}
+
+	return r.scopes[0], variable{}, false
+}
+
+// resolve follows any namerefs from the given name, returning the name of the
+// variable ultimately referred to, which may include a subscript.
+func (r *Runner) resolve(name string) (string, error) {
+	start := name
+
+	for range maxNameref {
+		_, v, ok := r.lookup(name)
+		if !ok || v.unset || !v.Attributes.Has(attributes.Nameref) {
+			return name, nil
+		}
+
+		if name = v.Value; name == start {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", start, ErrCircularNameref)
+}
+
+// Get returns a variable or special parameter, implementing the
+// expand.Environment interface.
+//
+// Namerefs are followed to the variable they refer to, and a name with a
+// subscript, such as can be the value of a nameref, returns the element of an
+// array as a scalar.
+func (r *Runner) Get(name string) (expand.Variable, bool) {
+	if v, ok := r.special(name); ok {
+		return v, true
+	}
+
+	name, err := r.resolve(name)
+	if err != nil {
+		r.warn(err)
+
+		return expand.Variable{}, false
+	}
+
+	base, key, keyed := splitSubscript(name)
+
+	_, v, ok := r.lookup(base)
+	if !ok || v.unset {
+		return expand.Variable{}, false
+	} else if !keyed {
+		return v.Variable, true
+	}
+
+	key, err = r.subscript(v.Variable, key)
+	if err != nil {
+		return expand.Variable{}, false
+	}
+
+	value, ok := v.Index(key)
+
+	return expand.Scalar(value), ok
+}
+
+// GetRef returns a variable without following namerefs, implementing the
+// expand.RefGetter interface.
+func (r *Runner) GetRef(name string) (expand.Variable, bool) {
+	_, v, ok := r.lookup(name)
+	if !ok || v.unset {
+		return expand.Variable{}, false
+	}
+
+	return v.Variable, true
+}
+
+func splitSubscript(name string) (string, string, bool) {
+	base, key, keyed := strings.Cut(name, "[")
+
+	return base, strings.TrimSuffix(key, "]"), keyed
+}
+
+// subscript evaluates the subscript of an Indexed array, which is an
+// arithmetic expression.
+func (r *Runner) subscript(v expand.Variable, key string) (string, error) {
+	if v.Attributes.Has(attributes.Associative) {
+		return key, nil
+	}
+
+	n, err := r.arithmetic(key)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(n, 10), nil
+}
+
+// special returns the value of a special parameter or dynamic variable.
+func (r *Runner) special(name string) (expand.Variable, bool) {
+	switch name {
+	case "?":
+		return expand.Scalar(strconv.Itoa(r.status)), true
+	case "$":
+		return expand.Scalar(strconv.Itoa(r.shared.pid)), true
+	case "!":
+		if r.lastJob == 0 {
+			return expand.Variable{}, false
+		}
+
+		return expand.Scalar(strconv.Itoa(r.lastJob)), true
+	case "0":
+		return expand.Scalar(r.Name), true
+	case "@":
+		return expand.Indexed(r.Args...), true
+	case "-":
+		return expand.Scalar(r.Options.flags()), true
+	case "BASH_COMMAND":
+		if r.bashCommand == nil {
+			return expand.Variable{}, false
+		}
+
+		return expand.Scalar(fmt.Sprintf("%s", r.bashCommand)), true
+	case "LINENO":
+		return expand.Scalar(strconv.FormatUint(r.lineno, 10)), true
+	case "RANDOM":
+		return expand.Scalar(strconv.Itoa(r.shared.random())), true
+	case "SECONDS":
+		return expand.Scalar(strconv.FormatInt(int64(time.Since(r.start)/time.Second), 10)), true
+	case "EPOCHSECONDS":
+		return expand.Scalar(strconv.FormatInt(time.Now().Unix(), 10)), true
+	case "EPOCHREALTIME":
+		now := time.Now()
+
+		return expand.Scalar(fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)), true
+	case "BASHPID":
+		return expand.Scalar(strconv.Itoa(r.pid)), true
+	case "BASH_SUBSHELL":
+		return expand.Scalar(strconv.Itoa(r.subshells)), true
+	case "FUNCNAME":
+		if len(r.funcNames) == 0 {
+			return expand.Variable{}, false
+		}
+
+		names := slices.Clone(r.funcNames)
+
+		slices.Reverse(names)
+
+		return expand.Indexed(append(names, "main")...), true
+	}
+
+	return expand.Variable{}, false
+}
+
+// Set sets a variable, implementing the expand.Environment interface.
+//
+// The attributes of an existing variable are kept, and values are converted
+// according to the Integer, Lowercase, and Uppercase attributes. Namerefs are
+// followed to the variable they refer to, and assigning a scalar to an array
+// sets its first element.
+func (r *Runner) Set(name string, v expand.Variable) error {
+	switch name {
+	case "RANDOM":
+		n, _ := strconv.ParseInt(v.String(), 10, 64)
+
+		r.shared.seed(n)
+
+		return nil
+	case "SECONDS":
+		n, _ := strconv.ParseInt(v.String(), 10, 64)
+
+		r.start = time.Now().Add(-time.Duration(n) * time.Second)
+
+		return nil
+	}
+
+	name, err := r.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	base, key, keyed := splitSubscript(name)
+
+	s, old, _ := r.lookup(base)
+	if old.Attributes.Has(attributes.Readonly) {
+		return fmt.Errorf("%s: %w", base, expand.ErrReadonly)
+	}
+
+	if !keyed && old.Attributes.IsArray() && !v.Attributes.IsArray() {
+		key, keyed = "0", true
+	}
+
+	if keyed {
+		if key, err = r.subscript(old.Variable, key); err != nil {
+			return err
+		}
+
+		value := v.String()
+
+		if v, err = old.AssignIndex(key, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	v.Attributes |= old.Attributes
+
+	return r.store(s, base, v)
+}
+
+// store converts the values of a variable according to its attributes, and
+// stores it in a scope.
+func (r *Runner) store(s scope, name string, v expand.Variable) error {
+	if r.Options&AllExport != 0 {
+		v.Attributes |= attributes.Exported
+	}
+
+	v, err := r.convert(v)
+	if err != nil {
+		return err
+	}
+
+	s[name] = variable{Variable: v}
+
+	return nil
+}
+
+// convert converts the values of a variable according to the Integer,
+// Lowercase, and Uppercase attributes.
+func (r *Runner) convert(v expand.Variable) (expand.Variable, error) {
+	var conv func(string) (string, error)
+
+	switch {
+	case v.Attributes.Has(attributes.Integer):
+		conv = func(s string) (string, error) {
+			n, err := r.arithmetic(s)
+
+			return strconv.FormatInt(n, 10), err
+		}
+	case v.Attributes.Has(attributes.Lowercase):
+		conv = func(s string) (string, error) { return strings.ToLower(s), nil }
+	case v.Attributes.Has(attributes.Uppercase):
+		conv = func(s string) (string, error) { return strings.ToUpper(s), nil }
+	default:
+		return v, nil
+	}
+
+	var err error
+
+	switch {
+	case v.Attributes.Has(attributes.Associative):
+		m := make(map[string]string, len(v.Map))
+
+		for key, value := range v.Map {
+			if m[key], err = conv(value); err != nil {
+				return v, err
+			}
+		}
+
+		v.Map = m
+	case v.Attributes.Has(attributes.Indexed):
+		a := make(map[int]string, len(v.Array))
+
+		for idx, value := range v.Array {
+			if a[idx], err = conv(value); err != nil {
+				return v, err
+			}
+		}
+
+		v.Array = a
+	default:
+		v.Value, err = conv(v.Value)
+	}
+
+	return v, err
+}
+
+// arithmetic evaluates an arithmetic expression using the variables of the
+// shell.
+func (r *Runner) arithmetic(expr string) (int64, error) {
+	ev := arith.Evaluator{Vars: arith.Env(r), NoUnset: r.Options&NoUnset != 0}
+
+	return ev.Eval(expr)
+}
+
+// Names returns the names of all set variables, implementing the expand.Namer
+// interface.
+func (r *Runner) Names() []string {
+	names := make(map[string]bool)
+
+	for _, s := range r.scopes {
+		for name, v := range s {
+			names[name] = !v.unset
+		}
+	}
+
+	var set []string
+
+	for name, ok := range names {
+		if ok {
+			set = append(set, name)
+		}
+	}
+
+	slices.Sort(set)
+
+	return set
+}
+
+// environ returns the exported variables, in the form 'name=value', as given to
+// external commands.
+func (r *Runner) environ() []string {
+	var env []string
+
+	for _, name := range r.Names() {
+		if _, v, _ := r.lookup(name); v.Attributes.Has(attributes.Exported) && !v.Attributes.IsArray() {
+			env = append(env, name+"="+v.Value)
+		}
+	}
+
+	return env
+}
+
+// pushScope adds a new innermost scope, returning a function that removes it.
+func (r *Runner) pushScope(s scope) func() {
+	r.scopes = append(r.scopes, s)
+
+	return func() {
+		r.scopes = r.scopes[:len(r.scopes)-1]
+	}
+}
+
+// copyScopes returns a copy of the variables, as inherited by a subshell.
+func (r *Runner) copyScopes() []scope {
+	scopes := make([]scope, len(r.scopes))
+
+	for n, s := range r.scopes {
+		scopes[n] = maps.Clone(s)
+	}
+
+	return scopes
+}
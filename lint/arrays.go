@@ -0,0 +1,281 @@
+package lint
+
+import (
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Array and arithmetic rules.
+var (
+	ArrayAsScalar = &Rule{
+		ID:         "array-as-scalar",
+		Severity:   SeverityWarning,
+		Summary:    "expanding an array without an index only uses its first element",
+		ShellCheck: []string{"SC2128"},
+		Check:      checkArrayAsScalar,
+	}
+	ArrayLength = &Rule{
+		ID:         "array-length",
+		Severity:   SeverityWarning,
+		Summary:    "'${#array}' is the length of the first element, not the number of elements",
+		ShellCheck: []string{"SC2128"},
+		Check:      checkArrayLength,
+	}
+	ArithmeticDollar = &Rule{
+		ID:       "arithmetic-dollar",
+		Severity: SeverityWarning,
+		Summary:  "'$' on variables in arithmetic changes the meaning of assignments, and of variables holding expressions",
+		Check:    checkArithmeticDollar,
+	}
+	OctalLiteral = &Rule{
+		ID:       "octal-literal",
+		Severity: SeverityWarning,
+		Summary:  "numbers with a leading zero are octal in arithmetic",
+		Check:    checkOctalLiteral,
+	}
+	StringCompareNumbers = &Rule{
+		ID:         "string-compare-numbers",
+		Severity:   SeverityWarning,
+		Summary:    "'<' and '>' in '[[ ... ]]' compare strings, not numbers",
+		ShellCheck: []string{"SC2071"},
+		Check:      checkStringCompareNumbers,
+	}
+	ReadonlyAssignment = &Rule{
+		ID:       "readonly-assignment",
+		Severity: SeverityError,
+		Summary:  "assigning to a read-only variable fails",
+		Check:    checkReadonlyAssignment,
+	}
+)
+
+// ArrayRules returns the rules that find misuse of arrays, arithmetic, and
+// variable attributes.
+func ArrayRules() []*Rule {
+	return []*Rule{
+		ArrayAsScalar,
+		ArrayLength,
+		ArithmeticDollar,
+		OctalLiteral,
+		StringCompareNumbers,
+		ReadonlyAssignment,
+	}
+}
+
+func checkArrayAsScalar(c *Context) {
+	arrs := arrays(c.File)
+
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.WordPart:
+			if t.Part != nil && t.Part.Type == bash.TokenIdentifier {
+				if name, _ := astutil.SplitParameter(t.Part.Data); arrs[name] {
+					c.Report(t.Tokens, "'%s' is an array; use \"${%[1]s[@]}\" for all elements or \"${%[1]s[0]}\" for the first", name)
+				}
+			}
+		case *bash.ParameterExpansion:
+			if t.Indirect || t.Parameter.Parameter == nil || len(t.Parameter.Array) > 0 {
+				break
+			}
+
+			switch t.Type {
+			case bash.ParameterLength, bash.ParameterPrefix, bash.ParameterPrefixSeperate:
+			default:
+				if name := t.Parameter.Parameter.Data; arrs[name] {
+					c.Report(t.Tokens, "'%s' is an array; use \"${%[1]s[@]}\" for all elements or \"${%[1]s[0]}\" for the first", name)
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func checkArrayLength(c *Context) {
+	arrs := arrays(c.File)
+
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if pe, ok := t.(*bash.ParameterExpansion); ok && pe.Type == bash.ParameterLength && pe.Parameter.Parameter != nil && len(pe.Parameter.Array) == 0 {
+			if name := pe.Parameter.Parameter.Data; arrs[name] {
+				c.Report(pe.Tokens, "'${#%s}' is the length of the first element; use '${#%[1]s[@]}' for the number of elements", name)
+			}
+		}
+
+		return true
+	})
+}
+
+// arithmeticParts calls fn for each word part directly within an arithmetic
+// expression, including the operands of the arithmetic operators of
+// '[[ ... ]]'.
+func arithmeticParts(f *bash.File, fn func(*bash.WordPart)) {
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.ArithmeticExpansion:
+			for _, wo := range t.WordsAndOperators {
+				if wo.Word != nil {
+					for n := range wo.Word.Parts {
+						fn(&wo.Word.Parts[n])
+					}
+				}
+			}
+		case *bash.Tests:
+			switch t.Test {
+			case bash.TestOperatorEqual, bash.TestOperatorNotEqual, bash.TestOperatorLessThan, bash.TestOperatorLessThanEqual, bash.TestOperatorGreaterThan, bash.TestOperatorGreaterThanEqual:
+				if t.Word != nil {
+					for n := range t.Word.Parts {
+						fn(&t.Word.Parts[n])
+					}
+				}
+
+				if t.Pattern != nil {
+					for n := range t.Pattern.Parts {
+						fn(&t.Pattern.Parts[n])
+					}
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func checkArithmeticDollar(c *Context) {
+	exprs := expressions(c.File)
+
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if ae, ok := t.(*bash.ArithmeticExpansion); ok {
+			for n, wo := range ae.WordsAndOperators {
+				name, ok := dollarName(wo.Word)
+				if !ok {
+					continue
+				}
+
+				if isOperator(ae.WordsAndOperators, n+1, arithmeticAssignments...) || isOperator(ae.WordsAndOperators, n-1, "++", "--") {
+					c.Report(wo.Tokens, "'$%s' is expanded before evaluation, so the variable named by its value is assigned; use '%[1]s'", name)
+				} else if value, ok := exprs[name]; ok {
+					c.Report(wo.Tokens, "'$%s' is expanded as the text '%s' before evaluation, so it is not evaluated as a single operand; use '%[1]s'", name, value)
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+// arithmeticAssignments are the operators that assign to their left operand.
+var arithmeticAssignments = []string{"=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "^=", "|=", "++", "--"}
+
+// dollarName returns the name of the variable when the word is a single,
+// simple, parameter expansion, such as '$a'.
+func dollarName(w *bash.Word) (string, bool) {
+	if w == nil || len(w.Parts) != 1 || w.Parts[0].Part == nil || w.Parts[0].Part.Type != bash.TokenIdentifier {
+		return "", false
+	}
+
+	name, rest := astutil.SplitParameter(w.Parts[0].Part.Data)
+
+	return name, astutil.IsName(name) && rest == ""
+}
+
+// isOperator returns true when the element at the given index is one of the
+// given operators.
+func isOperator(wos []bash.WordOrOperator, n int, ops ...string) bool {
+	return n >= 0 && n < len(wos) && wos[n].Operator != nil && slices.Contains(ops, wos[n].Operator.Data)
+}
+
+func checkOctalLiteral(c *Context) {
+	arithmeticParts(c.File, func(p *bash.WordPart) {
+		if p.Part == nil || p.Part.Type != bash.TokenNumberLiteral && p.Part.Type != bash.TokenWord && p.Part.Type != bash.TokenPattern {
+			return
+		}
+
+		num := p.Part.Data
+
+		if len(num) < 2 || num[0] != '0' || strings.Trim(num, "0123456789") != "" {
+			return
+		}
+
+		if strings.ContainsAny(num, "89") {
+			c.ReportSeverity(SeverityError, p.Tokens, "'%s' is not a valid octal number; use '10#%[1]s' for decimal", num)
+		} else {
+			c.Report(p.Tokens, "'%s' is an octal number; use '10#%[1]s' for decimal", num)
+		}
+	})
+}
+
+func checkStringCompareNumbers(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if tests, ok := t.(*bash.Tests); ok && (tests.Test == bash.TestOperatorStringBefore || tests.Test == bash.TestOperatorStringAfter) && tests.Word != nil && tests.Pattern != nil {
+			if isNumber(tests.Word.Parts) || isNumber(tests.Pattern.Parts) {
+				op, numOp := "<", "-lt"
+
+				if tests.Test == bash.TestOperatorStringAfter {
+					op, numOp = ">", "-gt"
+				}
+
+				c.Report(bash.Tokens{tests.Word.Tokens[0], tests.Pattern.Tokens[len(tests.Pattern.Tokens)-1]}, "'%s' compares strings; use '%s' or '(( ... ))' for numbers", op, numOp)
+			}
+		}
+
+		return true
+	})
+}
+
+func isNumber(parts []bash.WordPart) bool {
+	var sb strings.Builder
+
+	for _, p := range parts {
+		if p.Part == nil || p.Part.Type == bash.TokenIdentifier {
+			return false
+		}
+
+		sb.WriteString(astutil.Unquote(p.Part.Data, p.Part.Type))
+	}
+
+	num := strings.TrimPrefix(sb.String(), "-")
+
+	return num != "" && strings.Trim(num, "0123456789") == ""
+}
+
+// bashReadonly contains the variables that bash itself makes read-only.
+var bashReadonly = map[string]bool{
+	"BASHOPTS":      true,
+	"BASH_VERSINFO": true,
+	"EUID":          true,
+	"PPID":          true,
+	"SHELLOPTS":     true,
+	"UID":           true,
+}
+
+func checkReadonlyAssignment(c *Context) {
+	readonly := make(map[string]uint64)
+
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			for _, d := range astutil.Declarations(cmd) {
+				if _, ok := readonly[d.Name]; !ok && strings.Contains(d.Flags, "r") {
+					readonly[d.Name] = d.Tokens[0].Pos
+				}
+			}
+		}
+
+		return true
+	})
+
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if a, ok := t.(*bash.Assignment); ok && a.Identifier.Identifier != nil {
+			name := a.Identifier.Identifier.Data
+
+			if bashReadonly[name] {
+				c.Report(a.Tokens, "'%s' is a read-only variable set by bash", name)
+			} else if pos, ok := readonly[name]; ok && pos < a.Tokens[0].Pos {
+				c.Report(a.Tokens, "'%s' was made read-only and cannot be assigned", name)
+			}
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,181 @@
+package lint
+
+import "testing"
+
+func TestArrayAsScalar(t *testing.T) {
+	doTests(t, []*Rule{ArrayAsScalar}, []ruleTest{
+		{ // 1
+			"a=(1 2 3)\necho $a",
+			[]string{"2:6 array-as-scalar"},
+		},
+		{ // 2
+			"a=(1 2 3)\necho \"${a[@]}\" \"${a[0]}\" ${#a[@]}",
+			nil,
+		},
+		{ // 3
+			"declare -A m\necho \"${m}\"",
+			[]string{"2:7 array-as-scalar"},
+		},
+		{ // 4
+			"read -ra parts\necho \"$parts\"",
+			[]string{"2:7 array-as-scalar"},
+		},
+		{ // 5
+			"mapfile -t lines < file\necho \"${lines:-none}\"",
+			[]string{"2:7 array-as-scalar"},
+		},
+		{ // 6
+			"b[2]=x\necho $b/path",
+			[]string{"2:6 array-as-scalar"},
+		},
+		{ // 7
+			"a=1\necho $a",
+			nil,
+		},
+		{ // 8
+			"read -r a\necho $a",
+			nil,
+		},
+	})
+}
+
+func TestArrayLength(t *testing.T) {
+	doTests(t, []*Rule{ArrayLength}, []ruleTest{
+		{ // 1
+			"local -a files=(*)\necho ${#files}",
+			[]string{"2:6 array-length"},
+		},
+		{ // 2
+			"files=(*)\necho ${#files[@]}",
+			nil,
+		},
+		{ // 3
+			"name=abc\necho ${#name}",
+			nil,
+		},
+	})
+}
+
+func TestArithmeticDollar(t *testing.T) {
+	doTests(t, []*Rule{ArithmeticDollar}, []ruleTest{
+		{ // 1
+			"(( $a + 1 ))",
+			nil,
+		},
+		{ // 2
+			"echo $(( a + $1 + $# ))",
+			nil,
+		},
+		{ // 3
+			"echo $(( $count * 2 ))",
+			nil,
+		},
+		{ // 4
+			"for (( i = 0; i < $n; i++ )); do :; done",
+			nil,
+		},
+		{ // 5
+			"(( $a = 1 ))\n(( $b += 2, c = $d ))",
+			[]string{"1:4 arithmetic-dollar", "2:4 arithmetic-dollar"},
+		},
+		{ // 6
+			"(( $a++ ))\necho $(( --$b ))",
+			[]string{"1:4 arithmetic-dollar", "2:12 arithmetic-dollar"},
+		},
+		{ // 7
+			"size=4+4\necho $(( $size * 2 )) $(( size * 2 ))",
+			[]string{"2:10 arithmetic-dollar"},
+		},
+		{ // 8
+			"n=8\nm=-1\necho $(( $n * $m ))",
+			nil,
+		},
+	})
+}
+
+func TestOctalLiteral(t *testing.T) {
+	doTests(t, []*Rule{OctalLiteral}, []ruleTest{
+		{ // 1
+			"(( a = 08 ))",
+			[]string{"1:8 octal-literal"},
+		},
+		{ // 2
+			"echo $(( 010 + 1 ))",
+			[]string{"1:10 octal-literal"},
+		},
+		{ // 3
+			"echo $(( 10 + 0 ))",
+			nil,
+		},
+		{ // 4
+			"[[ $month -eq 09 ]]",
+			[]string{"1:15 octal-literal"},
+		},
+		{ // 5
+			"[[ $a == 09 ]]",
+			nil,
+		},
+		{ // 6
+			"echo $(( 09 ))",
+			[]string{"1:10 octal-literal"},
+		},
+		{ // 7
+			"(( n = 1 + 09 ))",
+			[]string{"1:12 octal-literal"},
+		},
+		{ // 8
+			"echo $(( 019 )) $(( 0x19 ))",
+			[]string{"1:10 octal-literal"},
+		},
+	})
+}
+
+func TestStringCompareNumbers(t *testing.T) {
+	doTests(t, []*Rule{StringCompareNumbers}, []ruleTest{
+		{ // 1
+			"[[ $a > 5 ]]",
+			[]string{"1:4 string-compare-numbers"},
+		},
+		{ // 2
+			"[[ 10 < $b ]]",
+			[]string{"1:4 string-compare-numbers"},
+		},
+		{ // 3
+			"[[ $a > $b ]]",
+			nil,
+		},
+		{ // 4
+			"[[ $a -gt 5 ]]",
+			nil,
+		},
+		{ // 5
+			"[[ $a < abc ]]",
+			nil,
+		},
+	})
+}
+
+func TestReadonlyAssignment(t *testing.T) {
+	doTests(t, []*Rule{ReadonlyAssignment}, []ruleTest{
+		{ // 1
+			"readonly a=1\na=2",
+			[]string{"2:1 readonly-assignment"},
+		},
+		{ // 2
+			"declare -r b\nb=2",
+			[]string{"2:1 readonly-assignment"},
+		},
+		{ // 3
+			"UID=0",
+			[]string{"1:1 readonly-assignment"},
+		},
+		{ // 4
+			"c=1\nreadonly c",
+			nil,
+		},
+		{ // 5
+			"readonly d=1\nf() {\n\tlocal d=2\n}",
+			[]string{"3:8 readonly-assignment"},
+		},
+	})
+}
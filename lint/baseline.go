@@ -0,0 +1,102 @@
+package lint
+
+import (
+	"cmp"
+	"encoding/json"
+	"io"
+	"slices"
+)
+
+type baselineKey struct {
+	File    string `json:"file"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type baselineEntry struct {
+	baselineKey
+	Count int `json:"count"`
+}
+
+// Baseline records a set of existing Diagnostics so that only new ones are
+// reported.
+//
+// Diagnostics are matched on their file, rule, and message, and not their
+// position, so that unrelated edits to a file do not cause existing problems
+// to be reported again.
+type Baseline struct {
+	counts map[baselineKey]int
+}
+
+// NewBaseline creates an empty Baseline.
+func NewBaseline() *Baseline {
+	return &Baseline{counts: make(map[baselineKey]int)}
+}
+
+// ReadBaseline reads a Baseline previously written by WriteTo.
+func ReadBaseline(r io.Reader) (*Baseline, error) {
+	var entries []baselineEntry
+
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	b := NewBaseline()
+
+	for _, e := range entries {
+		b.counts[e.baselineKey] += e.Count
+	}
+
+	return b, nil
+}
+
+// Add records the given Diagnostics, found in the named file, in the Baseline.
+func (b *Baseline) Add(file string, diagnostics []Diagnostic) {
+	for _, d := range diagnostics {
+		b.counts[baselineKey{File: file, Rule: d.Rule, Message: d.Message}]++
+	}
+}
+
+// Filter returns the Diagnostics, found in the named file, that are not
+// recorded in the Baseline.
+//
+// When a file has more matching Diagnostics than were recorded, the later ones
+// are returned.
+func (b *Baseline) Filter(file string, diagnostics []Diagnostic) []Diagnostic {
+	var (
+		filtered []Diagnostic
+		seen     = make(map[baselineKey]int)
+	)
+
+	for _, d := range diagnostics {
+		key := baselineKey{File: file, Rule: d.Rule, Message: d.Message}
+
+		if seen[key]++; seen[key] > b.counts[key] {
+			filtered = append(filtered, d)
+		}
+	}
+
+	return filtered
+}
+
+// WriteTo writes the Baseline, as JSON, to the given Writer.
+func (b *Baseline) WriteTo(w io.Writer) (int64, error) {
+	entries := make([]baselineEntry, 0, len(b.counts))
+
+	for key, count := range b.counts {
+		entries = append(entries, baselineEntry{baselineKey: key, Count: count})
+	}
+
+	slices.SortFunc(entries, func(a, b baselineEntry) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Rule, b.Rule), cmp.Compare(a.Message, b.Message))
+	})
+
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(append(data, '\n'))
+
+	return int64(n), err
+}
@@ -0,0 +1,165 @@
+package lint
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+type suppression struct {
+	start, end uint64
+	rules      map[string]bool
+}
+
+type suppressionList []suppression
+
+// suppressions parses the directive comments of a file, either of the form
+// '# shellcheck disable=SC2086,SC2164' or '# bashlint disable=rule-id', into the
+// ranges of the source in which the given rules are suppressed.
+//
+// A directive before the first command of the file applies to the whole file,
+// one following a command on the same line applies to that line, and any
+// other directive applies to the whole of the next line of commands,
+// including the bodies of any compound commands.
+func suppressions(f *bash.File, rules []*Rule) suppressionList {
+	var (
+		sups      suppressionList
+		lines     []bash.Tokens
+		firstCode = ^uint64(0)
+		lineStart uint64
+		lastLine  = ^uint64(0)
+		codeOnLn  bool
+	)
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if l, ok := t.(*bash.Line); ok {
+			if code := trimComments(l.Tokens); len(code) > 0 {
+				lines = append(lines, code)
+			}
+		}
+
+		return true
+	})
+
+	slices.SortFunc(lines, func(a, b bash.Tokens) int {
+		return cmp.Compare(a[0].Pos, b[0].Pos)
+	})
+
+	for _, tk := range f.Tokens {
+		if tk.Line != lastLine {
+			lastLine = tk.Line
+			lineStart = tk.Pos
+			codeOnLn = false
+		}
+
+		switch tk.Type {
+		case bash.TokenWhitespace, bash.TokenLineTerminator:
+			continue
+		case bash.TokenComment:
+		default:
+			codeOnLn = true
+
+			if firstCode > tk.Pos {
+				firstCode = tk.Pos
+			}
+
+			continue
+		}
+
+		ids := directiveRules(tk.Data, rules)
+		if len(ids) == 0 {
+			continue
+		}
+
+		sup := suppression{rules: ids}
+
+		if codeOnLn {
+			sup.start, sup.end = lineStart, tk.Pos
+		} else if tk.Pos < firstCode {
+			sup.end = ^uint64(0)
+		} else if n, found := slices.BinarySearchFunc(lines, tk.Pos, func(l bash.Tokens, pos uint64) int {
+			return cmp.Compare(l[0].Pos, pos)
+		}); n < len(lines) && !found {
+			sup.start, sup.end = lines[n][0].Pos, astutil.End(lines[n]).Pos
+		} else {
+			continue
+		}
+
+		sups = append(sups, sup)
+	}
+
+	return sups
+}
+
+// trimComments removes any leading and trailing comments, and whitespace, from
+// the tokens of a Line.
+func trimComments(tks bash.Tokens) bash.Tokens {
+	isCode := func(tk bash.Token) bool {
+		return tk.Type != bash.TokenWhitespace && tk.Type != bash.TokenLineTerminator && tk.Type != bash.TokenComment
+	}
+
+	start := slices.IndexFunc(tks, isCode)
+	if start < 0 {
+		return nil
+	}
+
+	end := len(tks)
+
+	for !isCode(tks[end-1]) {
+		end--
+	}
+
+	return tks[start:end]
+}
+
+// directiveRules parses a comment for a disable directive, returning the IDs of
+// the rules it disables.
+func directiveRules(comment string, rules []*Rule) map[string]bool {
+	fields := strings.Fields(strings.TrimPrefix(comment, "#"))
+
+	if len(fields) < 2 || fields[0] != "shellcheck" && fields[0] != "bashlint" {
+		return nil
+	}
+
+	ids := make(map[string]bool)
+
+	for _, field := range fields[1:] {
+		if strings.HasPrefix(field, "#") {
+			break
+		}
+
+		values, ok := strings.CutPrefix(field, "disable=")
+		if !ok {
+			continue
+		}
+
+		for _, value := range strings.Split(values, ",") {
+			if value == "all" {
+				ids[value] = true
+
+				continue
+			}
+
+			for _, r := range rules {
+				if fields[0] == "bashlint" && r.ID == value || fields[0] == "shellcheck" && slices.ContainsFunc(r.ShellCheck, func(code string) bool { return code == value || code == "SC"+value }) {
+					ids[r.ID] = true
+				}
+			}
+		}
+	}
+
+	return ids
+}
+
+func (s suppressionList) suppressed(d Diagnostic) bool {
+	for _, sup := range s {
+		if d.Start.Pos >= sup.start && d.Start.Pos < sup.end && (sup.rules["all"] || sup.rules[d.Rule]) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func TestDirectives(t *testing.T) {
+	doTests(t, []*Rule{UncheckedCd, RmUnsafePath}, []ruleTest{
+		{ // 1
+			"# shellcheck disable=SC2164\ncd a\ncd b",
+			nil,
+		},
+		{ // 2
+			"#!/bin/bash\n# bashlint disable=unchecked-cd\n\ncd a",
+			nil,
+		},
+		{ // 3
+			"cd a\n# shellcheck disable=SC2164\ncd b\ncd c",
+			[]string{"1:1 unchecked-cd", "4:1 unchecked-cd"},
+		},
+		{ // 4
+			"cd a\ncd b # bashlint disable=unchecked-cd\ncd c",
+			[]string{"1:1 unchecked-cd", "3:1 unchecked-cd"},
+		},
+		{ // 5
+			"echo\n# shellcheck disable=SC2164\nf() {\n\tcd a\n\tcd b\n}\ncd c",
+			[]string{"7:1 unchecked-cd"},
+		},
+		{ // 6
+			"echo\n# shellcheck disable=SC2115\ncd a\nrm -rf \"$a/\"",
+			[]string{"3:1 unchecked-cd", "4:8 rm-unsafe-path"},
+		},
+		{ // 7
+			"echo\n# shellcheck disable=SC2115,SC2164\ncd a && rm -rf \"$a/\"\ncd b",
+			[]string{"4:1 unchecked-cd"},
+		},
+		{ // 8
+			"echo\nif true; then\n\t# shellcheck disable=all\n\tcd a\n\tcd b\nfi",
+			[]string{"5:2 unchecked-cd"},
+		},
+		{ // 9
+			"echo\n# shellcheck disable=SC2086\ncd a",
+			[]string{"3:1 unchecked-cd"},
+		},
+		{ // 10
+			"echo\n# bashlint disable=SC2164\ncd a",
+			[]string{"3:1 unchecked-cd"},
+		},
+	})
+}
+
+func TestBaseline(t *testing.T) {
+	l := New(UncheckedCd)
+	old := l.Lint(testutil.Parse(t, "cd a\necho\ncd a"))
+	b := NewBaseline()
+
+	b.Add("a.sh", old)
+
+	var buf bytes.Buffer
+
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatalf("unexpected error writing baseline: %s", err)
+	}
+
+	b, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading baseline: %s", err)
+	}
+
+	for n, test := range [...]struct {
+		File   string
+		Input  string
+		Output []string
+	}{
+		{ // 1
+			"a.sh",
+			"cd a\necho\ncd a",
+			nil,
+		},
+		{ // 2
+			"a.sh",
+			"echo\n\ncd a\necho\ncd a",
+			nil,
+		},
+		{ // 3
+			"a.sh",
+			"cd a\ncd a\ncd a",
+			[]string{"3:1 unchecked-cd"},
+		},
+		{ // 4
+			"a.sh",
+			"pushd b",
+			[]string{"1:1 unchecked-cd"},
+		},
+		{ // 5
+			"b.sh",
+			"cd a",
+			[]string{"1:1 unchecked-cd"},
+		},
+	} {
+		var output []string
+
+		for _, d := range b.Filter(test.File, l.Lint(testutil.Parse(t, test.Input))) {
+			output = append(output, fmt.Sprintf("%s %s", d.Start, d.Rule))
+		}
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("test %d: expecting diagnostics %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package lint
+
+import (
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Error handling rules.
+var (
+	UncheckedCd = &Rule{
+		ID:         "unchecked-cd",
+		Severity:   SeverityWarning,
+		Summary:    "cd without '|| exit' or '|| return' continues in the wrong directory when it fails",
+		ShellCheck: []string{"SC2164"},
+		Check:      checkUncheckedCd,
+	}
+	PipefailMissing = &Rule{
+		ID:       "pipefail-missing",
+		Severity: SeverityWarning,
+		Summary:  "the status of a pipeline is used without 'set -o pipefail', hiding failures in all but the last command",
+		Check:    checkPipefailMissing,
+	}
+	MaskedStatus = &Rule{
+		ID:         "masked-status",
+		Severity:   SeverityWarning,
+		Summary:    "declaring and assigning a command substitution in one command masks its exit status",
+		ShellCheck: []string{"SC2155"},
+		Check:      checkMaskedStatus,
+	}
+	ErrexitIgnored = &Rule{
+		ID:         "errexit-ignored",
+		Severity:   SeverityInfo,
+		Summary:    "'set -e' is disabled for functions called as a condition, before '&&' or '||', or after '!'",
+		ShellCheck: []string{"SC2310"},
+		Check:      checkErrexitIgnored,
+	}
+	NoErrorOptions = &Rule{
+		ID:       "no-error-options",
+		Severity: SeverityInfo,
+		Summary:  "script never enables errexit, nounset, or pipefail",
+		Check:    checkNoErrorOptions,
+	}
+)
+
+// ErrorHandlingRules returns the rules that find failures that would allow a
+// script to continue running unnoticed.
+func ErrorHandlingRules() []*Rule {
+	return []*Rule{
+		UncheckedCd,
+		PipefailMissing,
+		MaskedStatus,
+		ErrexitIgnored,
+		NoErrorOptions,
+	}
+}
+
+func checkUncheckedCd(c *Context) {
+	opts := shellOptions(c.File)
+
+	astutil.Inspect(c.File, func(t bash.Type, parents []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			switch name := astutil.CommandName(cmd); name {
+			case "cd", "pushd", "popd":
+				if !statusChecked(parents) && !opts.enabled("errexit", cmd.Tokens[0].Pos) {
+					c.Report(cmd.Tokens, "use '%s ... || exit' or '%[1]s ... || return' in case %[1]s fails", name)
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func checkPipefailMissing(c *Context) {
+	opts := shellOptions(c.File)
+
+	astutil.Inspect(c.File, func(t bash.Type, parents []bash.Type) bool {
+		if p, ok := t.(*bash.Pipeline); ok && p.Pipeline != nil {
+			if _, inPipeline := parents[len(parents)-1].(*bash.Pipeline); !inPipeline {
+				pos := p.Tokens[0].Pos
+
+				if !opts.enabled("pipefail", pos) && (statusChecked(parents) || opts.enabled("errexit", pos)) {
+					c.Report(p.Tokens, "the status of this pipeline is that of its last command; use 'set -o pipefail' to catch earlier failures")
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func checkMaskedStatus(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			switch name := astutil.CommandName(cmd); name {
+			case "local", "declare", "typeset", "export", "readonly":
+				for _, aw := range cmd.AssignmentsOrWords[1:] {
+					if aw.Assignment != nil && hasCommandSubstitution(aw.Assignment.Value) {
+						c.Report(aw.Assignment.Tokens, "'%s' returns its own status, masking that of the command substitution; declare and assign separately", name)
+					}
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func hasCommandSubstitution(v *bash.Value) bool {
+	if v == nil || v.Word == nil {
+		return false
+	}
+
+	for _, p := range v.Word.Parts {
+		if cs := p.CommandSubstitution; cs != nil && (cs.SubstitutionType == bash.SubstitutionNew || cs.SubstitutionType == bash.SubstitutionBacktick) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkErrexitIgnored(c *Context) {
+	opts := shellOptions(c.File)
+	fns := functions(c.File)
+
+	astutil.Inspect(c.File, func(t bash.Type, parents []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			if name := astutil.CommandName(cmd); fns[name] && opts.enabled("errexit", cmd.Tokens[0].Pos) && errexitIgnored(cmd, parents) {
+				c.Report(cmd.Tokens, "'set -e' is disabled while '%s' runs as a condition; failures within it will not exit", name)
+			}
+		}
+
+		return true
+	})
+}
+
+func checkNoErrorOptions(c *Context) {
+	if len(c.File.Lines) == 0 || shellOptions(c.File).set("errexit", "nounset", "pipefail") {
+		return
+	}
+
+	tks := c.File.Lines[0].Tokens
+
+	if len(c.File.Comments[0]) > 0 {
+		tks = bash.Tokens(c.File.Comments[0][:1])
+	}
+
+	c.Report(tks, "script never sets errexit, nounset, or pipefail; consider 'set -euo pipefail'")
+}
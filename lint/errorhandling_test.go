@@ -0,0 +1,168 @@
+package lint
+
+import "testing"
+
+func TestUncheckedCd(t *testing.T) {
+	doTests(t, []*Rule{UncheckedCd}, []ruleTest{
+		{ // 1
+			"cd /tmp",
+			[]string{"1:1 unchecked-cd"},
+		},
+		{ // 2
+			"cd /tmp || exit",
+			nil,
+		},
+		{ // 3
+			"f() {\n\tcd \"$1\" || return 1\n}",
+			nil,
+		},
+		{ // 4
+			"if cd /tmp; then\n\tls\nfi",
+			nil,
+		},
+		{ // 5
+			"set -e\ncd /tmp",
+			nil,
+		},
+		{ // 6
+			"cd /tmp\nset -e\npushd a\npopd",
+			[]string{"1:1 unchecked-cd"},
+		},
+		{ // 7
+			"a && cd /tmp",
+			[]string{"1:6 unchecked-cd"},
+		},
+		{ // 8
+			"cd /tmp | cat",
+			[]string{"1:1 unchecked-cd"},
+		},
+		{ // 9
+			"! cd /tmp",
+			nil,
+		},
+	})
+}
+
+func TestPipefailMissing(t *testing.T) {
+	doTests(t, []*Rule{PipefailMissing}, []ruleTest{
+		{ // 1
+			"a | b",
+			nil,
+		},
+		{ // 2
+			"if a | b; then\n\tc\nfi",
+			[]string{"1:4 pipefail-missing"},
+		},
+		{ // 3
+			"a | b || exit",
+			[]string{"1:1 pipefail-missing"},
+		},
+		{ // 4
+			"set -o pipefail\na | b || exit",
+			nil,
+		},
+		{ // 5
+			"set -e\na | b | c",
+			[]string{"2:1 pipefail-missing"},
+		},
+		{ // 6
+			"set -euo pipefail\na | b | c",
+			nil,
+		},
+		{ // 7
+			"while a | grep -q b; do\n\tc\ndone",
+			[]string{"1:7 pipefail-missing"},
+		},
+	})
+}
+
+func TestMaskedStatus(t *testing.T) {
+	doTests(t, []*Rule{MaskedStatus}, []ruleTest{
+		{ // 1
+			"local a=$(b)",
+			[]string{"1:7 masked-status"},
+		},
+		{ // 2
+			"local a\na=$(b)",
+			nil,
+		},
+		{ // 3
+			"export a=`b` c=d",
+			[]string{"1:8 masked-status"},
+		},
+		{ // 4
+			"declare -r a=\"$(b)\" c=d",
+			[]string{"1:12 masked-status"},
+		},
+		{ // 5
+			"local a=b <(c)",
+			nil,
+		},
+		{ // 6
+			"readonly a=x$(b)",
+			[]string{"1:10 masked-status"},
+		},
+	})
+}
+
+func TestErrexitIgnored(t *testing.T) {
+	doTests(t, []*Rule{ErrexitIgnored}, []ruleTest{
+		{ // 1
+			"set -e\nf() {\n\tfalse\n\techo\n}\nif f; then\n\tg\nfi",
+			[]string{"6:4 errexit-ignored"},
+		},
+		{ // 2
+			"f() {\n\tfalse\n}\nf || exit",
+			nil,
+		},
+		{ // 3
+			"set -e\nf() {\n\tfalse\n}\nf\nf && g\ng || f",
+			[]string{"6:1 errexit-ignored"},
+		},
+		{ // 4
+			"set -e\nf() {\n\tfalse\n}\nf || g",
+			[]string{"5:1 errexit-ignored"},
+		},
+		{ // 5
+			"set -e\nf() {\n\tfalse\n}\n! f\ng && ! f",
+			[]string{"5:3 errexit-ignored", "6:8 errexit-ignored"},
+		},
+		{ // 6
+			"set -e\nf() {\n\tfalse\n}\nuntil f; do\n\tf\ndone\nwhile f; do :; done",
+			[]string{"5:7 errexit-ignored", "8:7 errexit-ignored"},
+		},
+		{ // 7
+			"set -e\nf() {\n\tfalse\n}\n{ f; g; } && h\nif { g; f; }; then :; fi",
+			[]string{"5:3 errexit-ignored", "6:9 errexit-ignored"},
+		},
+		{ // 8
+			"set -e\nf() {\n\tfalse\n}\ng() {\n\tf\n}\nif true; then\n\tf\nfi\nf | g",
+			nil,
+		},
+	})
+}
+
+func TestNoErrorOptions(t *testing.T) {
+	doTests(t, []*Rule{NoErrorOptions}, []ruleTest{
+		{ // 1
+			"",
+			nil,
+		},
+		{ // 2
+			"#!/bin/bash\n\necho",
+			[]string{"1:1 no-error-options"},
+		},
+		{ // 3
+			"a\nset -u",
+			nil,
+		},
+		{ // 4
+			"#!/bin/bash -e\na",
+			nil,
+		},
+		{ // 5
+			"#!/usr/bin/env bash\nset +e\na",
+			[]string{"1:1 no-error-options"},
+		},
+	})
+}
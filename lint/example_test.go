@@ -0,0 +1,30 @@
+package lint_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/lint"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "#!/bin/bash\n\ncd /some/dir\nlocal files=$(ls)\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	for _, d := range lint.New(lint.ErrorHandlingRules()...).Lint(b) {
+		fmt.Println(d)
+	}
+
+	// Output:
+	// 1:1: info: script never sets errexit, nounset, or pipefail; consider 'set -euo pipefail' [no-error-options]
+	// 3:1: warning: use 'cd ... || exit' or 'cd ... || return' in case cd fails [unchecked-cd]
+	// 4:7: warning: 'local' returns its own status, masking that of the command substitution; declare and assign separately [masked-status]
+}
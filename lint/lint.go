@@ -0,0 +1,215 @@
+// Package lint provides a framework for checking parsed bash for common
+// mistakes.
+package lint
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/parser"
+)
+
+// Severity represents how serious a Diagnostic is.
+type Severity uint8
+
+// Severities.
+const (
+	SeverityStyle Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+// String implements the fmt.Stringer interface.
+func (s Severity) String() string {
+	switch s {
+	case SeverityStyle:
+		return "style"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+
+	return "unknown"
+}
+
+// Position represents a location within the source; all values are zero
+// indexed.
+type Position struct {
+	Pos, Line, LinePos uint64
+}
+
+// String implements the fmt.Stringer interface, returning a one-indexed
+// line:column pair.
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line+1, p.LinePos+1)
+}
+
+// Diagnostic represents a single problem found by a Rule.
+type Diagnostic struct {
+	Rule     string
+	Severity Severity
+	Message  string
+	Start    Position
+	End      Position
+}
+
+// String implements the fmt.Stringer interface.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", d.Start, d.Severity, d.Message, d.Rule)
+}
+
+// Rule represents a single check that can be run against a parsed file.
+//
+// The ID must be unique amongst the rules given to a Linter.
+//
+// ShellCheck lists the codes of any equivalent ShellCheck checks, allowing
+// existing '# shellcheck disable=...' directives to suppress the rule.
+type Rule struct {
+	ID         string
+	Severity   Severity
+	Summary    string
+	ShellCheck []string
+	Check      func(*Context)
+}
+
+// Context is passed to the Check function of a Rule, and is used to report
+// any problems found.
+type Context struct {
+	File        *bash.File
+	rule        *Rule
+	diagnostics []Diagnostic
+}
+
+// Report records a Diagnostic, with the span of the given tokens, for the rule
+// being checked.
+func (c *Context) Report(tks bash.Tokens, format string, args ...any) {
+	c.ReportSeverity(c.rule.Severity, tks, format, args...)
+}
+
+// ReportSeverity records a Diagnostic, as Report, but with a Severity other
+// than that of the rule.
+func (c *Context) ReportSeverity(s Severity, tks bash.Tokens, format string, args ...any) {
+	d := Diagnostic{
+		Rule:     c.rule.ID,
+		Severity: s,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	if len(tks) > 0 {
+		end := astutil.End(tks)
+		d.Start = Position{Pos: tks[0].Pos, Line: tks[0].Line, LinePos: tks[0].LinePos}
+		d.End = Position{Pos: end.Pos, Line: end.Line, LinePos: end.LinePos}
+	}
+
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// Linter runs a set of Rules against parsed bash files.
+type Linter struct {
+	rules []*Rule
+}
+
+// New creates a new Linter with the given rules.
+func New(rules ...*Rule) *Linter {
+	return &Linter{rules: rules}
+}
+
+// Rules returns the rules the Linter will run.
+func (l *Linter) Rules() []*Rule {
+	return l.rules
+}
+
+// Lint runs all of the rules against the given file, returning the found
+// Diagnostics sorted by position.
+//
+// Diagnostics suppressed by a directive comment are not returned.
+func (l *Linter) Lint(f *bash.File) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	sups := suppressions(f, l.rules)
+
+	for _, r := range l.rules {
+		c := Context{File: f, rule: r}
+
+		r.Check(&c)
+
+		for _, d := range c.diagnostics {
+			if !sups.suppressed(d) {
+				diagnostics = append(diagnostics, d)
+			}
+		}
+	}
+
+	slices.SortStableFunc(diagnostics, func(a, b Diagnostic) int {
+		return cmp.Or(cmp.Compare(a.Start.Pos, b.Start.Pos), cmp.Compare(a.Rule, b.Rule))
+	})
+
+	return diagnostics
+}
+
+// Filter returns only those Diagnostics with a Severity of at least min.
+func Filter(diagnostics []Diagnostic, min Severity) []Diagnostic {
+	var filtered []Diagnostic
+
+	for _, d := range diagnostics {
+		if d.Severity >= min {
+			filtered = append(filtered, d)
+		}
+	}
+
+	return filtered
+}
+
+// ParseErrorRule is the Rule used for Diagnostics created by ParseError.
+var ParseErrorRule = &Rule{
+	ID:       "parse-error",
+	Severity: SeverityError,
+	Summary:  "the file could not be parsed",
+	Check:    func(*Context) {},
+}
+
+// ParseError converts an error returned from bash.Parse into a Diagnostic,
+// positioned at the token that caused the error.
+//
+// Returns false if the error does not contain a bash.Error.
+func ParseError(err error) (Diagnostic, bool) {
+	var e bash.Error
+
+	if !errors.As(err, &e) {
+		return Diagnostic{}, false
+	}
+
+	for {
+		var inner bash.Error
+
+		if !errors.As(e.Err, &inner) {
+			break
+		}
+
+		e = inner
+	}
+
+	start := Position{Pos: e.Token.Pos, Line: e.Token.Line, LinePos: e.Token.LinePos}
+	end := start
+
+	if e.Token.Type != parser.TokenError && e.Token.Type != parser.TokenDone {
+		tk := astutil.End(bash.Tokens{e.Token})
+		end = Position{Pos: tk.Pos, Line: tk.Line, LinePos: tk.LinePos}
+	}
+
+	return Diagnostic{
+		Rule:     ParseErrorRule.ID,
+		Severity: ParseErrorRule.Severity,
+		Message:  fmt.Sprintf("%s: %s", e.Parsing, e.Err),
+		Start:    start,
+		End:      end,
+	}, true
+}
@@ -0,0 +1,70 @@
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+type ruleTest struct {
+	Input  string
+	Output []string
+}
+
+func doTests(t *testing.T, rules []*Rule, tests []ruleTest) {
+	t.Helper()
+
+	l := New(rules...)
+
+	for n, test := range tests {
+		var output []string
+
+		for _, d := range l.Lint(testutil.Parse(t, test.Input)) {
+			output = append(output, fmt.Sprintf("%s %s", d.Start, d.Rule))
+		}
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("test %d: expecting diagnostics %q, got %q", n+1, test.Output, output)
+		}
+	}
+}
+
+func TestLinter(t *testing.T) {
+	rule := &Rule{
+		ID:       "echo",
+		Severity: SeverityStyle,
+		Check: func(c *Context) {
+			for _, l := range c.File.Lines {
+				if cmd := l.Statements[0].Pipeline.CommandOrCompound.Command; cmd != nil {
+					c.Report(cmd.Tokens, "found %s", cmd.AssignmentsOrWords[0].Word.Parts[0].Part.Data)
+				}
+			}
+		},
+	}
+
+	d := New(rule).Lint(testutil.Parse(t, "a\n  b c"))
+
+	expected := []Diagnostic{
+		{
+			Rule:     "echo",
+			Severity: SeverityStyle,
+			Message:  "found a",
+			End:      Position{Pos: 1, LinePos: 1},
+		},
+		{
+			Rule:     "echo",
+			Severity: SeverityStyle,
+			Message:  "found b",
+			Start:    Position{Pos: 4, Line: 1, LinePos: 2},
+			End:      Position{Pos: 7, Line: 1, LinePos: 5},
+		},
+	}
+
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("expecting %v, got %v", expected, d)
+	} else if str := d[1].String(); str != "2:3: style: found b [echo]" {
+		t.Errorf("expecting string %q, got %q", "2:3: style: found b [echo]", str)
+	}
+}
@@ -0,0 +1,218 @@
+package lint
+
+import (
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Portability rules, which only report when the target shell, determined by
+// the shebang or a 'shell=' directive, is a POSIX shell.
+var (
+	BashismDoubleBracket = &Rule{
+		ID:         "bashism-double-bracket",
+		Severity:   SeverityWarning,
+		Summary:    "'[[ ... ]]' is not supported by POSIX sh; use '[ ... ]'",
+		ShellCheck: []string{"SC2039", "SC3010"},
+		Check:      posixCheck(false, checkDoubleBracket),
+	}
+	BashismTestEquals = &Rule{
+		ID:         "bashism-test-equals",
+		Severity:   SeverityWarning,
+		Summary:    "'==' in '[' or 'test' is not supported by POSIX sh; use '='",
+		ShellCheck: []string{"SC2039", "SC3014"},
+		Check:      posixCheck(false, checkTestEquals),
+	}
+	BashismFunctionKeyword = &Rule{
+		ID:         "bashism-function-keyword",
+		Severity:   SeverityWarning,
+		Summary:    "the 'function' keyword is not supported by POSIX sh; use 'name() { ... }'",
+		ShellCheck: []string{"SC2039", "SC2112"},
+		Check:      posixCheck(false, checkFunctionKeyword),
+	}
+	BashismLocal = &Rule{
+		ID:         "bashism-local",
+		Severity:   SeverityWarning,
+		Summary:    "'local' is not defined by POSIX, though dash and ash support it",
+		ShellCheck: []string{"SC2039", "SC3043"},
+		Check:      posixCheck(true, checkLocal),
+	}
+	BashismArray = &Rule{
+		ID:         "bashism-array",
+		Severity:   SeverityWarning,
+		Summary:    "arrays are not supported by POSIX sh",
+		ShellCheck: []string{"SC2039", "SC3030", "SC3054"},
+		Check:      posixCheck(false, checkArray),
+	}
+	BashismANSICQuote = &Rule{
+		ID:         "bashism-ansi-c-quote",
+		Severity:   SeverityWarning,
+		Summary:    "$'...' strings are not supported by POSIX sh; use printf",
+		ShellCheck: []string{"SC2039", "SC3003"},
+		Check:      posixCheck(false, checkANSICQuote),
+	}
+	BashismHereString = &Rule{
+		ID:         "bashism-here-string",
+		Severity:   SeverityWarning,
+		Summary:    "'<<<' is not supported by POSIX sh; use a heredoc or a pipe",
+		ShellCheck: []string{"SC2039", "SC3011"},
+		Check:      posixCheck(false, checkHereString),
+	}
+	BashismRedirectBoth = &Rule{
+		ID:         "bashism-redirect-both",
+		Severity:   SeverityWarning,
+		Summary:    "'&>' is not supported by POSIX sh, which runs the command in the background; use '>file 2>&1'",
+		ShellCheck: []string{"SC2039", "SC3020"},
+		Check:      posixCheck(false, checkRedirectBoth),
+	}
+	BashismBraceExpansion = &Rule{
+		ID:         "bashism-brace-expansion",
+		Severity:   SeverityWarning,
+		Summary:    "brace expansion is not supported by POSIX sh",
+		ShellCheck: []string{"SC2039", "SC3009"},
+		Check:      posixCheck(false, checkBraceExpansion),
+	}
+	BashismSource = &Rule{
+		ID:         "bashism-source",
+		Severity:   SeverityWarning,
+		Summary:    "'source' is not supported by POSIX sh; use '.'",
+		ShellCheck: []string{"SC2039", "SC3046"},
+		Check:      posixCheck(false, checkSource),
+	}
+	BashismEchoFlags = &Rule{
+		ID:         "bashism-echo-flags",
+		Severity:   SeverityWarning,
+		Summary:    "the flags of 'echo' are not portable; use printf",
+		ShellCheck: []string{"SC2039", "SC3037"},
+		Check:      posixCheck(false, checkEchoFlags),
+	}
+)
+
+// PortabilityRules returns the rules that find bash features used in scripts
+// targeting a POSIX shell.
+func PortabilityRules() []*Rule {
+	return []*Rule{
+		BashismDoubleBracket,
+		BashismTestEquals,
+		BashismFunctionKeyword,
+		BashismLocal,
+		BashismArray,
+		BashismANSICQuote,
+		BashismHereString,
+		BashismRedirectBoth,
+		BashismBraceExpansion,
+		BashismSource,
+		BashismEchoFlags,
+	}
+}
+
+// posixCheck creates a Check function that calls fn for every type in the file
+// when the file targets a POSIX shell.
+//
+// When strict is true, shells that extend POSIX with common features, such as
+// dash, are excluded.
+func posixCheck(strict bool, fn func(*Context, bash.Type)) func(*Context) {
+	return func(c *Context) {
+		switch targetShell(c.File) {
+		case "sh", "posh":
+		case "dash", "ash":
+			if strict {
+				return
+			}
+		default:
+			return
+		}
+
+		astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+			fn(c, t)
+
+			return true
+		})
+	}
+}
+
+func checkDoubleBracket(c *Context, t bash.Type) {
+	if tc, ok := t.(*bash.TestCompound); ok {
+		c.Report(tc.Tokens, "'[[' is a bashism")
+	}
+}
+
+func checkTestEquals(c *Context, t bash.Type) {
+	if cmd, ok := t.(*bash.Command); ok {
+		if name := astutil.CommandName(cmd); name == "[" || name == "test" {
+			for _, w := range astutil.Args(cmd) {
+				if arg, ok := astutil.Literal(w); ok && arg == "==" {
+					c.Report(w.Tokens, "'==' in '%s' is a bashism; use '='", name)
+				}
+			}
+		}
+	}
+}
+
+func checkFunctionKeyword(c *Context, t bash.Type) {
+	if fc, ok := t.(*bash.FunctionCompound); ok && fc.HasKeyword {
+		c.Report(fc.Tokens[:1], "the 'function' keyword is a bashism")
+	}
+}
+
+func checkLocal(c *Context, t bash.Type) {
+	if cmd, ok := t.(*bash.Command); ok && astutil.CommandName(cmd) == "local" {
+		c.Report(cmd.AssignmentsOrWords[0].Tokens, "'local' is not defined by POSIX")
+	}
+}
+
+func checkArray(c *Context, t bash.Type) {
+	switch t := t.(type) {
+	case *bash.Assignment:
+		if t.Value != nil && t.Value.Array != nil {
+			c.Report(t.Tokens, "array assignment is a bashism")
+		} else if len(t.Identifier.Subscript) > 0 {
+			c.Report(t.Identifier.Tokens, "array element assignment is a bashism")
+		}
+	case *bash.ParameterExpansion:
+		if len(t.Parameter.Array) > 0 {
+			c.Report(t.Tokens, "array expansion is a bashism")
+		}
+	}
+}
+
+func checkANSICQuote(c *Context, t bash.Type) {
+	if p, ok := t.(*bash.WordPart); ok && p.Part != nil && p.Part.Type == bash.TokenString && strings.HasPrefix(p.Part.Data, "$'") {
+		c.Report(p.Tokens, "$'...' is a bashism")
+	}
+}
+
+func checkHereString(c *Context, t bash.Type) {
+	if r, ok := t.(*bash.Redirection); ok && r.Redirector != nil && r.Redirector.Data == "<<<" {
+		c.Report(r.Tokens, "'<<<' is a bashism")
+	}
+}
+
+func checkRedirectBoth(c *Context, t bash.Type) {
+	if r, ok := t.(*bash.Redirection); ok && r.Redirector != nil && strings.HasPrefix(r.Redirector.Data, "&>") {
+		c.Report(r.Tokens, "'%s' is a bashism", r.Redirector.Data)
+	}
+}
+
+func checkBraceExpansion(c *Context, t bash.Type) {
+	if p, ok := t.(*bash.WordPart); ok && p.BraceExpansion != nil {
+		c.Report(p.Tokens, "brace expansion is a bashism")
+	}
+}
+
+func checkSource(c *Context, t bash.Type) {
+	if cmd, ok := t.(*bash.Command); ok && astutil.CommandName(cmd) == "source" {
+		c.Report(cmd.AssignmentsOrWords[0].Tokens, "'source' is a bashism; use '.'")
+	}
+}
+
+func checkEchoFlags(c *Context, t bash.Type) {
+	if cmd, ok := t.(*bash.Command); ok && astutil.CommandName(cmd) == "echo" {
+		if args := astutil.Args(cmd); len(args) > 0 {
+			if arg, ok := astutil.Literal(args[0]); ok && len(arg) > 1 && arg[0] == '-' && strings.Trim(arg[1:], "neE") == "" && strings.ContainsAny(arg, "eE") {
+				c.Report(args[0].Tokens, "'echo %s' is not portable; use printf", arg)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package lint
+
+import "testing"
+
+func TestBashismDoubleBracket(t *testing.T) {
+	doTests(t, []*Rule{BashismDoubleBracket}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\n[[ -f a ]] && echo",
+			[]string{"2:1 bashism-double-bracket"},
+		},
+		{ // 2
+			"#!/bin/bash\n[[ -f a ]] && echo",
+			nil,
+		},
+		{ // 3
+			"[[ -f a ]]",
+			nil,
+		},
+		{ // 4
+			"#!/usr/bin/env dash\nif [[ $a ]]; then :; fi",
+			[]string{"2:4 bashism-double-bracket"},
+		},
+		{ // 5
+			"#!/bin/bash\n# shellcheck shell=sh\n[[ a ]]",
+			[]string{"3:1 bashism-double-bracket"},
+		},
+		{ // 6
+			"#!/bin/sh\n# bashlint shell=bash\n[[ a ]]",
+			nil,
+		},
+	})
+}
+
+func TestBashismTestEquals(t *testing.T) {
+	doTests(t, []*Rule{BashismTestEquals}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\n[ \"$a\" == b ]",
+			[]string{"2:8 bashism-test-equals"},
+		},
+		{ // 2
+			"#!/bin/sh\ntest \"$a\" = b",
+			nil,
+		},
+		{ // 3
+			"#!/bin/sh\ntest \"$a\" == b",
+			[]string{"2:11 bashism-test-equals"},
+		},
+	})
+}
+
+func TestBashismFunctionKeyword(t *testing.T) {
+	doTests(t, []*Rule{BashismFunctionKeyword}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\nfunction f {\n\t:\n}",
+			[]string{"2:1 bashism-function-keyword"},
+		},
+		{ // 2
+			"#!/bin/sh\nf() {\n\t:\n}",
+			nil,
+		},
+	})
+}
+
+func TestBashismLocal(t *testing.T) {
+	doTests(t, []*Rule{BashismLocal}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\nf() {\n\tlocal a=1\n}",
+			[]string{"3:2 bashism-local"},
+		},
+		{ // 2
+			"#!/bin/dash\nf() {\n\tlocal a=1\n}",
+			nil,
+		},
+	})
+}
+
+func TestBashismArray(t *testing.T) {
+	doTests(t, []*Rule{BashismArray}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\na=(1 2 3)",
+			[]string{"2:1 bashism-array"},
+		},
+		{ // 2
+			"#!/bin/sh\na[1]=x",
+			[]string{"2:1 bashism-array"},
+		},
+		{ // 3
+			"#!/bin/sh\necho \"${a[@]}\" ${#b[@]}",
+			[]string{"2:7 bashism-array", "2:16 bashism-array"},
+		},
+		{ // 4
+			"#!/bin/sh\na=1\necho \"${a}\"",
+			nil,
+		},
+	})
+}
+
+func TestBashismANSICQuote(t *testing.T) {
+	doTests(t, []*Rule{BashismANSICQuote}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\nIFS=$'\\n'",
+			[]string{"2:5 bashism-ansi-c-quote"},
+		},
+		{ // 2
+			"#!/bin/sh\nIFS='\n'",
+			nil,
+		},
+	})
+}
+
+func TestBashismRedirections(t *testing.T) {
+	doTests(t, []*Rule{BashismHereString, BashismRedirectBoth}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\ngrep a <<< \"$b\"",
+			[]string{"2:8 bashism-here-string"},
+		},
+		{ // 2
+			"#!/bin/sh\ncmd &> /dev/null",
+			[]string{"2:5 bashism-redirect-both"},
+		},
+		{ // 3
+			"#!/bin/sh\ncmd &>> log",
+			[]string{"2:5 bashism-redirect-both"},
+		},
+		{ // 4
+			"#!/bin/sh\ncmd > /dev/null 2>&1",
+			nil,
+		},
+	})
+}
+
+func TestBashismBraceExpansion(t *testing.T) {
+	doTests(t, []*Rule{BashismBraceExpansion}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\ncp file{,.bak}",
+			[]string{"2:8 bashism-brace-expansion"},
+		},
+		{ // 2
+			"#!/bin/sh\necho {a}",
+			nil,
+		},
+	})
+}
+
+func TestBashismSource(t *testing.T) {
+	doTests(t, []*Rule{BashismSource}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\nsource ./lib.sh",
+			[]string{"2:1 bashism-source"},
+		},
+		{ // 2
+			"#!/bin/sh\n. ./lib.sh",
+			nil,
+		},
+	})
+}
+
+func TestBashismEchoFlags(t *testing.T) {
+	doTests(t, []*Rule{BashismEchoFlags}, []ruleTest{
+		{ // 1
+			"#!/bin/sh\necho -e \"a\\tb\"",
+			[]string{"2:6 bashism-echo-flags"},
+		},
+		{ // 2
+			"#!/bin/sh\necho -ne a",
+			[]string{"2:6 bashism-echo-flags"},
+		},
+		{ // 3
+			"#!/bin/sh\necho -n a",
+			nil,
+		},
+		{ // 4
+			"#!/bin/sh\necho a -e",
+			nil,
+		},
+	})
+}
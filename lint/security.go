@@ -0,0 +1,419 @@
+package lint
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Security rules.
+var (
+	PipeToShell = &Rule{
+		ID:       "pipe-to-shell",
+		Severity: SeverityError,
+		Summary:  "downloaded content is run by a shell without being verified",
+		Check:    checkPipeToShell,
+	}
+	EvalInjection = &Rule{
+		ID:       "eval-injection",
+		Severity: SeverityError,
+		Summary:  "eval of expanded values runs any code they contain",
+		Check:    checkEvalInjection,
+	}
+	RmUnsafePath = &Rule{
+		ID:         "rm-unsafe-path",
+		Severity:   SeverityError,
+		Summary:    "recursive rm of a path starting with a parameter that may be empty or unset",
+		ShellCheck: []string{"SC2115"},
+		Check:      checkRmUnsafePath,
+	}
+	WorldWritable = &Rule{
+		ID:       "world-writable",
+		Severity: SeverityWarning,
+		Summary:  "chmod makes files writable by all users",
+		Check:    checkWorldWritable,
+	}
+	PredictableTmp = &Rule{
+		ID:       "predictable-tmp",
+		Severity: SeverityWarning,
+		Summary:  "fixed filenames in /tmp can be pre-created by other users; use mktemp",
+		Check:    checkPredictableTmp,
+	}
+	SudoInterpolation = &Rule{
+		ID:       "sudo-interpolation",
+		Severity: SeverityWarning,
+		Summary:  "expanded values in a command run with elevated privileges",
+		Check:    checkSudoInterpolation,
+	}
+	HardcodedSecret = &Rule{
+		ID:       "hardcoded-secret",
+		Severity: SeverityError,
+		Summary:  "credentials should not be stored in scripts",
+		Check:    checkHardcodedSecret,
+	}
+)
+
+// SecurityRules returns the rules that find patterns that are commonly
+// exploitable, or which leak credentials.
+//
+// The Severity of each rule is intended to allow a review gate to fail on
+// SeverityError, using Filter.
+func SecurityRules() []*Rule {
+	return []*Rule{
+		PipeToShell,
+		EvalInjection,
+		RmUnsafePath,
+		WorldWritable,
+		PredictableTmp,
+		SudoInterpolation,
+		HardcodedSecret,
+	}
+}
+
+var (
+	downloaders = []string{"curl", "wget", "fetch"}
+	shells      = []string{"sh", "bash", "dash", "ksh", "zsh", "ash", "mksh"}
+)
+
+func unwrapCommand(c *bash.Command) (string, []*bash.Word, []string) {
+	return astutil.Unwrap(astutil.Words(c))
+}
+
+func pipelineCommand(p *bash.Pipeline) string {
+	if p == nil || p.CommandOrCompound.Command == nil {
+		return ""
+	}
+
+	name, _, _ := unwrapCommand(p.CommandOrCompound.Command)
+
+	return name
+}
+
+func checkPipeToShell(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.Pipeline:
+			if name := pipelineCommand(t); slices.Contains(downloaders, name) {
+				if shell := pipelineCommand(t.Pipeline); slices.Contains(shells, shell) {
+					c.Report(t.Tokens, "output of '%s' is piped directly into '%s'; download to a file and verify it first", name, shell)
+				}
+			}
+		case *bash.Command:
+			name, words, _ := unwrapCommand(t)
+			if !slices.Contains(shells, name) {
+				break
+			}
+
+			for _, w := range words[1:] {
+				for _, p := range w.Parts {
+					if cs := p.CommandSubstitution; cs != nil && cs.SubstitutionType != bash.SubstitutionProcessOutput && runsDownloader(&cs.Command) {
+						c.Report(t.Tokens, "'%s' runs downloaded content; download to a file and verify it first", name)
+
+						return true
+					}
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func runsDownloader(f *bash.File) bool {
+	found := false
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			if name, _, _ := unwrapCommand(cmd); slices.Contains(downloaders, name) {
+				found = true
+			}
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+func checkEvalInjection(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			if name, words, _ := unwrapCommand(cmd); name == "eval" {
+				for _, w := range words[1:] {
+					if _, ok := astutil.Literal(w); !ok {
+						c.Report(w.Tokens, "eval of a non-literal value; any code it contains will be run")
+					}
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func checkRmUnsafePath(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			if name, words, _ := unwrapCommand(cmd); name == "rm" && isRecursive(words[1:]) {
+				for _, w := range words[1:] {
+					if param, ok := unguardedPrefix(w); ok {
+						c.Report(w.Tokens, "if '%s' is empty or unset this removes from the root directory; use \"${%[1]s:?}\"", param)
+					}
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func isRecursive(args []*bash.Word) bool {
+	for _, w := range args {
+		arg, _ := astutil.Literal(w)
+
+		if arg == "--" {
+			break
+		} else if arg == "--recursive" {
+			return true
+		} else if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.ContainsAny(arg, "rR") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unguardedPrefix determines whether a word starts with a parameter that may
+// expand to nothing, followed by a '/', returning the name of that parameter.
+func unguardedPrefix(w *bash.Word) (string, bool) {
+	segments := astutil.Segments(w)
+
+	if len(segments) < 2 || segments[0].IsLiteral() || !segments[1].IsLiteral() || !strings.HasPrefix(segments[1].Literal, "/") {
+		return "", false
+	}
+
+	if segments[0].Parameter != "" {
+		return segments[0].Parameter, true
+	}
+
+	pe := segments[0].Part.ParameterExpansion
+	if pe == nil || pe.Parameter.Parameter == nil {
+		return "", false
+	}
+
+	switch pe.Type {
+	case bash.ParameterSubstitution, bash.ParameterAssignment, bash.ParameterSetAssign:
+		return "", false
+	}
+
+	return pe.Parameter.Parameter.Data, true
+}
+
+func checkWorldWritable(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			if name, words, _ := unwrapCommand(cmd); name == "chmod" {
+				start := slices.IndexFunc(cmd.AssignmentsOrWords, func(aw bash.AssignmentOrWord) bool { return aw.Word == words[0] })
+
+				for _, aw := range cmd.AssignmentsOrWords[start+1:] {
+					mode, ok := modeArg(aw)
+					if !ok || strings.HasPrefix(mode, "--") || strings.HasPrefix(mode, "-") && strings.Trim(mode[1:], "RfvcH") == "" {
+						continue
+					}
+
+					if worldWritable(mode) {
+						c.Report(aw.Tokens, "mode '%s' allows any user to write; restrict it to the owner or group", mode)
+					}
+
+					break
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+// modeArg returns the literal value of a chmod argument, which, for a symbolic
+// mode such as 'a=rwx', is parsed as an Assignment.
+func modeArg(aw bash.AssignmentOrWord) (string, bool) {
+	if a := aw.Assignment; a != nil {
+		if a.Identifier.Identifier == nil || a.Assignment != bash.AssignmentAssign || a.Value == nil || a.Value.Word == nil {
+			return "", false
+		}
+
+		value, ok := astutil.Literal(a.Value.Word)
+
+		return a.Identifier.Identifier.Data + "=" + value, ok
+	}
+
+	return astutil.Literal(aw.Word)
+}
+
+func worldWritable(mode string) bool {
+	if mode != "" && strings.Trim(mode, "01234567") == "" {
+		return (mode[len(mode)-1]-'0')&2 != 0
+	}
+
+	for _, clause := range strings.Split(mode, ",") {
+		who := strings.TrimLeft(clause, "ugoa")
+		others := strings.ContainsAny(clause[:len(clause)-len(who)], "oa")
+
+		for len(who) > 0 && strings.IndexByte("+-=", who[0]) >= 0 {
+			op, perms := who[0], who[1:]
+
+			if n := strings.IndexAny(perms, "+-="); n >= 0 {
+				perms, who = perms[:n], perms[n:]
+			} else {
+				who = ""
+			}
+
+			if others && op != '-' && strings.Contains(perms, "w") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+var tmpWriters = []string{"touch", "mkdir", "tee", "cp", "mv", "ln", "install"}
+
+func checkPredictableTmp(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.Command:
+			if name, words, _ := unwrapCommand(t); slices.Contains(tmpWriters, name) {
+				for _, w := range words[1:] {
+					reportTmp(c, w)
+				}
+			}
+		case *bash.Redirection:
+			if t.Redirector != nil && strings.Contains(t.Redirector.Data, ">") {
+				reportTmp(c, &t.Output)
+			}
+		case *bash.Assignment:
+			if t.Value != nil && t.Value.Word != nil {
+				reportTmp(c, t.Value.Word)
+			}
+		}
+
+		return true
+	})
+}
+
+func reportTmp(c *Context, w *bash.Word) {
+	segments := astutil.Segments(w)
+	if len(segments) == 0 || !segments[0].IsLiteral() {
+		return
+	}
+
+	for _, dir := range [...]string{"/tmp/", "/var/tmp/"} {
+		if name, ok := strings.CutPrefix(segments[0].Literal, dir); ok && (name != "" || len(segments) > 1) {
+			c.Report(w.Tokens, "predictable filename in %s; use 'mktemp' to create it safely", strings.TrimSuffix(dir, "/"))
+
+			return
+		}
+	}
+}
+
+func checkSudoInterpolation(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		if cmd, ok := t.(*bash.Command); ok {
+			_, words, wrapped := unwrapCommand(cmd)
+
+			if n := slices.IndexFunc(wrapped, isPrivileged); n >= 0 {
+				for _, w := range words {
+					if _, ok := astutil.Literal(w); !ok {
+						c.Report(w.Tokens, "expanded value passed to a command run by '%s'; validate it first", wrapped[n])
+					}
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+func isPrivileged(name string) bool {
+	return name == "sudo" || name == "doas"
+}
+
+var (
+	secretNames = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "private_key", "access_key", "credentials"}
+	notSecrets  = []string{"_file", "_path", "_dir", "_url", "_name", "_var", "_env", "_header", "_prompt", "_msg", "_message", "_label", "_hint"}
+	secretValue = regexp.MustCompile(`AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36}|xox[baprs]-[A-Za-z0-9-]{10,}|-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+	secretLine  = regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?([A-Za-z_][A-Za-z0-9_.-]*)[ \t]*=[ \t]*(.*)$`)
+)
+
+func checkHardcodedSecret(c *Context) {
+	astutil.Inspect(c.File, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.Assignment:
+			if t.Identifier.Identifier == nil || t.Value == nil || t.Value.Word == nil || !isSecretName(t.Identifier.Identifier.Data) {
+				break
+			}
+
+			if value, ok := astutil.Literal(t.Value.Word); ok && isSecretValue(value) {
+				c.Report(t.Tokens, "'%s' is assigned a literal credential; read it from the environment or a protected file", t.Identifier.Identifier.Data)
+
+				return false
+			}
+		case *bash.Word:
+			for _, s := range astutil.Segments(t) {
+				if s.IsLiteral() && secretValue.MatchString(s.Literal) {
+					c.Report(t.Tokens, "word contains what appears to be a credential")
+
+					break
+				}
+			}
+		case *bash.HeredocPartOrWord:
+			if t.HeredocPart == nil {
+				break
+			}
+
+			if secretValue.MatchString(t.HeredocPart.Data) {
+				c.Report(t.Tokens, "heredoc contains what appears to be a credential")
+
+				break
+			}
+
+			for _, m := range secretLine.FindAllStringSubmatch(t.HeredocPart.Data, -1) {
+				if isSecretName(m[1]) && isSecretValue(strings.Trim(m[2], "\"'")) {
+					c.Report(t.Tokens, "heredoc sets '%s' to a literal credential; read it from the environment or a protected file", m[1])
+
+					break
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+// isSecretValue determines whether a literal value could be a credential,
+// rather than being empty or a message, such as a prompt, containing spaces.
+func isSecretValue(value string) bool {
+	return value != "" && !strings.ContainsAny(value, " \t")
+}
+
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, suffix := range notSecrets {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+
+	for _, secret := range secretNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+
+	return false
+}
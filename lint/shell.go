@@ -0,0 +1,333 @@
+package lint
+
+import (
+	"path"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+var shortOptions = map[byte]string{
+	'a': "allexport",
+	'b': "notify",
+	'e': "errexit",
+	'f': "noglob",
+	'h': "hashall",
+	'k': "keyword",
+	'm': "monitor",
+	'n': "noexec",
+	'p': "privileged",
+	't': "onecmd",
+	'u': "nounset",
+	'v': "verbose",
+	'x': "xtrace",
+	'B': "braceexpand",
+	'C': "noclobber",
+	'E': "errtrace",
+	'H': "histexpand",
+	'P': "physical",
+	'T': "functrace",
+}
+
+type optionChange struct {
+	pos     uint64
+	name    string
+	enabled bool
+}
+
+type options []optionChange
+
+// shellOptions collects every change to the shell options made by the shebang
+// line and by calls to the 'set' builtin, in source order.
+func shellOptions(f *bash.File) options {
+	var o options
+
+	if _, args := shebang(f); len(args) > 0 {
+		o.parseArgs(0, args)
+	}
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if c, ok := t.(*bash.Command); ok && astutil.CommandName(c) == "set" && len(c.Tokens) > 0 {
+			var args []string
+
+			for _, w := range astutil.Args(c) {
+				arg, _ := astutil.Literal(w)
+				args = append(args, arg)
+			}
+
+			o.parseArgs(c.Tokens[0].Pos, args)
+		}
+
+		return true
+	})
+
+	return o
+}
+
+func (o *options) parseArgs(pos uint64, args []string) {
+	for n := 0; n < len(args); n++ {
+		arg := args[n]
+
+		if arg == "-" || arg == "--" || len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			break
+		}
+
+		enabled := arg[0] == '-'
+
+		for _, c := range []byte(arg[1:]) {
+			if c == 'o' {
+				if n+1 < len(args) {
+					n++
+
+					*o = append(*o, optionChange{pos: pos, name: args[n], enabled: enabled})
+				}
+			} else if name, ok := shortOptions[c]; ok {
+				*o = append(*o, optionChange{pos: pos, name: name, enabled: enabled})
+			}
+		}
+	}
+}
+
+// enabled determines whether the named option is in effect at the given
+// position in the source.
+func (o options) enabled(name string, pos uint64) bool {
+	enabled := false
+
+	for _, c := range o {
+		if c.pos > pos {
+			break
+		}
+
+		if c.name == name {
+			enabled = c.enabled
+		}
+	}
+
+	return enabled
+}
+
+// set determines whether any of the named options are ever enabled.
+func (o options) set(names ...string) bool {
+	for _, c := range o {
+		if c.enabled {
+			for _, name := range names {
+				if c.name == name {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// shebang returns the base name of the interpreter named on the first line
+// of the file, along with any arguments to be passed to it.
+//
+// An interpreter of 'env' is skipped, with the following argument used in its
+// place.
+func shebang(f *bash.File) (string, []string) {
+	if len(f.Comments[0]) == 0 || f.Comments[0][0].Pos != 0 || !strings.HasPrefix(f.Comments[0][0].Data, "#!") {
+		return "", nil
+	}
+
+	fields := strings.Fields(f.Comments[0][0].Data[2:])
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	if path.Base(fields[0]) == "env" {
+		fields = fields[1:]
+
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+			fields = fields[1:]
+		}
+
+		if len(fields) == 0 {
+			return "", nil
+		}
+	}
+
+	return path.Base(fields[0]), fields[1:]
+}
+
+// targetShell returns the shell that the file is intended to be run by,
+// taken from a 'shell=' directive in the comments at the top of the file,
+// such as '# shellcheck shell=sh', or from the shebang.
+func targetShell(f *bash.File) string {
+	for _, c := range f.Comments[0] {
+		fields := strings.Fields(strings.TrimPrefix(c.Data, "#"))
+
+		if len(fields) == 0 || fields[0] != "shellcheck" && fields[0] != "bashlint" {
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			if shell, ok := strings.CutPrefix(field, "shell="); ok {
+				return shell
+			}
+		}
+	}
+
+	name, _ := shebang(f)
+
+	return name
+}
+
+// arrays returns the names of all variables that are used as arrays, either
+// by being assigned an array value, having an element assigned, being
+// declared with '-a' or '-A', or being filled by 'read -a' or 'mapfile'.
+func arrays(f *bash.File) map[string]bool {
+	arrs := make(map[string]bool)
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.Assignment:
+			if t.Identifier.Identifier != nil && (len(t.Identifier.Subscript) > 0 || t.Value != nil && t.Value.Array != nil) {
+				arrs[t.Identifier.Identifier.Data] = true
+			}
+		case *bash.Command:
+			for _, d := range astutil.Declarations(t) {
+				if strings.ContainsAny(d.Flags, "aA") {
+					arrs[d.Name] = true
+				}
+			}
+
+			if names, isArray := astutil.AssignedNames(t); isArray {
+				for _, name := range names {
+					arrs[name.Name] = true
+				}
+			}
+		}
+
+		return true
+	})
+
+	return arrs
+}
+
+// expressions returns the names of the variables that are assigned a literal
+// value that is an arithmetic expression, rather than a single number, along
+// with that value.
+func expressions(f *bash.File) map[string]string {
+	exprs := make(map[string]string)
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if a, ok := t.(*bash.Assignment); ok && a.Identifier.Identifier != nil && len(a.Identifier.Subscript) == 0 && a.Value != nil && a.Value.Word != nil {
+			if value, ok := astutil.Literal(a.Value.Word); ok && strings.ContainsAny(strings.TrimLeft(value, "+-"), "+-*/%<>&|^!~?:=()") {
+				exprs[a.Identifier.Identifier.Data] = value
+			}
+		}
+
+		return true
+	})
+
+	return exprs
+}
+
+// functions returns the names of all functions defined in the file.
+func functions(f *bash.File) map[string]bool {
+	fns := make(map[string]bool)
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if fc, ok := t.(*bash.FunctionCompound); ok && fc.Identifier != nil {
+			fns[fc.Identifier.Data] = true
+		}
+
+		return true
+	})
+
+	return fns
+}
+
+// statusChecked determines whether the exit status of the type whose
+// ancestors are given is tested, either by being the condition of an 'if',
+// 'while', or 'until', being negated, or by being the left operand of a '&&'
+// or '||' operator.
+func statusChecked(parents []bash.Type) bool {
+	n := len(parents) - 1
+
+	for ; n >= 0; n-- {
+		switch p := parents[n].(type) {
+		case *bash.CommandOrCompound:
+			continue
+		case *bash.Pipeline:
+			if p.Pipeline != nil && n+1 < len(parents) {
+				if _, ok := parents[n+1].(*bash.CommandOrCompound); ok {
+					return false
+				}
+			}
+
+			if p.Not {
+				return true
+			}
+
+			continue
+		}
+
+		break
+	}
+
+	if n < 0 {
+		return false
+	}
+
+	if s, ok := parents[n].(*bash.Statement); !ok {
+		return false
+	} else if s.LogicalOperator != bash.LogicalOperatorNone {
+		return true
+	}
+
+	for ; n > 0; n-- {
+		switch parents[n-1].(type) {
+		case *bash.Statement:
+			continue
+		case *bash.TestConsequence, *bash.LoopCompound:
+			return true
+		}
+
+		break
+	}
+
+	return false
+}
+
+// errexitIgnored returns true when the type, with the given ancestors, runs in
+// a context in which bash ignores 'set -e'; within the condition of an 'if',
+// 'while', or 'until', in any but the last pipeline of an '&&' or '||' list,
+// or in a pipeline negated with '!'.
+//
+// As the body of a function runs in the context it is called from, the search
+// stops at a function definition.
+func errexitIgnored(t bash.Type, parents []bash.Type) bool {
+	child := t
+
+	for n := len(parents) - 1; n >= 0; n-- {
+		switch p := parents[n].(type) {
+		case *bash.Statement:
+			if child == bash.Type(&p.Pipeline) && p.LogicalOperator != bash.LogicalOperatorNone {
+				return true
+			}
+		case *bash.Pipeline:
+			if p.Not {
+				return true
+			}
+		case *bash.TestConsequence:
+			if child == bash.Type(&p.Test) {
+				return true
+			}
+		case *bash.LoopCompound:
+			if child == bash.Type(&p.Statement) {
+				return true
+			}
+		case *bash.FunctionCompound:
+			return false
+		}
+
+		child = parents[n]
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package metrics_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/metrics"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "#!/bin/bash\n\nbackup() {\n\tfor f in \"$@\"; do\n\t\tif [ -f \"$f\" ] && [ ! -L \"$f\" ]; then\n\t\t\tcp \"$f\" \"$f.bak\"\n\t\tfi\n\tdone\n}\n\nbackup \"$(ls)\"\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	m := metrics.Measure(b)
+
+	fmt.Printf("file: complexity=%d depth=%d statements=%d commands=%v subshells=%d\n", m.Complexity, m.Depth, m.Statements, m.ExternalCommands, m.Subshells)
+
+	for _, fn := range m.Functions {
+		fmt.Printf("%s: lines=%d complexity=%d depth=%d statements=%d\n", fn.Name, fn.Lines, fn.Complexity, fn.Depth, fn.Statements)
+	}
+
+	// Output:
+	// file: complexity=4 depth=2 statements=6 commands=[cp ls] subshells=1
+	// backup: lines=7 complexity=4 depth=2 statements=3
+}
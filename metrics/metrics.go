@@ -0,0 +1,167 @@
+// Package metrics measures the complexity and size of parsed bash files and
+// the functions they define.
+package metrics
+
+import (
+	"slices"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/callgraph"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Metrics contains the measurements of either a whole file or a single
+// function.
+//
+// Complexity is the cyclomatic complexity; one plus the number of decision
+// points, which are each if and elif test, case arm, while, until, for, and
+// select loop, and '&&' or '||' operator.
+//
+// Depth is the maximum nesting depth of statements within compound commands
+// and command substitutions, with the statements directly in the body of a
+// function counted as depth zero.
+//
+// Statements counts the statements on each line, with a chain of commands
+// joined by '&&' or '||' counted as a single statement.
+//
+// ExternalCommands contains the sorted, unique names of the external commands
+// called, and ExternalCalls counts the number of places they are called.
+//
+// Subshells counts the parenthesised groupings, and command and process
+// substitutions.
+type Metrics struct {
+	Name             string   `json:"name,omitempty"`
+	Line             uint64   `json:"line"`
+	Lines            uint64   `json:"lines"`
+	Complexity       int      `json:"complexity"`
+	Depth            int      `json:"depth"`
+	Statements       int      `json:"statements"`
+	ExternalCalls    int      `json:"externalCalls"`
+	ExternalCommands []string `json:"externalCommands"`
+	Subshells        int      `json:"subshells"`
+}
+
+// File contains the Metrics of a whole file, including the code of its
+// functions, and of each function, in definition order.
+type File struct {
+	Metrics
+	Functions []Metrics `json:"functions"`
+}
+
+// Measure calculates the Metrics of a parsed file and its functions.
+func Measure(f *bash.File) *File {
+	file := &File{Metrics: measure(f, nil)}
+
+	if len(f.Tokens) > 0 {
+		file.Line = 1
+		file.Lines = f.Tokens[len(f.Tokens)-1].Line + 1
+	}
+
+	var defs []*bash.FunctionCompound
+
+	astutil.Inspect(f, func(t bash.Type, _ []bash.Type) bool {
+		if fc, ok := t.(*bash.FunctionCompound); ok && fc.Identifier != nil {
+			defs = append(defs, fc)
+			m := measure(fc, fc)
+			m.Name = fc.Identifier.Data
+
+			if len(fc.Tokens) > 0 {
+				m.Line = fc.Tokens[0].Line + 1
+				m.Lines = fc.Tokens[len(fc.Tokens)-1].Line - fc.Tokens[0].Line + 1
+			}
+
+			file.Functions = append(file.Functions, m)
+		}
+
+		return true
+	})
+
+	calls := callgraph.Build(f).External()
+
+	file.ExternalCalls, file.ExternalCommands = externals(calls, func(*callgraph.Call) bool { return true })
+
+	for n := range file.Functions {
+		file.Functions[n].ExternalCalls, file.Functions[n].ExternalCommands = externals(calls, func(c *callgraph.Call) bool {
+			return c.Caller != nil && c.Caller.Definition == defs[n]
+		})
+	}
+
+	return file
+}
+
+func externals(calls []*callgraph.Call, include func(*callgraph.Call) bool) (int, []string) {
+	count, cmds := 0, []string{}
+
+	for _, c := range calls {
+		if !include(c) {
+			continue
+		}
+
+		count++
+
+		if !slices.Contains(cmds, c.Name) {
+			cmds = append(cmds, c.Name)
+		}
+	}
+
+	slices.Sort(cmds)
+
+	return count, cmds
+}
+
+// measure calculates the Metrics of the code within t; when fn is set, nested
+// function definitions are excluded.
+func measure(t bash.Type, fn *bash.FunctionCompound) Metrics {
+	m := Metrics{Complexity: 1}
+
+	astutil.Inspect(t, func(t bash.Type, parents []bash.Type) bool {
+		switch t := t.(type) {
+		case *bash.FunctionCompound:
+			if fn != nil && t != fn {
+				return false
+			}
+		case *bash.Statement:
+			if _, ok := parents[len(parents)-1].(*bash.Line); ok {
+				m.Statements++
+				m.Depth = max(m.Depth, depth(parents))
+			}
+
+			if t.LogicalOperator != bash.LogicalOperatorNone {
+				m.Complexity++
+			}
+		case *bash.TestConsequence, *bash.PatternLines, *bash.LoopCompound, *bash.ForCompound, *bash.SelectCompound:
+			m.Complexity++
+		case *bash.GroupingCompound:
+			if t.SubShell {
+				m.Subshells++
+			}
+		case *bash.CommandSubstitution:
+			m.Subshells++
+		}
+
+		return true
+	})
+
+	return m
+}
+
+// depth counts the compound commands, other than the bodies of functions, that
+// contain a node.
+func depth(parents []bash.Type) int {
+	d := 0
+
+	for n, p := range parents {
+		switch p := p.(type) {
+		case *bash.IfCompound, *bash.CaseCompound, *bash.LoopCompound, *bash.ForCompound, *bash.SelectCompound, *bash.CommandSubstitution:
+			d++
+		case *bash.GroupingCompound:
+			if n < 2 {
+				d++
+			} else if _, isBody := parents[n-2].(*bash.FunctionCompound); !isBody || p.SubShell {
+				d++
+			}
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func TestMeasure(t *testing.T) {
+	for n, test := range [...]struct {
+		Input     string
+		File      Metrics
+		Functions []Metrics
+	}{
+		{ // 1
+			"echo a\nls -l",
+			Metrics{Line: 1, Lines: 2, Complexity: 1, Statements: 2, ExternalCalls: 1, ExternalCommands: []string{"ls"}},
+			nil,
+		},
+		{ // 2
+			"if a; then\n\tb\nelif c && d; then\n\te\nelse\n\tf\nfi",
+			Metrics{Line: 1, Lines: 7, Complexity: 4, Depth: 1, Statements: 4, ExternalCalls: 6, ExternalCommands: []string{"a", "b", "c", "d", "e", "f"}},
+			nil,
+		},
+		{ // 3
+			"case $1 in\na) x;;\nb) y;;\n*) z;;\nesac\nwhile true; do\n\tfor i in 1 2; do\n\t\tuntil false; do\n\t\t\tbreak\n\t\tdone\n\tdone\ndone",
+			Metrics{Line: 1, Lines: 12, Complexity: 7, Depth: 3, Statements: 8, ExternalCalls: 3, ExternalCommands: []string{"x", "y", "z"}},
+			nil,
+		},
+		{ // 4
+			"f() {\n\tlocal x=$(date)\n\t(cd /tmp && rm -f a)\n\tg() {\n\t\tif a; then\n\t\t\tb\n\t\tfi\n\t}\n}\nf",
+			Metrics{Line: 1, Lines: 10, Complexity: 3, Depth: 1, Statements: 9, ExternalCalls: 4, ExternalCommands: []string{"a", "b", "date", "rm"}, Subshells: 2},
+			[]Metrics{
+				{Name: "f", Line: 1, Lines: 9, Complexity: 2, Depth: 1, Statements: 5, ExternalCalls: 2, ExternalCommands: []string{"date", "rm"}, Subshells: 2},
+				{Name: "g", Line: 4, Lines: 5, Complexity: 2, Depth: 1, Statements: 2, ExternalCalls: 2, ExternalCommands: []string{"a", "b"}},
+			},
+		},
+	} {
+		m := Measure(testutil.Parse(t, test.Input))
+
+		if !reflect.DeepEqual(m.Metrics, test.File) {
+			t.Errorf("test %d: expecting file metrics %+v, got %+v", n+1, test.File, m.Metrics)
+		}
+
+		if !reflect.DeepEqual(m.Functions, test.Functions) {
+			t.Errorf("test %d: expecting function metrics %+v, got %+v", n+1, test.Functions, m.Functions)
+		}
+	}
+}
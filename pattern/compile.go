@@ -0,0 +1,241 @@
+package pattern
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type kind uint8
+
+const (
+	kindLiteral kind = iota
+	kindAny
+	kindStar
+	kindBracket
+	kindExtended
+)
+
+type node struct {
+	kind    kind
+	char    rune
+	bracket *bracket
+	op      byte
+	id      int
+	alts    [][]node
+}
+
+type charRange struct {
+	lo, hi rune
+}
+
+type bracket struct {
+	negate  bool
+	ranges  []charRange
+	classes []func(rune) bool
+}
+
+// match determines whether a character is matched by the bracket expression.
+func (b *bracket) match(c rune, fold bool) bool {
+	matched := false
+
+	for _, r := range b.ranges {
+		if r.lo <= c && c <= r.hi || fold && (r.lo <= unicode.ToLower(c) && unicode.ToLower(c) <= r.hi || r.lo <= unicode.ToUpper(c) && unicode.ToUpper(c) <= r.hi) {
+			matched = true
+
+			break
+		}
+	}
+
+	for _, fn := range b.classes {
+		if matched {
+			break
+		}
+
+		matched = fn(c)
+	}
+
+	return matched != b.negate
+}
+
+var classes = map[string]func(rune) bool{
+	"alnum":  func(c rune) bool { return unicode.IsLetter(c) || unicode.IsDigit(c) },
+	"alpha":  unicode.IsLetter,
+	"ascii":  func(c rune) bool { return c < 0x80 },
+	"blank":  func(c rune) bool { return c == ' ' || c == '\t' },
+	"cntrl":  unicode.IsControl,
+	"digit":  func(c rune) bool { return c >= '0' && c <= '9' },
+	"graph":  func(c rune) bool { return unicode.IsGraphic(c) && !unicode.IsSpace(c) },
+	"lower":  unicode.IsLower,
+	"print":  unicode.IsPrint,
+	"punct":  unicode.IsPunct,
+	"space":  unicode.IsSpace,
+	"upper":  unicode.IsUpper,
+	"word":   func(c rune) bool { return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) },
+	"xdigit": func(c rune) bool { return strings.ContainsRune("0123456789abcdefABCDEF", c) },
+}
+
+type compiler struct {
+	pattern string
+	pos     int
+	ext     bool
+	exts    int
+}
+
+// sequence compiles nodes until the end of the pattern or, when within an
+// extended pattern, until the unescaped '|' or ')' that ends the current
+// alternative.
+func (c *compiler) sequence(inExt bool) []node {
+	var nodes []node
+
+	for c.pos < len(c.pattern) {
+		ch := c.pattern[c.pos]
+
+		if inExt && (ch == '|' || ch == ')') {
+			break
+		}
+
+		if c.ext && strings.IndexByte("?*+@!", ch) >= 0 && c.pos+1 < len(c.pattern) && c.pattern[c.pos+1] == '(' {
+			if n, ok := c.extended(ch); ok {
+				nodes = append(nodes, n)
+
+				continue
+			}
+		}
+
+		switch ch {
+		case '*':
+			for c.pos < len(c.pattern) && c.pattern[c.pos] == '*' && !c.isExtStart(c.pos) {
+				c.pos++
+			}
+
+			if len(nodes) == 0 || nodes[len(nodes)-1].kind != kindStar {
+				nodes = append(nodes, node{kind: kindStar})
+			}
+
+			continue
+		case '?':
+			c.pos++
+
+			nodes = append(nodes, node{kind: kindAny})
+
+			continue
+		case '[':
+			if b, end, ok := compileBracket(c.pattern[c.pos+1:]); ok {
+				c.pos = len(c.pattern) - len(end)
+
+				nodes = append(nodes, node{kind: kindBracket, bracket: b})
+
+				continue
+			}
+		case '\\':
+			if c.pos+1 < len(c.pattern) {
+				c.pos++
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(c.pattern[c.pos:])
+		c.pos += size
+
+		nodes = append(nodes, node{kind: kindLiteral, char: r})
+	}
+
+	return nodes
+}
+
+func (c *compiler) isExtStart(pos int) bool {
+	return c.ext && pos+1 < len(c.pattern) && c.pattern[pos+1] == '('
+}
+
+// extended compiles an extended pattern, such as '@(a|b)', returning false if
+// it is not terminated, in which case the operator is treated normally.
+func (c *compiler) extended(op byte) (node, bool) {
+	start := c.pos
+	n := node{kind: kindExtended, op: op}
+	c.pos += 2
+
+	for {
+		n.alts = append(n.alts, c.sequence(true))
+
+		if c.pos >= len(c.pattern) {
+			c.pos = start
+
+			return node{}, false
+		}
+
+		c.pos++
+
+		if c.pattern[c.pos-1] == ')' {
+			break
+		}
+	}
+
+	n.id = c.exts
+	c.exts++
+
+	return n, true
+}
+
+// compileBracket compiles a bracket expression, the pattern starting after the
+// opening bracket, returning the remainder of the pattern. The final bool is
+// false when the expression is not terminated, in which case the bracket is
+// matched literally.
+func compileBracket(pattern string) (*bracket, string, bool) {
+	var b bracket
+
+	if pattern != "" && (pattern[0] == '!' || pattern[0] == '^') {
+		b.negate = true
+		pattern = pattern[1:]
+	}
+
+	for first := true; ; first = false {
+		if pattern == "" {
+			return nil, "", false
+		}
+
+		if pattern[0] == ']' && !first {
+			return &b, pattern[1:], true
+		}
+
+		if strings.HasPrefix(pattern, "[:") {
+			if end := strings.Index(pattern[2:], ":]"); end >= 0 {
+				if fn, ok := classes[pattern[2:2+end]]; ok {
+					b.classes = append(b.classes, fn)
+					pattern = pattern[4+end:]
+
+					continue
+				}
+			}
+		}
+
+		lo, rest := bracketChar(pattern)
+		if lo == utf8.RuneError {
+			return nil, "", false
+		}
+
+		hi := lo
+
+		if len(rest) > 1 && rest[0] == '-' && rest[1] != ']' {
+			if hi, rest = bracketChar(rest[1:]); hi == utf8.RuneError {
+				return nil, "", false
+			}
+		}
+
+		pattern = rest
+		b.ranges = append(b.ranges, charRange{lo, hi})
+	}
+}
+
+func bracketChar(pattern string) (rune, string) {
+	if pattern[0] == '\\' {
+		if len(pattern) == 1 {
+			return utf8.RuneError, ""
+		}
+
+		pattern = pattern[1:]
+	}
+
+	c, size := utf8.DecodeRuneInString(pattern)
+
+	return c, pattern[size:]
+}
@@ -0,0 +1,38 @@
+package pattern_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash/pattern"
+)
+
+func Example() {
+	p, err := pattern.Parse(`*.@(tar.gz|tgz)`, pattern.ExtGlob)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	for _, file := range []string{"backup.tar.gz", "backup.tgz", "backup.zip"} {
+		fmt.Println(file, p.Match(file))
+	}
+
+	q, _ := pattern.Parse(`"*"[[:digit:]]*`, 0)
+
+	fmt.Println(q.Match("*1st"), q.Match("first"))
+
+	path := "/usr/local/lib/libc.so.6"
+	suffix := pattern.Compile(".*", 0)
+
+	fmt.Println(path[:suffix.Suffix(path, false)])
+	fmt.Println(path[:suffix.Suffix(path, true)])
+
+	// Output:
+	// backup.tar.gz true
+	// backup.tgz true
+	// backup.zip false
+	// true false
+	// /usr/local/lib/libc.so
+	// /usr/local/lib/libc
+}
@@ -0,0 +1,222 @@
+package pattern
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Match determines whether the whole of s matches the pattern.
+func (p *Pattern) Match(s string) bool {
+	return p.matcher(s).from(0)[len(s)]
+}
+
+// Prefix returns the length of the shortest, or longest, prefix of s that
+// matches the pattern, or -1 if there is none.
+func (p *Pattern) Prefix(s string, longest bool) int {
+	ends := p.matcher(s).from(0)
+
+	if longest {
+		for n := len(s); n >= 0; n-- {
+			if ends[n] {
+				return n
+			}
+		}
+	} else {
+		for n, end := range ends {
+			if end {
+				return n
+			}
+		}
+	}
+
+	return -1
+}
+
+// Suffix returns the start of the shortest, or longest, suffix of s that
+// matches the pattern, or -1 if there is none.
+func (p *Pattern) Suffix(s string, longest bool) int {
+	m := p.matcher(s)
+	starts := boundaries(s)
+
+	if longest {
+		for _, start := range starts {
+			if m.from(start)[len(s)] {
+				return start
+			}
+		}
+	} else {
+		for n := len(starts) - 1; n >= 0; n-- {
+			if m.from(starts[n])[len(s)] {
+				return starts[n]
+			}
+		}
+	}
+
+	return -1
+}
+
+// boundaries returns the positions of the character boundaries of s, including
+// the start and end.
+func boundaries(s string) []int {
+	positions := make([]int, 0, len(s)+1)
+
+	for n := range s {
+		positions = append(positions, n)
+	}
+
+	return append(positions, len(s))
+}
+
+// set is a set of positions within the string being matched, indexed by byte
+// offset.
+type set []bool
+
+func (m *matcher) newSet() set {
+	return make(set, len(m.s)+1)
+}
+
+func (s set) union(t set) {
+	for n, ok := range t {
+		if ok {
+			s[n] = true
+		}
+	}
+}
+
+// matcher matches the nodes of a pattern against a single string, caching the
+// results of extended patterns at each position.
+type matcher struct {
+	*Pattern
+	s     string
+	cache []map[int]set
+}
+
+func (p *Pattern) matcher(s string) *matcher {
+	return &matcher{Pattern: p, s: s, cache: make([]map[int]set, p.exts)}
+}
+
+// from returns the set of positions at which a match of the pattern starting
+// at the given position can end.
+func (m *matcher) from(start int) set {
+	s := m.newSet()
+	s[start] = true
+
+	return m.sequence(m.nodes, s)
+}
+
+// sequence returns the set of positions reachable by matching the nodes, in
+// order, from any of the starting positions.
+func (m *matcher) sequence(nodes []node, starts set) set {
+	for _, n := range nodes {
+		next := m.newSet()
+
+		for pos, ok := range starts {
+			if !ok {
+				continue
+			}
+
+			switch n.kind {
+			case kindStar:
+				next[pos] = true
+
+				for p := range m.s[pos:] {
+					next[pos+p] = true
+				}
+
+				next[len(m.s)] = true
+			case kindExtended:
+				next.union(m.extended(&n, pos))
+			default:
+				if pos == len(m.s) {
+					continue
+				}
+
+				if c, size := utf8.DecodeRuneInString(m.s[pos:]); m.matchOne(&n, c) {
+					next[pos+size] = true
+				}
+			}
+
+			if n.kind == kindStar {
+				break
+			}
+		}
+
+		starts = next
+	}
+
+	return starts
+}
+
+func (m *matcher) matchOne(n *node, c rune) bool {
+	switch n.kind {
+	case kindAny:
+		return true
+	case kindBracket:
+		return n.bracket.match(c, m.fold)
+	}
+
+	return n.char == c || m.fold && unicode.ToLower(n.char) == unicode.ToLower(c)
+}
+
+// extended returns the set of positions at which an extended pattern starting
+// at the given position can end.
+func (m *matcher) extended(n *node, start int) set {
+	if cached, ok := m.cache[n.id][start]; ok {
+		return cached
+	}
+
+	var ends set
+
+	switch n.op {
+	case '@':
+		ends = m.alternatives(n, start)
+	case '?':
+		ends = m.alternatives(n, start)
+		ends[start] = true
+	case '+', '*':
+		ends = m.newSet()
+
+		if n.op == '*' {
+			ends[start] = true
+		}
+
+		for queue := []int{start}; len(queue) > 0; queue = queue[1:] {
+			for pos, ok := range m.alternatives(n, queue[0]) {
+				if ok && !ends[pos] {
+					ends[pos] = true
+					queue = append(queue, pos)
+				}
+			}
+		}
+	case '!':
+		matched := m.alternatives(n, start)
+		ends = m.newSet()
+
+		for _, pos := range boundaries(m.s[start:]) {
+			ends[start+pos] = !matched[start+pos]
+		}
+	}
+
+	if m.cache[n.id] == nil {
+		m.cache[n.id] = make(map[int]set)
+	}
+
+	m.cache[n.id][start] = ends
+
+	return ends
+}
+
+// alternatives returns the set of positions at which any of the alternatives
+// of an extended pattern starting at the given position can end.
+func (m *matcher) alternatives(n *node, start int) set {
+	ends := m.newSet()
+
+	for _, alt := range n.alts {
+		s := m.newSet()
+		s[start] = true
+
+		ends.union(m.sequence(alt, s))
+	}
+
+	return ends
+}
@@ -0,0 +1,238 @@
+// Package pattern implements the pattern matching of bash, as used by case
+// statements, the '[[' command, pathname expansion, and the pattern operations
+// of parameter expansion.
+package pattern
+
+import (
+	"errors"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Options modifies the matching of a Pattern, matching the shell options of
+// the same names.
+type Options uint8
+
+// Option flags.
+const (
+	NoCaseMatch Options = 1 << iota // shopt -s nocasematch
+	ExtGlob                         // shopt -s extglob
+)
+
+// Pattern is a compiled bash pattern.
+type Pattern struct {
+	source string
+	nodes  []node
+	fold   bool
+	exts   int
+}
+
+// Compile compiles a pattern in which a backslash causes the following
+// character to be matched literally, as produced by the Pattern method of an
+// expand.Expander.
+//
+// A bracket expression or extended pattern that is not terminated is matched
+// literally, as in bash, and so compilation cannot fail.
+func Compile(pattern string, opts Options) *Pattern {
+	c := compiler{pattern: pattern, ext: opts&ExtGlob != 0}
+	p := &Pattern{source: pattern, fold: opts&NoCaseMatch != 0}
+	p.nodes = c.sequence(false)
+	p.exts = c.exts
+
+	return p
+}
+
+// Parse compiles a pattern from shell source text, such as the Data of the
+// Pattern token of a bash.ParameterExpansion, in which quoted sections are
+// matched literally.
+//
+// The source must not contain any expansions; those patterns should instead
+// be expanded with an expand.Expander and then compiled with Compile.
+func Parse(source string, opts Options) (*Pattern, error) {
+	var sb strings.Builder
+
+	for len(source) > 0 {
+		var (
+			n   int
+			err error
+		)
+
+		switch c := source[0]; {
+		case c == '\\':
+			if n = 2; len(source) == 1 {
+				n = 1
+			}
+
+			if source[:n] != "\\\n" {
+				sb.WriteString(source[:n])
+			}
+		case c == '\'':
+			if n = strings.IndexByte(source[1:], '\'') + 2; n == 1 {
+				return nil, ErrUnterminated
+			}
+
+			sb.WriteString(Escape(source[1 : n-1]))
+		case strings.HasPrefix(source, "$'"):
+			if n = quoteEnd(source, 2, '\''); n < 0 {
+				return nil, ErrUnterminated
+			}
+
+			sb.WriteString(Escape(astutil.Unquote(source[:n], bash.TokenString)))
+		case c == '"' || strings.HasPrefix(source, "$\""):
+			if n, err = doubleQuoteEnd(source); err != nil {
+				return nil, err
+			}
+
+			sb.WriteString(Escape(astutil.Unquote(source[:n], bash.TokenString)))
+		case c == '`', c == '$' && len(source) > 1 && isExpansion(source[1]):
+			return nil, ErrNotLiteral
+		default:
+			n = 1
+
+			sb.WriteByte(c)
+		}
+
+		source = source[n:]
+	}
+
+	return Compile(sb.String(), opts), nil
+}
+
+// quoteEnd returns the position after the closing quote of a string, skipping
+// over backslash escapes, or -1 if the string is not terminated.
+func quoteEnd(source string, start int, quote byte) int {
+	for n := start; n < len(source); n++ {
+		switch source[n] {
+		case '\\':
+			n++
+		case quote:
+			return n + 1
+		}
+	}
+
+	return -1
+}
+
+func doubleQuoteEnd(source string) (int, error) {
+	start := strings.IndexByte(source, '"') + 1
+
+	for n := start; n < len(source); n++ {
+		switch source[n] {
+		case '\\':
+			n++
+		case '`':
+			return 0, ErrNotLiteral
+		case '$':
+			if n+1 < len(source) && isExpansion(source[n+1]) {
+				return 0, ErrNotLiteral
+			}
+		case '"':
+			return n + 1, nil
+		}
+	}
+
+	return 0, ErrUnterminated
+}
+
+func isExpansion(c byte) bool {
+	return c == '{' || c == '(' || c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("@*#?$!-", c) >= 0
+}
+
+// FromWord compiles a pattern from a Word, such as one of the patterns of a
+// case statement, which must not contain any expansions.
+func FromWord(w *bash.Word, opts Options) (*Pattern, error) {
+	return fromParts(w.Parts, opts)
+}
+
+// FromPattern compiles the Pattern of a TestCompound, which must not contain
+// any expansions.
+func FromPattern(p *bash.Pattern, opts Options) (*Pattern, error) {
+	return fromParts(p.Parts, opts)
+}
+
+func fromParts(parts []bash.WordPart, opts Options) (*Pattern, error) {
+	var sb strings.Builder
+
+	for _, p := range parts {
+		if p.Part == nil {
+			return nil, ErrNotLiteral
+		}
+
+		sb.WriteString(p.Part.Data)
+	}
+
+	return Parse(sb.String(), opts)
+}
+
+// String returns the source of the pattern, as given to Compile.
+func (p *Pattern) String() string {
+	return p.source
+}
+
+const specialChars = "\\*?[]+@!()|"
+
+// Escape escapes the special characters of s with backslashes, so that the
+// resulting pattern matches s literally.
+func Escape(s string) string {
+	if !strings.ContainsAny(s, specialChars) {
+		return s
+	}
+
+	var sb strings.Builder
+
+	for _, c := range s {
+		if strings.ContainsRune(specialChars, c) {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+
+// Unescape removes the backslash escapes from a pattern.
+func Unescape(pattern string) string {
+	if !strings.Contains(pattern, "\\") {
+		return pattern
+	}
+
+	var sb strings.Builder
+
+	for n := 0; n < len(pattern); n++ {
+		if pattern[n] == '\\' && n+1 < len(pattern) {
+			n++
+		}
+
+		sb.WriteByte(pattern[n])
+	}
+
+	return sb.String()
+}
+
+// HasMeta determines whether a pattern contains any unescaped special
+// characters, and so would not only match itself, once unescaped.
+func HasMeta(pattern string, opts Options) bool {
+	for n := 0; n < len(pattern); n++ {
+		switch pattern[n] {
+		case '\\':
+			n++
+		case '*', '?', '[':
+			return true
+		case '+', '@', '!':
+			if opts&ExtGlob != 0 && n+1 < len(pattern) && pattern[n+1] == '(' {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Errors.
+var (
+	ErrNotLiteral   = errors.New("pattern contains expansions")
+	ErrUnterminated = errors.New("unterminated quoted string")
+)
@@ -0,0 +1,266 @@
+package pattern
+
+import (
+	"errors"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/parser"
+)
+
+func TestMatch(t *testing.T) {
+	for n, test := range [...]struct {
+		Pattern, Input string
+		Options        Options
+		Match          bool
+	}{
+		{"*", "", 0, true},                             // 1
+		{"a*b*c", "aXbYbZc", 0, true},                  // 2
+		{"a*b*c", "aXbYbZ", 0, false},                  // 3
+		{"?", "é", 0, true},                            // 4
+		{`\*`, "*", 0, true},                           // 5
+		{`\*`, "a", 0, false},                          // 6
+		{"[a-c]x", "bx", 0, true},                      // 7
+		{"[!a-c]x", "bx", 0, false},                    // 8
+		{"[^a-c]x", "dx", 0, true},                     // 9
+		{"[]]", "]", 0, true},                          // 10
+		{"[a-]", "-", 0, true},                         // 11
+		{"[[:digit:]]*", "1a", 0, true},                // 12
+		{"[[:upper:]]", "a", 0, false},                 // 13
+		{"[", "[", 0, true},                            // 14
+		{"[ab", "[ab", 0, true},                        // 15
+		{`[\]]`, "]", 0, true},                         // 16
+		{"*.tar.gz", "a.tar.gz", 0, true},              // 17
+		{"[!]a]", "]", 0, false},                       // 18
+		{"[[:alpha:][:digit:]]", "5", 0, true},         // 19
+		{`a\`, `a\`, 0, true},                          // 20
+		{"ABC", "abc", 0, false},                       // 21
+		{"ABC", "abc", NoCaseMatch, true},              // 22
+		{"[a-c]*", "BCD", NoCaseMatch, true},           // 23
+		{"@(foo|bar)", "bar", 0, false},                // 24
+		{"@(foo|bar)", "@(foo|bar)", 0, true},          // 25
+		{"@(foo|bar)", "bar", ExtGlob, true},           // 26
+		{"@(foo|bar)", "foobar", ExtGlob, false},       // 27
+		{"?(a)b", "b", ExtGlob, true},                  // 28
+		{"?(a)b", "aab", ExtGlob, false},               // 29
+		{"*(a)b", "aaab", ExtGlob, true},               // 30
+		{"+(a)b", "b", ExtGlob, false},                 // 31
+		{"+(a|b)c", "ababc", ExtGlob, true},            // 32
+		{"!(foo)", "foo", ExtGlob, false},              // 33
+		{"!(foo)", "bar", ExtGlob, true},               // 34
+		{"!(foo)", "", ExtGlob, true},                  // 35
+		{"!(*.c)", "x.c", ExtGlob, false},              // 36
+		{"a!(b)c", "abc", ExtGlob, false},              // 37
+		{"a!(b)c", "axc", ExtGlob, true},               // 38
+		{"*(a|ab)c", "ababac", ExtGlob, true},          // 39
+		{"+(x", "+(x", ExtGlob, true},                  // 40
+		{"@(a|)", "", ExtGlob, true},                   // 41
+		{"*!(a)", "aaa", ExtGlob, true},                // 42
+		{"@(a)@(b)", "ab", ExtGlob, true},              // 43
+		{"**(a)", "xaa", ExtGlob, true},                // 44
+		{"@(FOO)", "foo", ExtGlob | NoCaseMatch, true}, // 45
+		{`\@(a)`, "@(a)", ExtGlob, true},               // 46
+	} {
+		if m := Compile(test.Pattern, test.Options).Match(test.Input); m != test.Match {
+			t.Errorf("test %d: expecting match of %q against %q to be %t, got %t", n+1, test.Pattern, test.Input, test.Match, m)
+		}
+	}
+}
+
+func TestPrefixSuffix(t *testing.T) {
+	for n, test := range [...]struct {
+		Pattern, Input                                   string
+		ShortPrefix, LongPrefix, ShortSuffix, LongSuffix string
+	}{
+		{ // 1
+			Pattern:     "a*",
+			Input:       "banana",
+			ShortPrefix: "banana",
+			LongPrefix:  "banana",
+			ShortSuffix: "banan",
+			LongSuffix:  "b",
+		},
+		{ // 2
+			Pattern:     "*a",
+			Input:       "banana",
+			ShortPrefix: "nana",
+			LongPrefix:  "",
+			ShortSuffix: "banan",
+			LongSuffix:  "",
+		},
+		{ // 3
+			Pattern:     "a*a",
+			Input:       "banana",
+			ShortPrefix: "banana",
+			LongPrefix:  "banana",
+			ShortSuffix: "ban",
+			LongSuffix:  "b",
+		},
+		{ // 4
+			Pattern:     "?(b)an",
+			Input:       "banana",
+			ShortPrefix: "ana",
+			LongPrefix:  "ana",
+			ShortSuffix: "banana",
+			LongSuffix:  "banana",
+		},
+		{ // 5
+			Pattern:     "*(a|n)",
+			Input:       "banana",
+			ShortPrefix: "banana",
+			LongPrefix:  "banana",
+			ShortSuffix: "banana",
+			LongSuffix:  "b",
+		},
+		{ // 6
+			Pattern:     "!(b*)",
+			Input:       "banana",
+			ShortPrefix: "banana",
+			LongPrefix:  "banana",
+			ShortSuffix: "banana",
+			LongSuffix:  "b",
+		},
+		{ // 7
+			Pattern:     `\**`,
+			Input:       "**a",
+			ShortPrefix: "*a",
+			LongPrefix:  "",
+			ShortSuffix: "*",
+			LongSuffix:  "",
+		},
+	} {
+		p := Compile(test.Pattern, ExtGlob)
+
+		for m, expected := range [...]string{test.ShortPrefix, test.LongPrefix, test.ShortSuffix, test.LongSuffix} {
+			output := test.Input
+
+			if m < 2 {
+				if end := p.Prefix(test.Input, m == 1); end >= 0 {
+					output = test.Input[end:]
+				}
+			} else if start := p.Suffix(test.Input, m == 3); start >= 0 {
+				output = test.Input[:start]
+			}
+
+			if output != expected {
+				t.Errorf("test %d.%d: expecting output %q, got %q", n+1, m+1, expected, output)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for n, test := range [...]struct {
+		Source, Pattern string
+		Err             error
+	}{
+		{ // 1
+			Source:  "*.go",
+			Pattern: "*.go",
+		},
+		{ // 2
+			Source:  `"*"*'?'\?`,
+			Pattern: `\**\?\?`,
+		},
+		{ // 3
+			Source:  `$'\t'[ab]"$"`,
+			Pattern: "\t[ab]$",
+		},
+		{ // 4
+			Source:  "a\\\nb",
+			Pattern: "ab",
+		},
+		{ // 5
+			Source:  `"@(a|b)"`,
+			Pattern: `\@\(a\|b\)`,
+		},
+		{ // 6
+			Source: "*$x",
+			Err:    ErrNotLiteral,
+		},
+		{ // 7
+			Source: `"${x}"`,
+			Err:    ErrNotLiteral,
+		},
+		{ // 8
+			Source: "'abc",
+			Err:    ErrUnterminated,
+		},
+	} {
+		if p, err := Parse(test.Source, 0); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if err == nil && p.String() != test.Pattern {
+			t.Errorf("test %d: expecting pattern %q, got %q", n+1, test.Pattern, p.String())
+		}
+	}
+}
+
+func TestFromWord(t *testing.T) {
+	tk := parser.NewStringTokeniser("case $x in \"a\"*|b[cd]) ;; $y) ;; esac")
+
+	f, err := bash.Parse(&tk)
+	if err != nil {
+		t.Fatalf("unexpected error parsing script: %s", err)
+	}
+
+	cc := f.Lines[0].Statements[0].Pipeline.CommandOrCompound.Compound.CaseCompound
+
+	for n, test := range [...]struct {
+		Word    *bash.Word
+		Pattern string
+		Err     error
+	}{
+		{ // 1
+			Word:    &cc.Matches[0].Patterns[0],
+			Pattern: `a*`,
+		},
+		{ // 2
+			Word:    &cc.Matches[0].Patterns[1],
+			Pattern: `b[cd]`,
+		},
+		{ // 3
+			Word: &cc.Matches[1].Patterns[0],
+			Err:  ErrNotLiteral,
+		},
+	} {
+		if p, err := FromWord(test.Word, 0); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if err == nil && p.String() != test.Pattern {
+			t.Errorf("test %d: expecting pattern %q, got %q", n+1, test.Pattern, p.String())
+		}
+	}
+}
+
+func TestHasMeta(t *testing.T) {
+	for n, test := range [...]struct {
+		Pattern string
+		Options Options
+		HasMeta bool
+	}{
+		{"abc", 0, false},         // 1
+		{"a*c", 0, true},          // 2
+		{`a\*c`, 0, false},        // 3
+		{"a[b]", 0, true},         // 4
+		{"+(a)", 0, false},        // 5
+		{"+(a)", ExtGlob, true},   // 6
+		{`\!(a)`, ExtGlob, false}, // 7
+	} {
+		if m := HasMeta(test.Pattern, test.Options); m != test.HasMeta {
+			t.Errorf("test %d: expecting %t, got %t", n+1, test.HasMeta, m)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for n, s := range [...]string{
+		"abc",
+		`a*b?c[d]e\f`,
+		"@(a|b)+(c)!(d)",
+	} {
+		if p := Compile(Escape(s), ExtGlob); !p.Match(s) {
+			t.Errorf("test %d: expecting escaped pattern %q to match %q", n+1, p, s)
+		} else if u := Unescape(Escape(s)); u != s {
+			t.Errorf("test %d: expecting unescaped pattern to be %q, got %q", n+1, s, u)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package report
+
+import "errors"
+
+// Errors.
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+)
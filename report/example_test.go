@@ -0,0 +1,28 @@
+package report_test
+
+import (
+	"os"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/lint"
+	"vimagination.zapto.org/bash/report"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	tk := parser.NewStringTokeniser("#!/bin/bash\nset -e\n\neval \"$1\"\n")
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		return
+	}
+
+	rules := lint.SecurityRules()
+	r := report.New("example", rules...)
+
+	r.Add("script.sh", lint.New(rules...).Lint(b)...)
+	r.Write(os.Stdout, report.FormatGitHub)
+
+	// Output:
+	// ::error file=script.sh,line=4,col=6,endLine=4,endColumn=10,title=eval-injection::eval of a non-literal value; any code it contains will be run
+}
@@ -0,0 +1,192 @@
+// Package report writes diagnostics, from linting or parsing bash, in
+// machine-readable formats.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"vimagination.zapto.org/bash/lint"
+)
+
+// Format represents an output format for a Report.
+type Format uint8
+
+// Formats.
+const (
+	FormatText Format = iota
+	FormatJSONLines
+	FormatGitHub
+	FormatSARIF
+)
+
+var formatNames = [...]string{
+	FormatText:      "text",
+	FormatJSONLines: "jsonl",
+	FormatGitHub:    "github",
+	FormatSARIF:     "sarif",
+}
+
+// String implements the fmt.Stringer interface.
+func (f Format) String() string {
+	if int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+
+	return "unknown"
+}
+
+// ParseFormat returns the Format with the given name.
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == name {
+			return Format(f), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+}
+
+// FormatNames returns the names of all Formats, for use in help text.
+func FormatNames() string {
+	return strings.Join(formatNames[:], ", ")
+}
+
+// Result is a Diagnostic found in a named file.
+type Result struct {
+	File string
+	lint.Diagnostic
+}
+
+// Report is a collection of Results, along with the metadata of the tool and
+// rules that produced them.
+type Report struct {
+	Tool    string
+	Rules   []*lint.Rule
+	Results []Result
+}
+
+// New creates a new Report for the named tool and the rules it runs.
+func New(tool string, rules ...*lint.Rule) *Report {
+	return &Report{Tool: tool, Rules: rules}
+}
+
+// Add adds Diagnostics found in the named file to the Report.
+func (r *Report) Add(file string, diagnostics ...lint.Diagnostic) {
+	for _, d := range diagnostics {
+		r.Results = append(r.Results, Result{File: file, Diagnostic: d})
+	}
+}
+
+// AddError adds an error, found when reading or parsing the named file, to the
+// Report.
+//
+// A parsing error is positioned at the token that caused it; any other error
+// is positioned at the start of the file.
+func (r *Report) AddError(file string, err error) {
+	d, ok := lint.ParseError(err)
+	if !ok {
+		d = lint.Diagnostic{Rule: lint.ParseErrorRule.ID, Severity: lint.SeverityError, Message: err.Error()}
+	}
+
+	r.Add(file, d)
+}
+
+// Write writes the Report in the given Format.
+func (r *Report) Write(w io.Writer, f Format) error {
+	switch f {
+	case FormatText:
+		return r.writeText(w)
+	case FormatJSONLines:
+		return r.writeJSONLines(w)
+	case FormatGitHub:
+		return r.writeGitHub(w)
+	case FormatSARIF:
+		return r.writeSARIF(w)
+	}
+
+	return ErrUnknownFormat
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	for _, res := range r.Results {
+		if _, err := fmt.Fprintf(w, "%s:%s\n", res.File, res.Diagnostic); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type jsonPosition struct {
+	Offset uint64 `json:"offset"`
+	Line   uint64 `json:"line"`
+	Column uint64 `json:"column"`
+}
+
+func newJSONPosition(p lint.Position) jsonPosition {
+	return jsonPosition{Offset: p.Pos, Line: p.Line + 1, Column: p.LinePos + 1}
+}
+
+type jsonResult struct {
+	File     string       `json:"file"`
+	Rule     string       `json:"rule"`
+	Severity string       `json:"severity"`
+	Message  string       `json:"message"`
+	Start    jsonPosition `json:"start"`
+	End      jsonPosition `json:"end"`
+}
+
+func (r *Report) writeJSONLines(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	for _, res := range r.Results {
+		if err := enc.Encode(jsonResult{
+			File:     res.File,
+			Rule:     res.Rule,
+			Severity: res.Severity.String(),
+			Message:  res.Message,
+			Start:    newJSONPosition(res.Start),
+			End:      newJSONPosition(res.End),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	githubData     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func githubLevel(s lint.Severity) string {
+	switch s {
+	case lint.SeverityError:
+		return "error"
+	case lint.SeverityWarning:
+		return "warning"
+	}
+
+	return "notice"
+}
+
+func (r *Report) writeGitHub(w io.Writer) error {
+	for _, res := range r.Results {
+		if _, err := fmt.Fprintf(w, "::%s file=%s,line=%d,col=%d,endLine=%d,endColumn=%d,title=%s::%s\n",
+			githubLevel(res.Severity),
+			githubProperty.Replace(res.File),
+			res.Start.Line+1, res.Start.LinePos+1,
+			res.End.Line+1, res.End.LinePos+1,
+			githubProperty.Replace(res.Rule),
+			githubData.Replace(res.Message),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
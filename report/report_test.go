@@ -0,0 +1,137 @@
+package report
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/lint"
+	"vimagination.zapto.org/parser"
+)
+
+func testReport() *Report {
+	r := New("bashlint", lint.UncheckedCd)
+
+	r.Add("dir/a.sh", lint.Diagnostic{
+		Rule:     "unchecked-cd",
+		Severity: lint.SeverityWarning,
+		Message:  "use 'cd ... || exit'",
+		Start:    lint.Position{Pos: 5, Line: 1, LinePos: 0},
+		End:      lint.Position{Pos: 11, Line: 1, LinePos: 6},
+	})
+	r.Add("/b,c.sh", lint.Diagnostic{
+		Rule:     "other",
+		Severity: lint.SeverityInfo,
+		Message:  "50%\nnew line",
+	})
+
+	return r
+}
+
+func TestText(t *testing.T) {
+	var sb strings.Builder
+
+	if err := testReport().Write(&sb, FormatText); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const expected = "dir/a.sh:2:1: warning: use 'cd ... || exit' [unchecked-cd]\n/b,c.sh:1:1: info: 50%\nnew line [other]\n"
+
+	if out := sb.String(); out != expected {
+		t.Errorf("expecting output %q, got %q", expected, out)
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var sb strings.Builder
+
+	if err := testReport().Write(&sb, FormatJSONLines); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const expected = `{"file":"dir/a.sh","rule":"unchecked-cd","severity":"warning","message":"use 'cd ... || exit'","start":{"offset":5,"line":2,"column":1},"end":{"offset":11,"line":2,"column":7}}
+{"file":"/b,c.sh","rule":"other","severity":"info","message":"50%\nnew line","start":{"offset":0,"line":1,"column":1},"end":{"offset":0,"line":1,"column":1}}
+`
+
+	if out := sb.String(); out != expected {
+		t.Errorf("expecting output %q, got %q", expected, out)
+	}
+}
+
+func TestGitHub(t *testing.T) {
+	var sb strings.Builder
+
+	if err := testReport().Write(&sb, FormatGitHub); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const expected = "::warning file=dir/a.sh,line=2,col=1,endLine=2,endColumn=7,title=unchecked-cd::use 'cd ... || exit'\n" +
+		"::notice file=/b%2Cc.sh,line=1,col=1,endLine=1,endColumn=1,title=other::50%25%0Anew line\n"
+
+	if out := sb.String(); out != expected {
+		t.Errorf("expecting output %q, got %q", expected, out)
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	var sb strings.Builder
+
+	if err := testReport().Write(&sb, FormatSARIF); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for n, expected := range [...]string{
+		`"version": "2.1.0"`,
+		`"name": "bashlint"`,
+		`"id": "unchecked-cd"`,
+		`"text": "cd without '|| exit' or '|| return' continues in the wrong directory when it fails"`,
+		`"id": "other"`,
+		`"ruleIndex": 1`,
+		`"level": "note"`,
+		`"uri": "dir/a.sh"`,
+		`"uri": "file:///b,c.sh"`,
+		`"charLength": 6`,
+		`"endColumn": 7`,
+	} {
+		if !strings.Contains(sb.String(), expected) {
+			t.Errorf("test %d: expecting output to contain %s", n+1, expected)
+		}
+	}
+}
+
+func TestAddError(t *testing.T) {
+	tk := parser.NewStringTokeniser("if a; then\n\tb\n")
+
+	_, err := bash.Parse(&tk)
+	if err == nil {
+		t.Fatal("expecting parse error")
+	}
+
+	r := New("bashfmt")
+
+	r.AddError("a.sh", err)
+	r.AddError("b.sh", errors.New("file not found"))
+
+	if len(r.Results) != 2 {
+		t.Fatalf("expecting 2 results, got %d", len(r.Results))
+	} else if res := r.Results[0]; res.Rule != "parse-error" || res.Start.Line != 2 {
+		t.Errorf("test 1: expecting parse-error on line 3, got %s on line %d", res.Rule, res.Start.Line+1)
+	} else if res := r.Results[1]; res.Message != "file not found" {
+		t.Errorf("test 2: expecting message %q, got %q", "file not found", res.Message)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for n, name := range [...]string{"text", "jsonl", "github", "sarif"} {
+		if f, err := ParseFormat(name); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if f.String() != name {
+			t.Errorf("test %d: expecting format %q, got %q", n+1, name, f)
+		}
+	}
+
+	if _, err := ParseFormat("xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expecting ErrUnknownFormat, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"vimagination.zapto.org/bash/lint"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     *sarifMessage      `json:"shortDescription,omitempty"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   uint64 `json:"startLine"`
+	StartColumn uint64 `json:"startColumn"`
+	EndLine     uint64 `json:"endLine"`
+	EndColumn   uint64 `json:"endColumn"`
+	CharOffset  uint64 `json:"charOffset"`
+	CharLength  uint64 `json:"charLength"`
+}
+
+func sarifLevel(s lint.Severity) string {
+	switch s {
+	case lint.SeverityError:
+		return "error"
+	case lint.SeverityWarning:
+		return "warning"
+	}
+
+	return "note"
+}
+
+// fileURI converts a file path to the URI used to identify it in a SARIF log;
+// relative paths remain relative to allow the consumer to resolve them against
+// the root of the repository.
+func fileURI(path string) string {
+	u := url.URL{Path: filepath.ToSlash(path)}
+
+	if filepath.IsAbs(path) {
+		u.Scheme = "file"
+	}
+
+	return u.String()
+}
+
+func (r *Report) writeSARIF(w io.Writer) error {
+	var (
+		rules   []sarifRule
+		results = make([]sarifResult, 0, len(r.Results))
+		indexes = make(map[string]int)
+	)
+
+	addRule := func(rule *lint.Rule) {
+		if _, ok := indexes[rule.ID]; ok {
+			return
+		}
+
+		sr := sarifRule{ID: rule.ID, DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.Severity)}}
+
+		if rule.Summary != "" {
+			sr.ShortDescription = &sarifMessage{Text: rule.Summary}
+		}
+
+		indexes[rule.ID] = len(rules)
+		rules = append(rules, sr)
+	}
+
+	for _, rule := range r.Rules {
+		addRule(rule)
+	}
+
+	for _, res := range r.Results {
+		if res.Rule == lint.ParseErrorRule.ID {
+			addRule(lint.ParseErrorRule)
+		} else {
+			addRule(&lint.Rule{ID: res.Rule, Severity: res.Severity})
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    res.Rule,
+			RuleIndex: indexes[res.Rule],
+			Level:     sarifLevel(res.Severity),
+			Message:   sarifMessage{Text: res.Message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: fileURI(res.File)},
+					Region: sarifRegion{
+						StartLine:   res.Start.Line + 1,
+						StartColumn: res.Start.LinePos + 1,
+						EndLine:     res.End.Line + 1,
+						EndColumn:   res.End.LinePos + 1,
+						CharOffset:  res.Start.Pos,
+						CharLength:  res.End.Pos - res.Start.Pos,
+					},
+				},
+			}},
+		})
+	}
+
+	if rules == nil {
+		rules = []sarifRule{}
+	}
+
+	enc := json.NewEncoder(w)
+
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: r.Tool, Rules: rules}},
+			Results: results,
+		}},
+	})
+}
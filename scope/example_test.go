@@ -0,0 +1,44 @@
+package scope_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/scope"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "greet() {\n\tlocal msg=\"Hello, $name\"\n\n\techo \"$msg\"\n}\n\nname=World\nunused=1\ngreet\necho \"$missing\"\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	table := scope.Resolve(b)
+
+	for _, ref := range table.References {
+		for _, def := range ref.Definitions {
+			fmt.Printf("%s %s on line %d is defined on line %d\n", ref.Kind, ref.Name, ref.Token.Line+1, def.Token.Line+1)
+		}
+	}
+
+	for _, sym := range table.Unused() {
+		fmt.Printf("unused: %s\n", sym.Name)
+	}
+
+	for _, ref := range table.Undefined() {
+		fmt.Printf("undefined: %s\n", ref.Name)
+	}
+
+	// Output:
+	// variable name on line 2 is defined on line 7
+	// variable msg on line 4 is defined on line 2
+	// function greet on line 9 is defined on line 1
+	// unused: unused
+	// undefined: missing
+}
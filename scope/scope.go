@@ -0,0 +1,579 @@
+// Package scope resolves the variables and functions of a parsed bash file
+// into symbol tables, linking each reference to its possible definitions.
+package scope
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+)
+
+// Kind determines whether a Symbol or Reference is for a variable or a
+// function.
+type Kind uint8
+
+// Kinds.
+const (
+	Variable Kind = iota
+	Function
+)
+
+// String implements the fmt.Stringer interface.
+func (k Kind) String() string {
+	switch k {
+	case Variable:
+		return "variable"
+	case Function:
+		return "function"
+	}
+
+	return "unknown"
+}
+
+// Binding represents the way in which a Symbol was defined.
+type Binding uint8
+
+// Bindings.
+const (
+	BindAssignment  Binding = iota // name=value
+	BindEnvironment                // name=value command
+	BindDeclaration                // declare, local, typeset, export, readonly
+	BindLoop                       // for and select
+	BindRead                       // read, mapfile, readarray, printf -v, getopts
+	BindArithmetic                 // (( name = value ))
+	BindFunction                   // name() { ... }
+)
+
+// String implements the fmt.Stringer interface.
+func (b Binding) String() string {
+	switch b {
+	case BindAssignment:
+		return "assignment"
+	case BindEnvironment:
+		return "environment"
+	case BindDeclaration:
+		return "declaration"
+	case BindLoop:
+		return "loop"
+	case BindRead:
+		return "read"
+	case BindArithmetic:
+		return "arithmetic"
+	case BindFunction:
+		return "function"
+	}
+
+	return "unknown"
+}
+
+// Symbol represents a single definition of a variable or function.
+//
+// Token is the token containing the name, and is the command name for
+// variables implicitly set by a command, such as REPLY for 'read'.
+//
+// Local is set for variables that are local to the function whose Scope they
+// are in; all other variables are visible to any code run after them, with
+// those set in a function visible to its callers.
+type Symbol struct {
+	Name       string
+	Kind       Kind
+	Binding    Binding
+	Local      bool
+	Exported   bool
+	Scope      *Scope
+	Token      *bash.Token
+	References []*Reference
+}
+
+// Reference represents a single use of a variable or call to a function.
+//
+// Definitions contains all of the Symbols that may provide the value of the
+// variable, or the function called, at the point of the Reference. Due to the
+// dynamic scoping of bash, this includes the local variables of functions that
+// call the function containing the Reference.
+type Reference struct {
+	Name        string
+	Kind        Kind
+	Scope       *Scope
+	Token       *bash.Token
+	Definitions []*Symbol
+	exports     bool
+}
+
+// Scope represents either the global scope of a file, or the scope of a
+// single function.
+type Scope struct {
+	Function *bash.FunctionCompound
+	Parent   *Scope
+	Children []*Scope
+	Symbols  []*Symbol
+	callers  []*Scope
+}
+
+// Name returns the name of the function of the Scope, or an empty string for
+// the global scope.
+func (s *Scope) Name() string {
+	if s.Function == nil || s.Function.Identifier == nil {
+		return ""
+	}
+
+	return s.Function.Identifier.Data
+}
+
+// Table contains all of the Symbols and References of a file, in source
+// order, along with the tree of Scopes.
+type Table struct {
+	Global     *Scope
+	Symbols    []*Symbol
+	References []*Reference
+}
+
+// Resolve builds the symbol Table for a parsed file.
+func Resolve(f *bash.File) *Table {
+	r := resolver{
+		Table:  Table{Global: new(Scope)},
+		scopes: make(map[*bash.FunctionCompound]*Scope),
+	}
+
+	astutil.Inspect(f, r.inspect)
+	r.resolve()
+
+	return &r.Table
+}
+
+type resolver struct {
+	Table
+	scopes map[*bash.FunctionCompound]*Scope
+}
+
+func (r *resolver) scopeOf(parents []bash.Type) *Scope {
+	for n := len(parents) - 1; n >= 0; n-- {
+		if fc, ok := parents[n].(*bash.FunctionCompound); ok {
+			return r.scopes[fc]
+		}
+	}
+
+	return r.Global
+}
+
+func (r *resolver) define(s *Scope, name string, kind Kind, binding Binding, tk *bash.Token) *Symbol {
+	sym := &Symbol{Name: name, Kind: kind, Binding: binding, Scope: s, Token: tk}
+
+	s.Symbols = append(s.Symbols, sym)
+	r.Symbols = append(r.Symbols, sym)
+
+	return sym
+}
+
+func (r *resolver) reference(s *Scope, name string, kind Kind, tk *bash.Token) *Reference {
+	ref := &Reference{Name: name, Kind: kind, Scope: s, Token: tk}
+
+	r.References = append(r.References, ref)
+
+	return ref
+}
+
+func (r *resolver) inspect(t bash.Type, parents []bash.Type) bool {
+	s := r.scopeOf(parents)
+
+	switch t := t.(type) {
+	case *bash.FunctionCompound:
+		if t.Identifier != nil {
+			r.define(s, t.Identifier.Data, Function, BindFunction, t.Identifier)
+		}
+
+		fs := &Scope{Function: t, Parent: s}
+		s.Children = append(s.Children, fs)
+		r.scopes[t] = fs
+	case *bash.Command:
+		r.command(s, t)
+	case *bash.Assignment:
+		if _, isArg := parents[len(parents)-1].(*bash.AssignmentOrWord); !isArg && t.Identifier.Identifier != nil {
+			binding := BindAssignment
+
+			if cmd, ok := parents[len(parents)-1].(*bash.Command); ok && len(cmd.AssignmentsOrWords) > 0 {
+				binding = BindEnvironment
+			}
+
+			sym := r.define(s, t.Identifier.Identifier.Data, Variable, binding, t.Identifier.Identifier)
+			sym.Exported = binding == BindEnvironment
+		}
+	case *bash.ForCompound:
+		if t.Identifier != nil {
+			r.define(s, t.Identifier.Data, Variable, BindLoop, t.Identifier)
+		}
+	case *bash.SelectCompound:
+		if t.Identifier != nil {
+			r.define(s, t.Identifier.Data, Variable, BindLoop, t.Identifier)
+		}
+	case *bash.ArithmeticExpansion:
+		r.arithmetic(s, t)
+	case *bash.ParameterExpansion:
+		if p := t.Parameter.Parameter; p != nil && astutil.IsName(p.Data) {
+			r.reference(s, p.Data, Variable, p)
+		}
+	case *bash.WordPart:
+		if t.Part != nil && t.Part.Type == bash.TokenIdentifier {
+			if name, _ := astutil.SplitParameter(t.Part.Data); astutil.IsName(name) {
+				r.reference(s, name, Variable, t.Part)
+			}
+		}
+	case *bash.Tests:
+		if t.Test == bash.TestOperatorVarNameIsSet && t.Word != nil {
+			if name, ok := astutil.Literal(t.Word); ok && astutil.IsName(name) {
+				r.reference(s, name, Variable, t.Word.Parts[0].Part)
+			}
+		}
+	}
+
+	return true
+}
+
+func (r *resolver) command(s *Scope, c *bash.Command) {
+	if len(c.AssignmentsOrWords) == 0 || c.AssignmentsOrWords[0].Word == nil {
+		return
+	}
+
+	name := astutil.CommandName(c)
+	nameToken := c.AssignmentsOrWords[0].Word.Parts[0].Part
+
+	if astutil.IsDeclaration(name) {
+		for _, d := range astutil.Declarations(c) {
+			global := s == r.Global || strings.Contains(d.Flags, "g") || name == "export" || name == "readonly"
+
+			if d.Assignment == nil && (name == "export" || name == "readonly") {
+				r.reference(s, d.Name, Variable, d.Token).exports = name == "export"
+
+				continue
+			}
+
+			sym := r.define(s, d.Name, Variable, BindDeclaration, d.Token)
+			sym.Local = !global
+			sym.Exported = strings.Contains(d.Flags, "x")
+
+			if strings.Contains(d.Flags, "n") {
+				r.nameref(s, d.Assignment)
+			}
+		}
+
+		return
+	}
+
+	if names, _ := astutil.AssignedNames(c); len(names) > 0 {
+		for _, n := range names {
+			tk := nameToken
+
+			if n.Word != nil {
+				tk = n.Word.Parts[0].Part
+			}
+
+			r.define(s, n.Name, Variable, BindRead, tk)
+		}
+	}
+
+	if name != "" && nameToken != nil {
+		r.reference(s, name, Function, nameToken)
+	}
+}
+
+// nameref adds a reference to the variable named by the value of a nameref
+// declaration, as the variable is read and set through the nameref.
+func (r *resolver) nameref(s *Scope, a *bash.Assignment) {
+	if a == nil || a.Value == nil || a.Value.Word == nil {
+		return
+	}
+
+	if value, ok := astutil.Literal(a.Value.Word); ok {
+		if name, _, _ := strings.Cut(value, "["); astutil.IsName(name) {
+			r.reference(s, name, Variable, a.Value.Word.Parts[0].Part)
+		}
+	}
+}
+
+var assignmentOperators = []string{"=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "^=", "|="}
+
+func (r *resolver) arithmetic(s *Scope, a *bash.ArithmeticExpansion) {
+	for n, wo := range a.WordsAndOperators {
+		if wo.Word == nil || len(wo.Word.Parts) != 1 || wo.Word.Parts[0].Part == nil || wo.Word.Parts[0].Part.Type != bash.TokenWord {
+			continue
+		}
+
+		tk := wo.Word.Parts[0].Part
+		name, _, _ := strings.Cut(tk.Data, "[")
+
+		if !astutil.IsName(name) {
+			continue
+		}
+
+		var before, after string
+
+		if n > 0 && a.WordsAndOperators[n-1].Operator != nil {
+			before = a.WordsAndOperators[n-1].Operator.Data
+		}
+
+		if n+1 < len(a.WordsAndOperators) && a.WordsAndOperators[n+1].Operator != nil {
+			after = a.WordsAndOperators[n+1].Operator.Data
+		}
+
+		assigned := slices.Contains(assignmentOperators, after) || after == "++" || after == "--" || before == "++" || before == "--"
+
+		if assigned {
+			r.define(s, name, Variable, BindArithmetic, tk)
+		}
+
+		if after != "=" {
+			r.reference(s, name, Variable, tk)
+		}
+	}
+}
+
+func (r *resolver) resolve() {
+	functions := make(map[string][]*Symbol)
+
+	for _, sym := range r.Symbols {
+		if sym.Kind == Function {
+			functions[sym.Name] = append(functions[sym.Name], sym)
+		}
+	}
+
+	var refs []*Reference
+
+	for _, ref := range r.References {
+		if ref.Kind == Function {
+			if fns, ok := functions[ref.Name]; ok {
+				ref.Definitions = fns
+
+				for _, fn := range fns {
+					fn.References = append(fn.References, ref)
+
+					if fs := r.functionScope(fn); fs != nil && !slices.Contains(fs.callers, ref.Scope) {
+						fs.callers = append(fs.callers, ref.Scope)
+					}
+				}
+			} else {
+				continue
+			}
+		}
+
+		refs = append(refs, ref)
+	}
+
+	r.References = refs
+
+	for _, sym := range r.Symbols {
+		if sym.Kind == Variable && !sym.Local && sym.Scope != r.Global {
+			sym.Local = localBefore(sym.Scope, sym.Name, sym.Token.Pos)
+		}
+	}
+
+	for _, ref := range r.References {
+		if ref.Kind != Variable {
+			continue
+		}
+
+		ref.Definitions = r.variableDefinitions(ref)
+
+		for _, def := range ref.Definitions {
+			def.References = append(def.References, ref)
+
+			if ref.exports {
+				def.Exported = true
+			}
+		}
+	}
+}
+
+func (r *resolver) functionScope(fn *Symbol) *Scope {
+	for _, child := range fn.Scope.Children {
+		if child.Function.Identifier == fn.Token {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// localBefore determines whether the named variable is declared local in the
+// given function Scope before the given position.
+func localBefore(s *Scope, name string, pos uint64) bool {
+	for _, sym := range s.Symbols {
+		if sym.Name == name && sym.Binding == BindDeclaration && sym.Local && sym.Token.Pos < pos {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *resolver) variableDefinitions(ref *Reference) []*Symbol {
+	return r.definitions(ref.Scope, ref.Name, ref.Token.Pos)
+}
+
+// definitions returns the Symbols that may provide the value of the named
+// variable at the given position within a Scope.
+func (t *Table) definitions(s *Scope, name string, pos uint64) []*Symbol {
+	var defs []*Symbol
+
+	if s != t.Global && localBefore(s, name, pos+1) {
+		for _, sym := range s.Symbols {
+			if sym.Name == name && sym.Local {
+				defs = append(defs, sym)
+			}
+		}
+
+		return defs
+	}
+
+	callers := callersOf(s)
+
+	for _, sym := range t.Symbols {
+		if sym.Kind == Variable && sym.Name == name && (!sym.Local || slices.Contains(callers, sym.Scope)) {
+			defs = append(defs, sym)
+		}
+	}
+
+	return defs
+}
+
+// callersOf returns all of the function scopes that may, directly or
+// indirectly, call the function of the given Scope.
+func callersOf(s *Scope) []*Scope {
+	var callers []*Scope
+
+	queue := slices.Clone(s.callers)
+
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		if c == s || slices.Contains(callers, c) {
+			continue
+		}
+
+		callers = append(callers, c)
+		queue = append(queue, c.callers...)
+	}
+
+	return callers
+}
+
+func contains(tk *bash.Token, pos uint64) bool {
+	return tk != nil && pos >= tk.Pos && pos < tk.Pos+uint64(max(len(tk.Data), 1))
+}
+
+// Lookup returns the Symbol or Reference whose name token contains the given
+// position.
+func (t *Table) Lookup(pos uint64) (*Symbol, *Reference) {
+	for _, sym := range t.Symbols {
+		if contains(sym.Token, pos) {
+			return sym, nil
+		}
+	}
+
+	for _, ref := range t.References {
+		if contains(ref.Token, pos) {
+			return nil, ref
+		}
+	}
+
+	return nil, nil
+}
+
+// Definitions returns the possible definitions of the Symbol or Reference at
+// the given position.
+func (t *Table) Definitions(pos uint64) []*Symbol {
+	sym, ref := t.Lookup(pos)
+
+	if sym != nil {
+		return []*Symbol{sym}
+	} else if ref != nil {
+		return ref.Definitions
+	}
+
+	return nil
+}
+
+// Variable returns all of the Symbols that may define the same variable as the
+// given variable Symbol, including the Symbol itself, in source order.
+//
+// As with References, this includes the local variables of functions that may
+// call the function containing the Symbol.
+func (t *Table) Variable(sym *Symbol) []*Symbol {
+	if sym.Kind != Variable {
+		return nil
+	}
+
+	return t.definitions(sym.Scope, sym.Name, sym.Token.Pos)
+}
+
+// ReferencesAt returns all References that may use the definitions of the
+// Symbol or Reference at the given position.
+func (t *Table) ReferencesAt(pos uint64) []*Reference {
+	var refs []*Reference
+
+	for _, def := range t.Definitions(pos) {
+		for _, ref := range def.References {
+			if !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	slices.SortFunc(refs, func(a, b *Reference) int {
+		return cmp.Compare(a.Token.Pos, b.Token.Pos)
+	})
+
+	return refs
+}
+
+// Unused returns all variable Symbols that are never referenced.
+//
+// Exported variables, which may be used by other programs, are not included.
+func (t *Table) Unused() []*Symbol {
+	var unused []*Symbol
+
+	for _, sym := range t.Symbols {
+		if sym.Kind == Variable && len(sym.References) == 0 && !sym.Exported && sym.Name != "_" {
+			unused = append(unused, sym)
+		}
+	}
+
+	return unused
+}
+
+// Undefined returns all variable References that have no definition.
+//
+// References to variables set by the shell, such as HOME and PATH, are not
+// included.
+func (t *Table) Undefined() []*Reference {
+	var undefined []*Reference
+
+	for _, ref := range t.References {
+		if ref.Kind == Variable && len(ref.Definitions) == 0 && !ShellVariables[ref.Name] {
+			undefined = append(undefined, ref)
+		}
+	}
+
+	return undefined
+}
+
+// ShellVariables contains the names of variables set by bash, or commonly
+// inherited from the environment.
+var ShellVariables = map[string]bool{
+	"BASH": true, "BASHOPTS": true, "BASHPID": true, "BASH_ALIASES": true, "BASH_ARGC": true,
+	"BASH_ARGV": true, "BASH_ARGV0": true, "BASH_CMDS": true, "BASH_COMMAND": true, "BASH_LINENO": true,
+	"BASH_REMATCH": true, "BASH_SOURCE": true, "BASH_SUBSHELL": true, "BASH_VERSINFO": true, "BASH_VERSION": true,
+	"COLUMNS": true, "COMP_CWORD": true, "COMP_LINE": true, "COMP_POINT": true, "COMP_WORDS": true,
+	"COMPREPLY": true, "DIRSTACK": true, "EPOCHREALTIME": true, "EPOCHSECONDS": true, "EUID": true,
+	"FUNCNAME": true, "GROUPS": true, "HISTFILE": true, "HOME": true, "HOSTNAME": true,
+	"HOSTTYPE": true, "IFS": true, "LANG": true, "LC_ALL": true, "LINENO": true,
+	"LINES": true, "MACHTYPE": true, "MAPFILE": true, "OLDPWD": true, "OPTARG": true,
+	"OPTERR": true, "OPTIND": true, "OSTYPE": true, "PATH": true, "PIPESTATUS": true,
+	"PPID": true, "PS1": true, "PS2": true, "PS3": true, "PS4": true,
+	"PWD": true, "RANDOM": true, "REPLY": true, "SECONDS": true, "SHELL": true,
+	"SHELLOPTS": true, "SHLVL": true, "SRANDOM": true, "TERM": true, "TMPDIR": true,
+	"UID": true, "USER": true,
+}
@@ -0,0 +1,202 @@
+package scope
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func pos(tk *bash.Token) string {
+	return fmt.Sprintf("%d:%d", tk.Line+1, tk.LinePos+1)
+}
+
+func TestResolve(t *testing.T) {
+	for n, test := range [...]struct {
+		Input      string
+		References []string
+	}{
+		{ // 1
+			"a=1\necho $a",
+			[]string{"a@2:6 -> 1:1"},
+		},
+		{ // 2
+			"a=1\na=2\necho \"${a}\"",
+			[]string{"a@3:9 -> 1:1 2:1"},
+		},
+		{ // 3
+			"f() {\n\tlocal a=1\n\techo $a\n}\na=2\necho $a\nf",
+			[]string{"a@3:7 -> 2:8", "a@6:6 -> 5:1", "f@7:1 -> 1:1"},
+		},
+		{ // 4
+			"f() {\n\techo $a\n}\ng() {\n\tlocal a=1\n\tf\n}\nh() {\n\tlocal a=2\n}\na=3",
+			[]string{"a@2:7 -> 5:8 11:1", "f@6:2 -> 1:1"},
+		},
+		{ // 5
+			"f() {\n\tlocal a\n\ta=1\n\techo $a\n}\necho $a",
+			[]string{"a@4:7 -> 2:8 3:2", "a@6:6 -> "},
+		},
+		{ // 6
+			"for i in 1 2; do\n\techo $i\ndone\nselect s in a b; do echo \"$s\"; done",
+			[]string{"i@2:7 -> 1:5", "s@4:27 -> 4:8"},
+		},
+		{ // 7
+			"read -r a b\nread\nmapfile -t arr\necho \"$a$b$REPLY${arr[@]}\"",
+			[]string{"a@4:7 -> 1:9", "b@4:9 -> 1:11", "REPLY@4:11 -> 2:1", "arr@4:19 -> 3:12"},
+		},
+		{ // 8
+			"(( i = 0, i++ ))\necho $(( i + j ))",
+			[]string{"i@1:11 -> 1:4 1:11", "i@2:10 -> 1:4 1:11", "j@2:14 -> "},
+		},
+		{ // 9
+			"f() {\n\tg=1\n}\nf\necho $g",
+			[]string{"f@4:1 -> 1:1", "g@5:6 -> 2:2"},
+		},
+		{ // 10
+			"[[ -v x ]]\nprintf -v x %s y\ngetopts ab opt\necho $x $opt",
+			[]string{"x@1:7 -> 2:11", "x@4:6 -> 2:11", "opt@4:9 -> 3:12"},
+		},
+		{ // 11
+			"ls\necho \"${!name}\"",
+			[]string{"name@2:10 -> "},
+		},
+		{ // 12
+			"d=1\ndeclare -n r=d\necho \"$r\"",
+			[]string{"d@2:14 -> 1:1", "r@3:7 -> 2:12"},
+		},
+	} {
+		table := Resolve(testutil.Parse(t, test.Input))
+
+		var refs []string
+
+		for _, ref := range table.References {
+			out := fmt.Sprintf("%s@%s ->", ref.Name, pos(ref.Token))
+
+			if len(ref.Definitions) == 0 {
+				out += " "
+			}
+
+			for _, def := range ref.Definitions {
+				out += " " + pos(def.Token)
+			}
+
+			refs = append(refs, out)
+		}
+
+		if !reflect.DeepEqual(refs, test.References) {
+			t.Errorf("test %d: expecting references %q, got %q", n+1, test.References, refs)
+		}
+	}
+}
+
+func TestUnusedUndefined(t *testing.T) {
+	for n, test := range [...]struct {
+		Input     string
+		Unused    []string
+		Undefined []string
+	}{
+		{ // 1
+			"a=1\nb=2\necho $b $c $HOME",
+			[]string{"a@1:1"},
+			[]string{"c@3:9"},
+		},
+		{ // 2
+			"export a=1\nb=2\nexport b\nC=1 cmd",
+			nil,
+			nil,
+		},
+		{ // 3
+			"f() {\n\tlocal x=1\n}\nf",
+			[]string{"x@2:8"},
+			nil,
+		},
+		{ // 4
+			"d=1\nf() {\n\tlocal -n r=d\n\techo \"$r\"\n}\nf",
+			nil,
+			nil,
+		},
+	} {
+		table := Resolve(testutil.Parse(t, test.Input))
+
+		var unused, undefined []string
+
+		for _, sym := range table.Unused() {
+			unused = append(unused, sym.Name+"@"+pos(sym.Token))
+		}
+
+		for _, ref := range table.Undefined() {
+			undefined = append(undefined, ref.Name+"@"+pos(ref.Token))
+		}
+
+		if !reflect.DeepEqual(unused, test.Unused) {
+			t.Errorf("test %d: expecting unused %q, got %q", n+1, test.Unused, unused)
+		} else if !reflect.DeepEqual(undefined, test.Undefined) {
+			t.Errorf("test %d: expecting undefined %q, got %q", n+1, test.Undefined, undefined)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	table := Resolve(testutil.Parse(t, "a=1\nf() {\n\techo $a\n}\nf\necho $a"))
+
+	if defs := table.Definitions(16); len(defs) != 1 || defs[0].Name != "a" || defs[0].Token.Pos != 0 {
+		t.Errorf("test 1: expecting definition of a at 0, got %v", defs)
+	}
+
+	if refs := table.ReferencesAt(0); len(refs) != 2 || refs[0].Token.Pos != 16 || refs[1].Token.Pos != 28 {
+		t.Errorf("test 2: expecting 2 references to a, got %d", len(refs))
+	}
+
+	if defs := table.Definitions(21); len(defs) != 1 || defs[0].Kind != Function {
+		t.Errorf("test 3: expecting function definition, got %v", defs)
+	}
+
+	if sym, ref := table.Lookup(8); sym != nil || ref != nil {
+		t.Errorf("test 4: expecting no symbol, got %v, %v", sym, ref)
+	}
+}
+
+func TestVariable(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    string
+		Pos      uint64
+		Variable []string
+	}{
+		{ // 1
+			"a=1\na=2\nb=3",
+			4,
+			[]string{"a@1:1", "a@2:1"},
+		},
+		{ // 2
+			"a=1\nf() {\n\tlocal a\n\ta=2\n}\nf",
+			20,
+			[]string{"a@3:8", "a@4:2"},
+		},
+		{ // 3
+			"a=1\nf() {\n\ta=2\n}\ng() {\n\tlocal a\n\tf\n}\ng",
+			11,
+			[]string{"a@1:1", "a@3:2", "a@6:8"},
+		},
+	} {
+		table := Resolve(testutil.Parse(t, test.Input))
+		sym, _ := table.Lookup(test.Pos)
+
+		if sym == nil {
+			t.Errorf("test %d: expecting symbol at %d", n+1, test.Pos)
+
+			continue
+		}
+
+		var variable []string
+
+		for _, s := range table.Variable(sym) {
+			variable = append(variable, s.Name+"@"+pos(s.Token))
+		}
+
+		if !reflect.DeepEqual(variable, test.Variable) {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Variable, variable)
+		}
+	}
+}
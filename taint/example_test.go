@@ -0,0 +1,44 @@
+package taint_test
+
+import (
+	"fmt"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/taint"
+	"vimagination.zapto.org/parser"
+)
+
+func Example() {
+	src := "#!/bin/bash\n\nbranch=\"$1\"\ndir=\"/srv/$(basename \"$branch\")\"\n\nrm -rf $dir\neval \"git checkout $branch\"\n"
+	tk := parser.NewStringTokeniser(src)
+
+	b, err := bash.Parse(&tk)
+	if err != nil {
+		fmt.Println(err)
+
+		return
+	}
+
+	for _, flow := range taint.Analyse(b) {
+		fmt.Printf("%s:\n", flow.Sink)
+
+		for _, step := range flow.Path {
+			fmt.Printf("\t%s\n", step)
+		}
+	}
+
+	// Output:
+	// rm:
+	// 	3:9 positional 1
+	// 	3:1 assignment branch
+	// 	4:23 expansion branch
+	// 	4:11 substitution
+	// 	4:1 assignment dir
+	// 	6:8 expansion dir
+	// 	6:1 sink rm
+	// eval:
+	// 	3:9 positional 1
+	// 	3:1 assignment branch
+	// 	7:20 expansion branch
+	// 	7:1 sink eval
+}
@@ -0,0 +1,438 @@
+// Package taint tracks untrusted input through a parsed bash file, finding
+// where it reaches commands that could be exploited with it.
+package taint
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/bash"
+	"vimagination.zapto.org/bash/internal/astutil"
+	"vimagination.zapto.org/bash/scope"
+)
+
+// StepKind represents the role of a Step in a Flow.
+type StepKind uint8
+
+// Step Kinds.
+const (
+	StepPositional StepKind = iota
+	StepEnvironment
+	StepRead
+	StepAssignment
+	StepExpansion
+	StepSubstitution
+	StepSink
+)
+
+var stepNames = [...]string{
+	StepPositional:   "positional",
+	StepEnvironment:  "environment",
+	StepRead:         "read",
+	StepAssignment:   "assignment",
+	StepExpansion:    "expansion",
+	StepSubstitution: "substitution",
+	StepSink:         "sink",
+}
+
+// String implements the fmt.Stringer interface.
+func (s StepKind) String() string {
+	if int(s) < len(stepNames) {
+		return stepNames[s]
+	}
+
+	return "unknown"
+}
+
+// IsSource returns true for the Step Kinds that introduce untrusted input.
+func (s StepKind) IsSource() bool {
+	return s <= StepRead
+}
+
+// Step is a single point on the path of untrusted input.
+//
+// Token is the token identifying the Step, such as the name of the variable
+// being assigned or expanded, and Tokens contains all of the tokens of the
+// node being described, giving its full span.
+type Step struct {
+	Kind   StepKind
+	Name   string
+	Token  *bash.Token
+	Tokens bash.Tokens
+}
+
+// String implements the fmt.Stringer interface.
+func (s Step) String() string {
+	if s.Name == "" {
+		return fmt.Sprintf("%d:%d %s", s.Token.Line+1, s.Token.LinePos+1, s.Kind)
+	}
+
+	return fmt.Sprintf("%d:%d %s %s", s.Token.Line+1, s.Token.LinePos+1, s.Kind, s.Name)
+}
+
+// Sink names.
+const (
+	SinkEval        = "eval"
+	SinkShell       = "shell -c"
+	SinkSource      = "source"
+	SinkRm          = "rm"
+	SinkSudo        = "sudo"
+	SinkRedirection = "redirection"
+)
+
+// Flow is the path of untrusted input from a source to a sink.
+//
+// The first Step of the Path is the source of the input, and the last is the
+// sink, with the Steps between describing how the input was propagated.
+type Flow struct {
+	Sink string
+	Path []Step
+}
+
+// Source returns the first Step of the Flow.
+func (f Flow) Source() Step {
+	return f.Path[0]
+}
+
+// String implements the fmt.Stringer interface.
+func (f Flow) String() string {
+	var sb strings.Builder
+
+	for n, s := range f.Path {
+		if n > 0 {
+			sb.WriteString(" -> ")
+		}
+
+		sb.WriteString(s.String())
+	}
+
+	return sb.String()
+}
+
+var shells = map[string]bool{"sh": true, "bash": true, "dash": true, "ash": true, "ksh": true, "zsh": true, "mksh": true, "posh": true}
+
+// Analyse finds all Flows of untrusted input, from positional parameters,
+// environment variables, and the 'read' builtin, to the following sinks:
+//
+//	eval      Any argument.
+//	shell -c  The command string passed to a shell, such as 'bash -c'.
+//	source    The path of the file to source, for both 'source' and '.'.
+//	rm        Any unquoted expansion in an argument.
+//	sudo      Any argument of a command run through 'sudo' or 'doas'.
+//	redirection The target of a redirection.
+//
+// Values are tracked through assignments, declarations, loop variables,
+// parameter expansions, and command substitutions. The analysis is flow
+// insensitive; a variable is considered tainted if any of its possible
+// definitions is tainted.
+//
+// The Flows are returned in the order of their sinks.
+func Analyse(f *bash.File) []Flow {
+	a := &analysis{
+		table:   scope.Resolve(f),
+		symbols: make(map[definition]*scope.Symbol),
+		refs:    make(map[*bash.Token]*scope.Reference),
+		tainted: make(map[*scope.Symbol][]Step),
+	}
+
+	for _, sym := range a.table.Symbols {
+		if sym.Kind == scope.Variable {
+			a.symbols[definition{sym.Token, sym.Name}] = sym
+		}
+	}
+
+	for _, ref := range a.table.References {
+		if ref.Kind == scope.Variable {
+			a.refs[ref.Token] = ref
+		}
+	}
+
+	for a.changed = true; a.changed; {
+		a.changed = false
+
+		astutil.Inspect(f, a.propagate)
+	}
+
+	astutil.Inspect(f, a.sinks)
+
+	slices.SortStableFunc(a.flows, func(x, y Flow) int {
+		return cmp.Compare(x.Path[len(x.Path)-1].Token.Pos, y.Path[len(y.Path)-1].Token.Pos)
+	})
+
+	return a.flows
+}
+
+// definition identifies a Symbol; as the variables implicitly set by a command
+// share its name token, the name is also required.
+type definition struct {
+	token *bash.Token
+	name  string
+}
+
+type analysis struct {
+	table   *scope.Table
+	symbols map[definition]*scope.Symbol
+	refs    map[*bash.Token]*scope.Reference
+	tainted map[*scope.Symbol][]Step
+	changed bool
+	flows   []Flow
+}
+
+func (a *analysis) taint(tk *bash.Token, path []Step, step Step) {
+	sym := a.symbols[definition{tk, step.Name}]
+	if sym == nil || a.tainted[sym] != nil {
+		return
+	}
+
+	a.tainted[sym] = append(slices.Clip(path), step)
+	a.changed = true
+}
+
+func (a *analysis) propagate(t bash.Type, _ []bash.Type) bool {
+	switch t := t.(type) {
+	case *bash.Assignment:
+		if t.Identifier.Identifier == nil || t.Value == nil {
+			break
+		}
+
+		if path := a.path(t.Value); path != nil {
+			a.taint(t.Identifier.Identifier, path, Step{Kind: StepAssignment, Name: t.Identifier.Identifier.Data, Token: t.Identifier.Identifier, Tokens: t.Tokens})
+		}
+	case *bash.ForCompound:
+		if t.Identifier == nil {
+			break
+		}
+
+		path := []Step{{Kind: StepPositional, Name: "@", Token: t.Identifier, Tokens: t.Tokens}}
+
+		if t.Words != nil {
+			path = a.words(pointers(t.Words))
+		}
+
+		if path != nil {
+			a.taint(t.Identifier, path, Step{Kind: StepAssignment, Name: t.Identifier.Data, Token: t.Identifier, Tokens: t.Tokens})
+		}
+	case *bash.SelectCompound:
+		if t.Identifier != nil {
+			a.taint(t.Identifier, nil, Step{Kind: StepRead, Name: t.Identifier.Data, Token: t.Identifier, Tokens: t.Tokens})
+		}
+	case *bash.Command:
+		a.command(t)
+	}
+
+	return true
+}
+
+func (a *analysis) command(c *bash.Command) {
+	names, _ := astutil.AssignedNames(c)
+	if len(names) == 0 {
+		return
+	}
+
+	words := astutil.Words(c)
+	nameToken := words[0].Parts[0].Part
+	name, _ := astutil.Literal(words[0])
+
+	for _, n := range names {
+		tk := nameToken
+
+		if n.Word != nil {
+			tk = n.Word.Parts[0].Part
+		}
+
+		switch name {
+		case "getopts":
+			a.taint(tk, nil, Step{Kind: StepPositional, Name: n.Name, Token: tk, Tokens: c.Tokens})
+		case "printf":
+			if path := a.words(words[1:]); path != nil {
+				a.taint(tk, path, Step{Kind: StepAssignment, Name: n.Name, Token: tk, Tokens: c.Tokens})
+			}
+		default:
+			a.taint(tk, nil, Step{Kind: StepRead, Name: n.Name, Token: tk, Tokens: c.Tokens})
+		}
+	}
+}
+
+func (a *analysis) words(words []*bash.Word) []Step {
+	for _, w := range words {
+		if path := a.path(w); path != nil {
+			return path
+		}
+	}
+
+	return nil
+}
+
+func pointers(words []bash.Word) []*bash.Word {
+	p := make([]*bash.Word, len(words))
+
+	for n := range words {
+		p[n] = &words[n]
+	}
+
+	return p
+}
+
+func isPositional(name string) bool {
+	return name == "@" || name == "*" || name != "" && name != "0" && strings.Trim(name, "0123456789") == ""
+}
+
+// path returns the path of the first untrusted input found within the given
+// node, or nil if the node contains no untrusted input.
+func (a *analysis) path(t bash.Type) []Step {
+	var path []Step
+
+	astutil.Inspect(t, func(t bash.Type, _ []bash.Type) bool {
+		if path != nil {
+			return false
+		}
+
+		switch t := t.(type) {
+		case *bash.ParameterExpansion:
+			if t.Type == bash.ParameterLength || t.Parameter.Parameter == nil {
+				return false
+			}
+
+			path = a.parameter(t.Parameter.Parameter.Data, t.Parameter.Parameter, t.Tokens)
+		case *bash.WordPart:
+			if t.Part != nil && t.Part.Type == bash.TokenIdentifier {
+				name, _ := astutil.SplitParameter(t.Part.Data)
+				path = a.parameter(name, t.Part, bash.Tokens{*t.Part})
+			}
+		case *bash.CommandSubstitution:
+			if inner := a.path(&t.Command); inner != nil {
+				path = append(slices.Clip(inner), Step{Kind: StepSubstitution, Token: &t.Tokens[0], Tokens: t.Tokens})
+			}
+
+			return false
+		case *bash.ArithmeticExpansion:
+			return false
+		}
+
+		return true
+	})
+
+	return path
+}
+
+func (a *analysis) parameter(name string, tk *bash.Token, tks bash.Tokens) []Step {
+	if isPositional(name) {
+		return []Step{{Kind: StepPositional, Name: name, Token: tk, Tokens: tks}}
+	}
+
+	ref := a.refs[tk]
+	if ref == nil {
+		return nil
+	}
+
+	if len(ref.Definitions) == 0 {
+		if scope.ShellVariables[name] {
+			return nil
+		}
+
+		return []Step{{Kind: StepEnvironment, Name: name, Token: tk, Tokens: tks}}
+	}
+
+	for _, def := range ref.Definitions {
+		if path := a.tainted[def]; path != nil {
+			return append(slices.Clip(path), Step{Kind: StepExpansion, Name: name, Token: tk, Tokens: tks})
+		}
+	}
+
+	return nil
+}
+
+func (a *analysis) sinks(t bash.Type, _ []bash.Type) bool {
+	switch t := t.(type) {
+	case *bash.Command:
+		a.commandSinks(t)
+	case *bash.Redirection:
+		if t.Heredoc == nil {
+			if path := a.path(&t.Output); path != nil {
+				a.flow(SinkRedirection, path, t.Redirector, t.Tokens)
+			}
+		}
+	}
+
+	return true
+}
+
+func (a *analysis) flow(sink string, path []Step, tk *bash.Token, tks bash.Tokens) {
+	a.flows = append(a.flows, Flow{Sink: sink, Path: append(slices.Clip(path), Step{Kind: StepSink, Name: sink, Token: tk, Tokens: tks})})
+}
+
+func (a *analysis) commandSinks(c *bash.Command) {
+	words := astutil.Words(c)
+	if len(words) == 0 {
+		return
+	}
+
+	name, cmdWords, wrapped := astutil.Unwrap(words)
+
+	if slices.Contains(wrapped, "sudo") || slices.Contains(wrapped, "doas") || name == "sudo" || name == "doas" {
+		if path := a.words(words[1:]); path != nil {
+			a.flow(SinkSudo, path, words[0].Parts[0].Part, c.Tokens)
+		}
+	}
+
+	if len(cmdWords) < 2 {
+		return
+	}
+
+	tk := cmdWords[0].Parts[0].Part
+	args := cmdWords[1:]
+
+	switch {
+	case name == "eval":
+		if path := a.words(args); path != nil {
+			a.flow(SinkEval, path, tk, c.Tokens)
+		}
+	case name == "source" || name == ".":
+		if path := a.path(args[0]); path != nil {
+			a.flow(SinkSource, path, tk, c.Tokens)
+		}
+	case shells[name]:
+		if script := shellCommand(args); script != nil {
+			if path := a.path(script); path != nil {
+				a.flow(SinkShell, path, tk, c.Tokens)
+			}
+		}
+	case name == "rm":
+		for _, arg := range args {
+			for _, s := range astutil.Segments(arg) {
+				if s.IsLiteral() || s.Quoted {
+					continue
+				}
+
+				if path := a.path(s.Part); path != nil {
+					a.flow(SinkRm, path, tk, c.Tokens)
+
+					return
+				}
+			}
+		}
+	}
+}
+
+// shellCommand returns the command string argument given to a shell with the
+// -c option.
+func shellCommand(args []*bash.Word) *bash.Word {
+	for n, w := range args {
+		arg, ok := astutil.Literal(w)
+		if !ok || !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			return nil
+		}
+
+		if !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c") {
+			if n+1 < len(args) {
+				return args[n+1]
+			}
+
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package taint
+
+import (
+	"reflect"
+	"testing"
+
+	"vimagination.zapto.org/bash/internal/testutil"
+)
+
+func TestAnalyse(t *testing.T) {
+	for n, test := range [...]struct {
+		Input string
+		Flows []string
+	}{
+		{ // 1
+			"eval \"$1\"",
+			[]string{"1:7 positional 1 -> 1:1 sink eval"},
+		},
+		{ // 2
+			"x=$1\neval \"$x\"",
+			[]string{"1:3 positional 1 -> 1:1 assignment x -> 2:7 expansion x -> 2:1 sink eval"},
+		},
+		{ // 3
+			"read -r line\ny=\"prefix $line\"\nbash -c \"$y\"",
+			[]string{"1:9 read line -> 2:11 expansion line -> 2:1 assignment y -> 3:10 expansion y -> 3:1 sink shell -c"},
+		},
+		{ // 4
+			"source \"$CONFIG_DIR/env.sh\"",
+			[]string{"1:9 environment CONFIG_DIR -> 1:1 sink source"},
+		},
+		{ // 5
+			"rm -rf \"$1\"\nrm -rf $2",
+			[]string{"2:8 positional 2 -> 2:1 sink rm"},
+		},
+		{ // 6
+			"f() {\n\tlocal target=${1:-default}\n\techo hi > \"$target\"\n}",
+			[]string{"2:17 positional 1 -> 2:8 assignment target -> 3:13 expansion target -> 3:10 sink redirection"},
+		},
+		{ // 7
+			"name=$(basename \"$1\")\nsudo useradd \"$name\"",
+			[]string{"1:18 positional 1 -> 1:6 substitution -> 1:1 assignment name -> 2:15 expansion name -> 2:1 sink sudo"},
+		},
+		{ // 8
+			"for f in \"$@\"; do\n\teval \"$f\"\ndone",
+			[]string{"1:11 positional @ -> 1:5 assignment f -> 2:8 expansion f -> 2:2 sink eval"},
+		},
+		{ // 9
+			"x=safe\neval \"$x\"\nsh -c 'echo $1' _ \"$1\"\necho \"$HOME\" > \"$PWD/out\"\neval \"${#1}\"",
+			nil,
+		},
+		{ // 10
+			"g() {\n\teval \"$cmd\"\n}\ncmd=$2\ng",
+			[]string{"4:5 positional 2 -> 4:1 assignment cmd -> 2:8 expansion cmd -> 2:2 sink eval"},
+		},
+		{ // 11
+			"printf -v q '%q' \"$1\"\n. \"$q\"",
+			[]string{"1:19 positional 1 -> 1:11 assignment q -> 2:4 expansion q -> 2:1 sink source"},
+		},
+		{ // 12
+			"while getopts o: opt; do\n\tcat > \"$OPTARG\"\ndone",
+			[]string{"1:7 positional OPTARG -> 2:9 expansion OPTARG -> 2:6 sink redirection"},
+		},
+		{ // 13
+			"env -i sudo -u \"$USER_NAME\" ls",
+			[]string{"1:17 environment USER_NAME -> 1:1 sink sudo"},
+		},
+		{ // 14
+			"for arg; do\n\trm $arg\ndone",
+			[]string{"1:5 positional @ -> 1:5 assignment arg -> 2:5 expansion arg -> 2:2 sink rm"},
+		},
+	} {
+		var flows []string
+
+		for _, f := range Analyse(testutil.Parse(t, test.Input)) {
+			flows = append(flows, f.String())
+		}
+
+		if !reflect.DeepEqual(flows, test.Flows) {
+			t.Errorf("test %d: expecting flows %q, got %q", n+1, test.Flows, flows)
+		}
+	}
+}
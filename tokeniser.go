@@ -27,13 +27,13 @@ const (
 	newline               = "\n"
 	whitespaceNewline     = whitespace + newline
 	heredocsBreak         = whitespace + newline + "|&;()<>\\\"'"
-	heredocStringBreak    = newline + "$"
+	heredocStringBreak    = newline + "$\\"
 	doubleStops           = "\\`$\""
 	singleStops           = "'"
 	ansiStops             = "'\\"
 	word                  = "\\\"'`(){}- \t\n"
 	wordBreak             = "\\\"'`() \t\n$|&;<>{"
-	wordBreakBrace        = "\\\"'`() \t\n$|&;,<>}"
+	wordBreakBrace        = "\\\"'`() \t\n$|&;,<>{}"
 	wordBreakArithmetic   = "\\\"'`(){} \t\n$+-!~*/%<=>&^|?:,;"
 	wordBreakNoBrace      = wordBreak + "#}]"
 	wordBreakSubstring    = wordBreakNoBrace + ":"
@@ -41,7 +41,6 @@ const (
 	wordBreakCommandIndex = "\\\"'`(){} \t\n$+-!~*/%<=>&^|?:,]"
 	testWordBreak         = " `\\\t\n\"'$|&;<>(){}!,"
 	hexDigit              = "0123456789ABCDEFabcdef"
-	octalDigit            = "012345678"
 	decimalDigit          = "0123456789"
 	letters               = "AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
 	identStart            = letters + "_"
@@ -576,7 +575,7 @@ func (b *bashTokeniser) operatorOrWord(t *parser.Tokeniser) (parser.Token, parse
 		} else if td == stateBraceExpansionWord {
 			b.popState()
 
-			return t.Return(TokenBraceExpansion, b.main)
+			return t.Return(TokenBraceExpansion, b.braceExpansionEnd)
 		} else if td == stateParameterExpansionSubString {
 			b.popState()
 			b.popState()
@@ -821,10 +820,12 @@ func (b *bashTokeniser) heredocString(t *parser.Tokeniser) (parser.Token, parser
 		charBreak = heredocStringBreak
 	}
 
+	escaped := false
+
 	for {
 		state := t.State()
 
-		if t.AcceptString(heredoc.delim, false) == len(heredoc.delim) && (t.Peek() == '\n' || t.Peek() == -1) {
+		if !escaped && t.AcceptString(heredoc.delim, false) == len(heredoc.delim) && (t.Peek() == '\n' || t.Peek() == -1) {
 			state.Reset()
 
 			str := t.Get()
@@ -836,6 +837,8 @@ func (b *bashTokeniser) heredocString(t *parser.Tokeniser) (parser.Token, parser
 			return parser.Token{Type: TokenHeredoc, Data: str}, b.heredocEnd
 		}
 
+		escaped = false
+
 		switch t.ExceptRun(charBreak) {
 		case -1:
 			return t.ReturnError(io.ErrUnexpectedEOF)
@@ -844,7 +847,7 @@ func (b *bashTokeniser) heredocString(t *parser.Tokeniser) (parser.Token, parser
 
 			t.Next()
 
-			if t.Accept(decimalDigit) || t.Accept(identStart) || t.Accept("({$!?") {
+			if t.Accept(decimalDigit) || t.Accept(identStart) || t.Accept("({$!?@*#-") {
 				state.Reset()
 				b.pushState(stateHeredocIdentifier)
 
@@ -858,6 +861,11 @@ func (b *bashTokeniser) heredocString(t *parser.Tokeniser) (parser.Token, parser
 			}
 
 			continue
+		case '\\':
+			t.Next()
+			t.Next()
+
+			escaped = true
 		case '\n':
 			t.Next()
 
@@ -909,7 +917,7 @@ func (b *bashTokeniser) identifier(t *parser.Tokeniser) (parser.Token, parser.To
 		state.Reset()
 
 		return b.stringStart(t)
-	} else if t.Accept("$!?@*") {
+	} else if t.Accept("$!?@*#-") {
 		return t.Return(TokenIdentifier, b.main)
 	}
 
@@ -1135,7 +1143,7 @@ func (b *bashTokeniser) zero(t *parser.Tokeniser) (parser.Token, parser.TokenFun
 
 		t.AcceptRun(hexDigit)
 	} else {
-		t.AcceptRun(octalDigit)
+		t.AcceptRun(decimalDigit)
 	}
 
 	return t.Return(TokenNumberLiteral, b.main)
@@ -1161,7 +1169,7 @@ func (b *bashTokeniser) number(t *parser.Tokeniser) (parser.Token, parser.TokenF
 
 func (b *bashTokeniser) keywordIdentOrWord(t *parser.Tokeniser) (parser.Token, parser.TokenFunc) {
 	if !b.isInCommand() {
-		if td := b.lastState(); td != stateTest && td != stateTestBinary {
+		if td := b.lastState(); td != stateTest && td != stateTestBinary && td != stateValue {
 			state := t.State()
 			kw := t.AcceptWord(keywords, false)
 
@@ -1193,7 +1201,7 @@ func (b *bashTokeniser) keywordIdentOrWord(t *parser.Tokeniser) (parser.Token, p
 }
 
 func (b *bashTokeniser) identOrWord(t *parser.Tokeniser) (parser.Token, parser.TokenFunc) {
-	if td := b.lastState(); td != stateTest && td != stateTestBinary {
+	if td := b.lastState(); td != stateTest && td != stateTestBinary && td != stateCaseEnd {
 		if t.Accept(identStart) {
 			t.AcceptRun(identCont)
 
@@ -2040,7 +2048,7 @@ func (b *bashTokeniser) word(t *parser.Tokeniser) (parser.Token, parser.TokenFun
 
 			t.Next()
 
-			if t.Accept(decimalDigit) || t.Accept(identStart) || t.Accept("({") {
+			if t.Accept(decimalDigit) || t.Accept(identStart) || t.Accept("({$!?@*#-") {
 				state.Reset()
 
 				return t.Return(TokenWord, b.main)
@@ -2150,6 +2158,14 @@ func (b *bashTokeniser) braceExpansionDelimiter(t *parser.Tokeniser) (parser.Tok
 	return t.Return(TokenPunctuator, b.braceExpansionSequence)
 }
 
+func (b *bashTokeniser) braceExpansionEnd(t *parser.Tokeniser) (parser.Token, parser.TokenFunc) {
+	if t.Peek() == '}' && b.lastState() != stateBraceExpansionWord {
+		return b.word(t)
+	}
+
+	return b.main(t)
+}
+
 func (b *bashTokeniser) isBraceExpansionWord(t *parser.Tokeniser) bool {
 	b.pushState(stateBraceExpansionWord)
 	defer b.popState()
@@ -4683,6 +4683,124 @@ func TestTokeniser(t *testing.T) {
 				{Type: parser.TokenDone, Data: ""},
 			},
 		},
+		{ // 316
+			"a{b,c{d,e}}f",
+			[]parser.Token{
+				{Type: TokenWord, Data: "a"},
+				{Type: TokenBraceExpansion, Data: "{"},
+				{Type: TokenWord, Data: "b"},
+				{Type: TokenPunctuator, Data: ","},
+				{Type: TokenWord, Data: "c"},
+				{Type: TokenBraceExpansion, Data: "{"},
+				{Type: TokenWord, Data: "d"},
+				{Type: TokenPunctuator, Data: ","},
+				{Type: TokenWord, Data: "e"},
+				{Type: TokenBraceExpansion, Data: "}"},
+				{Type: TokenBraceExpansion, Data: "}"},
+				{Type: TokenWord, Data: "f"},
+				{Type: parser.TokenDone, Data: ""},
+			},
+		},
+		{ // 317
+			"{a,b}}c {1..2}} }",
+			[]parser.Token{
+				{Type: TokenBraceExpansion, Data: "{"},
+				{Type: TokenWord, Data: "a"},
+				{Type: TokenPunctuator, Data: ","},
+				{Type: TokenWord, Data: "b"},
+				{Type: TokenBraceExpansion, Data: "}"},
+				{Type: TokenWord, Data: "}c"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenBraceSequenceExpansion, Data: "{"},
+				{Type: TokenNumberLiteral, Data: "1"},
+				{Type: TokenPunctuator, Data: ".."},
+				{Type: TokenNumberLiteral, Data: "2"},
+				{Type: TokenBraceExpansion, Data: "}"},
+				{Type: TokenWord, Data: "}"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenPunctuator, Data: "}"},
+				{Type: parser.TokenDone, Data: ""},
+			},
+		},
+		{ // 318
+			"case a in b[cd]|e=f) ;; esac",
+			[]parser.Token{
+				{Type: TokenKeyword, Data: "case"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenWord, Data: "a"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenKeyword, Data: "in"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenWord, Data: "b[cd]"},
+				{Type: TokenPunctuator, Data: "|"},
+				{Type: TokenWord, Data: "e=f"},
+				{Type: TokenPunctuator, Data: ")"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenPunctuator, Data: ";;"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenKeyword, Data: "esac"},
+				{Type: parser.TokenDone, Data: ""},
+			},
+		},
+		{ // 319
+			"<<abc\n\\$a \\\\$b \\\nabc\nabc",
+			[]parser.Token{
+				{Type: TokenPunctuator, Data: "<<"},
+				{Type: TokenWord, Data: "abc"},
+				{Type: TokenLineTerminator, Data: "\n"},
+				{Type: TokenHeredoc, Data: "\\$a \\\\"},
+				{Type: TokenIdentifier, Data: "$b"},
+				{Type: TokenHeredoc, Data: " \\\nabc\n"},
+				{Type: TokenHeredocEnd, Data: "abc"},
+				{Type: parser.TokenDone, Data: ""},
+			},
+		},
+		{ // 320
+			"a$? b$#c <<d\ne$-f\nd",
+			[]parser.Token{
+				{Type: TokenWord, Data: "a"},
+				{Type: TokenIdentifier, Data: "$?"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenWord, Data: "b"},
+				{Type: TokenIdentifier, Data: "$#"},
+				{Type: TokenWord, Data: "c"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenPunctuator, Data: "<<"},
+				{Type: TokenWord, Data: "d"},
+				{Type: TokenLineTerminator, Data: "\n"},
+				{Type: TokenHeredoc, Data: "e"},
+				{Type: TokenIdentifier, Data: "$-"},
+				{Type: TokenHeredoc, Data: "f\n"},
+				{Type: TokenHeredocEnd, Data: "d"},
+				{Type: parser.TokenDone, Data: ""},
+			},
+		},
+		{ // 321
+			"a=in b=let",
+			[]parser.Token{
+				{Type: TokenIdentifierAssign, Data: "a"},
+				{Type: TokenAssignment, Data: "="},
+				{Type: TokenWord, Data: "in"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenIdentifierAssign, Data: "b"},
+				{Type: TokenAssignment, Data: "="},
+				{Type: TokenWord, Data: "let"},
+				{Type: parser.TokenDone, Data: ""},
+			},
+		},
+		{ // 322
+			"$(( 09 019 ))",
+			[]parser.Token{
+				{Type: TokenPunctuator, Data: "$(("},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenNumberLiteral, Data: "09"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenNumberLiteral, Data: "019"},
+				{Type: TokenWhitespace, Data: " "},
+				{Type: TokenPunctuator, Data: "))"},
+				{Type: parser.TokenDone, Data: ""},
+			},
+		},
 	} {
 		p := parser.NewStringTokeniser(test.Input)
 